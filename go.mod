@@ -57,6 +57,7 @@ require (
 	github.com/miekg/dns v1.1.42
 	github.com/mitchellh/copystructure v1.2.0
 	github.com/mitchellh/go-homedir v1.1.0
+	github.com/natefinch/lumberjack v2.0.0+incompatible
 	github.com/onsi/gomega v1.13.0
 	github.com/openshift/api v0.0.0-20200713203337-b2494ecb17dd
 	github.com/pkg/errors v0.9.1
@@ -105,6 +106,7 @@ require (
 	k8s.io/utils v0.0.0-20210527160623-6fdb442a123b
 	sigs.k8s.io/controller-runtime v0.9.0-beta.5
 	sigs.k8s.io/gateway-api v0.3.0
+	sigs.k8s.io/kustomize/api v0.8.8
 	sigs.k8s.io/mcs-api v0.1.0
 	sigs.k8s.io/yaml v1.2.0
 )
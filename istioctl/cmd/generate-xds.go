@@ -0,0 +1,143 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/istioctl/pkg/util/handlers"
+	"istio.io/istio/pilot/pkg/xds"
+	"istio.io/istio/pilot/test/offline"
+	"istio.io/istio/pkg/test"
+	"istio.io/istio/pkg/util/protomarshal"
+)
+
+type generateXdsOptions struct {
+	offlineProxyFlags
+	files     []string
+	baseFiles []string
+	output    string
+}
+
+func generateXdsCommand() *cobra.Command {
+	opts := generateXdsOptions{}
+	cmd := &cobra.Command{
+		Use:   "generate-xds",
+		Short: "Generate the xDS configuration for a proxy using configuration from local files",
+		Long: `Generate the xDS configuration Istiod would send to a proxy, without a cluster.
+
+An in memory control plane is started with the Istio and Kubernetes resources in the provided files, and
+the listeners, clusters, routes, endpoints and extension configurations generated for the proxy are written
+as an Envoy config dump. The output can be inspected with 'istioctl proxy-config <type> -f <file>'.
+
+If --base is provided, configuration is generated for both sets of files and a diff of each changed
+resource is written instead.
+
+` + ExperimentalMsg,
+		Example: `  # Generate the configuration for the productpage pod
+  istioctl experimental generate-xds -f samples/bookinfo/ --pod productpage-v1.default > config_dump.json
+  istioctl proxy-config routes -f config_dump.json
+
+  # Show how a change to the configuration in new/ changes the configuration of an ingress gateway
+  istioctl experimental generate-xds --base old/ -f new/ --labels istio=ingressgateway -n istio-system --type router`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("generate-xds takes no arguments")
+			}
+			if len(opts.files) == 0 {
+				return fmt.Errorf("at least one file or directory must be provided with --filename")
+			}
+			if opts.output != jsonOutput && opts.output != yamlOutput {
+				return fmt.Errorf("unknown output format %q, must be one of json or yaml", opts.output)
+			}
+			return opts.validate()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ns := handlers.HandleNamespace(namespace, defaultNamespace)
+			gc, err := generateXds(opts.offlineProxyFlags, opts.files, ns)
+			if err != nil {
+				return err
+			}
+			if len(opts.baseFiles) == 0 {
+				return writeConfigDump(cmd.OutOrStdout(), opts.output, gc)
+			}
+			base, err := generateXds(opts.offlineProxyFlags, opts.baseFiles, ns)
+			if err != nil {
+				return err
+			}
+			changed, err := offline.Diff(cmd.OutOrStdout(), base, gc, 3)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), "No differences found")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVarP(&opts.files, "filename", "f", nil,
+		"Files or directories containing Istio and Kubernetes resources. Directories are read recursively.")
+	cmd.Flags().StringSliceVar(&opts.baseFiles, "base", nil,
+		"Files or directories containing the resources to compare against. If set, a diff is written instead of a config dump.")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", jsonOutput, "Output format: one of json|yaml")
+	opts.attach(cmd)
+	return cmd
+}
+
+func generateXds(opts offlineProxyFlags, files []string, ns string) (*offline.GeneratedConfig, error) {
+	in, err := offline.ReadInputs(files, ns)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := opts.buildProxy(in, ns)
+	if err != nil {
+		return nil, err
+	}
+	m, err := opts.meshConfig()
+	if err != nil {
+		return nil, err
+	}
+	var gc *offline.GeneratedConfig
+	err = offline.Run(in, m, func(t test.Failer, s *xds.FakeDiscoveryServer) {
+		var err error
+		if gc, err = offline.Generate(t, s, s.SetupProxy(proxy)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate configuration: %v", err)
+	}
+	return gc, nil
+}
+
+func writeConfigDump(w io.Writer, format string, gc *offline.GeneratedConfig) error {
+	out, err := protomarshal.ToJSONWithIndent(gc.ConfigDump(), "  ")
+	if err != nil {
+		return err
+	}
+	if format == yamlOutput {
+		by, err := yaml.JSONToYAML([]byte(out))
+		if err != nil {
+			return err
+		}
+		out = string(by)
+	}
+	_, err = fmt.Fprintln(w, out)
+	return err
+}
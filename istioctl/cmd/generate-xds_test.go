@@ -0,0 +1,140 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"istio.io/istio/istioctl/pkg/util/configdump"
+	"istio.io/istio/pilot/test/offline"
+	"istio.io/pkg/version"
+)
+
+var generateXdsProxy = offlineProxyFlags{
+	pod:       "productpage-v1.default",
+	proxyType: "sidecar",
+}
+
+func TestGenerateXds(t *testing.T) {
+	gc, err := generateXds(generateXdsProxy, []string{"testdata/simulate"}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if err := writeConfigDump(out, jsonOutput, gc); err != nil {
+		t.Fatal(err)
+	}
+
+	// The output must be readable by proxy-config -f
+	dump := &configdump.Wrapper{}
+	if err := json.Unmarshal(out.Bytes(), dump); err != nil {
+		t.Fatal(err)
+	}
+	routes, err := dump.GetDynamicRouteDump(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, r := range routes.DynamicRouteConfigs {
+		if strings.Contains(r.RouteConfig.String(), "outbound|9080|v2|reviews.default.svc.cluster.local") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected route to reviews v2 in routes, got %v", routes)
+	}
+	clusters, err := dump.GetDynamicClusterDump(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters.DynamicActiveClusters) == 0 {
+		t.Fatalf("expected clusters")
+	}
+	if len(gc.Endpoints) == 0 {
+		t.Fatalf("expected endpoints")
+	}
+}
+
+func TestOfflineProxyVersion(t *testing.T) {
+	in, err := offline.ReadInputs([]string{"testdata/simulate"}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := generateXdsProxy.buildProxy(in, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Metadata.IstioVersion != version.Info.Version {
+		t.Fatalf("expected the proxy to default to the istioctl version %q, got %q", version.Info.Version, p.Metadata.IstioVersion)
+	}
+
+	flags := generateXdsProxy
+	flags.proxyVersion = "1.10.2"
+	if p, err = flags.buildProxy(in, "default"); err != nil {
+		t.Fatal(err)
+	}
+	if p.Metadata.IstioVersion != "1.10.2" {
+		t.Fatalf("expected the proxy version to be overridden, got %q", p.Metadata.IstioVersion)
+	}
+}
+
+func TestGenerateXdsDiff(t *testing.T) {
+	by, err := os.ReadFile("testdata/simulate/config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	modified := strings.Replace(string(by), "prefix: /v2", "prefix: /v3", 1)
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(modified), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := generateXds(generateXdsProxy, []string{"testdata/simulate"}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gc, err := generateXds(generateXdsProxy, []string{dir}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	changed, err := offline.Diff(out, base, base, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed || out.Len() != 0 {
+		t.Fatalf("expected no diff, got %v", out.String())
+	}
+
+	changed, err = offline.Diff(out, base, gc, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatalf("expected diff")
+	}
+	if !strings.Contains(out.String(), "--- base RouteConfiguration 9080") || !strings.Contains(out.String(), `+            "prefix": "/v3"`) {
+		t.Fatalf("unexpected diff: %v", out.String())
+	}
+	if strings.Contains(out.String(), "Cluster outbound") {
+		t.Fatalf("clusters should not change: %v", out.String())
+	}
+}
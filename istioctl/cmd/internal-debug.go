@@ -108,6 +108,11 @@ By default it will use the default serviceAccount from (istio-system) namespace
   # Retrieve syncz information via XDS from specific control plane in multi-control plane in-cluster configuration
   # (Select a specific control plane in an in-cluster canary Istio configuration.)
   istioctl x internal-debug syncz --xds-label istio.io/rev=default
+
+  # Retrieve the recent certificate issuances of a workload identity from all instances of Istiod
+  # (ca_issuancez is an unsafe admin endpoint, only served when Istiod runs with UNSAFE_ENABLE_ADMIN_ENDPOINTS=true.
+  # It is requested with a token of the service account of Istiod, so creating tokens for it must be allowed.)
+  istioctl x internal-debug "ca_issuancez?identity=spiffe://cluster.local/ns/default/sa/productpage" --all
 `,
 		RunE: func(c *cobra.Command, args []string) error {
 			kubeClient, err := kubeClientWithRevision(kubeconfig, configContext, opts.Revision)
@@ -130,8 +135,14 @@ By default it will use the default serviceAccount from (istio-system) namespace
 				TypeUrl: v3.DebugType,
 			}
 
-			xdsResponses, err := multixds.MultiRequestAndProcessXds(internalDebugAllIstiod, &xdsRequest, centralOpts, istioNamespace,
-				namespace, serviceAccount, kubeClient)
+			var xdsResponses map[string]*xdsapi.DiscoveryResponse
+			if istiodOnlyDebugType(args[0]) {
+				xdsResponses, err = multixds.IstiodRequestAndProcessXds(internalDebugAllIstiod, &xdsRequest, centralOpts,
+					istioNamespace, kubeClient)
+			} else {
+				xdsResponses, err = multixds.MultiRequestAndProcessXds(internalDebugAllIstiod, &xdsRequest, centralOpts, istioNamespace,
+					namespace, serviceAccount, kubeClient)
+			}
 			if err != nil {
 				return err
 			}
@@ -160,3 +171,11 @@ By default it will use the default serviceAccount from (istio-system) namespace
 }
 
 var internalDebugAllIstiod bool
+
+// istiodOnlyDebugType returns true if the debug resource is only served to the identity of Istiod itself.
+func istiodOnlyDebugType(resource string) bool {
+	if i := strings.Index(resource, "?"); i >= 0 {
+		resource = resource[:i]
+	}
+	return resource == "ca_issuancez" || resource == "ca_revoke"
+}
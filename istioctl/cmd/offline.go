@@ -0,0 +1,75 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/test/offline"
+	"istio.io/istio/pkg/config/mesh"
+)
+
+// offlineProxyFlags are the flags shared by commands that generate proxy configuration from local files.
+type offlineProxyFlags struct {
+	meshConfigFile string
+
+	pod          string
+	labels       map[string]string
+	ip           string
+	proxyType    string
+	proxyVersion string
+}
+
+func (o *offlineProxyFlags) attach(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.meshConfigFile, "meshConfigFile", "",
+		"Overrides the mesh config values to use for generating configuration.")
+	cmd.Flags().StringVar(&o.pod, "pod", "",
+		"The pod, in the form <name>[.<namespace>], to generate configuration for. The pod must be defined in the provided files.")
+	cmd.Flags().StringToStringVarP(&o.labels, "labels", "l", nil,
+		"Labels of the proxy. If --pod is set, these are added to the pod labels.")
+	cmd.Flags().StringVar(&o.ip, "ip", "", "IP address of the proxy. Defaults to the pod IP.")
+	cmd.Flags().StringVar(&o.proxyType, "type", string(model.SidecarProxy), "Type of the proxy: one of sidecar|router")
+	cmd.Flags().StringVar(&o.proxyVersion, "proxyVersion", "",
+		"Istio version of the proxy, such as 1.11.0. Defaults to the version of istioctl.")
+}
+
+func (o *offlineProxyFlags) validate() error {
+	if o.pod == "" && len(o.labels) == 0 {
+		return fmt.Errorf("one of --pod or --labels must be provided")
+	}
+	return nil
+}
+
+func (o *offlineProxyFlags) buildProxy(in *offline.Inputs, ns string) (*model.Proxy, error) {
+	return in.BuildProxy(offline.ProxyOptions{
+		Pod:          o.pod,
+		Namespace:    ns,
+		Labels:       o.labels,
+		IP:           o.ip,
+		Type:         model.NodeType(o.proxyType),
+		IstioVersion: o.proxyVersion,
+	})
+}
+
+func (o *offlineProxyFlags) meshConfig() (*meshconfig.MeshConfig, error) {
+	if o.meshConfigFile == "" {
+		return nil, nil
+	}
+	return mesh.ReadMeshConfig(o.meshConfigFile)
+}
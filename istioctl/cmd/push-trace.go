@@ -0,0 +1,179 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	envoy_corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/istioctl/pkg/clioptions"
+	"istio.io/istio/istioctl/pkg/multixds"
+	"istio.io/istio/istioctl/pkg/util/handlers"
+	"istio.io/istio/pilot/pkg/xds"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+)
+
+func pushTraceCommand() *cobra.Command {
+	var opts clioptions.ControlPlaneOptions
+	var centralOpts clioptions.CentralControlPlaneOptions
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "push-trace [<pod-name>[.<namespace>]]",
+		Short: "Explains why recent configuration pushes did or did not reach a proxy",
+		Long: `Retrieves the recent pushes recorded by Istiod.
+
+If a pod is given, each recent push is shown along with the decision Istiod made for the pod's proxy:
+  pushed                 the proxy was sent the updated configuration
+  skipped_sidecar_scope  none of the updated configs are visible to the proxy's Sidecar scope
+  skipped_type           none of the updated configs apply to the type of the proxy, such as a Gateway for a sidecar
+
+Otherwise, the recent pushes to all proxies are shown.
+
+` + ExperimentalMsg,
+		Example: `  # Show why recent pushes did or did not reach the productpage pod
+  istioctl x push-trace productpage-v1-7d8d8c6f8c-5vkpm.default
+
+  # Show the recent pushes to all proxies
+  istioctl x push-trace`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return fmt.Errorf("push-trace takes at most one pod")
+			}
+			if output != "short" && output != jsonOutput {
+				return fmt.Errorf("unknown output format %q, must be one of short or json", output)
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			kubeClient, err := kubeClientWithRevision(kubeconfig, configContext, opts.Revision)
+			if err != nil {
+				return err
+			}
+			resource := "push_trace"
+			if len(args) == 1 {
+				podName, ns := handlers.InferPodInfo(args[0], handlers.HandleNamespace(namespace, defaultNamespace))
+				resource += "?proxyID=" + podName + "." + ns
+			}
+			xdsRequest := xdsapi.DiscoveryRequest{
+				ResourceNames: []string{resource},
+				Node: &envoy_corev3.Node{
+					Id: "debug~0.0.0.0~istioctl~cluster.local",
+				},
+				TypeUrl: v3.DebugType,
+			}
+			// The proxy is only connected to one Istiod, so always ask all of them.
+			xdsResponses, err := multixds.MultiRequestAndProcessXds(true, &xdsRequest, centralOpts, istioNamespace,
+				"", "", kubeClient)
+			if err != nil {
+				return err
+			}
+			traces, err := parsePushTraces(xdsResponses, len(args) == 1)
+			if err != nil {
+				return err
+			}
+			return printPushTraces(c.OutOrStdout(), output, traces)
+		},
+	}
+
+	opts.AttachControlPlaneFlags(cmd)
+	centralOpts.AttachControlPlaneFlags(cmd)
+	cmd.Flags().StringVarP(&output, "output", "o", "short", "Output format: one of short|json")
+	return cmd
+}
+
+// parsePushTraces extracts the push traces from the responses of each Istiod, keyed by Istiod. For a proxy, only the
+// Istiod the proxy is connected to responds with a trace.
+func parsePushTraces(responses map[string]*xdsapi.DiscoveryResponse, forProxy bool) (map[string]xds.PushTraceResponse, error) {
+	traces := map[string]xds.PushTraceResponse{}
+	var errs []string
+	for istiod, response := range responses {
+		for _, resource := range response.Resources {
+			trace := xds.PushTraceResponse{}
+			if err := json.Unmarshal(resource.Value, &trace); err != nil || trace.Entries == nil {
+				errs = append(errs, strings.TrimSpace(string(resource.Value)))
+				continue
+			}
+			traces[istiod] = trace
+		}
+	}
+	if len(traces) == 0 {
+		if forProxy {
+			return nil, fmt.Errorf("proxy not found on any Istiod: %v", strings.Join(errs, "; "))
+		}
+		return nil, fmt.Errorf("failed to retrieve push traces: %v", strings.Join(errs, "; "))
+	}
+	return traces, nil
+}
+
+func printPushTraces(w io.Writer, format string, traces map[string]xds.PushTraceResponse) error {
+	if format == jsonOutput {
+		out, err := json.MarshalIndent(traces, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	}
+	istiods := make([]string, 0, len(traces))
+	for istiod := range traces {
+		istiods = append(istiods, istiod)
+	}
+	sort.Strings(istiods)
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ISTIOD\tTIME\tVERSION\tFULL\tREASON\tDECISION\tCONFIGS")
+	for _, istiod := range istiods {
+		for _, e := range traces[istiod].Entries {
+			decision := string(e.Decision)
+			if decision == "" {
+				decision = fmt.Sprintf("sent to %d proxies", e.Proxies)
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\t%s\t%s\n",
+				istiod, e.Time.Format(time.RFC3339), e.PushVersion, e.Full, describeReasons(e), decision, describeConfigs(e))
+		}
+	}
+	return tw.Flush()
+}
+
+func describeReasons(e xds.PushTraceEntry) string {
+	reasons := make([]string, 0, len(e.Reasons))
+	for _, r := range e.Reasons {
+		reasons = append(reasons, string(r))
+	}
+	return strings.Join(reasons, ",")
+}
+
+func describeConfigs(e xds.PushTraceEntry) string {
+	if e.ConfigsUpdatedCount == 0 {
+		if e.Full {
+			return "all"
+		}
+		return ""
+	}
+	configs := strings.Join(e.ConfigsUpdated, ",")
+	if more := e.ConfigsUpdatedCount - len(e.ConfigsUpdated); more > 0 {
+		configs += fmt.Sprintf(" and %d more", more)
+	}
+	return configs
+}
@@ -0,0 +1,87 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes/any"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/xds"
+)
+
+func debugResponse(t *testing.T, body interface{}) *xdsapi.DiscoveryResponse {
+	t.Helper()
+	var value []byte
+	if s, ok := body.(string); ok {
+		value = []byte(s)
+	} else {
+		var err error
+		if value, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &xdsapi.DiscoveryResponse{Resources: []*any.Any{{Value: value}}}
+}
+
+func TestPushTrace(t *testing.T) {
+	trace := xds.PushTraceResponse{
+		ProxyID: "productpage.default-1",
+		Entries: []xds.PushTraceEntry{
+			{
+				Time:                time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				PushVersion:         "v1",
+				Full:                true,
+				Reasons:             []model.TriggerReason{model.ConfigUpdate},
+				ConfigsUpdated:      []string{"Gateway/default/gw"},
+				ConfigsUpdatedCount: 3,
+				Decision:            xds.PushDecisionSkippedType,
+			},
+		},
+	}
+	responses := map[string]*xdsapi.DiscoveryResponse{
+		"istiod-1": debugResponse(t, trace),
+		"istiod-2": debugResponse(t, `{"statusCode":"404"}Proxy not connected to this Pilot instance.`),
+	}
+
+	traces, err := parsePushTraces(responses, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 1 || traces["istiod-1"].ProxyID != trace.ProxyID {
+		t.Fatalf("unexpected traces: %v", traces)
+	}
+	out := &bytes.Buffer{}
+	if err := printPushTraces(out, "short", traces); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"ISTIOD", "istiod-1", "skipped_type", "Gateway/default/gw and 2 more", "config"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%v", want, out.String())
+		}
+	}
+
+	if _, err := parsePushTraces(map[string]*xdsapi.DiscoveryResponse{
+		"istiod-2": debugResponse(t, "Proxy not connected to this Pilot instance."),
+	}, true); err == nil {
+		t.Fatalf("expected error when no Istiod knows the proxy")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	envoy_corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/istioctl/pkg/clioptions"
+	"istio.io/istio/istioctl/pkg/multixds"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+)
+
+func revokeCertCommand() *cobra.Command {
+	var opts clioptions.ControlPlaneOptions
+	var centralOpts clioptions.CentralControlPlaneOptions
+
+	cmd := &cobra.Command{
+		Use:   "revoke-cert <cert-file>",
+		Short: "Revokes a certificate issued by the Istiod CA",
+		Long: `Revokes a PEM encoded certificate issued by the Istiod CA, which then lists it in its CRL until it expires.
+
+Revocation is an unsafe admin endpoint of Istiod, only available when Istiod runs with UNSAFE_ENABLE_ADMIN_ENDPOINTS=true.
+The request is authenticated with a token of the service account of Istiod, so creating tokens for that service
+account must be allowed.
+
+` + ExperimentalMsg,
+		Example: `  # Revoke a workload certificate
+  istioctl x revoke-cert cert.pem`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			certPEM, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			kubeClient, err := kubeClientWithRevision(kubeconfig, configContext, opts.Revision)
+			if err != nil {
+				return err
+			}
+			xdsRequest := xdsapi.DiscoveryRequest{
+				ResourceNames: []string{revokeCertResource(certPEM)},
+				Node: &envoy_corev3.Node{
+					Id: "debug~0.0.0.0~istioctl~cluster.local",
+				},
+				TypeUrl: v3.DebugType,
+			}
+			// Revocations are shared by all Istiods, so asking one of them is enough.
+			xdsResponses, err := multixds.IstiodRequestAndProcessXds(false, &xdsRequest, centralOpts, istioNamespace, kubeClient)
+			if err != nil {
+				return err
+			}
+			return printRevocation(c.OutOrStdout(), xdsResponses)
+		},
+	}
+
+	opts.AttachControlPlaneFlags(cmd)
+	centralOpts.AttachControlPlaneFlags(cmd)
+	return cmd
+}
+
+// revokeCertResource returns the debug resource that revokes the PEM encoded certificate.
+func revokeCertResource(certPEM []byte) string {
+	return "ca_revoke?" + url.Values{"cert": {string(certPEM)}}.Encode()
+}
+
+func printRevocation(w io.Writer, responses map[string]*xdsapi.DiscoveryResponse) error {
+	revoked := false
+	for _, response := range responses {
+		for _, resource := range response.Resources {
+			msg := strings.TrimSpace(string(resource.Value))
+			if !strings.HasPrefix(msg, "revoked certificate") {
+				if strings.Contains(msg, "404 page not found") {
+					msg = "certificate revocation is not enabled, UNSAFE_ENABLE_ADMIN_ENDPOINTS must be set on Istiod"
+				}
+				return fmt.Errorf("failed to revoke certificate: %s", msg)
+			}
+			_, _ = fmt.Fprintln(w, msg)
+			revoked = true
+		}
+	}
+	if !revoked {
+		return fmt.Errorf("failed to revoke certificate: no response from Istiod")
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+)
+
+func TestRevokeCertResource(t *testing.T) {
+	cert := "-----BEGIN CERTIFICATE-----\nMIIB+/=\n-----END CERTIFICATE-----\n"
+	u, err := url.Parse("/debug/" + revokeCertResource([]byte(cert)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/debug/ca_revoke" || u.Query().Get("cert") != cert {
+		t.Fatalf("unexpected revocation request %v", u)
+	}
+}
+
+func TestPrintRevocation(t *testing.T) {
+	cases := []struct {
+		name      string
+		responses map[string]*xdsapi.DiscoveryResponse
+		want      string
+		wantErr   string
+	}{
+		{
+			name:      "revoked",
+			responses: map[string]*xdsapi.DiscoveryResponse{"istiod-1": debugResponse(t, "revoked certificate\n")},
+			want:      "revoked certificate\n",
+		},
+		{
+			name: "not issued by the CA",
+			responses: map[string]*xdsapi.DiscoveryResponse{
+				"istiod-1": debugResponse(t, `{"statusCode":"400"}failed to revoke certificate: certificate 1 was not issued by this CA`),
+			},
+			wantErr: "was not issued by this CA",
+		},
+		{
+			name:      "not enabled",
+			responses: map[string]*xdsapi.DiscoveryResponse{"istiod-1": debugResponse(t, "404 page not found\n")},
+			wantErr:   "UNSAFE_ENABLE_ADMIN_ENDPOINTS",
+		},
+		{
+			name:    "no response",
+			wantErr: "no response from Istiod",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := printRevocation(&out, c.responses)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != c.want {
+				t.Fatalf("got %q, want %q", out.String(), c.want)
+			}
+		})
+	}
+}
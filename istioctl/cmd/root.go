@@ -228,6 +228,10 @@ debug and diagnose their Istio mesh.
 	experimentalCmd.AddCommand(revisionCommand())
 	experimentalCmd.AddCommand(debugCommand())
 	experimentalCmd.AddCommand(preCheck())
+	experimentalCmd.AddCommand(simulateCommand())
+	experimentalCmd.AddCommand(generateXdsCommand())
+	experimentalCmd.AddCommand(pushTraceCommand())
+	experimentalCmd.AddCommand(revokeCertCommand())
 
 	analyzeCmd := Analyze()
 	hideInheritedFlags(analyzeCmd, "istioNamespace")
@@ -0,0 +1,273 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/istioctl/pkg/util/handlers"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/simulation"
+	"istio.io/istio/pilot/pkg/xds"
+	"istio.io/istio/pilot/test/offline"
+	"istio.io/istio/pkg/test"
+)
+
+type simulateOptions struct {
+	offlineProxyFlags
+	files  []string
+	output string
+
+	hosts    []string
+	ports    []int
+	path     string
+	address  string
+	protocol string
+	tls      string
+	alpn     string
+	sni      string
+	mode     string
+}
+
+// simulateResult is the outcome of a single simulated call
+type simulateResult struct {
+	Call        simulation.Call `json:"call"`
+	Listener    string          `json:"listener,omitempty"`
+	FilterChain string          `json:"filterChain,omitempty"`
+	RouteConfig string          `json:"routeConfig,omitempty"`
+	VirtualHost string          `json:"virtualHost,omitempty"`
+	Route       string          `json:"route,omitempty"`
+	Cluster     string          `json:"cluster,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+func simulateCommand() *cobra.Command {
+	opts := simulateOptions{}
+	cmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Simulate traffic through a proxy using configuration from local files",
+		Long: `Simulate traffic through a proxy without a cluster.
+
+The configuration generated for the proxy is computed from the Istio and Kubernetes resources in the
+provided files, and each call is matched against the generated listeners, filter chains, virtual hosts
+and routes. The command exits with an error if any call fails to match.
+
+` + ExperimentalMsg,
+		Example: `  # Simulate an HTTP call from the productpage pod to the reviews service
+  istioctl experimental simulate -f samples/bookinfo/ --pod productpage-v1.default --host reviews --port 9080
+
+  # Simulate calls to several hosts from a proxy with the given labels
+  istioctl experimental simulate -f config/ --labels app=sleep -n test --host a.example.com --host b.example.com --port 80
+
+  # Simulate a TLS call through an ingress gateway
+  istioctl experimental simulate -f config/ --labels istio=ingressgateway -n istio-system --type router \
+    --host example.com --port 443 --tls tls --protocol http`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("simulate takes no arguments")
+			}
+			if len(opts.files) == 0 {
+				return fmt.Errorf("at least one file or directory must be provided with --filename")
+			}
+			if err := opts.validate(); err != nil {
+				return err
+			}
+			if len(opts.ports) == 0 {
+				return fmt.Errorf("at least one --port must be provided")
+			}
+			if opts.output != "short" && opts.output != "json" {
+				return fmt.Errorf("unknown output format %q, must be one of short or json", opts.output)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			results, err := runSimulation(opts, handlers.HandleNamespace(namespace, defaultNamespace))
+			if err != nil {
+				return err
+			}
+			if err := printSimulateResults(cmd.OutOrStdout(), opts.output, results); err != nil {
+				return err
+			}
+			failed := 0
+			for _, r := range results {
+				if r.Error != "" {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d calls failed", failed, len(results))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVarP(&opts.files, "filename", "f", nil,
+		"Files or directories containing Istio and Kubernetes resources. Directories are read recursively.")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "short", "Output format: one of short|json")
+	opts.attach(cmd)
+	cmd.Flags().StringSliceVar(&opts.hosts, "host", nil,
+		"Host header, and SNI for TLS calls, of the call. May be repeated; a call is made for each host and port.")
+	cmd.Flags().IntSliceVar(&opts.ports, "port", nil, "Destination port of the call. May be repeated.")
+	cmd.Flags().StringVar(&opts.path, "path", "/", "Path of the call")
+	cmd.Flags().StringVar(&opts.address, "address", "", "Destination IP address of the call")
+	cmd.Flags().StringVar(&opts.protocol, "protocol", string(simulation.HTTP), "Protocol of the call: one of http|http2|tcp")
+	cmd.Flags().StringVar(&opts.tls, "tls", string(simulation.Plaintext), "TLS mode of the call: one of plaintext|tls|mtls")
+	cmd.Flags().StringVar(&opts.alpn, "alpn", "", "ALPN of the call. Defaults based on the protocol and TLS mode.")
+	cmd.Flags().StringVar(&opts.sni, "sni", "", "SNI of the call. Defaults to the host for TLS calls.")
+	cmd.Flags().StringVar(&opts.mode, "mode", "",
+		"How the call reaches the proxy: one of outbound|inbound|gateway. Defaults to gateway for routers, outbound otherwise.")
+	return cmd
+}
+
+func (o simulateOptions) calls() ([]simulation.Call, error) {
+	protocol := simulation.Protocol(o.protocol)
+	switch protocol {
+	case simulation.HTTP, simulation.HTTP2, simulation.TCP:
+	default:
+		return nil, fmt.Errorf("unknown protocol %q", o.protocol)
+	}
+	tlsMode := simulation.TLSMode(o.tls)
+	switch tlsMode {
+	case simulation.Plaintext, simulation.TLS, simulation.MTLS:
+	default:
+		return nil, fmt.Errorf("unknown tls mode %q", o.tls)
+	}
+	mode := simulation.CallMode(o.mode)
+	if mode == "" {
+		mode = simulation.CallModeOutbound
+		if model.NodeType(o.proxyType) == model.Router {
+			mode = simulation.CallModeGateway
+		}
+	}
+	switch mode {
+	case simulation.CallModeOutbound, simulation.CallModeInbound, simulation.CallModeGateway:
+	default:
+		return nil, fmt.Errorf("unknown call mode %q", o.mode)
+	}
+	hosts := o.hosts
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+	var calls []simulation.Call
+	for _, h := range hosts {
+		for _, p := range o.ports {
+			calls = append(calls, simulation.Call{
+				Address:    o.address,
+				Port:       p,
+				Path:       o.path,
+				Protocol:   protocol,
+				TLS:        tlsMode,
+				Alpn:       o.alpn,
+				HostHeader: h,
+				Sni:        o.sni,
+				CallMode:   mode,
+			})
+		}
+	}
+	return calls, nil
+}
+
+func runSimulation(opts simulateOptions, ns string) ([]simulateResult, error) {
+	calls, err := opts.calls()
+	if err != nil {
+		return nil, err
+	}
+	in, err := offline.ReadInputs(opts.files, ns)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := opts.buildProxy(in, ns)
+	if err != nil {
+		return nil, err
+	}
+	m, err := opts.meshConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []simulateResult
+	err = offline.Run(in, m, func(t test.Failer, s *xds.FakeDiscoveryServer) {
+		sim := simulation.NewSimulationFromConfigGen(t, s.ConfigGenTest, s.SetupProxy(proxy))
+		for _, c := range calls {
+			r := sim.Run(c)
+			res := simulateResult{
+				Call:        c,
+				Listener:    r.ListenerMatched,
+				FilterChain: r.FilterChainMatched,
+				RouteConfig: r.RouteConfigMatched,
+				VirtualHost: r.VirtualHostMatched,
+				Route:       r.RouteMatched,
+				Cluster:     r.ClusterMatched,
+			}
+			if r.Error != nil {
+				res.Error = r.Error.Error()
+			}
+			results = append(results, res)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to simulate: %v", err)
+	}
+	return results, nil
+}
+
+func printSimulateResults(w io.Writer, format string, results []simulateResult) error {
+	switch format {
+	case "json":
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	case "short":
+		tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "CALL\tLISTENER\tFILTER CHAIN\tROUTE\tCLUSTER\tERROR")
+		for _, r := range results {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				describeCall(r.Call), r.Listener, r.FilterChain, describeRoute(r), r.Cluster, r.Error)
+		}
+		return tw.Flush()
+	}
+	return errors.New("unknown output format " + format)
+}
+
+func describeCall(c simulation.Call) string {
+	host := c.HostHeader
+	if host == "" {
+		host = "*"
+	}
+	call := fmt.Sprintf("%s://%s:%d%s", c.Protocol, host, c.Port, c.Path)
+	if c.TLS != "" && c.TLS != simulation.Plaintext {
+		call += " (" + string(c.TLS) + ")"
+	}
+	return call
+}
+
+func describeRoute(r simulateResult) string {
+	parts := []string{}
+	for _, p := range []string{r.RouteConfig, r.VirtualHost, r.Route} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,126 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"istio.io/istio/pilot/pkg/simulation"
+)
+
+func TestSimulate(t *testing.T) {
+	base := simulateOptions{
+		offlineProxyFlags: offlineProxyFlags{
+			pod:       "productpage-v1.default",
+			proxyType: "sidecar",
+		},
+		files:    []string{"testdata/simulate"},
+		path:     "/",
+		protocol: string(simulation.HTTP),
+		tls:      string(simulation.Plaintext),
+	}
+	cases := []struct {
+		name   string
+		modify func(o *simulateOptions)
+		want   []simulateResult
+	}{
+		{
+			name: "default route",
+			modify: func(o *simulateOptions) {
+				o.hosts = []string{"reviews"}
+				o.ports = []int{9080}
+			},
+			want: []simulateResult{{
+				Listener: "0.0.0.0_9080",
+				Cluster:  "outbound|9080|v1|reviews.default.svc.cluster.local",
+			}},
+		},
+		{
+			name: "prefix route",
+			modify: func(o *simulateOptions) {
+				o.hosts = []string{"reviews"}
+				o.ports = []int{9080}
+				o.path = "/v2/ratings"
+			},
+			want: []simulateResult{{
+				Listener: "0.0.0.0_9080",
+				Cluster:  "outbound|9080|v2|reviews.default.svc.cluster.local",
+			}},
+		},
+		{
+			name: "unknown host",
+			modify: func(o *simulateOptions) {
+				o.hosts = []string{"reviews", "unknown"}
+				o.ports = []int{9080}
+			},
+			want: []simulateResult{
+				{
+					Listener: "0.0.0.0_9080",
+					Cluster:  "outbound|9080|v1|reviews.default.svc.cluster.local",
+				},
+				{
+					Listener: "0.0.0.0_9080",
+					Cluster:  "PassthroughCluster",
+				},
+			},
+		},
+		{
+			name: "no route",
+			modify: func(o *simulateOptions) {
+				o.hosts = []string{"details"}
+				o.ports = []int{9080}
+				o.path = "/other"
+			},
+			want: []simulateResult{{
+				Listener: "0.0.0.0_9080",
+				Error:    simulation.ErrNoRoute.Error(),
+			}},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			o := base
+			tt.modify(&o)
+			got, err := runSimulation(o, "default")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d results, got %d: %+v", len(tt.want), len(got), got)
+			}
+			for i, w := range tt.want {
+				if got[i].Listener != w.Listener || got[i].Cluster != w.Cluster || got[i].Error != w.Error {
+					t.Errorf("call %d: want %+v, got %+v", i, w, got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSimulateMissingPod(t *testing.T) {
+	_, err := runSimulation(simulateOptions{
+		offlineProxyFlags: offlineProxyFlags{
+			pod:       "missing.default",
+			proxyType: "sidecar",
+		},
+		files:    []string{"testdata/simulate"},
+		ports:    []int{80},
+		protocol: string(simulation.HTTP),
+		tls:      string(simulation.Plaintext),
+	}, "default")
+	if err == nil {
+		t.Fatal("expected error for missing pod")
+	}
+}
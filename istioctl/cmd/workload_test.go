@@ -155,7 +155,7 @@ const goldenSuffix = ".golden"
 
 // TestWorkloadEntryConfigure enumerates test cases based on subdirectories of testdata/vmconfig.
 // Each subdirectory contains two input files: workloadgroup.yaml and meshconfig.yaml that are used
-// to generate golden outputs from the VM command.
+// to generate golden outputs from the VM command. The outputs are written to a temporary directory.
 func TestWorkloadEntryConfigure(t *testing.T) {
 	files, err := ioutil.ReadDir("testdata/vmconfig")
 	if err != nil {
@@ -194,44 +194,38 @@ func TestWorkloadEntryConfigure(t *testing.T) {
 				}, nil
 			}
 
+			outputDir := t.TempDir()
 			cmd := []string{
 				"x", "workload", "entry", "configure",
 				"-f", path.Join("testdata/vmconfig", dir.Name(), "workloadgroup.yaml"),
 				"--workloadIP", "10.10.10.10",
-				"-o", testdir,
+				"-o", outputDir,
 			}
 			if _, err := runTestCmd(t, cmd); err != nil {
 				t.Fatal(err)
 			}
 
+			// outputs to check, if other files seep in unexpectedly we fail the test
 			checkFiles := map[string]bool{
-				// outputs to check
 				"mesh.yaml": true, "istio-token": true, "hosts": true, "root-cert.pem": true, "cluster.env": true, "sidecar.env": true,
-				// inputs that we allow to exist, if other files seep in unexpectedly we fail the test
-				".gitignore": false, "meshconfig.yaml": false, "workloadgroup.yaml": false,
 			}
 
-			outputFiles, err := ioutil.ReadDir(testdir)
+			outputFiles, err := ioutil.ReadDir(outputDir)
 			if err != nil {
 				t.Fatal(err)
 			}
 
 			for _, f := range outputFiles {
-				checkGolden, ok := checkFiles[f.Name()]
-				if !ok {
-					if checkGolden, ok := checkFiles[f.Name()[:len(f.Name())-len(goldenSuffix)]]; !(checkGolden && ok) {
-						t.Errorf("unexpected file in output dir: %s", f.Name())
-					}
+				if !checkFiles[f.Name()] {
+					t.Errorf("unexpected file in output dir: %s", f.Name())
 					continue
 				}
-				if checkGolden {
-					t.Run(f.Name(), func(t *testing.T) {
-						contents := util.ReadFile(path.Join(testdir, f.Name()), t)
-						goldenFile := path.Join(testdir, f.Name()+goldenSuffix)
-						util.RefreshGoldenFile(contents, goldenFile, t)
-						util.CompareContent(contents, goldenFile, t)
-					})
-				}
+				t.Run(f.Name(), func(t *testing.T) {
+					contents := util.ReadFile(path.Join(outputDir, f.Name()), t)
+					goldenFile := path.Join(testdir, f.Name()+goldenSuffix)
+					util.RefreshGoldenFile(contents, goldenFile, t)
+					util.CompareContent(contents, goldenFile, t)
+				})
 			}
 		})
 	}
@@ -63,7 +63,7 @@ func RequestAndProcessXds(dr *xdsapi.DiscoveryRequest, centralOpts clioptions.Ce
 }
 
 // nolint: lll
-func queryEachShard(all bool, dr *xdsapi.DiscoveryRequest, istioNamespace string, kubeClient kube.ExtendedClient, centralOpts clioptions.CentralControlPlaneOptions) ([]*xdsapi.DiscoveryResponse, error) {
+func queryEachShard(all bool, dr *xdsapi.DiscoveryRequest, istioNamespace, serviceAccount string, kubeClient kube.ExtendedClient, centralOpts clioptions.CentralControlPlaneOptions) ([]*xdsapi.DiscoveryResponse, error) {
 	labelSelector := centralOpts.XdsPodLabel
 	if labelSelector == "" {
 		labelSelector = "app=istiod"
@@ -85,7 +85,7 @@ func queryEachShard(all bool, dr *xdsapi.DiscoveryRequest, istioNamespace string
 		CertDir: centralOpts.CertDir,
 		Timeout: centralOpts.Timeout,
 	}
-	dialOpts, err := xds.DialOptions(xdsOpts, istioNamespace, tokenServiceAccount, kubeClient)
+	dialOpts, err := xds.DialOptions(xdsOpts, istioNamespace, serviceAccount, kubeClient)
 	if err != nil {
 		return nil, err
 	}
@@ -100,7 +100,7 @@ func queryEachShard(all bool, dr *xdsapi.DiscoveryRequest, istioNamespace string
 		}
 		defer fw.Close()
 		xdsOpts.Xds = fw.Address()
-		response, err := xds.GetXdsResponse(dr, istioNamespace, tokenServiceAccount, xdsOpts, dialOpts)
+		response, err := xds.GetXdsResponse(dr, istioNamespace, serviceAccount, xdsOpts, dialOpts)
 		if err != nil {
 			return nil, fmt.Errorf("could not get XDS from discovery pod %q: %v", pod.Name, err)
 		}
@@ -129,10 +129,15 @@ func mergeShards(responses map[string]*xdsapi.DiscoveryResponse) (*xdsapi.Discov
 }
 
 func makeSan(istioNamespace, revision string) string {
+	return fmt.Sprintf("%s.%s.svc", istiodName(revision), istioNamespace)
+}
+
+// istiodName is the name of the service and service account of Istiod.
+func istiodName(revision string) string {
 	if revision == "" {
-		return fmt.Sprintf("istiod.%s.svc", istioNamespace)
+		return "istiod"
 	}
-	return fmt.Sprintf("istiod-%s.%s.svc", revision, istioNamespace)
+	return "istiod-" + revision
 }
 
 // AllRequestAndProcessXds returns all XDS responses from 1 central or 1..N K8s cluster-based XDS servers
@@ -150,6 +155,33 @@ func FirstRequestAndProcessXds(dr *xdsapi.DiscoveryRequest, centralOpts clioptio
 	return MultiRequestAndProcessXds(false, dr, centralOpts, istioNamespace, ns, serviceAccount, kubeClient)
 }
 
+// IstiodRequestAndProcessXds returns the XDS responses from 1 central or 1..N K8s cluster-based XDS servers,
+// authenticated with a token of the service account of Istiod itself, as required by the unsafe admin debug
+// endpoints. Only the first K8s cluster-based XDS server is asked, unless all is set.
+// nolint: lll
+func IstiodRequestAndProcessXds(all bool, dr *xdsapi.DiscoveryRequest, centralOpts clioptions.CentralControlPlaneOptions, istioNamespace string,
+	kubeClient kube.ExtendedClient) (map[string]*xdsapi.DiscoveryResponse, error) {
+	serviceAccount := istiodName(kubeClient.Revision())
+	if centralOpts.Xds != "" {
+		dialOpts, err := xds.DialOptions(centralOpts, istioNamespace, serviceAccount, kubeClient)
+		if err != nil {
+			return nil, err
+		}
+		response, err := xds.GetXdsResponse(dr, istioNamespace, serviceAccount, centralOpts, dialOpts)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]*xdsapi.DiscoveryResponse{
+			CpInfo(response).ID: response,
+		}, nil
+	}
+	responses, err := queryEachShard(all, dr, istioNamespace, serviceAccount, kubeClient, centralOpts)
+	if err != nil {
+		return nil, err
+	}
+	return mapShards(responses)
+}
+
 func getXdsAddressFromWebhooks(client kube.ExtendedClient) (string, error) {
 	webhooks, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().List(context.Background(), metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("%s=%s,!istio.io/tag", label.IoIstioRev.Name, client.Revision()),
@@ -193,7 +225,7 @@ func MultiRequestAndProcessXds(all bool, dr *xdsapi.DiscoveryRequest, centralOpt
 	}
 
 	// Self-administered case.  Find all Istiods in revision using K8s, port-forward and call each in turn
-	responses, err := queryEachShard(all, dr, istioNamespace, kubeClient, centralOpts)
+	responses, err := queryEachShard(all, dr, istioNamespace, tokenServiceAccount, kubeClient, centralOpts)
 	if err != nil {
 		if _, ok := err.(ControlPlaneNotFoundError); ok {
 			// Attempt to get the XDS address from the webhook and try again
@@ -38,6 +38,7 @@ func NewAgentOptions(proxy *model.Proxy, cfg *meshconfig.ProxyConfig) *istioagen
 		ProxyType:                proxy.Type,
 		EnableDynamicProxyConfig: enableProxyConfigXdsEnv,
 		EnableDynamicBootstrap:   enableBootstrapXdsEnv,
+		EnableCRL:                enableCRLXdsEnv,
 		ProxyIPAddresses:         proxy.IPAddresses,
 		ServiceNode:              proxy.ServiceNode(),
 		EnvoyStatusPort:          envoyStatusPortEnv,
@@ -53,11 +54,21 @@ func NewAgentOptions(proxy *model.Proxy, cfg *meshconfig.ProxyConfig) *istioagen
 		o.DNSCapture = DNSCaptureByAgent.Get()
 		o.ProxyNamespace = PodNamespaceVar.Get()
 		o.ProxyDomain = proxy.DNSDomain
+		o.DNSForwardingRules = dnsForwardingRules(cfg)
 	}
 
 	return o
 }
 
+// dnsForwardingRules returns the DNS forwarding rules of the ProxyConfig metadata, which includes the mesh wide
+// defaults read at startup and takes precedence over the environment set at injection time.
+func dnsForwardingRules(cfg *meshconfig.ProxyConfig) string {
+	if rules, f := cfg.GetProxyMetadata()[dnsForwardingRulesEnv.Name]; f {
+		return rules
+	}
+	return dnsForwardingRulesEnv.Get()
+}
+
 // Simplified extraction of gRPC headers from environment.
 // Unlike ISTIO_META, where we need JSON and advanced features - this is just for small string headers.
 func extractXDSHeadersFromEnv(o *istioagent.AgentOptions) {
@@ -46,6 +46,25 @@ var (
 	provCert = env.RegisterStringVar("PROV_CERT", "",
 		"Set to a directory containing provisioned certs, for VMs").Get()
 
+	validateFileMountedCertsEnv = env.RegisterBoolVar("VALIDATE_FILE_MOUNTED_CERTS", false,
+		"If true, certificates read from files are only served if the key matches and the chain is trusted "+
+			"by the workload roots. When the files are invalid, for example while they are being written, "+
+			"the last valid certificate is served.").Get()
+
+	tokenExchangeIssuerURLEnv = env.RegisterStringVar("TOKEN_EXCHANGE_ISSUER_URL", "",
+		"The URL of the OAuth 2.0 authorization server used by the TokenExchange token manager plugin. "+
+			"The token endpoint is discovered from the authorization server metadata.").Get()
+	tokenExchangeTokenEndpointEnv = env.RegisterStringVar("TOKEN_EXCHANGE_TOKEN_ENDPOINT", "",
+		"The token endpoint used by the TokenExchange token manager plugin, instead of the discovered one.").Get()
+	tokenExchangeAudienceEnv = env.RegisterStringVar("TOKEN_EXCHANGE_AUDIENCE", "",
+		"The audience of the tokens requested by the TokenExchange token manager plugin.").Get()
+	tokenExchangeScopeEnv = env.RegisterStringVar("TOKEN_EXCHANGE_SCOPE", "",
+		"The scope of the tokens requested by the TokenExchange token manager plugin.").Get()
+	tokenExchangeClientIDEnv = env.RegisterStringVar("TOKEN_EXCHANGE_CLIENT_ID", "",
+		"The client ID the TokenExchange token manager plugin authenticates with.").Get()
+	tokenExchangeClientSecretFileEnv = env.RegisterStringVar("TOKEN_EXCHANGE_CLIENT_SECRET_FILE", "",
+		"The file holding the client secret the TokenExchange token manager plugin authenticates with.").Get()
+
 	// set to "SYSTEM" for ACME/public signed XDS servers.
 	xdsRootCA = env.RegisterStringVar("XDS_ROOT_CA", "",
 		"Explicitly set the root CA to expect for the XDS connection.").Get()
@@ -70,12 +89,19 @@ var (
 		"The grace period ratio for the cert rotation, by default 0.5.").Get()
 	pkcs8KeysEnv = env.RegisterBoolVar("PKCS8_KEY", false,
 		"Whether to generate PKCS#8 private keys").Get()
-	eccSigAlgEnv        = env.RegisterStringVar("ECC_SIGNATURE_ALGORITHM", "", "The type of ECC signature algorithm to use when generating private keys").Get()
+	eccSigAlgEnv = env.RegisterStringVar("ECC_SIGNATURE_ALGORITHM", "",
+		"The type of ECC signature algorithm to use when generating private keys: ECDSA (P-256), ECDSA_P384 or ED25519. "+
+			"ED25519 keys cannot be loaded by Envoy, so it is only supported for proxyless gRPC and file mounted outputs. "+
+			"If empty, RSA keys are generated.").Get()
 	fileMountedCertsEnv = env.RegisterBoolVar("FILE_MOUNTED_CERTS", false, "").Get()
 	credFetcherTypeEnv  = env.RegisterStringVar("CREDENTIAL_FETCHER_TYPE", "",
-		"The type of the credential fetcher. Currently supported types include GoogleComputeEngine").Get()
+		"The type of the credential fetcher. Currently supported types include GoogleComputeEngine, "+
+			"AmazonWebServices and MicrosoftAzure").Get()
 	credIdentityProvider = env.RegisterStringVar("CREDENTIAL_IDENTITY_PROVIDER", "GoogleComputeEngine",
 		"The identity provider for credential. Currently default supported identity provider is GoogleComputeEngine").Get()
+	credAudience = env.RegisterStringVar("CREDENTIAL_AUDIENCE", "",
+		"The audience of the platform credential. Required by the MicrosoftAzure credential fetcher, which requests "+
+			"managed identity tokens for it as the resource, such as the application ID URI of the identity provider").Get()
 	proxyXDSViaAgent = env.RegisterBoolVar("PROXY_XDS_VIA_AGENT", true,
 		"If set to true, envoy will proxy XDS calls via the agent instead of directly connecting to istiod. This option "+
 			"will be removed once the feature is stabilized.").Get()
@@ -84,11 +110,20 @@ var (
 	// DNSCaptureByAgent is a copy of the env var in the init code.
 	DNSCaptureByAgent = env.RegisterBoolVar("ISTIO_META_DNS_CAPTURE", false,
 		"If set to true, enable the capture of outgoing DNS packets on port 53, redirecting to istio-agent on :15053")
+	dnsForwardingRulesEnv = env.RegisterStringVar("ISTIO_AGENT_DNS_FORWARDING_RULES", "",
+		"The YAML or JSON list of the rules forwarding the DNS queries for a domain to specific upstream resolvers, "+
+			"over udp, tcp, tls or https, instead of the resolv.conf servers. Usually set in the proxyMetadata of the "+
+			"ProxyConfig, or with the proxy.istio.io/config annotation.")
 
 	// Ability of istio-agent to retrieve proxyConfig via XDS for dynamic configuration updates
 	enableProxyConfigXdsEnv = env.RegisterBoolVar("PROXY_CONFIG_XDS_AGENT", false,
 		"If set to true, agent retrieves dynamic proxy-config updates via xds channel").Get()
 
+	// Ability of istio-agent to retrieve the CRLs of the mesh CA via XDS
+	enableCRLXdsEnv = env.RegisterBoolVar("CRL_XDS_AGENT", false,
+		"If set to true, agent retrieves the certificate revocation lists of the mesh CA via xds channel, "+
+			"and proxies reject peer certificates revoked by the CA").Get()
+
 	// Ability of istio-agent to retrieve bootstrap via XDS
 	enableBootstrapXdsEnv = env.RegisterBoolVar("BOOTSTRAP_XDS_AGENT", false,
 		"If set to true, agent retrieves the bootstrap configuration prior to starting Envoy").Get()
@@ -16,6 +16,7 @@ package options
 
 import (
 	"fmt"
+	"io/ioutil"
 	"path/filepath"
 	"strings"
 
@@ -27,7 +28,9 @@ import (
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/security/pkg/credentialfetcher"
 	"istio.io/istio/security/pkg/nodeagent/plugin/providers/google/stsclient"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
 	"istio.io/istio/security/pkg/stsservice/tokenmanager"
+	"istio.io/istio/security/pkg/stsservice/tokenmanager/tokenexchange"
 	"istio.io/pkg/log"
 )
 
@@ -41,6 +44,7 @@ func NewSecurityOptions(proxyConfig *meshconfig.ProxyConfig, stsPort int, tokenM
 		WorkloadUDSPath:                filepath.Join(proxyConfig.ConfigPath, "SDS"),
 		ClusterID:                      clusterIDVar.Get(),
 		FileMountedCerts:               fileMountedCertsEnv,
+		ValidateFileMountedCerts:       validateFileMountedCertsEnv,
 		WorkloadNamespace:              PodNamespaceVar.Get(),
 		ServiceAccount:                 serviceAccountVar.Get(),
 		XdsAuthProvider:                xdsAuthProvider.Get(),
@@ -61,14 +65,40 @@ func NewSecurityOptions(proxyConfig *meshconfig.ProxyConfig, stsPort int, tokenM
 	var tokenManager security.TokenManager
 	if stsPort > 0 || xdsAuthProvider.Get() != "" {
 		// tokenManager is gcp token manager when using the default token manager plugin.
-		tokenManager = tokenmanager.CreateTokenManager(tokenManagerPlugin,
-			tokenmanager.Config{CredFetcher: o.CredFetcher, TrustDomain: o.TrustDomain})
+		tmConfig := tokenmanager.Config{CredFetcher: o.CredFetcher, TrustDomain: o.TrustDomain}
+		if tokenManagerPlugin == tokenmanager.TokenExchange {
+			if tmConfig.TokenExchange, err = tokenExchangeConfig(); err != nil {
+				return o, err
+			}
+		}
+		if tokenManager, err = tokenmanager.CreateTokenManager(tokenManagerPlugin, tmConfig); err != nil {
+			return o, err
+		}
 	}
 	o.TokenManager = tokenManager
 
 	return o, err
 }
 
+// tokenExchangeConfig returns the config of the TokenExchange token manager plugin.
+func tokenExchangeConfig() (tokenexchange.Config, error) {
+	config := tokenexchange.Config{
+		IssuerURL:     tokenExchangeIssuerURLEnv,
+		TokenEndpoint: tokenExchangeTokenEndpointEnv,
+		Audience:      tokenExchangeAudienceEnv,
+		Scope:         tokenExchangeScopeEnv,
+		ClientID:      tokenExchangeClientIDEnv,
+	}
+	if tokenExchangeClientSecretFileEnv != "" {
+		secret, err := ioutil.ReadFile(tokenExchangeClientSecretFileEnv)
+		if err != nil {
+			return config, fmt.Errorf("failed to read the token exchange client secret: %v", err)
+		}
+		config.ClientSecret = strings.TrimSpace(string(secret))
+	}
+	return config, nil
+}
+
 func SetupSecurityOptions(proxyConfig *meshconfig.ProxyConfig, secOpt *security.Options, jwtPolicy,
 	credFetcherTypeEnv, credIdentityProvider string) (*security.Options, error) {
 	var jwtPath string
@@ -91,11 +121,10 @@ func SetupSecurityOptions(proxyConfig *meshconfig.ProxyConfig, secOpt *security.
 		o.CAEndpoint = proxyConfig.DiscoveryAddress
 	}
 
-	// TODO (liminw): CredFetcher is a general interface. In 1.7, we limit the use on GCE only because
-	// GCE is the only supported plugin at the moment.
-	if credFetcherTypeEnv == security.GCE {
+	if credFetcherTypeEnv == security.GCE || credFetcherTypeEnv == security.AWS || credFetcherTypeEnv == security.Azure {
 		o.CredIdentityProvider = credIdentityProvider
-		credFetcher, err := credentialfetcher.NewCredFetcher(credFetcherTypeEnv, o.TrustDomain, jwtPath, o.CredIdentityProvider)
+		credFetcher, err := credentialfetcher.NewCredFetcher(credFetcherTypeEnv, o.TrustDomain, jwtPath, o.CredIdentityProvider,
+			credAudience)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create credential fetcher: %v", err)
 		}
@@ -114,5 +143,8 @@ func SetupSecurityOptions(proxyConfig *meshconfig.ProxyConfig, secOpt *security.
 	if o.ProvCert != "" && o.FileMountedCerts {
 		return nil, fmt.Errorf("invalid options: PROV_CERT and FILE_MOUNTED_CERTS are mutually exclusive")
 	}
+	if err := pkiutil.ValidateECSigAlg(pkiutil.SupportedECSignatureAlgorithms(o.ECCSigAlg)); err != nil {
+		return nil, fmt.Errorf("invalid ECC_SIGNATURE_ALGORITHM: %v", err)
+	}
 	return o, nil
 }
@@ -40,6 +40,10 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/expfmt"
 	"go.opencensus.io/stats/view"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcHealth "google.golang.org/grpc/health/grpc_health_v1"
+	grpcStatus "google.golang.org/grpc/status"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"istio.io/istio/pilot/cmd/pilot-agent/metrics"
@@ -92,7 +96,8 @@ type KubeAppProbers map[string]*Prober
 
 // Prober represents a single container prober
 type Prober struct {
-	HTTPGet        *apimirror.HTTPGetAction `json:"httpGet"`
+	HTTPGet        *apimirror.HTTPGetAction `json:"httpGet,omitempty"`
+	GRPC           *apimirror.GRPCAction    `json:"grpc,omitempty"`
 	TimeoutSeconds int32                    `json:"timeoutSeconds,omitempty"`
 }
 
@@ -123,6 +128,7 @@ type Server struct {
 	appProbersDestination string
 	appKubeProbers        KubeAppProbers
 	appProbeClient        map[string]*http.Client
+	upstreamLocalAddress  *net.TCPAddr
 	statusPort            uint16
 	lastProbeSuccessful   bool
 	envoyStatsPort        int
@@ -209,23 +215,33 @@ func NewServer(config Options) (*Server, error) {
 	}
 
 	s.appProbeClient = make(map[string]*http.Client, len(s.appKubeProbers))
+	s.upstreamLocalAddress = UpstreamLocalAddressIPv4
+	if config.IPv6 {
+		s.upstreamLocalAddress = UpstreamLocalAddressIPv6
+	}
 	// Validate the map key matching the regex pattern.
 	for path, prober := range s.appKubeProbers {
 		if !appProberPattern.Match([]byte(path)) {
 			return nil, fmt.Errorf(`invalid key, must be in form of regex pattern %v`, appProberPattern)
 		}
+		if prober.GRPC != nil {
+			if prober.HTTPGet != nil {
+				return nil, fmt.Errorf("invalid prober config for %v, only one of httpGet and grpc can be set", path)
+			}
+			if prober.GRPC.Port <= 0 || prober.GRPC.Port > 65535 {
+				return nil, fmt.Errorf("invalid prober config for %v, the port %v is not valid", path, prober.GRPC.Port)
+			}
+			// gRPC probes dial a new connection on each probe, no client is cached.
+			continue
+		}
 		if prober.HTTPGet == nil {
-			return nil, fmt.Errorf(`invalid prober type, must be of type httpGet`)
+			return nil, fmt.Errorf(`invalid prober type, must be of type httpGet or grpc`)
 		}
 		if prober.HTTPGet.Port.Type != intstr.Int {
 			return nil, fmt.Errorf("invalid prober config for %v, the port must be int type", path)
 		}
-		localAddr := UpstreamLocalAddressIPv4
-		if config.IPv6 {
-			localAddr = UpstreamLocalAddressIPv6
-		}
 		d := &net.Dialer{
-			LocalAddr: localAddr,
+			LocalAddr: s.upstreamLocalAddress,
 		}
 		// Construct a http client and cache it in order to reuse the connection.
 		s.appProbeClient[path] = &http.Client{
@@ -541,6 +557,11 @@ func (s *Server) handleAppProbe(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if prober.GRPC != nil {
+		s.handleAppProbeGRPC(w, req, path, prober)
+		return
+	}
+
 	proberPath := prober.HTTPGet.Path
 	if !strings.HasPrefix(proberPath, "/") {
 		proberPath = "/" + proberPath
@@ -601,6 +622,56 @@ func (s *Server) handleAppProbe(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(response.StatusCode)
 }
 
+// handleAppProbeGRPC checks the health of the application with the gRPC Health Checking Protocol,
+// the probe succeeds if the application reports the SERVING status.
+func (s *Server) handleAppProbeGRPC(w http.ResponseWriter, req *http.Request, path string, prober *Prober) {
+	timeout := time.Second
+	if prober.TimeoutSeconds > 0 {
+		timeout = time.Duration(prober.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	d := &net.Dialer{
+		LocalAddr: s.upstreamLocalAddress,
+	}
+	addr := net.JoinHostPort(s.appProbersDestination, strconv.Itoa(int(prober.GRPC.Port)))
+	conn, err := grpc.DialContext(ctx, addr,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithUserAgent("istio-probe/1.0"),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return d.DialContext(ctx, "tcp", addr)
+		}))
+	if err != nil {
+		log.Errorf("Failed to connect to probe app: %v, original URL path = %v, app address = %v", err, path, addr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	var service string
+	if prober.GRPC.Service != nil {
+		service = *prober.GRPC.Service
+	}
+	resp, err := grpcHealth.NewHealthClient(conn).Check(ctx, &grpcHealth.HealthCheckRequest{Service: service})
+	if err != nil {
+		if grpcStatus.Code(err) == codes.Unimplemented {
+			log.Errorf("Probe app %v does not implement the gRPC Health Checking Protocol, original URL path = %v", addr, path)
+		} else {
+			log.Errorf("Request to probe app failed: %v, original URL path = %v, app address = %v", err, path, addr)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if resp.GetStatus() != grpcHealth.HealthCheckResponse_SERVING {
+		log.Debugf("Probe app %v service %q is %v, original URL path = %v", addr, service, resp.GetStatus(), path)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 func (s *Server) handleNdsz(w http.ResponseWriter, r *http.Request) {
 	if !isRequestFromLocalhost(r) {
 		http.Error(w, "Only requests from localhost are allowed", http.StatusForbidden)
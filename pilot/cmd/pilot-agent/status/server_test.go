@@ -32,6 +32,9 @@ import (
 	"time"
 
 	"github.com/prometheus/common/expfmt"
+	"google.golang.org/grpc"
+	grpcHealth "google.golang.org/grpc/health"
+	grpcHealthV1 "google.golang.org/grpc/health/grpc_health_v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"istio.io/istio/pilot/cmd/pilot-agent/status/ready"
@@ -109,6 +112,21 @@ func TestNewServer(t *testing.T) {
 			probe: `{"/app-health/hello-world/readyz": {"httpGet": {"path": "/hello/sunnyvale", "port": 8080}},
 "/app-health/business/livez": {"httpGet": {"port": 9090}}}`,
 		},
+		// A valid gRPC input.
+		{
+			probe: `{"/app-health/hello-world/readyz": {"grpc": {"port": 8080, "service": "foo"}},` +
+				`"/app-health/business/livez": {"grpc": {"port": 9090}}}`,
+		},
+		// Port of the gRPC input is not valid.
+		{
+			probe: `{"/app-health/hello-world/readyz": {"grpc": {"port": 0}}}`,
+			err:   "is not valid",
+		},
+		// Both httpGet and grpc are set.
+		{
+			probe: `{"/app-health/hello-world/readyz": {"httpGet": {"port": 8080}, "grpc": {"port": 8080}}}`,
+			err:   "only one of httpGet and grpc",
+		},
 		// A valid input without any prober info.
 		{
 			probe: `{}`,
@@ -554,6 +572,105 @@ func TestHttpsAppProbe(t *testing.T) {
 	}
 }
 
+func TestGRPCAppProbe(t *testing.T) {
+	// Starts the application first.
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Errorf("failed to allocate unused port %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	healthServer := grpcHealth.NewServer()
+	healthServer.SetServingStatus("serving", grpcHealthV1.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("not-serving", grpcHealthV1.HealthCheckResponse_NOT_SERVING)
+	grpcHealthV1.RegisterHealthServer(grpcServer, healthServer)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+	appPort := listener.Addr().(*net.TCPAddr).Port
+
+	// An application not implementing the gRPC Health Checking Protocol.
+	noHealthListener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Errorf("failed to allocate unused port %v", err)
+	}
+	noHealthServer := grpc.NewServer()
+	go noHealthServer.Serve(noHealthListener)
+	defer noHealthServer.Stop()
+	noHealthPort := noHealthListener.Addr().(*net.TCPAddr).Port
+
+	// Starts the pilot agent status server.
+	server, err := NewServer(Options{
+		StatusPort: 0,
+		KubeAppProbers: fmt.Sprintf(`{"/app-health/hello-world/readyz": {"grpc": {"port": %v}},
+"/app-health/hello-world/livez": {"grpc": {"port": %v, "service": "serving"}},
+"/app-health/hello-world/startupz": {"grpc": {"port": %v, "service": "not-serving"}},
+"/app-health/unknown/readyz": {"grpc": {"port": %v, "service": "unknown"}},
+"/app-health/no-health/readyz": {"grpc": {"port": %v}}}`, appPort, appPort, appPort, appPort, noHealthPort),
+	})
+	if err != nil {
+		t.Errorf("failed to create status server %v", err)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Run(ctx)
+
+	var statusPort uint16
+	if err := retry.UntilSuccess(func() error {
+		server.mutex.RLock()
+		statusPort = server.statusPort
+		server.mutex.RUnlock()
+		if statusPort == 0 {
+			return fmt.Errorf("no port allocated")
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to getport: %v", err)
+	}
+	t.Logf("status server starts at port %v, app starts at port %v", statusPort, appPort)
+	testCases := []struct {
+		probePath  string
+		statusCode int
+	}{
+		{
+			probePath:  "app-health/hello-world/readyz",
+			statusCode: http.StatusOK,
+		},
+		{
+			probePath:  "app-health/hello-world/livez",
+			statusCode: http.StatusOK,
+		},
+		{
+			probePath:  "app-health/hello-world/startupz",
+			statusCode: http.StatusInternalServerError,
+		},
+		{
+			probePath:  "app-health/unknown/readyz",
+			statusCode: http.StatusInternalServerError,
+		},
+		{
+			probePath:  "app-health/no-health/readyz",
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.probePath, func(t *testing.T) {
+			client := http.Client{}
+			req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:%v/%s", statusPort, tc.probePath), nil)
+			if err != nil {
+				t.Fatalf("[%v] failed to create request", tc.probePath)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal("request failed: ", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.statusCode {
+				t.Errorf("[%v] unexpected status code, want = %v, got = %v", tc.probePath, tc.statusCode, resp.StatusCode)
+			}
+		})
+	}
+}
+
 func TestProbeHeader(t *testing.T) {
 	headerChecker := func(t *testing.T, header http.Header) net.Listener {
 		listener, err := net.Listen("tcp", ":0")
@@ -165,6 +165,12 @@ func (s *Server) initDNSCerts(hostname, customHost, namespace string) error {
 			if err != nil {
 				return fmt.Errorf("failed reading %s: %v", path.Join(LocalCertDir.Get(), ca.RootCertFile), err)
 			}
+			if s.pluggedCertRotator != nil {
+				// regenerate istiod key cert when the plugged-in certs change.
+				s.pluggedCertRotator.AddHandler(func() {
+					s.genIstiodKeyCert(names, s.CA.GetCAKeyCertBundle().GetRootCertPem())
+				})
+			}
 		}
 	} else {
 		customCACertPath := security.DefaultRootCertFilePath
@@ -190,18 +196,23 @@ func (s *Server) watchRootCertAndGenKeyCert(names []string, stop <-chan struct{}
 			newRootCert := s.CA.GetCAKeyCertBundle().GetRootCertPem()
 			if !bytes.Equal(caBundle, newRootCert) {
 				caBundle = newRootCert
-				certChain, keyPEM, err := s.CA.GenKeyCert(names, SelfSignedCACertTTL.Get(), false)
-				if err != nil {
-					log.Errorf("failed generating istiod key cert %v", err)
-				} else {
-					s.istiodCertBundleWatcher.SetAndNotify(keyPEM, certChain, caBundle)
-					log.Infof("regenerated istiod dns cert: %s", certChain)
-				}
+				s.genIstiodKeyCert(names, caBundle)
 			}
 		}
 	}
 }
 
+// genIstiodKeyCert regenerates the istiod DNS cert, signed by the Istiod CA.
+func (s *Server) genIstiodKeyCert(names []string, caBundle []byte) {
+	certChain, keyPEM, err := s.CA.GenKeyCert(names, SelfSignedCACertTTL.Get(), false)
+	if err != nil {
+		log.Errorf("failed generating istiod key cert %v", err)
+	} else {
+		s.istiodCertBundleWatcher.SetAndNotify(keyPEM, certChain, caBundle)
+		log.Infof("regenerated istiod dns cert: %s", certChain)
+	}
+}
+
 // initCertificateWatches sets up watches for the plugin dns certs.
 func (s *Server) initCertificateWatches(tlsOptions TLSOptions) error {
 	if err := s.istiodCertBundleWatcher.SetFromFilesAndNotify(tlsOptions.KeyFile, tlsOptions.CertFile, tlsOptions.CaCertFile); err != nil {
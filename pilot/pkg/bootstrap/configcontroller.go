@@ -17,6 +17,9 @@ package bootstrap
 import (
 	"fmt"
 	"net/url"
+	"os"
+	"strings"
+	"time"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
 	"istio.io/istio/galley/pkg/config/mesh"
@@ -53,8 +56,21 @@ const (
 	// k8s:// - load in-cluster k8s controller
 	// example k8s://
 	Kubernetes ConfigSourceAddressScheme = "k8s"
+	// git://ADDRESS/REPO or git:///PATH - load files from a git repository, at a ref and path within it.
+	// example git:///srv/mesh-config.git?ref=main&path=istio&interval=1m
+	// Query parameters:
+	//   ref      - branch, tag or commit to read, defaults to the default branch
+	//   path     - directory within the repository to read, defaults to the repository root
+	//   interval - how often to poll for new commits, defaults to 1m
+	//   repo     - repository URL to clone instead of the address, for example to use https
+	//   dir      - directory to clone into, defaults to a temporary directory
+	//   webhook  - path on the http port that triggers an immediate poll when called
+	Git ConfigSourceAddressScheme = "git"
 )
 
+// defaultGitPollInterval is the default interval between polls of git config sources.
+const defaultGitPollInterval = time.Minute
+
 // initConfigController creates the config controller in the pilotConfig.
 func (s *Server) initConfigController(args *PilotArgs) error {
 	s.initStatusController(args, features.EnableStatus)
@@ -136,6 +152,14 @@ func (s *Server) initConfigController(args *PilotArgs) error {
 	}
 	s.configController = aggregateConfigController
 
+	if features.EnableStatus && len(s.statusSinks) > 0 {
+		sinkController := status.NewSinkController(s.configController, s.statusSinks...)
+		s.addStartFunc(func(stop <-chan struct{}) error {
+			s.statusReporter.StartLocal(sinkController, stop)
+			return nil
+		})
+	}
+
 	// Create the config store.
 	s.environment.IstioConfigStore = model.MakeIstioStore(s.configController)
 
@@ -196,6 +220,15 @@ func (s *Server) initConfigSources(args *PilotArgs) (err error) {
 				return err
 			}
 			s.ConfigStores = append(s.ConfigStores, configController)
+		case Git:
+			store := memory.Make(collections.Pilot)
+			configController := memory.NewController(store)
+
+			err := s.makeGitMonitor(srcAddress, args.RegistryOptions.KubeOptions.DomainSuffix, configController)
+			if err != nil {
+				return fmt.Errorf("invalid git config URL %s: %v", configSource.Address, err)
+			}
+			s.ConfigStores = append(s.ConfigStores, configController)
 		case XDS:
 			xdsMCP, err := adsc.New(srcAddress.Host, &adsc.Config{
 				Meta: model.NodeMetadata{
@@ -214,6 +247,7 @@ func (s *Server) initConfigSources(args *PilotArgs) (err error) {
 				return fmt.Errorf("MCP: failed running %v", err)
 			}
 			s.ConfigStores = append(s.ConfigStores, configController)
+			s.statusSinks = append(s.statusSinks, xdsMCP)
 			log.Warn("Started XDS config ", s.ConfigStores)
 		case Kubernetes:
 			if srcAddress.Path == "" || srcAddress.Path == "/" {
@@ -326,7 +360,14 @@ func (s *Server) makeKubeConfigController(args *PilotArgs) (model.ConfigStoreCac
 
 func (s *Server) makeFileMonitor(fileDir string, domainSuffix string, configController model.ConfigStore) error {
 	fileSnapshot := configmonitor.NewFileSnapshot(fileDir, collections.Pilot, domainSuffix)
-	fileMonitor := configmonitor.NewMonitor("file-monitor", configController, fileSnapshot.ReadConfigFiles, fileDir)
+	readConfigFiles := fileSnapshot.ReadConfigFiles
+	if features.EnableStatus {
+		// Write status beside the config files.
+		statusSink := configmonitor.NewFileStatusSink(fileSnapshot)
+		readConfigFiles = statusSink.ReadConfigFiles
+		s.statusSinks = append(s.statusSinks, statusSink)
+	}
+	fileMonitor := configmonitor.NewMonitor("file-monitor", configController, readConfigFiles, fileDir)
 
 	// Defer starting the file monitor until after the service is created.
 	s.addStartFunc(func(stop <-chan struct{}) error {
@@ -336,3 +377,68 @@ func (s *Server) makeFileMonitor(fileDir string, domainSuffix string, configCont
 
 	return nil
 }
+
+func (s *Server) makeGitMonitor(srcAddress *url.URL, domainSuffix string, configController model.ConfigStore) error {
+	query := srcAddress.Query()
+	repo := query.Get("repo")
+	if repo == "" {
+		if srcAddress.Host == "" {
+			// A repository on local disk.
+			repo = srcAddress.Path
+		} else {
+			repo = (&url.URL{Scheme: srcAddress.Scheme, Host: srcAddress.Host, Path: srcAddress.Path}).String()
+		}
+	}
+	if repo == "" {
+		return fmt.Errorf("contains no repository")
+	}
+	interval := defaultGitPollInterval
+	if i := query.Get("interval"); i != "" {
+		var err error
+		if interval, err = time.ParseDuration(i); err != nil || interval <= 0 {
+			return fmt.Errorf("invalid interval %q", i)
+		}
+	}
+	ref := query.Get("ref")
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid ref %q", ref)
+	}
+	webhook := query.Get("webhook")
+	if webhook != "" && features.GitConfigWebhookSecret == "" {
+		return fmt.Errorf("webhook requires PILOT_GIT_CONFIG_WEBHOOK_SECRET to be set")
+	}
+	dir := query.Get("dir")
+	tempDir := dir == ""
+	if tempDir {
+		var err error
+		if dir, err = os.MkdirTemp("", "istio-git-config"); err != nil {
+			return err
+		}
+	}
+
+	gitSnapshot := configmonitor.NewGitSnapshot(repo, ref, query.Get("path"), dir, collections.Pilot, domainSuffix)
+	gitMonitor := configmonitor.NewPollingMonitor("git-monitor", configController, gitSnapshot.ReadConfigFiles, interval)
+
+	if webhook != "" {
+		if !strings.HasPrefix(webhook, "/") {
+			webhook = "/" + webhook
+		}
+		s.httpMux.HandleFunc(webhook, configmonitor.GitWebhookHandler(features.GitConfigWebhookSecret, gitMonitor.Trigger))
+	}
+
+	// Defer starting the git monitor until after the service is created.
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		gitMonitor.Start(stop)
+		if tempDir {
+			go func() {
+				<-stop
+				if err := gitSnapshot.Close(); err != nil {
+					log.Warnf("failed to remove git checkout %s: %v", dir, err)
+				}
+			}()
+		}
+		return nil
+	})
+
+	return nil
+}
@@ -16,6 +16,7 @@ package bootstrap
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -25,18 +26,26 @@ import (
 	"strings"
 	"time"
 
+	"go.uber.org/atomic"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
 
 	"istio.io/api/security/v1beta1"
 	"istio.io/istio/pilot/pkg/features"
 	securityModel "istio.io/istio/pilot/pkg/security/model"
+	tb "istio.io/istio/pilot/pkg/trustbundle"
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/jwt"
 	kubelib "istio.io/istio/pkg/kube"
+	"istio.io/istio/pkg/kube/configmapwatcher"
 	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/spiffe"
 	"istio.io/istio/security/pkg/cmd"
 	"istio.io/istio/security/pkg/pki/ca"
 	"istio.io/istio/security/pkg/pki/ra"
@@ -76,6 +85,19 @@ type caOptions struct {
 //   The config map was used by node agent - no longer possible to use in sds-agent, but we still save it for
 //   backward compat. Will be removed with the node-agent. sds-agent is calling NewCitadelClient directly, using
 //   K8S root.
+//
+// - an optional "crl-chain.pem" in "cacerts" holds the CRLs of the CAs in cert-chain.pem; it is required to
+// revoke certificates issued by a plugged-in intermediate CA. Revoked certificates are stored in the
+// "istio-ca-crl" config map.
+
+const (
+	// crlPath is the path of the HTTP endpoint serving the CRLs published by the CA.
+	crlPath = "/ca/crl"
+	// spiffeBundlePath is the path of the SPIFFE bundle endpoint, on the HTTPS port.
+	spiffeBundlePath = "/spiffe/bundle"
+	// issuancePolicyConfigMapKey is the key of the issuance policy in the CA_ISSUANCE_POLICY_CONFIGMAP ConfigMap.
+	issuancePolicyConfigMapKey = "policy"
+)
 
 var (
 	// LocalCertDir replaces the "cert-chain", "signing-cert" and "signing-key" flags in citadel - Istio installer is
@@ -131,12 +153,59 @@ var (
 
 	// TODO: Likely to be removed and added to mesh config
 	externalCaType = env.RegisterStringVar("EXTERNAL_CA", "",
-		"External CA Integration Type. Permitted Values are ISTIOD_RA_KUBERNETES_API or "+
-			"ISTIOD_RA_ISTIO_API").Get()
+		"External CA Integration Type. Permitted Values are ISTIOD_RA_KUBERNETES_API, "+
+			"ISTIOD_RA_ISTIO_API or ISTIOD_RA_HTTP_API").Get()
+
+	// TODO: Likely to be removed and added to mesh config
+	externalCAHTTPConfig = env.RegisterStringVar("EXTERNAL_CA_HTTP_CONFIG", "./etc/external-ca/signer.yaml",
+		"Path to the configuration of the external HTTP signer used with ISTIOD_RA_HTTP_API: its URL, "+
+			"protocol (vault or pem), credentials, retries and issuer profiles.").Get()
 
 	// TODO: Likely to be removed and added to mesh config
 	k8sSigner = env.RegisterStringVar("K8S_SIGNER", "",
 		"Kubernates CA Signer type. Valid from Kubernates 1.18").Get()
+
+	pluggedCertHotReload = env.RegisterBoolVar("PLUGGED_CA_CERT_HOT_RELOAD", true,
+		"If true, Istiod reloads the plugged-in CA key and certificates when the files in ROOT_CA_DIR, "+
+			"mounted from the cacerts Secret, change.")
+
+	pluggedCertRootOverlap = env.RegisterDurationVar("PLUGGED_CA_ROOT_OVERLAP", cmd.DefaultWorkloadCertTTL,
+		"How long a root removed from the plugged-in root-cert.pem keeps being distributed to workloads. "+
+			"It should be longer than the TTL of workload certificates, so the certificates issued under "+
+			"the removed root are renewed before it is no longer trusted.")
+
+	issuancePolicyFile = env.RegisterStringVar("CA_ISSUANCE_POLICY_FILE", "",
+		"If set, the file holding the issuance policy checked by the CA server before signing workload "+
+			"certificates. The file is reloaded when it changes.").Get()
+
+	issuancePolicyConfigMap = env.RegisterStringVar("CA_ISSUANCE_POLICY_CONFIGMAP", "",
+		"If set, the name of the ConfigMap in the Istiod namespace holding the issuance policy checked by "+
+			"the CA server before signing workload certificates, in the \""+issuancePolicyConfigMapKey+"\" key. "+
+			"Takes precedence over CA_ISSUANCE_POLICY_FILE.").Get()
+
+	caAuditLogFile = env.RegisterStringVar("CA_AUDIT_LOG_FILE", "",
+		"If set, the file the CA server writes an audit record to for every certificate request, "+
+			"one JSON record per line.").Get()
+
+	caAuditLogMaxSize = env.RegisterIntVar("CA_AUDIT_LOG_MAX_SIZE_MB", 100,
+		"The size in megabytes of the CA audit log file before it is rotated.").Get()
+
+	caAuditLogMaxBackups = env.RegisterIntVar("CA_AUDIT_LOG_MAX_BACKUPS", 10,
+		"The number of rotated CA audit log files kept.").Get()
+
+	caAuditLogMaxAge = env.RegisterIntVar("CA_AUDIT_LOG_MAX_AGE_DAYS", 30,
+		"The number of days rotated CA audit log files are kept.").Get()
+
+	caAuditGrpcSink = env.RegisterStringVar("CA_AUDIT_GRPC_SINK_ADDRESS", "",
+		"If set, the address of a gRPC server the CA audit records are sent to, with the "+
+			caserver.AuditSinkWriteMethod+" method.").Get()
+
+	caAuditGrpcSinkPlaintext = env.RegisterBoolVar("CA_AUDIT_GRPC_SINK_PLAINTEXT", false,
+		"If true, the connection to the CA audit gRPC sink is not encrypted, otherwise it uses TLS "+
+			"verified with the system roots.").Get()
+
+	caAuditRecentRecords = env.RegisterIntVar("CA_AUDIT_RECENT_RECORDS", 1000,
+		"The number of recent CA audit records served by the /debug/ca_issuancez endpoint.").Get()
 )
 
 // EnableCA returns whether CA functionality is enabled in istiod.
@@ -150,7 +219,7 @@ func (s *Server) EnableCA() bool {
 // Protected by installer options: the CA will be started only if the JWT token in /var/run/secrets
 // is mounted. If it is missing - for example old versions of K8S that don't support such tokens -
 // we will not start the cert-signing server, since pods will have no way to authenticate.
-func (s *Server) RunCA(grpc *grpc.Server, ca caserver.CertificateAuthority, opts *caOptions) {
+func (s *Server) RunCA(grpc *grpc.Server, ca caserver.CertificateAuthority, opts *caOptions, stop <-chan struct{}) error {
 	iss := trustedIssuer.Get()
 	aud := audience.Get()
 
@@ -194,9 +263,18 @@ func (s *Server) RunCA(grpc *grpc.Server, ca caserver.CertificateAuthority, opts
 		}
 	}
 
+	if err := s.initIssuancePolicy(caServer, opts, stop); err != nil {
+		return fmt.Errorf("failed to initialize the CA issuance policy: %v", err)
+	}
+	caServer.AuditLog = s.caAuditLog
+
 	caServer.Register(grpc)
+	if s.httpMux != nil {
+		s.httpMux.HandleFunc(crlPath, caServer.ServeCRL)
+	}
 
 	log.Info("Istiod CA has started")
+	return nil
 }
 
 // detectAuthEnv will use the JWT token that is mounted in istiod to set the default audience
@@ -269,6 +347,7 @@ func (s *Server) loadRemoteCACerts(caOpts *caOptions, dir string) error {
 //   which may contain multiple roots. A 'cert-chain.pem' file has the full cert chain.
 func (s *Server) createIstioCA(client corev1.CoreV1Interface, opts *caOptions) (*ca.IstioCA, error) {
 	var caOpts *ca.IstioCAOptions
+	var pluggedCertConfig *ca.PluggedCertRotatorConfig
 	var err error
 
 	// In pods, this is the optional 'cacerts' Secret.
@@ -321,11 +400,36 @@ func (s *Server) createIstioCA(client corev1.CoreV1Interface, opts *caOptions) (
 		if err != nil {
 			return nil, fmt.Errorf("failed to create an istiod CA: %v", err)
 		}
+		if pluggedCertHotReload.Get() && rootCertFile != "" {
+			pluggedCertConfig = &ca.PluggedCertRotatorConfig{
+				SigningCertFile: signingCertFile,
+				SigningKeyFile:  signingKeyFile,
+				CertChainFile:   certChainFile,
+				RootCertFile:    rootCertFile,
+				CRLChainFile:    path.Join(LocalCertDir.Get(), ca.CRLChainFile),
+				RootOverlap:     pluggedCertRootOverlap.Get(),
+			}
+		}
+	}
+	if client != nil {
+		caOpts.CRLStore = ca.NewConfigMapCRLStore(client, opts.Namespace)
+	}
+	// The CRLs of the CAs above a plugged-in signing cert, required to revoke certificates.
+	if crls, err := ioutil.ReadFile(path.Join(LocalCertDir.Get(), ca.CRLChainFile)); err == nil {
+		caOpts.UpstreamCRLs = crls
 	}
 	istioCA, err := ca.NewIstioCA(caOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create an istiod CA: %v", err)
 	}
+	if pluggedCertConfig != nil {
+		if s.pluggedCertRotator, err = ca.NewPluggedCertRotator(pluggedCertConfig, istioCA); err != nil {
+			return nil, fmt.Errorf("failed to create the plugged-in cert rotator: %v", err)
+		}
+		if err := s.initPluggedCertWatches(pluggedCertConfig); err != nil {
+			return nil, err
+		}
+	}
 	// TODO: provide an endpoint returning all the roots. SDS can only pull a single root in current impl.
 	// ca.go saves or uses the secret, but also writes to the configmap "istio-security", under caTLSRootCert
 	// rootCertRotatorChan channel accepts signals to stop root cert rotator for
@@ -350,9 +454,18 @@ func (s *Server) createIstioRA(client kubelib.Client,
 		CaSigner:       opts.ExternalCASigner,
 		CaCertFile:     caCertFile,
 		VerifyAppendCA: true,
-		K8sClient:      client.CertificatesV1beta1(),
 		TrustDomain:    opts.TrustDomain,
 	}
+	if client != nil {
+		raOpts.K8sClient = client.CertificatesV1beta1()
+	}
+	if opts.ExternalCAType == ra.ExtCAHTTP {
+		signerConfig, err := ra.LoadHTTPSignerConfig(externalCAHTTPConfig)
+		if err != nil {
+			return nil, err
+		}
+		raOpts.HTTPSigner = signerConfig
+	}
 	return ra.NewIstioRA(raOpts)
 }
 
@@ -369,3 +482,199 @@ func getJwtPath() string {
 		return ""
 	}
 }
+
+// initSpiffeBundleEndpoint serves the roots of the Istiod CA, or of the RA, as a SPIFFE bundle endpoint.
+func (s *Server) initSpiffeBundleEndpoint() {
+	if !features.EnableSpiffeBundleEndpoint || s.httpsMux == nil {
+		return
+	}
+	roots := func() []byte {
+		if s.RA != nil {
+			return s.RA.GetCAKeyCertBundle().GetRootCertPem()
+		}
+		return s.CA.GetCAKeyCertBundle().GetRootCertPem()
+	}
+	s.httpsMux.Handle(spiffeBundlePath, tb.NewBundleEndpoint(roots, features.SpiffeBundleRefreshHint))
+	log.Infof("serving the SPIFFE bundle of trust domain %s at %s", spiffe.GetTrustDomain(), spiffeBundlePath)
+}
+
+// initPluggedCertWatches reloads the plugged-in CA key and certificates when the files change. In Kubernetes, the
+// files are updated by the kubelet when the cacerts Secret changes.
+func (s *Server) initPluggedCertWatches(config *ca.PluggedCertRotatorConfig) error {
+	files := []string{config.SigningCertFile, config.SigningKeyFile, config.CertChainFile, config.RootCertFile}
+	if _, err := os.Stat(config.CRLChainFile); err == nil {
+		files = append(files, config.CRLChainFile)
+	}
+	for _, file := range files {
+		log.Infof("adding watcher for plugged-in CA certificate %s", file)
+		if err := s.fileWatcher.Add(file); err != nil {
+			return fmt.Errorf("could not watch %v: %v", file, err)
+		}
+	}
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go s.pluggedCertRotator.Run(stop)
+		go func() {
+			// Merge the events of all the files, as they are usually updated together.
+			events := make(chan struct{}, 1)
+			for _, file := range files {
+				go func(file string) {
+					for {
+						select {
+						case <-s.fileWatcher.Events(file):
+							select {
+							case events <- struct{}{}:
+							default:
+							}
+						case err := <-s.fileWatcher.Errors(file):
+							log.Errorf("error watching %v: %v", file, err)
+						case <-stop:
+							return
+						}
+					}
+				}(file)
+			}
+			var reloadTimerC <-chan time.Time
+			for {
+				select {
+				case <-events:
+					if reloadTimerC == nil {
+						reloadTimerC = time.After(watchDebounceDelay)
+					}
+				case <-reloadTimerC:
+					reloadTimerC = nil
+					if err := s.pluggedCertRotator.Reload(); err != nil {
+						log.Errorf("failed to reload the plugged-in CA certificates, keep using the previous ones: %v", err)
+					}
+				case <-stop:
+					return
+				}
+			}
+		}()
+		return nil
+	})
+	return nil
+}
+
+// initCAAuditLog creates the audit log of the CA server, and serves the recent records on the debug interface.
+func (s *Server) initCAAuditLog() error {
+	if s.CA == nil && s.RA == nil {
+		return nil
+	}
+	creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	if caAuditGrpcSinkPlaintext {
+		creds = insecure.NewCredentials()
+	}
+	auditLog, err := caserver.NewAuditLog(caserver.AuditLogOptions{
+		File:            caAuditLogFile,
+		MaxSizeMB:       caAuditLogMaxSize,
+		MaxBackups:      caAuditLogMaxBackups,
+		MaxAgeDays:      caAuditLogMaxAge,
+		GRPCAddress:     caAuditGrpcSink,
+		GRPCDialOptions: []grpc.DialOption{grpc.WithTransportCredentials(creds)},
+		RecentRecords:   caAuditRecentRecords,
+	})
+	if err != nil {
+		return err
+	}
+	s.caAuditLog = auditLog
+	s.XDSServer.CAIssuances = auditLog
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go func() {
+			<-stop
+			if err := auditLog.Close(); err != nil {
+				log.Errorf("failed to close the CA audit log: %v", err)
+			}
+		}()
+		return nil
+	})
+	return nil
+}
+
+// initIssuancePolicy loads the issuance policy of the CA server from the CA_ISSUANCE_POLICY_CONFIGMAP ConfigMap
+// or the CA_ISSUANCE_POLICY_FILE file, and keeps it up to date. It fails if a configured policy cannot be loaded,
+// so the CA server never signs requests the policy would deny. An invalid or removed policy is ignored on reload,
+// the CA server keeps checking the last valid one.
+func (s *Server) initIssuancePolicy(caServer *caserver.Server, opts *caOptions, stop <-chan struct{}) error {
+	if issuancePolicyConfigMap != "" {
+		if s.kubeClient == nil {
+			return fmt.Errorf("the issuance policy ConfigMap %s requires a Kubernetes client", issuancePolicyConfigMap)
+		}
+		loaded := atomic.NewBool(false)
+		c := configmapwatcher.NewController(s.kubeClient, opts.Namespace, issuancePolicyConfigMap, func(cm *v1.ConfigMap) {
+			if cm == nil {
+				log.Errorf("issuance policy ConfigMap %s not found, keep using the previous one", issuancePolicyConfigMap)
+				return
+			}
+			policy, err := caserver.ParseIssuancePolicy([]byte(cm.Data[issuancePolicyConfigMapKey]))
+			if err != nil {
+				log.Errorf("invalid issuance policy in ConfigMap %s, keep using the previous one: %v", issuancePolicyConfigMap, err)
+				return
+			}
+			log.Infof("loaded issuance policy from ConfigMap %s", issuancePolicyConfigMap)
+			caServer.SetIssuancePolicy(policy)
+			loaded.Store(true)
+		})
+		go c.Run(stop)
+		if !cache.WaitForCacheSync(stop, c.HasSynced) {
+			return fmt.Errorf("failed to wait for the issuance policy ConfigMap %s sync", issuancePolicyConfigMap)
+		}
+		if !loaded.Load() {
+			return fmt.Errorf("no valid issuance policy in ConfigMap %s/%s", opts.Namespace, issuancePolicyConfigMap)
+		}
+		return nil
+	}
+	if issuancePolicyFile == "" {
+		return nil
+	}
+	policy, err := caserver.LoadIssuancePolicy(issuancePolicyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load issuance policy %s: %v", issuancePolicyFile, err)
+	}
+	log.Infof("loaded issuance policy from %s", issuancePolicyFile)
+	caServer.SetIssuancePolicy(policy)
+	reload := func() {
+		policy, err := caserver.LoadIssuancePolicy(issuancePolicyFile)
+		if err != nil {
+			log.Errorf("failed to load issuance policy %s, keep using the previous one: %v", issuancePolicyFile, err)
+			return
+		}
+		log.Infof("loaded issuance policy from %s", issuancePolicyFile)
+		caServer.SetIssuancePolicy(policy)
+	}
+	if err := s.fileWatcher.Add(issuancePolicyFile); err != nil {
+		log.Errorf("could not watch %v: %v", issuancePolicyFile, err)
+		return nil
+	}
+	go func() {
+		var reloadTimerC <-chan time.Time
+		for {
+			select {
+			case <-s.fileWatcher.Events(issuancePolicyFile):
+				if reloadTimerC == nil {
+					reloadTimerC = time.After(watchDebounceDelay)
+				}
+			case err := <-s.fileWatcher.Errors(issuancePolicyFile):
+				log.Errorf("error watching %v: %v", issuancePolicyFile, err)
+			case <-reloadTimerC:
+				reloadTimerC = nil
+				reload()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// initCRLDistribution pushes the CRLs published by the Istiod CA to the proxies, whenever a certificate
+// is revoked or the CRL is re-signed.
+func (s *Server) initCRLDistribution() {
+	if s.CA == nil || s.XDSServer == nil {
+		return
+	}
+	update := func() {
+		s.XDSServer.UpdateCRL(s.CA.GetCRL())
+	}
+	s.CA.AddCRLHandler(update)
+	update()
+}
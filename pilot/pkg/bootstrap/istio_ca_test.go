@@ -20,6 +20,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	v1 "k8s.io/api/core/v1"
@@ -28,6 +29,8 @@ import (
 	"istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/test/env"
 	"istio.io/istio/security/pkg/pki/ca"
+	mockca "istio.io/istio/security/pkg/pki/ca/mock"
+	caserver "istio.io/istio/security/pkg/server/ca"
 )
 
 const namespace = "istio-system"
@@ -112,3 +115,86 @@ func createCASecret(client kube.Client) error {
 func readSampleCertFromFile(f string) ([]byte, error) {
 	return ioutil.ReadFile(path.Join(env.IstioSrc, "samples/certs", f))
 }
+
+func TestInitIssuancePolicy(t *testing.T) {
+	defer func(file, configMap string) {
+		issuancePolicyFile, issuancePolicyConfigMap = file, configMap
+	}(issuancePolicyFile, issuancePolicyConfigMap)
+
+	dir := t.TempDir()
+	invalidFile := path.Join(dir, "invalid.yaml")
+	if err := ioutil.WriteFile(invalidFile, []byte("unknown: true"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name       string
+		file       string
+		configMap  string
+		policy     string
+		noKube     bool
+		wantErrMsg string
+	}{
+		{
+			name: "no policy",
+		},
+		{
+			name:       "invalid file",
+			file:       invalidFile,
+			wantErrMsg: "failed to load issuance policy",
+		},
+		{
+			name:       "missing file",
+			file:       path.Join(dir, "missing.yaml"),
+			wantErrMsg: "failed to load issuance policy",
+		},
+		{
+			name:       "ConfigMap without Kubernetes",
+			configMap:  "issuance-policy",
+			noKube:     true,
+			wantErrMsg: "requires a Kubernetes client",
+		},
+		{
+			name:       "missing ConfigMap",
+			configMap:  "issuance-policy",
+			wantErrMsg: "no valid issuance policy",
+		},
+		{
+			name:       "invalid ConfigMap",
+			configMap:  "issuance-policy",
+			policy:     "unknown: true",
+			wantErrMsg: "no valid issuance policy",
+		},
+		{
+			name:      "valid ConfigMap",
+			configMap: "issuance-policy",
+			policy:    "rules:\n- namespace: foo\n  deny: true\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := NewWithT(t)
+			issuancePolicyFile, issuancePolicyConfigMap = c.file, c.configMap
+			s := &Server{}
+			if !c.noKube {
+				s.kubeClient = kube.NewFakeClient()
+			}
+			if c.policy != "" {
+				_, err := s.kubeClient.CoreV1().ConfigMaps(namespace).Create(context.TODO(), &v1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: c.configMap, Namespace: namespace},
+					Data:       map[string]string{issuancePolicyConfigMapKey: c.policy},
+				}, metav1.CreateOptions{})
+				g.Expect(err).Should(BeNil())
+			}
+			caServer, err := caserver.New(&mockca.FakeCA{}, time.Hour, nil)
+			g.Expect(err).Should(BeNil())
+			stop := make(chan struct{})
+			defer close(stop)
+			err = s.initIssuancePolicy(caServer, &caOptions{Namespace: namespace}, stop)
+			if c.wantErrMsg == "" {
+				g.Expect(err).Should(BeNil())
+			} else {
+				g.Expect(err).Should(MatchError(ContainSubstring(c.wantErrMsg)))
+			}
+		})
+	}
+}
@@ -70,6 +70,7 @@ import (
 	"istio.io/istio/security/pkg/k8s/chiron"
 	"istio.io/istio/security/pkg/pki/ca"
 	"istio.io/istio/security/pkg/pki/ra"
+	caserver "istio.io/istio/security/pkg/server/ca"
 	"istio.io/istio/security/pkg/server/ca/authenticate"
 	"istio.io/istio/security/pkg/server/ca/authenticate/kubeauth"
 	"istio.io/pkg/ctrlz"
@@ -156,6 +157,11 @@ type Server struct {
 	CA             *ca.IstioCA
 	RA             ra.RegistrationAuthority
 
+	// pluggedCertRotator reloads the plugged-in CA certificates. It is nil if the CA is not using plugged-in certs.
+	pluggedCertRotator *ca.PluggedCertRotator
+	// caAuditLog records the certificate requests to the CA server.
+	caAuditLog *caserver.AuditLog
+
 	// TrustAnchors for workload to workload mTLS
 	workloadTrustBundle     *tb.TrustBundle
 	certMu                  sync.RWMutex
@@ -178,6 +184,8 @@ type Server struct {
 	internalStop chan struct{}
 
 	statusReporter *status.Reporter
+	// statusSinks write status for config that is not stored in Kubernetes back to its source.
+	statusSinks []status.Sink
 	// RWConfigStore is the configstore which allows updates, particularly for status.
 	RWConfigStore model.ConfigStoreCache
 }
@@ -254,6 +262,9 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 	if err := s.maybeCreateCA(caOpts); err != nil {
 		return nil, err
 	}
+	if err := s.initCAAuditLog(); err != nil {
+		return nil, fmt.Errorf("error initializing CA audit log: %v", err)
+	}
 
 	if err := s.initControllers(args); err != nil {
 		return nil, err
@@ -941,6 +952,11 @@ func (s *Server) initIstiodCerts(args *PilotArgs, host string) error {
 	} else if features.PilotCertProvider == constants.CertProviderNone {
 		return nil
 	} else if s.EnableCA() && features.PilotCertProvider == constants.CertProviderIstiod {
+		if s.CA == nil {
+			return fmt.Errorf("PILOT_CERT_PROVIDER=%s requires the Istiod CA, which is disabled with EXTERNAL_CA=%s: "+
+				"use custom Istiod certificates or PILOT_CERT_PROVIDER=%s",
+				constants.CertProviderIstiod, ra.ExtCAHTTP, constants.CertProviderKubernetes)
+		}
 		log.Infof("initializing Istiod DNS certificates host: %s, custom host: %s", host, features.IstiodServiceCustomHost)
 		err = s.initDNSCerts(host, features.IstiodServiceCustomHost, args.Namespace)
 		if err == nil {
@@ -1066,6 +1082,10 @@ func (s *Server) startCA(caOpts *caOptions) {
 	if s.CA == nil && s.RA == nil {
 		return
 	}
+	s.initSpiffeBundleEndpoint()
+	if s.RA == nil {
+		s.XDSServer.CARevocation = caserver.RevokeHandler(s.CA)
+	}
 	s.addStartFunc(func(stop <-chan struct{}) error {
 		grpcServer := s.secureGrpcServer
 		if s.secureGrpcServer == nil {
@@ -1074,10 +1094,13 @@ func (s *Server) startCA(caOpts *caOptions) {
 		// Start the RA server if configured, else start the CA server
 		if s.RA != nil {
 			log.Infof("Starting RA")
-			s.RunCA(grpcServer, s.RA, caOpts)
+			return s.RunCA(grpcServer, s.RA, caOpts, stop)
 		} else if s.CA != nil {
 			log.Infof("Starting IstioD CA")
-			s.RunCA(grpcServer, s.CA, caOpts)
+			if err := s.RunCA(grpcServer, s.CA, caOpts, stop); err != nil {
+				return err
+			}
+			s.initCRLDistribution()
 		}
 		return nil
 	})
@@ -1180,6 +1203,14 @@ func (s *Server) initWorkloadTrustBundle(args *PilotArgs) error {
 	if err != nil {
 		return err
 	}
+	if s.pluggedCertRotator != nil {
+		// Publish the new roots, and the roots still in their overlap window, when the plugged-in certs rotate.
+		s.pluggedCertRotator.AddHandler(func() {
+			if err := s.addIstioCAToTrustBundle(args); err != nil {
+				log.Errorf("failed to update the workload trust bundle with the rotated CA roots: %v", err)
+			}
+		})
+	}
 
 	// IstioRA: Explicitly add roots corresponding to RA
 	if s.RA != nil {
@@ -1199,8 +1230,15 @@ func (s *Server) initWorkloadTrustBundle(args *PilotArgs) error {
 }
 
 // isDisableCa returns whether CA functionality is disabled in istiod.
-// It return true only if istiod certs is signed by Kubernetes and
-// workload certs are signed by external CA
+// It return true only if workload certs are signed by external CA, and either
+// istiod certs is signed by Kubernetes or the external CA is an HTTP signer,
+// which must not be backed by a signing key held by istiod.
 func (s *Server) isDisableCa() bool {
-	return features.PilotCertProvider == constants.CertProviderKubernetes && s.RA != nil
+	if s.RA == nil {
+		return false
+	}
+	if _, ok := s.RA.(*ra.HTTPRA); ok {
+		return true
+	}
+	return features.PilotCertProvider == constants.CertProviderKubernetes
 }
@@ -15,29 +15,85 @@
 package monitor
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 
+	kubeyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/api/meta/v1alpha1"
 	"istio.io/istio/pilot/pkg/config/kube/crd"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/collection"
 	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/schema/resource"
 	"istio.io/pkg/log"
 )
 
 var supportedExtensions = map[string]bool{
 	".yaml": true,
 	".yml":  true,
+	".json": true,
 }
 
+// AcceptedCondition is the type of the status condition reporting whether a resource read from a file was accepted.
+const AcceptedCondition = "Accepted"
+
+// kustomizationFiles are the file names kustomize recognizes as a kustomization.
+var kustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
 // FileSnapshot holds a reference to a file directory that contains crd
 // config and filter criteria for which of those configs will be parsed.
 type FileSnapshot struct {
 	root             string
 	domainSuffix     string
 	configTypeFilter map[config.GroupVersionKind]bool
+
+	mu sync.Mutex
+	// accepted holds the last accepted version of each config, keyed by config.Key.
+	accepted map[string]*config.Config
+	// rejections holds the resources rejected by the last snapshot.
+	rejections []Rejection
+	// sources holds the resources returned by the last snapshot.
+	sources []Source
+}
+
+// Source is a resource returned by a snapshot, and where it was read from.
+type Source struct {
+	// Path is the file, or kustomization directory, the resource was read from.
+	Path string
+	// Meta identifies the resource.
+	Meta config.Meta
+}
+
+// Rejection is a resource that was read from a file but not accepted, because it could not be parsed or
+// failed validation.
+type Rejection struct {
+	// Path is the file, or kustomization directory, the resource was read from.
+	Path string
+	// Meta identifies the resource, as far as it could be parsed.
+	Meta config.Meta
+	// Error is the reason the resource was rejected.
+	Error error
+}
+
+// Key returns the config.Key of the rejected resource, or an empty string if it could not be identified.
+func (r Rejection) Key() string {
+	if r.Meta.Name == "" {
+		return ""
+	}
+	return (&config.Config{Meta: r.Meta}).Key()
 }
 
 // NewFileSnapshot returns a snapshotter.
@@ -47,6 +103,7 @@ func NewFileSnapshot(root string, schemas collection.Schemas, domainSuffix strin
 		root:             root,
 		domainSuffix:     domainSuffix,
 		configTypeFilter: make(map[config.GroupVersionKind]bool),
+		accepted:         make(map[string]*config.Config),
 	}
 
 	ss := schemas.All()
@@ -65,55 +122,325 @@ func NewFileSnapshot(root string, schemas collection.Schemas, domainSuffix strin
 
 // ReadConfigFiles parses files in the root directory and returns a sorted slice of
 // eligible model.Config. This can be used as a configFunc when creating a Monitor.
+//
+// Directories containing a kustomization are built with kustomize rather than read file by file, and
+// directories containing a Chart.yaml are skipped, as they hold unrendered Helm templates; the output
+// of helm template is read like any other file. Files may be YAML or JSON, and may contain multiple
+// documents or lists of resources.
+//
+// Resources that fail to parse or validate are rejected individually; see Rejections. If an earlier
+// version of a rejected resource was accepted, that version is kept, with the rejection reported in
+// its status.
 func (f *FileSnapshot) ReadConfigFiles() ([]*config.Config, error) {
+	inputs, err := f.readInputs()
+	if err != nil {
+		log.Warnf("failure during filepath.Walk: %v", err)
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	var result []*config.Config
+	var rejections []Rejection
+	var sources []Source
+	accepted := make(map[string]*config.Config)
+	paths := make(map[string]string)
+	for _, in := range inputs {
+		configs, rejected := parseInputs(in.path, in.data, f.domainSuffix, f.configTypeFilter)
+		for _, cfg := range configs {
+			if path, found := paths[cfg.Key()]; found {
+				rejected = append(rejected, Rejection{
+					Path:  in.path,
+					Meta:  cfg.Meta,
+					Error: fmt.Errorf("duplicate resource, already read from %s", path),
+				})
+				continue
+			}
+			paths[cfg.Key()] = in.path
+			accepted[cfg.Key()] = cfg
+			result = append(result, cfg)
+			sources = append(sources, Source{Path: in.path, Meta: cfg.Meta})
+		}
+		rejections = append(rejections, rejected...)
+	}
+
+	for _, r := range rejections {
+		log.Warnf("Rejected %s %s/%s from %s: %v", r.Meta.GroupVersionKind.Kind, r.Meta.Namespace, r.Meta.Name, r.Path, r.Error)
+		key := r.Key()
+		if key == "" {
+			continue
+		}
+		prev := f.accepted[key]
+		if prev == nil || accepted[key] != nil {
+			continue
+		}
+		// Keep serving the last accepted version, and report why the new version was rejected.
+		cpy := prev.DeepCopy()
+		status := r.Status()
+		status.Conditions[0].Message = "the latest version was rejected, serving the previous version: " + r.Error.Error()
+		cpy.Status = status
+		accepted[key] = prev
+		result = append(result, &cpy)
+		sources = append(sources, Source{Path: r.Path, Meta: cpy.Meta})
+	}
 
+	f.accepted = accepted
+	f.rejections = rejections
+	f.sources = sources
+
+	// Sort by the config IDs.
+	sort.Sort(byKey(result))
+	return result, nil
+}
+
+// Rejections returns the resources rejected by the last call to ReadConfigFiles.
+func (f *FileSnapshot) Rejections() []Rejection {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Rejection(nil), f.rejections...)
+}
+
+// Sources returns the resources returned by the last call to ReadConfigFiles, and where they were read from.
+func (f *FileSnapshot) Sources() []Source {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Source(nil), f.sources...)
+}
+
+// fileInput is the content of a file, or the output of a kustomization, to be parsed.
+type fileInput struct {
+	path string
+	data []byte
+}
+
+func (f *FileSnapshot) readInputs() ([]fileInput, error) {
+	var files []string
+	var kustomizations []string
 	err := filepath.Walk(f.root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
-		} else if !supportedExtensions[filepath.Ext(path)] || (info.Mode()&os.ModeType) != 0 {
+		}
+		if info.IsDir() {
+			if fileExists(filepath.Join(path, "Chart.yaml")) {
+				log.Warnf("Skipping %s: Helm charts must be rendered with helm template", path)
+				return filepath.SkipDir
+			}
+			if kustomizationFile(path) != "" {
+				kustomizations = append(kustomizations, path)
+				return filepath.SkipDir
+			}
 			return nil
 		}
+		if !supportedExtensions[filepath.Ext(path)] || (info.Mode()&os.ModeType) != 0 || isStatusFile(path) {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Directories referenced by a kustomization are only read as part of it.
+	referenced := map[string]bool{}
+	for _, dir := range kustomizations {
+		for _, ref := range kustomizationReferences(dir) {
+			referenced[ref] = true
+		}
+	}
+
+	var inputs []fileInput
+	for _, path := range files {
+		if isReferenced(referenced, path) {
+			continue
+		}
 		data, err := ioutil.ReadFile(path)
 		if err != nil {
 			log.Warnf("Failed to read %s: %v", path, err)
-			return err
+			return nil, err
+		}
+		inputs = append(inputs, fileInput{path: path, data: data})
+	}
+
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	for _, dir := range kustomizations {
+		if referenced[dir] {
+			continue
 		}
-		configs, err := parseInputs(data, f.domainSuffix)
+		resources, err := kustomizer.Run(filesys.MakeFsOnDisk(), dir)
 		if err != nil {
-			log.Warnf("Failed to parse %s: %v", path, err)
-			return err
+			log.Warnf("Failed to build kustomization %s: %v", dir, err)
+			return nil, err
+		}
+		data, err := resources.AsYaml()
+		if err != nil {
+			return nil, err
 		}
+		inputs = append(inputs, fileInput{path: dir, data: data})
+	}
+	return inputs, nil
+}
 
-		// Filter any unsupported types before appending to the result.
-		for _, cfg := range configs {
-			if !f.configTypeFilter[cfg.GroupVersionKind] {
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// kustomizationFile returns the kustomization file in dir, or an empty string if there is none.
+func kustomizationFile(dir string) string {
+	for _, name := range kustomizationFiles {
+		if path := filepath.Join(dir, name); fileExists(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// kustomizationReferences returns the local directories the kustomization in dir builds upon.
+func kustomizationReferences(dir string) []string {
+	data, err := ioutil.ReadFile(kustomizationFile(dir))
+	if err != nil {
+		return nil
+	}
+	k := struct {
+		Resources  []string `json:"resources"`
+		Bases      []string `json:"bases"`
+		Components []string `json:"components"`
+	}{}
+	if err := yaml.Unmarshal(data, &k); err != nil {
+		// kustomize will report the error when building.
+		return nil
+	}
+	var refs []string
+	for _, ref := range append(append(k.Resources, k.Bases...), k.Components...) {
+		path := filepath.Clean(filepath.Join(dir, ref))
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			refs = append(refs, path)
+		}
+	}
+	return refs
+}
+
+func isReferenced(referenced map[string]bool, path string) bool {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if referenced[dir] {
+			return true
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return false
+		}
+	}
+}
+
+// parseInputs parses every resource in data, which may contain multiple YAML documents or a JSON object, and
+// returns the configs of the types in filter. Resources that fail to parse or validate are rejected.
+// Resources that are not Istio configs, such as the Deployments in Helm output, are ignored.
+func parseInputs(path string, data []byte, domainSuffix string,
+	filter map[config.GroupVersionKind]bool) ([]*config.Config, []Rejection) {
+	var configs []*config.Config
+	var rejections []Rejection
+	reader := kubeyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rejections = append(rejections, Rejection{Path: path, Error: err})
+			break
+		}
+		objs, err := splitList(doc)
+		if err != nil {
+			rejections = append(rejections, Rejection{Path: path, Error: fmt.Errorf("cannot parse document: %v", err)})
+			continue
+		}
+		for _, obj := range objs {
+			cfg, err := convertObject(obj, domainSuffix)
+			if err != nil {
+				rejections = append(rejections, Rejection{Path: path, Meta: objectMeta(obj), Error: err})
 				continue
 			}
-			result = append(result, cfg)
+			if cfg == nil || !filter[cfg.GroupVersionKind] {
+				continue
+			}
+			configs = append(configs, cfg)
 		}
-		return nil
-	})
-	if err != nil {
-		log.Warnf("failure during filepath.Walk: %v", err)
 	}
+	return configs, rejections
+}
 
-	// Sort by the config IDs.
-	sort.Sort(byKey(result))
-	return result, err
+// splitList parses a document, expanding lists into their items.
+func splitList(doc []byte) ([]*crd.IstioKind, error) {
+	list := struct {
+		Kind  string            `json:"kind"`
+		Items []json.RawMessage `json:"items"`
+	}{}
+	if err := yaml.Unmarshal(doc, &list); err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(list.Kind, "List") || list.Items == nil {
+		obj := &crd.IstioKind{}
+		if err := yaml.Unmarshal(doc, obj); err != nil {
+			return nil, err
+		}
+		return []*crd.IstioKind{obj}, nil
+	}
+	objs := make([]*crd.IstioKind, 0, len(list.Items))
+	for _, item := range list.Items {
+		obj := &crd.IstioKind{}
+		if err := json.Unmarshal(item, obj); err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// convertObject converts and validates an object. It returns nil if the object is not an Istio config.
+func convertObject(obj *crd.IstioKind, domainSuffix string) (*config.Config, error) {
+	if obj.Kind == "" && obj.Name == "" && obj.Spec == nil {
+		// Empty document
+		return nil, nil
+	}
+	kgvk := obj.GroupVersionKind()
+	s, exists := collections.PilotServiceApi.FindByGroupVersionKind(resource.FromKubernetesGVK(&kgvk))
+	if !exists {
+		log.Debugf("unrecognized type %v", obj.Kind)
+		return nil, nil
+	}
+	cfg, err := crd.ConvertObject(s, obj, domainSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse proto message: %v", err)
+	}
+	if _, err := s.Resource().ValidateConfig(*cfg); err != nil {
+		return nil, fmt.Errorf("configuration is invalid: %v", err)
+	}
+	return cfg, nil
 }
 
-// parseInputs is identical to crd.ParseInputs, except that it returns an array of config pointers.
-func parseInputs(data []byte, domainSuffix string) ([]*config.Config, error) {
-	configs, _, err := crd.ParseInputs(string(data))
+// objectMeta identifies an object that could not be converted.
+func objectMeta(obj *crd.IstioKind) config.Meta {
+	meta := config.Meta{Name: obj.Name, Namespace: obj.Namespace}
+	kgvk := obj.GroupVersionKind()
+	if s, exists := collections.PilotServiceApi.FindByGroupVersionKind(resource.FromKubernetesGVK(&kgvk)); exists {
+		meta.GroupVersionKind = s.Resource().GroupVersionKind()
+	} else {
+		meta.GroupVersionKind = config.GroupVersionKind{Group: kgvk.Group, Version: kgvk.Version, Kind: kgvk.Kind}
+	}
+	return meta
+}
 
-	// Convert to an array of pointers.
-	refs := make([]*config.Config, len(configs))
-	for i := range configs {
-		refs[i] = &configs[i]
-		refs[i].Domain = domainSuffix
+// Status returns the status reporting the rejection.
+func (r Rejection) Status() *v1alpha1.IstioStatus {
+	return &v1alpha1.IstioStatus{
+		Conditions: []*v1alpha1.IstioCondition{{
+			Type:    AcceptedCondition,
+			Status:  "False",
+			Reason:  "Invalid",
+			Message: r.Error.Error(),
+		}},
 	}
-	return refs, err
 }
 
 // byKey is an array of config objects that is capable or sorting by Namespace, GroupVersionKind, and Name.
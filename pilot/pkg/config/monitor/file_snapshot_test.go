@@ -18,14 +18,18 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/onsi/gomega"
 
+	"istio.io/api/meta/v1alpha1"
 	networking "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/config/monitor"
+	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/collection"
 	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/schema/gvk"
 )
 
 var gatewayYAML = `
@@ -126,6 +130,178 @@ func TestFileSnapshotSorting(t *testing.T) {
 	g.Expect(configs[1].Spec).To(gomega.BeAssignableToTypeOf(&networking.VirtualService{}))
 }
 
+var gatewayJSON = `{
+  "apiVersion": "networking.istio.io/v1alpha3",
+  "kind": "List",
+  "items": [
+    {
+      "apiVersion": "networking.istio.io/v1alpha3",
+      "kind": "Gateway",
+      "metadata": {"name": "json-ingress", "namespace": "ns1"},
+      "spec": {"servers": [{"port": {"number": 443, "name": "https", "protocol": "HTTPS"}, "hosts": ["*"],
+        "tls": {"mode": "PASSTHROUGH"}}]}
+    },
+    {
+      "apiVersion": "networking.istio.io/v1alpha3",
+      "kind": "Gateway",
+      "metadata": {"name": "json-egress", "namespace": "ns1"},
+      "spec": {"servers": [{"port": {"number": 80, "name": "http", "protocol": "HTTP"}, "hosts": ["*"]}]}
+    }
+  ]
+}`
+
+// invalidVirtualServiceYAML has a route without a destination host, so fails validation.
+var invalidVirtualServiceYAML = `
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: route-for-myapp
+spec:
+  hosts:
+  - some.example.com
+  http:
+  - route:
+    - destination:
+        host: ""
+`
+
+func TestFileSnapshotRecursive(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	ts := &testState{
+		ConfigFiles: map[string][]byte{
+			"a/b/gateway.yml":  []byte(gatewayYAML),
+			"a/c/gateway.json": []byte(gatewayJSON),
+			"a/c/ignored.txt":  []byte("not config"),
+		},
+	}
+
+	ts.testSetup(t)
+	defer ts.testTeardown(t)
+
+	fileWatcher := monitor.NewFileSnapshot(ts.rootPath, collection.SchemasFor(), "")
+	configs, err := fileWatcher.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(fileWatcher.Rejections()).To(gomega.BeEmpty())
+	g.Expect(configNames(configs)).To(gomega.Equal([]string{"some-ingress", "json-egress", "json-ingress"}))
+}
+
+func TestFileSnapshotRejections(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	ts := &testState{
+		ConfigFiles: map[string][]byte{
+			"configs.yaml": []byte(gatewayYAML + "\n---\n" + virtualServiceYAML),
+		},
+	}
+
+	ts.testSetup(t)
+	defer ts.testTeardown(t)
+
+	fileWatcher := monitor.NewFileSnapshot(ts.rootPath, collection.SchemasFor(), "")
+	configs, err := fileWatcher.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(2))
+	g.Expect(configs[1].Status).To(gomega.BeNil())
+
+	// An invalid update is rejected, and the previous version kept with the rejection as its status. A new invalid
+	// resource, and a document that cannot be parsed, are rejected without affecting the rest of the file.
+	newInvalid := strings.Replace(invalidVirtualServiceYAML, "route-for-myapp", "new-route", 1)
+	ts.writeFile(t, "configs.yaml", gatewayYAML+"\n---\n"+invalidVirtualServiceYAML+"\n---\n"+newInvalid+"\n---\n{not: yaml: [")
+	configs, err = fileWatcher.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configNames(configs)).To(gomega.Equal([]string{"some-ingress", "route-for-myapp"}))
+	g.Expect(configs[1].Spec.(*networking.VirtualService).Hosts).To(gomega.Equal([]string{"some.example.com"}))
+	status := configs[1].Status.(*v1alpha1.IstioStatus)
+	g.Expect(status.Conditions[0].Type).To(gomega.Equal("Accepted"))
+	g.Expect(status.Conditions[0].Status).To(gomega.Equal("False"))
+
+	rejections := fileWatcher.Rejections()
+	g.Expect(rejections).To(gomega.HaveLen(3))
+	g.Expect(rejections[0].Meta.Name).To(gomega.Equal("route-for-myapp"))
+	g.Expect(rejections[0].Meta.GroupVersionKind).To(gomega.Equal(gvk.VirtualService))
+	g.Expect(rejections[1].Meta.Name).To(gomega.Equal("new-route"))
+	g.Expect(rejections[2].Meta.Name).To(gomega.BeEmpty())
+
+	// Once fixed, the resource is accepted again.
+	ts.writeFile(t, "configs.yaml", gatewayYAML+"\n---\n"+virtualServiceYAML)
+	configs, err = fileWatcher.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(2))
+	g.Expect(configs[1].Status).To(gomega.BeNil())
+	g.Expect(fileWatcher.Rejections()).To(gomega.BeEmpty())
+}
+
+func TestFileSnapshotKustomize(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	ts := &testState{
+		ConfigFiles: map[string][]byte{
+			"base/gateway.yaml": []byte(gatewayYAML),
+			"base/kustomization.yaml": []byte(`
+resources:
+- gateway.yaml
+`),
+			"overlays/prod/kustomization.yaml": []byte(`
+namespace: prod
+namePrefix: prod-
+resources:
+- ../../base
+`),
+		},
+	}
+
+	ts.testSetup(t)
+	defer ts.testTeardown(t)
+
+	fileWatcher := monitor.NewFileSnapshot(ts.rootPath, collection.SchemasFor(), "")
+	configs, err := fileWatcher.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(1))
+	g.Expect(configs[0].Name).To(gomega.Equal("prod-some-ingress"))
+	g.Expect(configs[0].Namespace).To(gomega.Equal("prod"))
+}
+
+func TestFileSnapshotHelmOutput(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	ts := &testState{
+		ConfigFiles: map[string][]byte{
+			// Output of helm template --output-dir
+			"rendered/mychart/templates/gateway.yaml": []byte("---\n# Source: mychart/templates/gateway.yaml\n" + gatewayYAML),
+			"rendered/mychart/templates/deployment.yaml": []byte(`---
+# Source: mychart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+spec:
+  replicas: 1
+`),
+			// An unrendered chart is skipped
+			"mychart/Chart.yaml":             []byte("name: mychart\nversion: 0.1.0\n"),
+			"mychart/templates/gateway.yaml": []byte("{{- if .Values.enabled }}\n" + gatewayYAML + "{{- end }}\n"),
+		},
+	}
+
+	ts.testSetup(t)
+	defer ts.testTeardown(t)
+
+	fileWatcher := monitor.NewFileSnapshot(ts.rootPath, collection.SchemasFor(), "")
+	configs, err := fileWatcher.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(fileWatcher.Rejections()).To(gomega.BeEmpty())
+	g.Expect(configNames(configs)).To(gomega.Equal([]string{"some-ingress"}))
+}
+
+func configNames(configs []*config.Config) []string {
+	names := make([]string, 0, len(configs))
+	for _, c := range configs {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
 type testState struct {
 	ConfigFiles map[string][]byte
 	rootPath    string
@@ -140,13 +316,23 @@ func (ts *testState) testSetup(t *testing.T) {
 	}
 
 	for name, content := range ts.ConfigFiles {
-		err = ioutil.WriteFile(filepath.Join(ts.rootPath, name), content, 0o600)
+		path := filepath.Join(ts.rootPath, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, content, 0o600)
 		if err != nil {
 			t.Fatal(err)
 		}
 	}
 }
 
+func (ts *testState) writeFile(t *testing.T, name string, content string) {
+	if err := ioutil.WriteFile(filepath.Join(ts.rootPath, name), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func (ts *testState) testTeardown(t *testing.T) {
 	err := os.RemoveAll(ts.rootPath)
 	if err != nil {
@@ -0,0 +1,253 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/pkg/log"
+)
+
+const (
+	// GitCommitAnnotation is set on configs read from a git repository to the commit that last changed the config.
+	GitCommitAnnotation = "config.istio.io/git-commit"
+
+	// GitWebhookSignatureHeader is the header holding the HMAC-SHA256 signature of the body of a webhook call,
+	// in the format used by GitHub and Gitea: "sha256=" followed by the hex encoded signature.
+	GitWebhookSignatureHeader = "X-Hub-Signature-256"
+
+	// maxWebhookBodySize is the largest webhook body that is read to verify its signature.
+	maxWebhookBodySize = 25 << 20
+)
+
+var errGitSnapshotClosed = errors.New("git snapshot is closed")
+
+// GitSnapshot holds a reference to a path within a git repository at a ref, and a local checkout of it.
+type GitSnapshot struct {
+	repo  string
+	ref   string
+	dir   string
+	files *FileSnapshot
+
+	mu sync.Mutex
+	// closed is set once the checkout is removed by Close.
+	closed bool
+	// commit is the commit currently checked out in dir.
+	commit string
+	// versions records the content hash of each config, and the commit it was first seen at, so that the
+	// annotation only changes when the config itself does.
+	versions map[string]gitConfigVersion
+}
+
+type gitConfigVersion struct {
+	hash   string
+	commit string
+}
+
+// NewGitSnapshot returns a snapshotter of the configs under path in the repository repo at ref. The repository
+// is cloned into dir, which is reused if it already holds a clone. repo may be any URL supported by git, including
+// a local path.
+func NewGitSnapshot(repo, ref, path, dir string, schemas collection.Schemas, domainSuffix string) *GitSnapshot {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	return &GitSnapshot{
+		repo:     repo,
+		ref:      ref,
+		dir:      dir,
+		files:    NewFileSnapshot(filepath.Join(dir, filepath.FromSlash(path)), schemas, domainSuffix),
+		versions: map[string]gitConfigVersion{},
+	}
+}
+
+// Rejections returns the resources rejected by the last call to ReadConfigFiles.
+func (g *GitSnapshot) Rejections() []Rejection {
+	return g.files.Rejections()
+}
+
+// Commit returns the commit the last snapshot was read at.
+func (g *GitSnapshot) Commit() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.commit
+}
+
+// Close removes the local checkout. The snapshot can no longer be read afterwards.
+func (g *GitSnapshot) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+	return os.RemoveAll(g.dir)
+}
+
+// ReadConfigFiles fetches the ref, checks it out and parses the files under path with a FileSnapshot. This can
+// be used as a configFunc when creating a Monitor.
+func (g *GitSnapshot) ReadConfigFiles() ([]*config.Config, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return nil, errGitSnapshotClosed
+	}
+
+	commit, err := g.sync()
+	if err != nil {
+		return nil, err
+	}
+	configs, err := g.files.ReadConfigFiles()
+	if err != nil {
+		return nil, err
+	}
+	if commit != g.commit {
+		log.Infof("Read %d configs from %s at %s (%s)", len(configs), g.repo, g.ref, commit)
+	}
+	g.commit = commit
+
+	versions := make(map[string]gitConfigVersion, len(configs))
+	for _, cfg := range configs {
+		key := cfg.GroupVersionKind.String() + "/" + cfg.Namespace + "/" + cfg.Name
+		v := gitConfigVersion{hash: configHash(cfg), commit: commit}
+		if prev, f := g.versions[key]; f && prev.hash == v.hash {
+			v.commit = prev.commit
+		}
+		versions[key] = v
+		if cfg.Annotations == nil {
+			cfg.Annotations = map[string]string{}
+		}
+		cfg.Annotations[GitCommitAnnotation] = v.commit
+	}
+	g.versions = versions
+	return configs, nil
+}
+
+// sync brings the checkout up to date with the ref, cloning the repository first if needed, and returns the
+// checked out commit.
+func (g *GitSnapshot) sync() (string, error) {
+	if _, err := os.Stat(filepath.Join(g.dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(g.dir, 0o755); err != nil {
+			return "", err
+		}
+		// The repository is passed after "--", so that it is never parsed as an option.
+		if _, err := g.git("clone", "--quiet", "--no-checkout", "--", g.repo, "."); err != nil {
+			return "", err
+		}
+	} else if _, err := g.git("fetch", "--quiet", "--force", "--tags", "origin"); err != nil {
+		return "", err
+	}
+	commit, err := g.resolve()
+	if err != nil {
+		return "", err
+	}
+	if _, err := g.git("checkout", "--quiet", "--force", "--detach", commit); err != nil {
+		return "", err
+	}
+	if _, err := g.git("clean", "--quiet", "--force", "-d", "-x"); err != nil {
+		return "", err
+	}
+	return commit, nil
+}
+
+// resolve returns the commit the ref points to. Branches are resolved against the remote, so that they follow
+// new commits; anything else, such as a tag or commit, is resolved as is.
+func (g *GitSnapshot) resolve() (string, error) {
+	var lastErr error
+	for _, rev := range []string{"origin/" + g.ref, g.ref} {
+		out, err := g.git("rev-parse", "--quiet", "--verify", rev+"^{commit}")
+		if err == nil {
+			return out, nil
+		}
+		lastErr = err
+	}
+	return "", fmt.Errorf("failed to resolve ref %q of %s: %v", g.ref, g.repo, lastErr)
+}
+
+func (g *GitSnapshot) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.dir
+	// Never prompt for credentials; they must be provided through the git configuration.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// GitWebhookHandler returns a handler for the webhook of a git repository, which calls trigger on POST requests
+// whose body is signed with secret in the GitWebhookSignatureHeader header.
+func GitWebhookHandler(secret string, trigger func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxWebhookBodySize))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !validWebhookSignature(secret, body, req.Header.Get(GitWebhookSignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		trigger()
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func validWebhookSignature(secret string, body []byte, signature string) bool {
+	if secret == "" || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// configHash hashes the parts of a config that are read from a file.
+func configHash(cfg *config.Config) string {
+	h := sha256.New()
+	b, err := json.Marshal(struct {
+		Labels      map[string]string
+		Annotations map[string]string
+		Spec        config.Spec
+	}{cfg.Labels, cfg.Annotations, cfg.Spec})
+	if err != nil {
+		b = []byte(fmt.Sprintf("%+v", cfg))
+	}
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
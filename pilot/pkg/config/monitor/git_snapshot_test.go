@@ -0,0 +1,220 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"istio.io/istio/pilot/pkg/config/monitor"
+	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+// gitRepo is a bare repository on local disk, with a working copy to commit to it from.
+type gitRepo struct {
+	t    *testing.T
+	bare string
+	work string
+}
+
+func newGitRepo(t *testing.T) *gitRepo {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	r := &gitRepo{t: t, bare: filepath.Join(dir, "repo.git"), work: filepath.Join(dir, "work")}
+	r.run(dir, "init", "--quiet", "--bare", r.bare)
+	r.run(dir, "clone", "--quiet", r.bare, r.work)
+	r.run(r.work, "checkout", "--quiet", "-b", "main")
+	return r
+}
+
+func (r *gitRepo) run(dir string, args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit writes files, where an empty content removes the file, and pushes the commit to the bare repository.
+func (r *gitRepo) commit(files map[string]string) string {
+	r.t.Helper()
+	for name, content := range files {
+		path := filepath.Join(r.work, name)
+		if content == "" {
+			if err := os.Remove(path); err != nil {
+				r.t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	r.run(r.work, "add", "-A")
+	r.run(r.work, "commit", "--quiet", "--allow-empty", "-m", "update")
+	r.run(r.work, "push", "--quiet", "origin", "main")
+	return r.run(r.work, "rev-parse", "HEAD")
+}
+
+func TestGitSnapshot(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := newGitRepo(t)
+	first := repo.commit(map[string]string{
+		"istio/gateway.yml":  gatewayYAML,
+		"istio/vs.yaml":      virtualServiceYAML,
+		"other/ignored.yaml": gatewayYAML,
+	})
+
+	schemas := collection.SchemasFor(collections.IstioNetworkingV1Alpha3Gateways, collections.IstioNetworkingV1Alpha3Virtualservices)
+	snapshot := monitor.NewGitSnapshot(repo.bare, "main", "istio", filepath.Join(t.TempDir(), "clone"), schemas, "")
+
+	configs, err := snapshot.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(2))
+	g.Expect(snapshot.Commit()).To(gomega.Equal(first))
+	for _, cfg := range configs {
+		g.Expect(cfg.Annotations[monitor.GitCommitAnnotation]).To(gomega.Equal(first))
+	}
+
+	// Only the changed config is annotated with the new commit.
+	second := repo.commit(map[string]string{
+		"istio/vs.yaml": strings.Replace(virtualServiceYAML, "some.example.internal", "other.example.internal", 1),
+	})
+	configs, err = snapshot.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(2))
+	g.Expect(snapshot.Commit()).To(gomega.Equal(second))
+	commits := map[string]string{}
+	for _, cfg := range configs {
+		commits[cfg.Name] = cfg.Annotations[monitor.GitCommitAnnotation]
+	}
+	g.Expect(commits).To(gomega.Equal(map[string]string{
+		"some-ingress":    first,
+		"route-for-myapp": second,
+	}))
+
+	// Removed files are removed from the snapshot.
+	third := repo.commit(map[string]string{"istio/gateway.yml": ""})
+	configs, err = snapshot.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(1))
+	g.Expect(configs[0].Name).To(gomega.Equal("route-for-myapp"))
+	g.Expect(snapshot.Commit()).To(gomega.Equal(third))
+
+	// A commit can be checked out directly.
+	pinned := monitor.NewGitSnapshot(repo.bare, first, "istio", filepath.Join(t.TempDir(), "clone"), schemas, "")
+	configs, err = pinned.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(2))
+	g.Expect(pinned.Commit()).To(gomega.Equal(first))
+}
+
+func TestGitSnapshotUnknownRef(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := newGitRepo(t)
+	repo.commit(map[string]string{"gateway.yaml": gatewayYAML})
+
+	snapshot := monitor.NewGitSnapshot(repo.bare, "missing", "", filepath.Join(t.TempDir(), "clone"), collection.SchemasFor(), "")
+	_, err := snapshot.ReadConfigFiles()
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestGitSnapshotRepoIsNotAnOption(t *testing.T) {
+	g := gomega.NewWithT(t)
+	newGitRepo(t)
+
+	// A repository that looks like an option is cloned as a repository, rather than passed to git as an option.
+	snapshot := monitor.NewGitSnapshot("--upload-pack=touch", "", "", filepath.Join(t.TempDir(), "clone"),
+		collection.SchemasFor(), "")
+	_, err := snapshot.ReadConfigFiles()
+	g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("repository '--upload-pack=touch' does not exist")))
+}
+
+func TestGitSnapshotClose(t *testing.T) {
+	g := gomega.NewWithT(t)
+	repo := newGitRepo(t)
+	repo.commit(map[string]string{"gateway.yaml": gatewayYAML})
+
+	dir := filepath.Join(t.TempDir(), "clone")
+	snapshot := monitor.NewGitSnapshot(repo.bare, "main", "", dir, collection.SchemasFor(), "")
+	_, err := snapshot.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(snapshot.Close()).To(gomega.Succeed())
+	_, err = os.Stat(dir)
+	g.Expect(os.IsNotExist(err)).To(gomega.BeTrue())
+	_, err = snapshot.ReadConfigFiles()
+	g.Expect(err).To(gomega.HaveOccurred())
+	_, err = os.Stat(dir)
+	g.Expect(os.IsNotExist(err)).To(gomega.BeTrue())
+}
+
+func TestGitWebhookHandler(t *testing.T) {
+	const body = `{"ref":"refs/heads/main"}`
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	cases := []struct {
+		name      string
+		method    string
+		signature string
+		code      int
+	}{
+		{name: "signed", method: http.MethodPost, signature: sign("secret"), code: http.StatusAccepted},
+		{name: "unsigned", method: http.MethodPost, code: http.StatusUnauthorized},
+		{name: "wrong secret", method: http.MethodPost, signature: sign("other"), code: http.StatusUnauthorized},
+		{name: "malformed signature", method: http.MethodPost, signature: "sha256=zz", code: http.StatusUnauthorized},
+		{name: "get", method: http.MethodGet, signature: sign("secret"), code: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			triggered := false
+			handler := monitor.GitWebhookHandler("secret", func() { triggered = true })
+			req := httptest.NewRequest(tt.method, "/git", strings.NewReader(body))
+			if tt.signature != "" {
+				req.Header.Set(monitor.GitWebhookSignatureHeader, tt.signature)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.code {
+				t.Errorf("got status %d, want %d", rec.Code, tt.code)
+			}
+			if triggered != (tt.code == http.StatusAccepted) {
+				t.Errorf("got triggered %v for status %d", triggered, rec.Code)
+			}
+		})
+	}
+}
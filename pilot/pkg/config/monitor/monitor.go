@@ -37,6 +37,8 @@ type Monitor struct {
 	// channel to trigger updates on
 	// generally set to a file watch, but used in tests as well
 	updateCh chan struct{}
+	// pollInterval, if set, triggers an update periodically instead of watching root for changes.
+	pollInterval time.Duration
 }
 
 // NewMonitor creates a Monitor and will delegate to a passed in controller.
@@ -48,10 +50,20 @@ func NewMonitor(name string, delegateStore model.ConfigStore, getSnapshotFunc fu
 		root:            root,
 		store:           delegateStore,
 		getSnapshotFunc: getSnapshotFunc,
+		updateCh:        make(chan struct{}, 1),
 	}
 	return monitor
 }
 
+// NewPollingMonitor creates a Monitor that checks the getSnapshotFunc for changes on the given interval, and whenever
+// Trigger is called, rather than watching files.
+func NewPollingMonitor(name string, delegateStore model.ConfigStore, getSnapshotFunc func() ([]*config.Config, error),
+	interval time.Duration) *Monitor {
+	monitor := NewMonitor(name, delegateStore, getSnapshotFunc, "")
+	monitor.pollInterval = interval
+	return monitor
+}
+
 const watchDebounceDelay = 50 * time.Millisecond
 
 // Trigger notifications when a file is mutated
@@ -71,7 +83,11 @@ func fileTrigger(path string, ch chan struct{}, stop <-chan struct{}) error {
 			case <-debounceC:
 				debounceC = nil
 				ch <- struct{}{}
-			case <-watcher.Events:
+			case event := <-watcher.Events:
+				// Status files are written by the monitor itself, and must not trigger a reload.
+				if isStatusFile(event.Name) {
+					continue
+				}
 				if debounceC == nil {
 					debounceC = time.After(watchDebounceDelay)
 				}
@@ -93,9 +109,10 @@ func fileTrigger(path string, ch chan struct{}, stop <-chan struct{}) error {
 func (m *Monitor) Start(stop <-chan struct{}) {
 	m.checkAndUpdate()
 
-	c := make(chan struct{}, 1)
-	m.updateCh = c
-	if err := fileTrigger(m.root, m.updateCh, stop); err != nil {
+	c := m.updateCh
+	if m.pollInterval > 0 {
+		go pollTrigger(m.pollInterval, c, stop)
+	} else if err := fileTrigger(m.root, m.updateCh, stop); err != nil {
 		log.Errorf("Unable to setup FileTrigger for %s: %v", m.root, err)
 	}
 	// Run the close loop asynchronously.
@@ -103,7 +120,7 @@ func (m *Monitor) Start(stop <-chan struct{}) {
 		for {
 			select {
 			case <-c:
-				log.Infof("Triggering reload of file configuration")
+				log.Infof("Triggering reload of configuration for %s", m.name)
 				m.checkAndUpdate()
 			case <-stop:
 				return
@@ -112,6 +129,31 @@ func (m *Monitor) Start(stop <-chan struct{}) {
 	}()
 }
 
+// Trigger requests an asynchronous check of the getSnapshotFunc. Multiple requests made before the check
+// runs are coalesced.
+func (m *Monitor) Trigger() {
+	select {
+	case m.updateCh <- struct{}{}:
+	default:
+	}
+}
+
+func pollTrigger(interval time.Duration, ch chan struct{}, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
 func (m *Monitor) checkAndUpdate() {
 	newConfigs, err := m.getSnapshotFunc()
 	// If an error exists then log it and return to running the check and update
@@ -146,7 +188,11 @@ func (m *Monitor) checkAndUpdate() {
 			// version may change without content changing
 			oldConfig.Meta.ResourceVersion = newConfig.Meta.ResourceVersion
 			if !reflect.DeepEqual(oldConfig, newConfig) {
-				m.updateConfig(newConfig)
+				if statusOnlyChange(oldConfig, newConfig) {
+					m.updateConfigStatus(newConfig)
+				} else {
+					m.updateConfig(newConfig)
+				}
 			}
 			oldIndex++
 			newIndex++
@@ -185,6 +231,24 @@ func (m *Monitor) updateConfig(c *config.Config) {
 	}
 }
 
+func (m *Monitor) updateConfigStatus(c *config.Config) {
+	if prev := m.store.Get(c.GroupVersionKind, c.Name, c.Namespace); prev != nil {
+		c.ResourceVersion = prev.ResourceVersion
+		c.CreationTimestamp = prev.CreationTimestamp
+	}
+
+	if _, err := m.store.UpdateStatus(*c); err != nil {
+		log.Warnf("Failed to update config status (%+v): %v ", *c, err)
+	}
+}
+
+// statusOnlyChange returns true if the configs differ only in status.
+func statusOnlyChange(a, b *config.Config) bool {
+	cpy := *a
+	cpy.Status = b.Status
+	return reflect.DeepEqual(&cpy, b)
+}
+
 func (m *Monitor) deleteConfig(c *config.Config) {
 	if err := m.store.Delete(c.GroupVersionKind, c.Name, c.Namespace, nil); err != nil {
 		log.Warnf("Failed to delete config (%+v): %v ", *c, err)
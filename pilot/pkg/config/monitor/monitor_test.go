@@ -16,11 +16,15 @@ package monitor
 
 import (
 	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/onsi/gomega"
 
+	"istio.io/api/meta/v1alpha1"
 	networking "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/config/memory"
 	"istio.io/istio/pkg/config"
@@ -202,3 +206,71 @@ func TestMonitorForError(t *testing.T) {
 		return nil
 	}).Should(gomega.Succeed())
 }
+
+func TestPollingMonitor(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	store := memory.Make(collection.SchemasFor(collections.IstioNetworkingV1Alpha3Gateways))
+
+	var configs atomic.Value
+	configs.Store(createConfigSet)
+	someConfigFunc := func() ([]*config.Config, error) {
+		return configs.Load().([]*config.Config), nil
+	}
+	mon := NewPollingMonitor("", store, someConfigFunc, time.Hour)
+	stop := make(chan struct{})
+	defer func() { close(stop) }()
+	mon.Start(stop)
+
+	c, err := store.List(gvk.Gateway, "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(c).To(gomega.HaveLen(1))
+
+	// Nothing is polled until the interval, but Trigger forces an update.
+	configs.Store([]*config.Config{})
+	mon.Trigger()
+	g.Eventually(func() []config.Config {
+		c, _ := store.List(gvk.Gateway, "")
+		return c
+	}).Should(gomega.BeEmpty())
+}
+
+func TestMonitorStatusOnlyChange(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	store := memory.Make(collection.SchemasFor(collections.IstioNetworkingV1Alpha3Gateways))
+
+	withStatus := createConfigSet[0].DeepCopy()
+	withStatus.Status = &v1alpha1.IstioStatus{
+		Conditions: []*v1alpha1.IstioCondition{{Type: "Accepted", Status: "False"}},
+	}
+	var configs atomic.Value
+	configs.Store(createConfigSet)
+	mon := NewPollingMonitor("", store, func() ([]*config.Config, error) {
+		return configs.Load().([]*config.Config), nil
+	}, time.Hour)
+	stop := make(chan struct{})
+	defer func() { close(stop) }()
+	mon.Start(stop)
+
+	configs.Store([]*config.Config{&withStatus})
+	mon.Trigger()
+	g.Eventually(func() config.Status {
+		return store.Get(gvk.Gateway, "magic", "").Status
+	}).Should(gomega.Equal(withStatus.Status))
+}
+
+func TestFileTriggerIgnoresStatusFiles(t *testing.T) {
+	g := gomega.NewWithT(t)
+	dir := t.TempDir()
+	ch := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	g.Expect(fileTrigger(dir, ch, stop)).To(gomega.Succeed())
+
+	g.Expect(writeFileAtomic(filepath.Join(dir, "gateway.yaml"+StatusFileSuffix), []byte("{}"))).To(gomega.Succeed())
+	g.Consistently(ch, 4*watchDebounceDelay).ShouldNot(gomega.Receive())
+
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "gateway.yaml"), []byte("{}"), 0o644)).To(gomega.Succeed())
+	g.Eventually(ch).Should(gomega.Receive())
+}
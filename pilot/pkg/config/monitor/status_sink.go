@@ -0,0 +1,280 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"istio.io/api/meta/v1alpha1"
+	"istio.io/istio/pkg/config"
+	"istio.io/pkg/log"
+)
+
+// StatusFileSuffix is the suffix of the files that status is written to. These files are never read as config, and
+// changes to them do not trigger a reload.
+const StatusFileSuffix = ".status.json"
+
+// FileStatusSink writes the status of the resources read by a FileSnapshot to a JSON file beside the file each
+// resource was read from. For a file gateway.yaml, status is written to gateway.yaml.status.json; for a
+// kustomization, to kustomization.status.json in its directory.
+type FileStatusSink struct {
+	snapshot *FileSnapshot
+
+	mu sync.Mutex
+	// paths maps the key of each resource to the status file of the file it was read from.
+	paths map[string]string
+	// files holds the content of each status file.
+	files map[string]*statusFile
+	// written holds the last content written to each status file.
+	written map[string][]byte
+}
+
+// statusFile is the format of a status file.
+type statusFile struct {
+	Resources []*resourceStatus `json:"resources,omitempty"`
+	// Errors lists the documents that could not be parsed well enough to identify the resource.
+	Errors []string `json:"errors,omitempty"`
+}
+
+type resourceStatus struct {
+	Kind      string                `json:"kind"`
+	Namespace string                `json:"namespace,omitempty"`
+	Name      string                `json:"name"`
+	Status    *v1alpha1.IstioStatus `json:"status"`
+
+	key string
+}
+
+// NewFileStatusSink returns a sink that writes status beside the files read by snapshot.
+func NewFileStatusSink(snapshot *FileSnapshot) *FileStatusSink {
+	return &FileStatusSink{
+		snapshot: snapshot,
+		paths:    map[string]string{},
+		files:    map[string]*statusFile{},
+		written:  map[string][]byte{},
+	}
+}
+
+// ReadConfigFiles reads config with the FileSnapshot and updates the status files with whether each resource
+// was accepted. This can be used as a configFunc when creating a Monitor.
+func (s *FileStatusSink) ReadConfigFiles() ([]*config.Config, error) {
+	configs, err := s.snapshot.ReadConfigFiles()
+	if err != nil {
+		return nil, err
+	}
+	s.Update()
+	return configs, nil
+}
+
+// Update rebuilds the status files from the last snapshot. Resources no longer read are removed, and the
+// Accepted condition of every resource is set; other conditions, written by WriteStatus, are kept.
+func (s *FileStatusSink) Update() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rejected := map[string]Rejection{}
+	paths := map[string]string{}
+	files := map[string]*statusFile{}
+	file := func(path string) *statusFile {
+		sf := files[path]
+		if sf == nil {
+			sf = &statusFile{}
+			files[path] = sf
+		}
+		return sf
+	}
+	add := func(path string, meta config.Meta, accepted *v1alpha1.IstioCondition) {
+		key := (&config.Config{Meta: meta}).Key()
+		rs := &resourceStatus{
+			Kind:      meta.GroupVersionKind.String(),
+			Namespace: meta.Namespace,
+			Name:      meta.Name,
+			Status:    &v1alpha1.IstioStatus{},
+			key:       key,
+		}
+		if prev := s.resourceStatus(key); prev != nil && s.paths[key] == path {
+			rs.Status = prev.Status.DeepCopy()
+		}
+		setCondition(rs.Status, accepted)
+		paths[key] = path
+		sf := file(path)
+		sf.Resources = append(sf.Resources, rs)
+	}
+
+	for _, r := range s.snapshot.Rejections() {
+		path := statusFilePath(r.Path)
+		if r.Key() == "" {
+			sf := file(path)
+			sf.Errors = append(sf.Errors, r.Error.Error())
+			continue
+		}
+		rejected[r.Key()] = r
+	}
+	for _, src := range s.snapshot.Sources() {
+		key := (&config.Config{Meta: src.Meta}).Key()
+		cond := &v1alpha1.IstioCondition{Type: AcceptedCondition, Status: "True"}
+		if r, f := rejected[key]; f {
+			cond = r.Status().Conditions[0]
+			cond.Message = "the latest version was rejected, serving the previous version: " + r.Error.Error()
+			delete(rejected, key)
+		}
+		add(statusFilePath(src.Path), src.Meta, cond)
+	}
+	for _, r := range rejected {
+		add(statusFilePath(r.Path), r.Meta, r.Status().Conditions[0])
+	}
+
+	// Status files that no longer have any content are removed.
+	for path := range s.files {
+		if _, f := files[path]; !f {
+			files[path] = &statusFile{}
+		}
+	}
+	s.paths = paths
+	s.files = files
+	for path := range files {
+		s.write(path)
+	}
+}
+
+// WriteStatus writes the status of a resource read by the snapshot. Conditions are merged with the existing status,
+// by type. Resources that were not read by the snapshot are ignored.
+func (s *FileStatusSink) WriteStatus(cfg config.Config) error {
+	status, ok := cfg.Status.(*v1alpha1.IstioStatus)
+	if !ok || status == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := cfg.Key()
+	rs := s.resourceStatus(key)
+	if rs == nil {
+		return nil
+	}
+	for _, c := range status.Conditions {
+		setCondition(rs.Status, c)
+	}
+	rs.Status.ObservedGeneration = status.ObservedGeneration
+	return s.write(s.paths[key])
+}
+
+// DeleteStatus removes the status of a resource. Resources that were not read by the snapshot are ignored.
+func (s *FileStatusSink) DeleteStatus(cfg config.Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := cfg.Key()
+	path, f := s.paths[key]
+	if !f {
+		return nil
+	}
+	delete(s.paths, key)
+	sf := s.files[path]
+	for i, rs := range sf.Resources {
+		if rs.key == key {
+			sf.Resources = append(sf.Resources[:i], sf.Resources[i+1:]...)
+			break
+		}
+	}
+	return s.write(path)
+}
+
+func (s *FileStatusSink) resourceStatus(key string) *resourceStatus {
+	sf := s.files[s.paths[key]]
+	if sf == nil {
+		return nil
+	}
+	for _, rs := range sf.Resources {
+		if rs.key == key {
+			return rs
+		}
+	}
+	return nil
+}
+
+// write writes a status file if its content changed, and removes it if it has no content.
+func (s *FileStatusSink) write(path string) error {
+	sf := s.files[path]
+	if sf == nil || (len(sf.Resources) == 0 && len(sf.Errors) == 0) {
+		delete(s.files, path)
+		delete(s.written, path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warnf("failed to remove status file %s: %v", path, err)
+			return err
+		}
+		return nil
+	}
+	sort.Slice(sf.Resources, func(i, j int) bool {
+		return sf.Resources[i].key < sf.Resources[j].key
+	})
+	b, err := json.MarshalIndent(sf, "", "  ")
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(b, s.written[path]) {
+		return nil
+	}
+	if err := writeFileAtomic(path, b); err != nil {
+		log.Warnf("failed to write status file %s: %v", path, err)
+		return err
+	}
+	s.written[path] = b
+	return nil
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// isStatusFile returns whether path is a status file, or a temporary file written while updating one.
+func isStatusFile(path string) bool {
+	return strings.Contains(filepath.Base(path), StatusFileSuffix)
+}
+
+// statusFilePath returns the status file for a file or kustomization directory.
+func statusFilePath(source string) string {
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		return filepath.Join(source, "kustomization"+StatusFileSuffix)
+	}
+	return source + StatusFileSuffix
+}
+
+// setCondition replaces the condition of the same type, or adds it.
+func setCondition(status *v1alpha1.IstioStatus, cond *v1alpha1.IstioCondition) {
+	for i, c := range status.Conditions {
+		if c.Type == cond.Type {
+			status.Conditions[i] = cond
+			return
+		}
+	}
+	status.Conditions = append(status.Conditions, cond)
+}
@@ -0,0 +1,116 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"istio.io/api/meta/v1alpha1"
+	"istio.io/istio/pilot/pkg/config/monitor"
+	"istio.io/istio/pkg/config/schema/collection"
+)
+
+type testStatusFile struct {
+	Resources []struct {
+		Kind      string          `json:"kind"`
+		Namespace string          `json:"namespace"`
+		Name      string          `json:"name"`
+		Status    json.RawMessage `json:"status"`
+	} `json:"resources"`
+	Errors []string `json:"errors"`
+}
+
+func readStatusFile(t *testing.T, path string) map[string]*v1alpha1.IstioStatus {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf := testStatusFile{}
+	if err := json.Unmarshal(b, &sf); err != nil {
+		t.Fatal(err)
+	}
+	out := map[string]*v1alpha1.IstioStatus{}
+	for _, r := range sf.Resources {
+		status := &v1alpha1.IstioStatus{}
+		if err := status.UnmarshalJSON(r.Status); err != nil {
+			t.Fatal(err)
+		}
+		out[r.Name] = status
+	}
+	return out
+}
+
+func conditions(status *v1alpha1.IstioStatus) map[string]string {
+	out := map[string]string{}
+	for _, c := range status.Conditions {
+		out[c.Type] = c.Status
+	}
+	return out
+}
+
+func TestFileStatusSink(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	ts := &testState{
+		ConfigFiles: map[string][]byte{
+			"gateway.yaml": []byte(gatewayYAML),
+			"vs.yaml":      []byte(virtualServiceYAML),
+		},
+	}
+
+	ts.testSetup(t)
+	defer ts.testTeardown(t)
+
+	snapshot := monitor.NewFileSnapshot(ts.rootPath, collection.SchemasFor(), "")
+	sink := monitor.NewFileStatusSink(snapshot)
+	configs, err := sink.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(2))
+
+	vsStatusFile := filepath.Join(ts.rootPath, "vs.yaml"+monitor.StatusFileSuffix)
+	statuses := readStatusFile(t, vsStatusFile)
+	g.Expect(conditions(statuses["route-for-myapp"])).To(gomega.Equal(map[string]string{"Accepted": "True"}))
+
+	// Distribution status is merged with the Accepted condition.
+	reconciled := *configs[1]
+	reconciled.Status = &v1alpha1.IstioStatus{
+		Conditions: []*v1alpha1.IstioCondition{{Type: "Reconciled", Status: "True"}},
+	}
+	g.Expect(sink.WriteStatus(reconciled)).To(gomega.Succeed())
+	statuses = readStatusFile(t, vsStatusFile)
+	g.Expect(conditions(statuses["route-for-myapp"])).To(gomega.Equal(map[string]string{"Accepted": "True", "Reconciled": "True"}))
+
+	// A rejected update is reported, keeping the other conditions; status files are not read as config.
+	ts.writeFile(t, "vs.yaml", invalidVirtualServiceYAML)
+	configs, err = sink.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(2))
+	statuses = readStatusFile(t, vsStatusFile)
+	g.Expect(conditions(statuses["route-for-myapp"])).To(gomega.Equal(map[string]string{"Accepted": "False", "Reconciled": "True"}))
+
+	// Once the resource is removed, so is its status file.
+	g.Expect(os.Remove(filepath.Join(ts.rootPath, "vs.yaml"))).To(gomega.Succeed())
+	configs, err = sink.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(1))
+	g.Expect(vsStatusFile).NotTo(gomega.BeAnExistingFile())
+	g.Expect(filepath.Join(ts.rootPath, "gateway.yaml"+monitor.StatusFileSuffix)).To(gomega.BeAnExistingFile())
+}
@@ -0,0 +1,220 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxCacheTTL bounds the time upstream responses are cached, regardless of their TTL.
+const maxCacheTTL = time.Hour
+
+// responseCache caches the responses of upstream DNS servers for the duration of their TTL.
+// Negative responses (NXDOMAIN, or NOERROR without answers) are cached for the duration
+// given by the SOA record of the authority section, as described in RFC 2308.
+type responseCache struct {
+	mu         sync.Mutex
+	entries    map[cacheKey]*cachedResponse
+	maxEntries int
+	now        func() time.Time
+}
+
+type cacheKey struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+	// The response depends on whether the request has EDNS and the DNSSEC OK bit.
+	edns bool
+	do   bool
+}
+
+type cachedResponse struct {
+	msg      *dns.Msg
+	stored   time.Time
+	expires  time.Time
+	negative bool
+}
+
+// newResponseCache returns a cache of at most maxEntries responses, or nil if maxEntries is not positive.
+func newResponseCache(maxEntries int) *responseCache {
+	if maxEntries <= 0 {
+		return nil
+	}
+	return &responseCache{
+		entries:    map[cacheKey]*cachedResponse{},
+		maxEntries: maxEntries,
+		now:        time.Now,
+	}
+}
+
+func newCacheKey(req *dns.Msg) cacheKey {
+	q := req.Question[0]
+	key := cacheKey{name: strings.ToLower(q.Name), qtype: q.Qtype, qclass: q.Qclass}
+	if opt := req.IsEdns0(); opt != nil {
+		key.edns = true
+		key.do = opt.Do()
+	}
+	return key
+}
+
+// get returns the cached response to the request, with the TTLs reduced by the time spent in the cache.
+// Returns nil if there is no valid cached response.
+func (c *responseCache) get(req *dns.Msg) *dns.Msg {
+	if c == nil {
+		return nil
+	}
+	key := newCacheKey(req)
+	now := c.now()
+	c.mu.Lock()
+	entry, f := c.entries[key]
+	if f && !now.Before(entry.expires) {
+		delete(c.entries, key)
+		cacheSize.Record(float64(len(c.entries)))
+		f = false
+	}
+	c.mu.Unlock()
+	if !f {
+		cacheMisses.Increment()
+		return nil
+	}
+	if entry.negative {
+		cacheHits.With(typeTag.Value(negativeResponse)).Increment()
+	} else {
+		cacheHits.With(typeTag.Value(positiveResponse)).Increment()
+	}
+
+	response := entry.msg.Copy()
+	response.Id = req.Id
+	response.Question = req.Question
+	elapsed := uint32(now.Sub(entry.stored) / time.Second)
+	for _, section := range [][]dns.RR{response.Answer, response.Ns, response.Extra} {
+		for _, rr := range section {
+			hdr := rr.Header()
+			if hdr.Rrtype == dns.TypeOPT {
+				// The TTL of the OPT record holds the extended RCODE and flags.
+				continue
+			}
+			if hdr.Ttl > elapsed {
+				hdr.Ttl -= elapsed
+			} else {
+				hdr.Ttl = 0
+			}
+		}
+	}
+	return response
+}
+
+// put caches the upstream response to the request, if it can be cached.
+func (c *responseCache) put(req *dns.Msg, response *dns.Msg) {
+	if c == nil {
+		return
+	}
+	ttl, negative, ok := cacheTTL(response)
+	if !ok {
+		return
+	}
+	now := c.now()
+	entry := &cachedResponse{
+		msg:      response.Copy(),
+		stored:   now,
+		expires:  now.Add(ttl),
+		negative: negative,
+	}
+	key := newCacheKey(req)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, f := c.entries[key]; !f && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[key] = entry
+	cacheSize.Record(float64(len(c.entries)))
+}
+
+// evict removes the expired entries, or the entry closest to its expiry if none has expired.
+func (c *responseCache) evict(now time.Time) {
+	var oldestKey cacheKey
+	var oldest *cachedResponse
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldest == nil || entry.expires.Before(oldest.expires) {
+			oldestKey, oldest = key, entry
+		}
+	}
+	if len(c.entries) >= c.maxEntries && oldest != nil {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// cacheTTL returns how long the response may be cached, and whether it is a negative response.
+func cacheTTL(response *dns.Msg) (time.Duration, bool, bool) {
+	if response.Truncated || len(response.Question) != 1 {
+		return 0, false, false
+	}
+	var ttl uint32
+	negative := false
+	switch {
+	case response.Rcode == dns.RcodeSuccess && len(response.Answer) > 0:
+		ttl = minTTL(response.Answer)
+		if len(response.Ns) > 0 {
+			if nsTTL := minTTL(response.Ns); nsTTL < ttl {
+				ttl = nsTTL
+			}
+		}
+	case response.Rcode == dns.RcodeSuccess || response.Rcode == dns.RcodeNameError:
+		negative = true
+		var soa *dns.SOA
+		for _, rr := range response.Ns {
+			if s, ok := rr.(*dns.SOA); ok {
+				soa = s
+				break
+			}
+		}
+		if soa == nil {
+			// Negative responses without SOA record must not be cached.
+			return 0, false, false
+		}
+		ttl = soa.Hdr.Ttl
+		if soa.Minttl < ttl {
+			ttl = soa.Minttl
+		}
+	default:
+		return 0, false, false
+	}
+	if ttl == 0 {
+		return 0, false, false
+	}
+	d := time.Duration(ttl) * time.Second
+	if d > maxCacheTTL {
+		d = maxCacheTTL
+	}
+	return d, negative, true
+}
+
+func minTTL(records []dns.RR) uint32 {
+	ttl := records[0].Header().Ttl
+	for _, rr := range records[1:] {
+		if rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	return ttl
+}
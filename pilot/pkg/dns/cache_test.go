@@ -0,0 +1,238 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/atomic"
+
+	nds "istio.io/istio/pilot/pkg/proto"
+)
+
+func soa(zone string, ttl, minTTL uint32) dns.RR {
+	return &dns.SOA{
+		Hdr:    dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+		Ns:     "ns." + zone,
+		Mbox:   "admin." + zone,
+		Minttl: minTTL,
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	cases := []struct {
+		name         string
+		response     func(m *dns.Msg)
+		wantTTL      time.Duration
+		wantNegative bool
+		wantCached   bool
+	}{
+		{
+			name: "minimum TTL of the answers",
+			response: func(m *dns.Msg) {
+				m.Answer = append(a("example.com.", []net.IP{net.ParseIP("1.1.1.1")}),
+					cname("example.com.", "other.com.")...)
+				m.Answer[1].Header().Ttl = 10
+			},
+			wantTTL:    10 * time.Second,
+			wantCached: true,
+		},
+		{
+			name: "TTL is bounded",
+			response: func(m *dns.Msg) {
+				m.Answer = a("example.com.", []net.IP{net.ParseIP("1.1.1.1")})
+				m.Answer[0].Header().Ttl = 86400
+			},
+			wantTTL:    maxCacheTTL,
+			wantCached: true,
+		},
+		{
+			name: "NXDOMAIN with SOA",
+			response: func(m *dns.Msg) {
+				m.Rcode = dns.RcodeNameError
+				m.Ns = []dns.RR{soa("example.com.", 300, 60)}
+			},
+			wantTTL:      60 * time.Second,
+			wantNegative: true,
+			wantCached:   true,
+		},
+		{
+			name: "NODATA with SOA",
+			response: func(m *dns.Msg) {
+				m.Ns = []dns.RR{soa("example.com.", 20, 60)}
+			},
+			wantTTL:      20 * time.Second,
+			wantNegative: true,
+			wantCached:   true,
+		},
+		{
+			name: "NXDOMAIN without SOA",
+			response: func(m *dns.Msg) {
+				m.Rcode = dns.RcodeNameError
+			},
+		},
+		{
+			name: "server failure",
+			response: func(m *dns.Msg) {
+				m.Rcode = dns.RcodeServerFailure
+			},
+		},
+		{
+			name: "truncated",
+			response: func(m *dns.Msg) {
+				m.Answer = a("example.com.", []net.IP{net.ParseIP("1.1.1.1")})
+				m.Truncated = true
+			},
+		},
+		{
+			name: "zero TTL",
+			response: func(m *dns.Msg) {
+				m.Answer = a("example.com.", []net.IP{net.ParseIP("1.1.1.1")})
+				m.Answer[0].Header().Ttl = 0
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := new(dns.Msg)
+			req.SetQuestion("example.com.", dns.TypeA)
+			m := new(dns.Msg)
+			m.SetReply(req)
+			tt.response(m)
+			ttl, negative, cached := cacheTTL(m)
+			if ttl != tt.wantTTL || negative != tt.wantNegative || cached != tt.wantCached {
+				t.Errorf("got ttl %v, negative %v, cached %v, want %v, %v, %v",
+					ttl, negative, cached, tt.wantTTL, tt.wantNegative, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	now := time.Now()
+	c := newResponseCache(2)
+	c.now = func() time.Time { return now }
+
+	query := func(host string, id uint16) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(host, dns.TypeA)
+		req.Id = id
+		return req
+	}
+	reply := func(req *dns.Msg, ttl uint32) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = a(req.Question[0].Name, []net.IP{net.ParseIP("1.1.1.1").To4()})
+		m.Answer[0].Header().Ttl = ttl
+		return m
+	}
+
+	if c.get(query("a.com.", 1)) != nil {
+		t.Fatal("expecting an empty cache")
+	}
+	c.put(query("a.com.", 1), reply(query("a.com.", 1), 30))
+
+	now = now.Add(10 * time.Second)
+	got := c.get(query("A.com.", 2))
+	if got == nil {
+		t.Fatal("expecting a cached response")
+	}
+	if got.Id != 2 || got.Question[0].Name != "A.com." {
+		t.Errorf("response does not match the request: %v", got)
+	}
+	if ttl := got.Answer[0].Header().Ttl; ttl != 20 {
+		t.Errorf("TTL got %d, want 20", ttl)
+	}
+	// The cached response must not be modified by the callers.
+	got.Answer[0].Header().Ttl = 1
+	if ttl := c.get(query("a.com.", 3)).Answer[0].Header().Ttl; ttl != 20 {
+		t.Errorf("TTL got %d, want 20", ttl)
+	}
+
+	// Requests with EDNS are cached separately.
+	edns := query("a.com.", 4)
+	edns.SetEdns0(4096, true)
+	if c.get(edns) != nil {
+		t.Error("expecting no cached response for EDNS request")
+	}
+
+	// The entry closest to its expiry is evicted when the cache is full.
+	c.put(query("b.com.", 5), reply(query("b.com.", 5), 300))
+	c.put(query("c.com.", 6), reply(query("c.com.", 6), 300))
+	if c.get(query("a.com.", 7)) != nil {
+		t.Error("expecting a.com. to be evicted")
+	}
+	if c.get(query("b.com.", 8)) == nil || c.get(query("c.com.", 9)) == nil {
+		t.Error("expecting b.com. and c.com. to be cached")
+	}
+
+	now = now.Add(300 * time.Second)
+	if c.get(query("b.com.", 10)) != nil {
+		t.Error("expecting b.com. to be expired")
+	}
+}
+
+func TestDNSUpstreamCache(t *testing.T) {
+	queries := atomic.NewInt32(0)
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(resp dns.ResponseWriter, msg *dns.Msg) {
+		queries.Inc()
+		answer := new(dns.Msg)
+		answer.SetReply(msg)
+		if msg.Question[0].Name == "www.bing.com." {
+			answer.Answer = a("www.bing.com.", []net.IP{net.ParseIP("1.1.1.1").To4()})
+		} else {
+			answer.Rcode = dns.RcodeNameError
+			answer.Ns = []dns.RR{soa("com.", 300, 60)}
+		}
+		_ = resp.WriteMsg(answer)
+	})
+	up := make(chan struct{})
+	server := &dns.Server{Addr: "127.0.0.1:0", Net: "udp", Handler: mux, NotifyStartedFunc: func() { close(up) }}
+	go server.ListenAndServe()
+	<-up
+	t.Cleanup(func() { server.Shutdown() })
+
+	testAgentDNS, err := NewLocalDNSServer("ns1", "ns1.svc.cluster.local", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAgentDNS.resolvConfServers = []string{server.PacketConn.LocalAddr().String()}
+	testAgentDNS.StartDNS()
+	testAgentDNS.UpdateLookupTable(&nds.NameTable{})
+	t.Cleanup(testAgentDNS.Close)
+	for _, host := range []string{"www.bing.com.", "nx.bing.com."} {
+		for i := 0; i < 3; i++ {
+			m := new(dns.Msg)
+			m.SetQuestion(host, dns.TypeA)
+			res, err := dns.Exchange(m, testAgentDNSAddr)
+			if err != nil {
+				t.Fatalf("Failed to resolve query for %s: %v", host, err)
+			}
+			if res.Id != m.Id {
+				t.Errorf("response id got %d, want %d", res.Id, m.Id)
+			}
+			if host == "nx.bing.com." && res.Rcode != dns.RcodeNameError {
+				t.Errorf("expecting NXDOMAIN for %s, got %v", host, res)
+			}
+		}
+	}
+	if n := queries.Load(); n != 2 {
+		t.Errorf("expecting 2 upstream queries, got %d", n)
+	}
+}
@@ -16,6 +16,7 @@ package dns
 
 import (
 	"net"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -23,6 +24,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/miekg/dns"
 
+	"istio.io/istio/pilot/pkg/features"
 	nds "istio.io/istio/pilot/pkg/proto"
 	"istio.io/istio/pilot/pkg/serviceregistry/provider"
 	"istio.io/istio/pkg/config/host"
@@ -42,6 +44,12 @@ type LocalDNSServer struct {
 	udpDNSProxy *dnsProxy
 	tcpDNSProxy *dnsProxy
 
+	// cache holds the responses of the upstream resolvers, nil if caching is disabled
+	cache *responseCache
+	// forwarder selects the upstream resolvers of the names matching the forwarding rules,
+	// nil if there is no rule
+	forwarder *forwarder
+
 	resolvConfServers []string
 	searchNamespaces  []string
 	// The namespace where the proxy resides
@@ -69,6 +77,12 @@ type LookupTable struct {
 	// The cname records here (comprised of different variants of the hosts above,
 	// expanded by the search namespaces) pointing to the actual host.
 	cname map[string][]dns.RR
+	// The SRV records of the service ports. The key is either the host, for all the ports of the service,
+	// or _<port name>._<protocol>.<host>, for a single port, following the kubernetes DNS specification.
+	srv map[string][]dns.RR
+	// The PTR records of the service and endpoint IPs. The key is the reverse lookup name of the IP
+	// (like 1.0.0.10.in-addr.arpa.). Unlike the others, these names are not stored in allHosts.
+	ptr map[string][]dns.RR
 }
 
 const (
@@ -78,9 +92,15 @@ const (
 	defaultTTLInSeconds = 30
 )
 
-func NewLocalDNSServer(proxyNamespace, proxyDomain string) (*LocalDNSServer, error) {
+func NewLocalDNSServer(proxyNamespace, proxyDomain string, forwardingRules []ForwardingRule) (*LocalDNSServer, error) {
 	h := &LocalDNSServer{
 		proxyNamespace: proxyNamespace,
+		cache:          newResponseCache(features.DNSUpstreamCacheMaxEntries),
+	}
+
+	var err error
+	if h.forwarder, err = newForwarder(forwardingRules); err != nil {
+		return nil, err
 	}
 
 	registerStats()
@@ -133,6 +153,7 @@ func NewLocalDNSServer(proxyNamespace, proxyDomain string) (*LocalDNSServer, err
 func (h *LocalDNSServer) StartDNS() {
 	go h.udpDNSProxy.start()
 	go h.tcpDNSProxy.start()
+	go h.forwarder.start()
 }
 
 func (h *LocalDNSServer) UpdateLookupTable(nt *nds.NameTable) {
@@ -141,6 +162,8 @@ func (h *LocalDNSServer) UpdateLookupTable(nt *nds.NameTable) {
 		name4:    map[string][]dns.RR{},
 		name6:    map[string][]dns.RR{},
 		cname:    map[string][]dns.RR{},
+		srv:      map[string][]dns.RR{},
+		ptr:      map[string][]dns.RR{},
 	}
 	for host, ni := range nt.Table {
 		// Given a host
@@ -159,6 +182,17 @@ func (h *LocalDNSServer) UpdateLookupTable(nt *nds.NameTable) {
 			continue
 		}
 		lookupTable.buildDNSAnswers(altHosts, ipv4, ipv6, h.searchNamespaces)
+		if !strings.HasPrefix(host, "*") {
+			// Wildcard hosts have no canonical name the SRV and PTR records could point to.
+			lookupTable.buildSRVAnswers(altHosts, host, ni.Ports)
+			lookupTable.buildPTRAnswers(host, append(ipv4, ipv6...))
+		}
+	}
+	// Sort the PTR records, as a single IP may be shared by several hosts in the randomly ordered name table.
+	for _, records := range lookupTable.ptr {
+		sort.Slice(records, func(i, j int) bool {
+			return records[i].(*dns.PTR).Ptr < records[j].(*dns.PTR).Ptr
+		})
 	}
 	h.lookupTable.Store(lookupTable)
 	h.nameTable.Store(nt)
@@ -212,11 +246,19 @@ func (h *LocalDNSServer) ServeDNS(proxy *dnsProxy, w dns.ResponseWriter, req *dn
 		// a client (ie curl, see https://github.com/istio/istio/issues/31250) sending parallel
 		// requests for A and AAAA may get NXDOMAIN for AAAA and treat the entire thing as a NXDOMAIN
 		response.Answer = answers
+		if req.Question[0].Qtype == dns.TypeSRV {
+			// Save the client the queries for the targets of the SRV records, as kube-dns does.
+			response.Extra = lookupTable.srvAdditionals(answers)
+		}
 		// Randomize the responses; this ensures for things like headless services we can do DNS-LB
 		// This matches standard kube-dns behavior. We only do this for cached responses as the
 		// upstream DNS server would already round robin if desired.
 		roundRobinResponse(response)
 		log.Debugf("response for hostname %q (found=true): %v", hostname, response)
+	} else if cached := h.cache.get(req); cached != nil {
+		// The upstream response to the same question is still valid.
+		response = cached
+		log.Debugf("cached upstream response for hostname %q : %v", hostname, response)
 	} else {
 		upstreamRequests.Increment()
 		start := time.Now()
@@ -225,6 +267,7 @@ func (h *LocalDNSServer) ServeDNS(proxy *dnsProxy, w dns.ResponseWriter, req *dn
 		response = h.queryUpstream(proxy.upstreamClient, req, log)
 		requestDuration.Record(time.Since(start).Seconds())
 		log.Debugf("upstream response for hostname %q : %v", hostname, response)
+		h.cache.put(req, response)
 	}
 	// Compress the response - we don't know if the incoming response was compressed or not. If it was,
 	// but we don't compress on the outbound, we will run into issues. For example, if the compressed
@@ -311,18 +354,24 @@ func roundRobinShuffle(records []dns.RR) {
 func (h *LocalDNSServer) Close() {
 	h.udpDNSProxy.close()
 	h.tcpDNSProxy.close()
+	h.forwarder.close()
 }
 
 // TODO: Figure out how to send parallel queries to all nameservers
 func (h *LocalDNSServer) queryUpstream(upstreamClient *dns.Client, req *dns.Msg, scope *istiolog.Scope) *dns.Msg {
 	var response *dns.Msg
-	for _, upstream := range h.resolvConfServers {
-		cResponse, _, err := upstreamClient.Exchange(req, upstream)
-		if err == nil {
-			response = cResponse
-			break
-		} else {
-			scope.Infof("upstream failure: %v", err)
+	if rule := h.forwarder.match(req.Question[0].Name); rule != nil {
+		// The name is forwarded to the upstreams of the rule instead of the resolv.conf servers.
+		response = rule.exchange(req, scope)
+	} else {
+		for _, upstream := range h.resolvConfServers {
+			cResponse, _, err := upstreamClient.Exchange(req, upstream)
+			if err == nil {
+				response = cResponse
+				break
+			} else {
+				scope.Infof("upstream failure: %v", err)
+			}
 		}
 	}
 	if response == nil {
@@ -377,6 +426,12 @@ func generateAltHosts(hostname string, nameinfo *nds.NameTable_NameInfo, proxyNa
 func (table *LookupTable) lookupHost(qtype uint16, hostname string) ([]dns.RR, bool) {
 	var hostFound bool
 
+	if qtype == dns.TypePTR {
+		// Reverse lookups of IPs which are not in the registry are forwarded upstream.
+		ptr, f := table.ptr[hostname]
+		return ptr, f
+	}
+
 	question := host.Name(hostname)
 	wildcard := false
 	// First check if host exists in all hosts.
@@ -415,8 +470,12 @@ func (table *LookupTable) lookupHost(qtype uint16, hostname string) ([]dns.RR, b
 		ipAnswers = table.name4[hostname]
 	case dns.TypeAAAA:
 		ipAnswers = table.name6[hostname]
+	case dns.TypeSRV:
+		if wildcard {
+			return nil, hostFound
+		}
+		ipAnswers = table.srv[hostname]
 	default:
-		// TODO: handle PTR records for reverse dns lookups
 		return nil, false
 	}
 
@@ -486,6 +545,65 @@ func (table *LookupTable) buildDNSAnswers(altHosts map[string]struct{}, ipv4 []n
 	}
 }
 
+// buildSRVAnswers stores the SRV records of the ports of the host, for each variant of the host. The records
+// point to the host itself, like in kubernetes, where they point to the fully qualified service name.
+func (table *LookupTable) buildSRVAnswers(altHosts map[string]struct{}, host string, ports []*nds.NameTable_Port) {
+	if len(ports) == 0 {
+		return
+	}
+	target := strings.ToLower(host) + "."
+	for h := range altHosts {
+		h = strings.ToLower(h)
+		for _, port := range ports {
+			name := "_" + strings.ToLower(port.Name) + "._" + port.Protocol + "." + h
+			record := srv(name, target, port.Port)
+			table.srv[name] = record
+			table.srv[h] = append(table.srv[h], srv(h, target, port.Port)...)
+			table.allHosts[name] = struct{}{}
+		}
+	}
+}
+
+// buildPTRAnswers stores the PTR records of the IPs of the host.
+func (table *LookupTable) buildPTRAnswers(host string, ips []net.IP) {
+	target := strings.ToLower(host) + "."
+	for _, ip := range ips {
+		name, err := dns.ReverseAddr(ip.String())
+		if err != nil {
+			continue
+		}
+		exists := false
+		for _, record := range table.ptr[name] {
+			if record.(*dns.PTR).Ptr == target {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			table.ptr[name] = append(table.ptr[name], ptr(name, target)...)
+		}
+	}
+}
+
+// srvAdditionals returns the A and AAAA records of the targets of the SRV records.
+func (table *LookupTable) srvAdditionals(answers []dns.RR) []dns.RR {
+	var out []dns.RR
+	seen := map[string]struct{}{}
+	for _, answer := range answers {
+		record, ok := answer.(*dns.SRV)
+		if !ok {
+			continue
+		}
+		if _, f := seen[record.Target]; f {
+			continue
+		}
+		seen[record.Target] = struct{}{}
+		out = append(out, table.name4[record.Target]...)
+		out = append(out, table.name6[record.Target]...)
+	}
+	return out
+}
+
 // Borrowed from https://github.com/coredns/coredns/blob/master/plugin/hosts/hosts.go
 // a takes a slice of net.IPs and returns a slice of A RRs.
 func a(host string, ips []net.IP) []dns.RR {
@@ -523,6 +641,34 @@ func cname(host string, targetHost string) []dns.RR {
 	return []dns.RR{answer}
 }
 
+func srv(host string, target string, port uint32) []dns.RR {
+	answer := new(dns.SRV)
+	answer.Hdr = dns.RR_Header{
+		Name:   host,
+		Rrtype: dns.TypeSRV,
+		Class:  dns.ClassINET,
+		Ttl:    defaultTTLInSeconds,
+	}
+	// Like kube-dns, all the records have the same priority and weight.
+	answer.Priority = 0
+	answer.Weight = 100
+	answer.Port = uint16(port)
+	answer.Target = target
+	return []dns.RR{answer}
+}
+
+func ptr(name string, targetHost string) []dns.RR {
+	answer := new(dns.PTR)
+	answer.Hdr = dns.RR_Header{
+		Name:   name,
+		Rrtype: dns.TypePTR,
+		Class:  dns.ClassINET,
+		Ttl:    defaultTTLInSeconds,
+	}
+	answer.Ptr = targetHost
+	return []dns.RR{answer}
+}
+
 // Size returns if buffer size *advertised* in the requests OPT record.
 // Or when the request was over TCP, we return the maximum allowed size of 64K.
 func size(proto string, r *dns.Msg) int {
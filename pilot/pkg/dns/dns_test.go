@@ -38,6 +38,7 @@ func TestDNS(t *testing.T) {
 		host                     string
 		id                       int
 		queryAAAA                bool
+		qtype                    uint16
 		expected                 []dns.RR
 		expectResolutionFailure  int
 		expectExternalResolution bool
@@ -166,6 +167,71 @@ func TestDNS(t *testing.T) {
 			host:      "ipv4.localhost.",
 			queryAAAA: true,
 		},
+		{
+			name:     "success: SRV query for a port of k8s host",
+			host:     "_http._tcp.productpage.ns1.svc.cluster.local.",
+			qtype:    dns.TypeSRV,
+			expected: srv("_http._tcp.productpage.ns1.svc.cluster.local.", "productpage.ns1.svc.cluster.local.", 9080),
+		},
+		{
+			name:     "success: SRV query for a port of k8s host - shortname",
+			host:     "_grpc._tcp.productpage.",
+			qtype:    dns.TypeSRV,
+			expected: srv("_grpc._tcp.productpage.", "productpage.ns1.svc.cluster.local.", 9090),
+		},
+		{
+			name:  "success: SRV query for all ports of k8s host",
+			host:  "productpage.ns1.svc.cluster.local.",
+			qtype: dns.TypeSRV,
+			expected: append(srv("productpage.ns1.svc.cluster.local.", "productpage.ns1.svc.cluster.local.", 9080),
+				srv("productpage.ns1.svc.cluster.local.", "productpage.ns1.svc.cluster.local.", 9090)...),
+		},
+		{
+			name:  "success: SRV query for k8s host with search namespace yields cname+SRV record",
+			host:  "productpage.ns1.ns1.svc.cluster.local.",
+			qtype: dns.TypeSRV,
+			expected: append(cname("productpage.ns1.ns1.svc.cluster.local.", "productpage.ns1."),
+				append(srv("productpage.ns1.", "productpage.ns1.svc.cluster.local.", 9080),
+					srv("productpage.ns1.", "productpage.ns1.svc.cluster.local.", 9090)...)...),
+		},
+		{
+			// This is not a NXDOMAIN, but empty response
+			name:  "success: SRV query for an unknown port of k8s host",
+			host:  "_mysql._tcp.productpage.ns1.svc.cluster.local.",
+			qtype: dns.TypeSRV,
+		},
+		{
+			name:     "success: SRV query for a udp port",
+			host:     "_dns._udp.example.ns2.svc.cluster.local.",
+			qtype:    dns.TypeSRV,
+			expected: srv("_dns._udp.example.ns2.svc.cluster.local.", "example.ns2.svc.cluster.local.", 53),
+		},
+		{
+			name:     "success: PTR query for k8s service IP",
+			host:     "9.9.9.9.in-addr.arpa.",
+			qtype:    dns.TypePTR,
+			expected: ptr("9.9.9.9.in-addr.arpa.", "productpage.ns1.svc.cluster.local."),
+		},
+		{
+			name:  "success: PTR query for IP shared by several hosts",
+			host:  "2.2.2.2.in-addr.arpa.",
+			qtype: dns.TypePTR,
+			expected: append(ptr("2.2.2.2.in-addr.arpa.", "dual.localhost."),
+				ptr("2.2.2.2.in-addr.arpa.", "ipv4.localhost.")...),
+		},
+		{
+			name:     "success: PTR query for IPv6 shared by several hosts",
+			host:     "9.2.3.8.2.4.0.0.0.0.f.f.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+			qtype:    dns.TypePTR,
+			expected: append(ptr("9.2.3.8.2.4.0.0.0.0.f.f.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "dual.localhost."),
+				ptr("9.2.3.8.2.4.0.0.0.0.f.f.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "ipv6.localhost.")...),
+		},
+		{
+			name:                    "failure: PTR query for unknown IP is forwarded upstream",
+			host:                    "10.10.10.11.in-addr.arpa.",
+			qtype:                   dns.TypePTR,
+			expectResolutionFailure: dns.RcodeNameError,
+		},
 		{
 			name: "udp: large request",
 			host: "giant.",
@@ -223,6 +289,9 @@ func TestDNS(t *testing.T) {
 				if tt.queryAAAA {
 					q = dns.TypeAAAA
 				}
+				if tt.qtype != 0 {
+					q = tt.qtype
+				}
 				m.SetQuestion(tt.host, q)
 				if tt.modifyReq != nil {
 					tt.modifyReq(m)
@@ -262,6 +331,20 @@ func TestDNS(t *testing.T) {
 	}
 }
 
+func TestDNSSRVAdditionals(t *testing.T) {
+	initDNS(t)
+	m := new(dns.Msg)
+	m.SetQuestion("_http._tcp.productpage.", dns.TypeSRV)
+	res, err := dns.Exchange(m, testAgentDNSAddr)
+	if err != nil {
+		t.Fatalf("Failed to resolve query: %v", err)
+	}
+	want := a("productpage.ns1.svc.cluster.local.", []net.IP{net.ParseIP("9.9.9.9").To4()})
+	if !equalsDNSrecords(res.Extra, want) {
+		t.Errorf("additional records do not match. \n got %v\nwant %v", res.Extra, want)
+	}
+}
+
 // Baseline:
 //      ~150us via agent if cached for A/AAAA
 //      ~300us via agent when doing the cname redirect
@@ -411,7 +494,7 @@ func makeUpstream(t test.Failer, responses map[string]string) string {
 
 func initDNS(t test.Failer) *LocalDNSServer {
 	srv := makeUpstream(t, map[string]string{"www.bing.com.": "1.1.1.1"})
-	testAgentDNS, err := NewLocalDNSServer("ns1", "ns1.svc.cluster.local")
+	testAgentDNS, err := NewLocalDNSServer("ns1", "ns1.svc.cluster.local", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -429,12 +512,17 @@ func initDNS(t test.Failer) *LocalDNSServer {
 				Registry:  "Kubernetes",
 				Namespace: "ns1",
 				Shortname: "productpage",
+				Ports: []*nds.NameTable_Port{
+					{Name: "http", Port: 9080, Protocol: "tcp"},
+					{Name: "grpc", Port: 9090, Protocol: "tcp"},
+				},
 			},
 			"example.ns2.svc.cluster.local": {
 				Ips:       []string{"10.10.10.10"},
 				Registry:  "Kubernetes",
 				Namespace: "ns2",
 				Shortname: "example",
+				Ports:     []*nds.NameTable_Port{{Name: "dns", Port: 53, Protocol: "udp"}},
 			},
 			"details.ns2.svc.cluster.remote": {
 				Ips:       []string{"11.11.11.11", "12.12.12.12", "13.13.13.13", "14.14.14.14"},
@@ -0,0 +1,350 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"sigs.k8s.io/yaml"
+
+	istiolog "istio.io/pkg/log"
+)
+
+const (
+	// Protocols of the upstream resolvers.
+	ProtocolUDP   = "udp"
+	ProtocolTCP   = "tcp"
+	ProtocolTLS   = "tls"
+	ProtocolHTTPS = "https"
+
+	upstreamTimeout = 5 * time.Second
+
+	// dohMediaType is the media type of DNS messages sent over HTTPS, see RFC 8484.
+	dohMediaType = "application/dns-message"
+)
+
+// healthCheckInterval is the interval of the health checks of the unhealthy upstream resolvers.
+var healthCheckInterval = 5 * time.Second
+
+// ForwardingRule forwards the queries for the names in a domain to a set of upstream resolvers,
+// instead of the resolvers of resolv.conf.
+type ForwardingRule struct {
+	// Domain is the suffix of the names forwarded by the rule, like corp.internal. The rule with the
+	// longest matching domain applies. The domain "." matches all names, it replaces the resolvers of resolv.conf.
+	Domain string `json:"domain"`
+	// Upstreams are the resolvers queried, in order. Unhealthy resolvers are only queried if all the others fail.
+	Upstreams []Upstream `json:"upstreams"`
+}
+
+// Upstream is an upstream resolver.
+type Upstream struct {
+	// Address is the host:port of the resolver, or the URL of the resolver for the https protocol, like
+	// https://dns.google/dns-query. The port defaults to 53, or 853 for the tls protocol.
+	Address string `json:"address"`
+	// Protocol is one of udp (the default), tcp, tls (DNS over TLS) and https (DNS over HTTPS).
+	Protocol string `json:"protocol,omitempty"`
+	// TLSServerName is the name verified in the certificate of the resolver, for the tls and https protocols.
+	// Defaults to the host of the address.
+	TLSServerName string `json:"tlsServerName,omitempty"`
+	// CACertificates is the file of the PEM encoded certificates of the CAs trusted to sign the certificate of
+	// the resolver, for the tls and https protocols. Defaults to the system roots.
+	CACertificates string `json:"caCertificates,omitempty"`
+}
+
+// ParseForwardingRules parses the YAML or JSON list of forwarding rules.
+func ParseForwardingRules(config string) ([]ForwardingRule, error) {
+	if strings.TrimSpace(config) == "" {
+		return nil, nil
+	}
+	var rules []ForwardingRule
+	if err := yaml.Unmarshal([]byte(config), &rules); err != nil {
+		return nil, fmt.Errorf("invalid DNS forwarding rules: %v", err)
+	}
+	return rules, nil
+}
+
+// forwarder selects the upstream resolvers of the queries with the forwarding rules.
+type forwarder struct {
+	// rules are sorted by decreasing length of their domain, so that the most specific rule matches first.
+	rules []*forwardingRule
+	stop  chan struct{}
+}
+
+type forwardingRule struct {
+	domain    string
+	upstreams []*upstream
+}
+
+func newForwarder(rules []ForwardingRule) (*forwarder, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	f := &forwarder{stop: make(chan struct{})}
+	for _, rule := range rules {
+		domain := dns.Fqdn(strings.ToLower(strings.TrimPrefix(rule.Domain, "*.")))
+		if _, ok := dns.IsDomainName(domain); !ok {
+			return nil, fmt.Errorf("invalid domain %q in DNS forwarding rule", rule.Domain)
+		}
+		if len(rule.Upstreams) == 0 {
+			return nil, fmt.Errorf("no upstream in DNS forwarding rule for %v", rule.Domain)
+		}
+		r := &forwardingRule{domain: domain}
+		for _, u := range rule.Upstreams {
+			up, err := newUpstream(u)
+			if err != nil {
+				return nil, fmt.Errorf("invalid upstream %v in DNS forwarding rule for %v: %v", u.Address, rule.Domain, err)
+			}
+			r.upstreams = append(r.upstreams, up)
+		}
+		f.rules = append(f.rules, r)
+	}
+	sort.SliceStable(f.rules, func(i, j int) bool {
+		return dns.CountLabel(f.rules[i].domain) > dns.CountLabel(f.rules[j].domain)
+	})
+	return f, nil
+}
+
+// match returns the rule for the name, or nil if the name is not forwarded by any rule.
+func (f *forwarder) match(name string) *forwardingRule {
+	if f == nil {
+		return nil
+	}
+	name = strings.ToLower(name)
+	for _, rule := range f.rules {
+		if dns.IsSubDomain(rule.domain, name) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// exchange queries the healthy upstreams of the rule in order, then the unhealthy ones if all the healthy ones fail.
+// Returns nil if all the upstreams fail.
+func (r *forwardingRule) exchange(req *dns.Msg, scope *istiolog.Scope) *dns.Msg {
+	var healthy, unhealthy []*upstream
+	for _, u := range r.upstreams {
+		if u.isHealthy() {
+			healthy = append(healthy, u)
+		} else {
+			unhealthy = append(unhealthy, u)
+		}
+	}
+	for _, u := range append(healthy, unhealthy...) {
+		response, err := u.exchange(req)
+		if err == nil {
+			u.setHealthy(true)
+			return response
+		}
+		scope.Infof("upstream %v failure: %v", u, err)
+		u.setHealthy(false)
+	}
+	return nil
+}
+
+// start checks the health of the unhealthy upstreams periodically, until the forwarder is stopped.
+func (f *forwarder) start() {
+	if f == nil {
+		return
+	}
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			for _, rule := range f.rules {
+				for _, u := range rule.upstreams {
+					if !u.isHealthy() {
+						u.healthCheck()
+					}
+				}
+			}
+		}
+	}
+}
+
+func (f *forwarder) close() {
+	if f != nil {
+		close(f.stop)
+	}
+}
+
+// upstream is an upstream resolver, which is marked unhealthy when a query fails, until a health check succeeds.
+type upstream struct {
+	address  string
+	protocol string
+	client   *dns.Client
+	// httpClient is set for the https protocol.
+	httpClient *http.Client
+
+	mu      sync.RWMutex
+	healthy bool
+}
+
+func newUpstream(u Upstream) (*upstream, error) {
+	up := &upstream{
+		address:  u.Address,
+		protocol: u.Protocol,
+		healthy:  true,
+	}
+	if up.protocol == "" {
+		up.protocol = ProtocolUDP
+	}
+	var tlsConfig *tls.Config
+	if up.protocol == ProtocolTLS || up.protocol == ProtocolHTTPS {
+		tlsConfig = &tls.Config{ServerName: u.TLSServerName, MinVersion: tls.VersionTLS12}
+		if u.CACertificates != "" {
+			b, err := ioutil.ReadFile(u.CACertificates)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(b) {
+				return nil, fmt.Errorf("no certificate found in %v", u.CACertificates)
+			}
+		}
+	}
+	switch up.protocol {
+	case ProtocolUDP, ProtocolTCP:
+		up.address = withDefaultPort(up.address, "53")
+		up.client = &dns.Client{Net: up.protocol, Timeout: upstreamTimeout}
+	case ProtocolTLS:
+		up.address = withDefaultPort(up.address, "853")
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(up.address)
+		}
+		up.client = &dns.Client{Net: "tcp-tls", Timeout: upstreamTimeout, TLSConfig: tlsConfig}
+	case ProtocolHTTPS:
+		addr, err := url.Parse(up.address)
+		if err != nil {
+			return nil, err
+		}
+		if addr.Scheme != "https" || addr.Host == "" {
+			return nil, errors.New("the address must be an https URL")
+		}
+		up.httpClient = &http.Client{
+			Timeout: upstreamTimeout,
+			Transport: &http.Transport{
+				Proxy:             http.ProxyFromEnvironment,
+				TLSClientConfig:   tlsConfig,
+				ForceAttemptHTTP2: true,
+				IdleConnTimeout:   90 * time.Second,
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q", up.protocol)
+	}
+	return up, nil
+}
+
+func withDefaultPort(address, port string) string {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return net.JoinHostPort(strings.Trim(address, "[]"), port)
+	}
+	return address
+}
+
+func (u *upstream) String() string {
+	return u.protocol + "://" + strings.TrimPrefix(u.address, "https://")
+}
+
+func (u *upstream) isHealthy() bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.healthy
+}
+
+func (u *upstream) setHealthy(healthy bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.healthy != healthy {
+		log.Infof("upstream %v is now healthy: %v", u, healthy)
+		u.healthy = healthy
+	}
+}
+
+// healthCheck marks the upstream healthy if it answers a query for the root name servers, whatever the answer.
+func (u *upstream) healthCheck() {
+	req := new(dns.Msg)
+	req.SetQuestion(".", dns.TypeNS)
+	if _, err := u.exchange(req); err == nil {
+		u.setHealthy(true)
+	} else {
+		log.Debugf("health check of upstream %v failed: %v", u, err)
+	}
+}
+
+func (u *upstream) exchange(req *dns.Msg) (*dns.Msg, error) {
+	if u.protocol == ProtocolHTTPS {
+		return u.exchangeHTTPS(req)
+	}
+	response, _, err := u.client.Exchange(req, u.address)
+	if err == nil && response.Truncated && u.protocol == ProtocolUDP {
+		// Retry over TCP, so that the response is not truncated for clients querying the agent over TCP.
+		tcp := &dns.Client{Net: ProtocolTCP, Timeout: upstreamTimeout}
+		response, _, err = tcp.Exchange(req, u.address)
+	}
+	return response, err
+}
+
+// exchangeHTTPS sends the query with a POST request, as described in RFC 8484.
+func (u *upstream) exchangeHTTPS(req *dns.Msg) (*dns.Msg, error) {
+	// The ID should be 0 to maximize the HTTP cache hits.
+	query := req.Copy()
+	query.Id = 0
+	b, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, u.address, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", dohMediaType)
+	httpReq.Header.Set("Accept", dohMediaType)
+	resp, err := u.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+	response := new(dns.Msg)
+	if err := response.Unpack(body); err != nil {
+		return nil, err
+	}
+	response.Id = req.Id
+	return response, nil
+}
@@ -0,0 +1,346 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/atomic"
+
+	nds "istio.io/istio/pilot/pkg/proto"
+)
+
+// answerWith returns a handler answering A queries with the IP.
+func answerWith(ip string, queries *atomic.Int32) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		queries.Inc()
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = a(req.Question[0].Name, []net.IP{net.ParseIP(ip).To4()})
+		_ = w.WriteMsg(m)
+	}
+}
+
+// startDNSServer starts a DNS server on the listener or packet conn, returns its address.
+func startDNSServer(t *testing.T, server *dns.Server) string {
+	t.Helper()
+	up := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(up) }
+	go server.ActivateAndServe()
+	<-up
+	t.Cleanup(func() { _ = server.Shutdown() })
+	if server.PacketConn != nil {
+		return server.PacketConn.LocalAddr().String()
+	}
+	return server.Listener.Addr().String()
+}
+
+func startUDPServer(t *testing.T, handler dns.Handler) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return startDNSServer(t, &dns.Server{PacketConn: pc, Handler: handler})
+}
+
+// writeCA writes the certificate of the test server, to be trusted by the upstreams.
+func writeCA(t *testing.T, ts *httptest.Server) string {
+	t.Helper()
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := ioutil.WriteFile(ca, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func TestNewForwarder(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{name: "empty"},
+		{
+			name: "valid",
+			config: `
+- domain: corp.internal
+  upstreams:
+  - address: 10.0.0.2
+  - address: 10.0.0.3:5353
+    protocol: tcp
+- domain: .
+  upstreams:
+  - address: 1.1.1.1
+    protocol: tls
+    tlsServerName: cloudflare-dns.com
+  - address: https://dns.google/dns-query
+    protocol: https`,
+		},
+		{name: "json", config: `[{"domain":"corp.internal","upstreams":[{"address":"10.0.0.2:53"}]}]`},
+		{name: "invalid yaml", config: `domain: corp.internal`, wantErr: "invalid DNS forwarding rules"},
+		{name: "no upstream", config: `[{"domain":"corp.internal"}]`, wantErr: "no upstream"},
+		{
+			name:    "invalid protocol",
+			config:  `[{"domain":"corp.internal","upstreams":[{"address":"10.0.0.2","protocol":"quic"}]}]`,
+			wantErr: "unsupported protocol",
+		},
+		{
+			name:    "https without URL",
+			config:  `[{"domain":"corp.internal","upstreams":[{"address":"10.0.0.2","protocol":"https"}]}]`,
+			wantErr: "https URL",
+		},
+		{
+			name:    "missing CA file",
+			config:  `[{"domain":"corp.internal","upstreams":[{"address":"10.0.0.2","protocol":"tls","caCertificates":"/nonexistent"}]}]`,
+			wantErr: "nonexistent",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseForwardingRules(tt.config)
+			if err == nil {
+				_, err = newForwarder(rules)
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestForwarderMatch(t *testing.T) {
+	f, err := newForwarder([]ForwardingRule{
+		{Domain: ".", Upstreams: []Upstream{{Address: "1.1.1.1"}}},
+		{Domain: "internal", Upstreams: []Upstream{{Address: "10.0.0.1"}}},
+		{Domain: "corp.internal", Upstreams: []Upstream{{Address: "10.0.0.2"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"www.google.com.":         "udp://1.1.1.1:53",
+		"corp.internal.":          "udp://10.0.0.2:53",
+		"App.Corp.Internal.":      "udp://10.0.0.2:53",
+		"other.internal.":         "udp://10.0.0.1:53",
+		"notcorp.internal.":       "udp://10.0.0.1:53",
+		"corp.internal.example.":  "udp://1.1.1.1:53",
+		"internal.corp.internal.": "udp://10.0.0.2:53",
+	}
+	for name, want := range cases {
+		if got := f.match(name).upstreams[0].String(); got != want {
+			t.Errorf("%s: got upstream %v, want %v", name, got, want)
+		}
+	}
+	if (*forwarder)(nil).match("www.google.com.") != nil {
+		t.Error("expecting no match without forwarding rules")
+	}
+}
+
+func TestForwardingProtocols(t *testing.T) {
+	queries := atomic.NewInt32(0)
+	udp := startUDPServer(t, answerWith("10.0.0.1", queries))
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp := startDNSServer(t, &dns.Server{Listener: tcpListener, Handler: answerWith("10.0.0.2", queries)})
+
+	// The DNS over TLS server uses the certificate of the test HTTPS server, which is valid for 127.0.0.1.
+	doh := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dohMediaType || req.Unpack(body) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.Id != 0 {
+			t.Errorf("expecting DoH query ID 0, got %d", req.Id)
+		}
+		queries.Inc()
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = a(req.Question[0].Name, []net.IP{net.ParseIP("10.0.0.4").To4()})
+		b, _ := m.Pack()
+		w.Header().Set("Content-Type", dohMediaType)
+		_, _ = w.Write(b)
+	}))
+	defer doh.Close()
+	ca := writeCA(t, doh)
+
+	tlsListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot := startDNSServer(t, &dns.Server{
+		Net:      "tcp-tls",
+		Listener: tls.NewListener(tlsListener, doh.TLS),
+		Handler:  answerWith("10.0.0.3", queries),
+	})
+
+	cases := []struct {
+		name     string
+		upstream Upstream
+		want     string
+	}{
+		{name: "udp", upstream: Upstream{Address: udp}, want: "10.0.0.1"},
+		{name: "tcp", upstream: Upstream{Address: tcp, Protocol: ProtocolTCP}, want: "10.0.0.2"},
+		{name: "tls", upstream: Upstream{Address: dot, Protocol: ProtocolTLS, CACertificates: ca}, want: "10.0.0.3"},
+		{name: "https", upstream: Upstream{Address: doh.URL + "/dns-query", Protocol: ProtocolHTTPS, CACertificates: ca}, want: "10.0.0.4"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newForwarder([]ForwardingRule{{Domain: "corp.internal", Upstreams: []Upstream{tt.upstream}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := new(dns.Msg)
+			req.SetQuestion("app.corp.internal.", dns.TypeA)
+			res := f.match("app.corp.internal.").exchange(req, log)
+			if res == nil {
+				t.Fatal("query failed")
+			}
+			if res.Id != req.Id {
+				t.Errorf("response id got %d, want %d", res.Id, req.Id)
+			}
+			if len(res.Answer) != 1 || res.Answer[0].(*dns.A).A.String() != tt.want {
+				t.Errorf("got answers %v, want %v", res.Answer, tt.want)
+			}
+		})
+	}
+
+	// The certificate of the resolver is verified.
+	f, err := newForwarder([]ForwardingRule{{Domain: "corp.internal", Upstreams: []Upstream{{Address: dot, Protocol: ProtocolTLS}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := new(dns.Msg)
+	req.SetQuestion("app.corp.internal.", dns.TypeA)
+	if res := f.match("app.corp.internal.").exchange(req, log); res != nil {
+		t.Errorf("expecting the query to fail with an untrusted certificate, got %v", res)
+	}
+}
+
+func TestForwardingFailover(t *testing.T) {
+	primaryQueries := atomic.NewInt32(0)
+	secondaryQueries := atomic.NewInt32(0)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := listener.Addr().String()
+	// The primary is down.
+	listener.Close()
+	secondary := startUDPServer(t, answerWith("10.0.0.2", secondaryQueries))
+
+	f, err := newForwarder([]ForwardingRule{{Domain: "corp.internal", Upstreams: []Upstream{
+		{Address: primary, Protocol: ProtocolTCP},
+		{Address: secondary},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := f.match("app.corp.internal.")
+	query := func() string {
+		t.Helper()
+		req := new(dns.Msg)
+		req.SetQuestion("app.corp.internal.", dns.TypeA)
+		res := rule.exchange(req, log)
+		if res == nil || len(res.Answer) != 1 {
+			t.Fatalf("query failed: %v", res)
+		}
+		return res.Answer[0].(*dns.A).A.String()
+	}
+
+	if got := query(); got != "10.0.0.2" {
+		t.Errorf("expecting the secondary to answer, got %v", got)
+	}
+	if rule.upstreams[0].isHealthy() {
+		t.Error("expecting the primary to be unhealthy")
+	}
+	if got := query(); got != "10.0.0.2" {
+		t.Errorf("expecting the secondary to answer, got %v", got)
+	}
+
+	// The primary is back, the health check marks it healthy again.
+	listener, err = net.Listen("tcp", primary)
+	if err != nil {
+		t.Skipf("failed to listen on %v again: %v", primary, err)
+	}
+	startDNSServer(t, &dns.Server{Listener: listener, Handler: answerWith("10.0.0.1", primaryQueries)})
+	old := healthCheckInterval
+	healthCheckInterval = 10 * time.Millisecond
+	defer func() { healthCheckInterval = old }()
+	go f.start()
+	defer f.close()
+	for i := 0; !rule.upstreams[0].isHealthy(); i++ {
+		if i > 500 {
+			t.Fatal("expecting the primary to be healthy again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := query(); got != "10.0.0.1" {
+		t.Errorf("expecting the primary to answer, got %v", got)
+	}
+	if n := secondaryQueries.Load(); n != 2 {
+		t.Errorf("expecting 2 queries to the secondary, got %d", n)
+	}
+}
+
+func TestDNSForwardingRules(t *testing.T) {
+	queries := atomic.NewInt32(0)
+	corp := startUDPServer(t, answerWith("10.0.0.1", queries))
+	testAgentDNS, err := NewLocalDNSServer("ns1", "ns1.svc.cluster.local", []ForwardingRule{
+		{Domain: "corp.internal", Upstreams: []Upstream{{Address: corp}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAgentDNS.resolvConfServers = []string{makeUpstream(t, map[string]string{"www.bing.com.": "1.1.1.1"})}
+	testAgentDNS.StartDNS()
+	testAgentDNS.UpdateLookupTable(&nds.NameTable{})
+	t.Cleanup(testAgentDNS.Close)
+
+	for host, want := range map[string]string{"app.corp.internal.": "10.0.0.1", "www.bing.com.": "1.1.1.1"} {
+		m := new(dns.Msg)
+		m.SetQuestion(host, dns.TypeA)
+		res, err := dns.Exchange(m, testAgentDNSAddr)
+		if err != nil {
+			t.Fatalf("Failed to resolve query for %s: %v", host, err)
+		}
+		if len(res.Answer) != 1 || res.Answer[0].(*dns.A).A.String() != want {
+			t.Errorf("%s: got answers %v, want %v", host, res.Answer, want)
+		}
+	}
+	if n := queries.Load(); n != 1 {
+		t.Errorf("expecting 1 query forwarded to the corp resolver, got %d", n)
+	}
+}
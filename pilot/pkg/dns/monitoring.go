@@ -18,7 +18,14 @@ import (
 	"istio.io/pkg/monitoring"
 )
 
+const (
+	positiveResponse = "positive"
+	negativeResponse = "negative"
+)
+
 var (
+	typeTag = monitoring.MustCreateLabel("type")
+
 	requests = monitoring.NewSum(
 		"dns_requests_total",
 		"Total number of DNS requests.",
@@ -39,6 +46,22 @@ var (
 		"Total time in seconds Istio takes to get DNS response from upstream.",
 		[]float64{.005, .001, 0.01, 0.1, 1, 5},
 	)
+
+	cacheHits = monitoring.NewSum(
+		"dns_upstream_cache_hits_total",
+		"Total number of DNS requests answered from the cache of upstream responses.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	cacheMisses = monitoring.NewSum(
+		"dns_upstream_cache_misses_total",
+		"Total number of DNS requests not found in the cache of upstream responses.",
+	)
+
+	cacheSize = monitoring.NewGauge(
+		"dns_upstream_cache_entries",
+		"Number of upstream DNS responses in the cache.",
+	)
 )
 
 func registerStats() {
@@ -46,4 +69,7 @@ func registerStats() {
 	monitoring.MustRegister(upstreamRequests)
 	monitoring.MustRegister(failures)
 	monitoring.MustRegister(requestDuration)
+	monitoring.MustRegister(cacheHits)
+	monitoring.MustRegister(cacheMisses)
+	monitoring.MustRegister(cacheSize)
 }
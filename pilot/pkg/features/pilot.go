@@ -76,6 +76,39 @@ var (
 	// Currently this may cause a bug when we go from N clusters -> 0 clusters -> N clusters
 	FilterGatewayClusterConfig = env.RegisterBoolVar("PILOT_FILTER_GATEWAY_CLUSTER_CONFIG", false, "").Get()
 
+	PushBudgetProxyQPS = env.RegisterFloatVar(
+		"PILOT_PUSH_BUDGET_PROXY_QPS",
+		0,
+		"If greater than zero, limits the rate of pushes to a single proxy. Pushes over the budget are "+
+			"deferred and merged into a single later push. Disabled by default.",
+	).Get()
+
+	PushBudgetProxyBurst = env.RegisterIntVar(
+		"PILOT_PUSH_BUDGET_PROXY_BURST",
+		10,
+		"The number of pushes a single proxy may receive in a burst when PILOT_PUSH_BUDGET_PROXY_QPS is set.",
+	).Get()
+
+	PushBudgetNamespaceQPS = env.RegisterFloatVar(
+		"PILOT_PUSH_BUDGET_NAMESPACE_QPS",
+		0,
+		"If greater than zero, limits the combined rate of pushes to all proxies in a namespace. Pushes over the "+
+			"budget are deferred and merged into a single later push. Disabled by default.",
+	).Get()
+
+	PushBudgetNamespaceBurst = env.RegisterIntVar(
+		"PILOT_PUSH_BUDGET_NAMESPACE_BURST",
+		100,
+		"The number of pushes the proxies in a namespace may receive in a burst when PILOT_PUSH_BUDGET_NAMESPACE_QPS is set.",
+	).Get()
+
+	PushTraceSize = env.RegisterIntVar(
+		"PILOT_PUSH_TRACE_SIZE",
+		20,
+		"The number of recent pushes, and push decisions for each proxy, recorded for the /debug/push_trace "+
+			"endpoint. If 0, push tracing is disabled.",
+	).Get()
+
 	DebounceAfter = env.RegisterDurationVar(
 		"PILOT_DEBOUNCE_AFTER",
 		100*time.Millisecond,
@@ -314,6 +347,9 @@ var (
 	EnableUnsafeAdminEndpoints = env.RegisterBoolVar("UNSAFE_ENABLE_ADMIN_ENDPOINTS", false,
 		"If this is set to true, dangerous admin endpoins will be exposed on the debug interface. Not recommended for production.").Get()
 
+	// IstiodServiceAccount is the service account of Istiod, the only identity allowed to call the CA debug endpoints.
+	IstiodServiceAccount = env.RegisterStringVar("SERVICE_ACCOUNT", "", "Name of service account").Get()
+
 	XDSAuth = env.RegisterBoolVar("XDS_AUTH", true,
 		"If true, will authenticate XDS clients.").Get()
 
@@ -355,6 +391,13 @@ var (
 	XDSCacheMaxSize = env.RegisterIntVar("PILOT_XDS_CACHE_SIZE", 20000,
 		"The maximum number of cache entries for the XDS cache.").Get()
 
+	XDSCacheSnapshotPath = env.RegisterStringVar("PILOT_XDS_CACHE_SNAPSHOT_PATH", "",
+		"If set, Pilot will periodically write the XDS cache to this file, and restore entries that are still "+
+			"valid for the current configuration from it on startup.").Get()
+
+	XDSCacheSnapshotInterval = env.RegisterDurationVar("PILOT_XDS_CACHE_SNAPSHOT_INTERVAL", 5*time.Minute,
+		"The interval at which the XDS cache is written to PILOT_XDS_CACHE_SNAPSHOT_PATH.").Get()
+
 	// EnableLegacyFSGroupInjection has first-party-jwt as allowed because we only
 	// need the fsGroup configuration for the projected service account volume mount,
 	// which is only used by first-party-jwt. The installer will automatically
@@ -422,6 +465,18 @@ var (
 		"If enabled, Istio agent will intercept ECDS resource update, downloads Wasm module, "+
 			"and replaces Wasm module remote load with downloaded local module file.").Get()
 
+	WasmModuleCacheMaxSizeMB = env.RegisterIntVar("ISTIO_AGENT_WASM_MODULE_CACHE_MAX_SIZE_MB", 0,
+		"The maximum total size in MB of the Wasm modules cached by Istio agent. When it is exceeded, "+
+			"the least recently used modules are evicted. 0 means unbounded.").Get()
+
+	WasmModuleVerificationKeys = env.RegisterStringVar("ISTIO_AGENT_WASM_MODULE_VERIFICATION_KEYS", "",
+		"The file of PEM encoded public keys Istio agent verifies the Wasm module signatures with. If set, "+
+			"only modules signed with one of the keys are handed to Envoy.").Get()
+
+	DNSUpstreamCacheMaxEntries = env.RegisterIntVar("ISTIO_AGENT_DNS_CACHE_MAX_ENTRIES", 1000,
+		"The maximum number of upstream DNS responses, including negative ones, cached by Istio agent "+
+			"for the duration of their TTL. 0 disables the cache.").Get()
+
 	PilotJwtPubKeyRefreshInterval = env.RegisterDurationVar(
 		"PILOT_JWT_PUB_KEY_REFRESH_INTERVAL",
 		20*time.Minute,
@@ -461,12 +516,23 @@ var (
 		"If enabled, pilot will allow any upstream cluster to be used with AUTO_PASSTHROUGH. "+
 			"This option is intended for backwards compatibility only and is not secure with untrusted downstreams; it will be removed in the future.").Get()
 
+	GitConfigWebhookSecret = env.RegisterStringVar("PILOT_GIT_CONFIG_WEBHOOK_SECRET", "",
+		"The shared secret that signs the calls to the webhook of git config sources, with HMAC-SHA256 in the "+
+			"X-Hub-Signature-256 header. A webhook can only be configured if it is set.").Get()
+
 	SharedMeshConfig = env.RegisterStringVar("SHARED_MESH_CONFIG", "",
 		"Additional config map to load for shared MeshConfig settings. The standard mesh config will take precedence.").Get()
 
 	MultiRootMesh = env.RegisterBoolVar("ISTIO_MULTIROOT_MESH", false,
 		"If enabled, mesh will support certificates signed by more than one trustAnchor for ISTIO_MUTUAL mTLS").Get()
 
+	EnableSpiffeBundleEndpoint = env.RegisterBoolVar("PILOT_ENABLE_SPIFFE_BUNDLE_ENDPOINT", false,
+		"If enabled, Istiod serves the trust bundle of the mesh trust domain at /spiffe/bundle on its HTTPS port, "+
+			"as a SPIFFE bundle endpoint, so other trust domains can federate with the mesh.").Get()
+
+	SpiffeBundleRefreshHint = env.RegisterDurationVar("PILOT_SPIFFE_BUNDLE_REFRESH_HINT", 5*time.Minute,
+		"The refresh hint of the SPIFFE bundle served by Istiod, telling other trust domains how often to fetch it.").Get()
+
 	EnableEnvoyFilterMetrics = env.RegisterBoolVar("PILOT_ENVOY_FILTER_STATS", false,
 		"If true, Pilot will collect metrics for envoy filter operations.").Get()
 
@@ -205,6 +205,10 @@ type PushContext struct {
 	// this is mainly used for kubernetes multi-cluster scenario
 	networkMgr *NetworkManager
 
+	// trustDomainBundles holds the trust anchors of each trust domain when the mesh is federated with other
+	// trust domains, and is nil otherwise.
+	trustDomainBundles map[string][]string
+
 	initDone        atomic.Bool
 	initializeMutex sync.Mutex
 }
@@ -966,6 +970,8 @@ func (ps *PushContext) InitContext(env *Environment, oldPushContext *PushContext
 	// TODO: only do this when meshnetworks or gateway service changed
 	ps.initNetworkManager(env)
 
+	ps.initTrustDomainBundles(env)
+
 	ps.clusterLocalHosts = env.ClusterLocal().GetClusterLocalHosts()
 
 	ps.initDone.Store(true)
@@ -1882,6 +1888,54 @@ func (ps *PushContext) NetworkManager() *NetworkManager {
 	return ps.networkMgr
 }
 
+// initTrustDomainBundles maps the trust domains federated with the mesh and the mesh trust domain, with its aliases,
+// to their trust anchors. The federated trust anchors are only trusted for identities of their own trust domain.
+func (ps *PushContext) initTrustDomainBundles(env *Environment) {
+	ps.trustDomainBundles = nil
+	if env.TrustBundle == nil {
+		return
+	}
+	federated := env.TrustBundle.GetFederatedTrustBundles()
+	meshRoots := env.TrustBundle.GetTrustBundle()
+	// Without the mesh trust anchors, the identities of the mesh could not be validated by trust domain.
+	if len(federated) == 0 || len(meshRoots) == 0 {
+		return
+	}
+	bundles := make(map[string][]string, len(federated)+1)
+	for td, roots := range federated {
+		bundles[td] = roots
+	}
+	for _, td := range append([]string{ps.Mesh.GetTrustDomain()}, ps.Mesh.GetTrustDomainAliases()...) {
+		bundles[td] = meshRoots
+	}
+	ps.trustDomainBundles = bundles
+}
+
+// TrustDomainBundles returns the trust anchors keyed by trust domain when the mesh is federated with other trust
+// domains, or nil if it is not.
+func (ps *PushContext) TrustDomainBundles() map[string][]string {
+	return ps.trustDomainBundles
+}
+
+// FederatedTrustDomains returns the sorted trust domains federated with the mesh trust domain.
+func (ps *PushContext) FederatedTrustDomains() []string {
+	if len(ps.trustDomainBundles) == 0 {
+		return nil
+	}
+	mesh := map[string]bool{ps.Mesh.GetTrustDomain(): true}
+	for _, td := range ps.Mesh.GetTrustDomainAliases() {
+		mesh[td] = true
+	}
+	out := make([]string, 0, len(ps.trustDomainBundles))
+	for td := range ps.trustDomainBundles {
+		if !mesh[td] {
+			out = append(out, td)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
 // BestEffortInferServiceMTLSMode infers the mTLS mode for the service + port from all authentication
 // policies (both alpha and beta) in the system. The function always returns MTLSUnknown for external service.
 // The result is a best effort. It is because the PeerAuthentication is workload-based, this function is unable
@@ -0,0 +1,281 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"google.golang.org/protobuf/proto"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pkg/config"
+	"istio.io/pkg/monitoring"
+)
+
+func init() {
+	monitoring.MustRegister(xdsCacheSnapshotEntries)
+}
+
+var (
+	snapshotOperationTag = monitoring.MustCreateLabel("operation")
+
+	xdsCacheSnapshotEntries = monitoring.NewGauge(
+		"xds_cache_snapshot_entries",
+		"Number of xds cache entries written to, or restored from, the last cache snapshot.",
+		monitoring.WithLabels(snapshotOperationTag),
+	)
+
+	xdsCacheSnapshotSaved    = xdsCacheSnapshotEntries.With(snapshotOperationTag.Value("save"))
+	xdsCacheSnapshotRestored = xdsCacheSnapshotEntries.With(snapshotOperationTag.Value("restore"))
+)
+
+// XdsCacheVersioner computes the versions of the configuration that cache entries depend on. Versions
+// must be stable across restarts of istiod: the same configuration must always have the same version.
+type XdsCacheVersioner interface {
+	// ConfigVersion returns the current version of a config. If false is returned, the config cannot be
+	// versioned, and entries that depend on it will not be persisted.
+	ConfigVersion(key ConfigKey) (string, bool)
+	// TypeVersion returns the current version of all configs of a type. If false is returned, the type
+	// cannot be versioned, and entries that depend on it will not be persisted.
+	TypeVersion(kind config.GroupVersionKind) (string, bool)
+}
+
+// PersistentXdsCache is an XdsCache that can snapshot its entries to disk and restore them, so that the
+// cache is warm after istiod restarts.
+type PersistentXdsCache interface {
+	XdsCache
+	// Save writes all cached values to disk, along with the version of every config they depend on. It
+	// returns the number of entries written.
+	Save(v XdsCacheVersioner) (int, error)
+	// Restore loads entries from disk into the cache. An entry is only restored if every config it
+	// depends on still has the version it had when the snapshot was taken. It returns the number of
+	// entries restored.
+	Restore(v XdsCacheVersioner) (int, error)
+}
+
+// NewPersistentXdsCache returns an XdsCache that persists its entries to the file at path.
+func NewPersistentXdsCache(path string) PersistentXdsCache {
+	return &persistentCache{
+		lruCache: newLruCache(features.EnableUnsafeAssertions),
+		path:     path,
+	}
+}
+
+type persistentCache struct {
+	*lruCache
+	path string
+}
+
+var _ PersistentXdsCache = &persistentCache{}
+
+// xdsCacheSnapshot is the on disk format of a cache snapshot.
+type xdsCacheSnapshot struct {
+	Entries []xdsCacheSnapshotEntry `json:"entries"`
+}
+
+type xdsCacheSnapshotEntry struct {
+	Key string `json:"key"`
+	// Resource is the serialized discovery.Resource.
+	Resource []byte                        `json:"resource"`
+	Configs  []xdsCacheSnapshotConfigEntry `json:"configs,omitempty"`
+	Types    []xdsCacheSnapshotTypeEntry   `json:"types,omitempty"`
+}
+
+type xdsCacheSnapshotConfigEntry struct {
+	Key     ConfigKey `json:"key"`
+	Version string    `json:"version"`
+}
+
+type xdsCacheSnapshotTypeEntry struct {
+	Kind    config.GroupVersionKind `json:"kind"`
+	Version string                  `json:"version"`
+}
+
+// persistedEntry is an XdsCacheEntry restored from a snapshot. It is used to index restored values.
+type persistedEntry struct {
+	key     string
+	configs []ConfigKey
+	types   []config.GroupVersionKind
+}
+
+var _ XdsCacheEntry = persistedEntry{}
+
+func (p persistedEntry) Key() string {
+	return p.key
+}
+
+func (p persistedEntry) DependentTypes() []config.GroupVersionKind {
+	return p.types
+}
+
+func (p persistedEntry) DependentConfigs() []ConfigKey {
+	return p.configs
+}
+
+func (p persistedEntry) Cacheable() bool {
+	return true
+}
+
+func (p *persistentCache) Save(v XdsCacheVersioner) (int, error) {
+	snapshot := p.snapshotEntries(v)
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		return 0, err
+	}
+	// Write to a temporary file first so that a crash while writing does not leave a corrupt snapshot.
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), filepath.Base(p.path)+".tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), p.path); err != nil {
+		return 0, err
+	}
+	xdsCacheSnapshotSaved.Record(float64(len(snapshot.Entries)))
+	return len(snapshot.Entries), nil
+}
+
+func (p *persistentCache) snapshotEntries(v XdsCacheVersioner) xdsCacheSnapshot {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	// Invert the indexes to find the dependencies of each key.
+	configs := map[string][]ConfigKey{}
+	for ckey, keys := range p.configIndex {
+		for k := range keys {
+			configs[k] = append(configs[k], ckey)
+		}
+	}
+	types := map[string][]config.GroupVersionKind{}
+	for kind, keys := range p.typesIndex {
+		for k := range keys {
+			types[k] = append(types[k], kind)
+		}
+	}
+
+	snapshot := xdsCacheSnapshot{}
+	for _, ik := range p.store.Keys() {
+		k := ik.(string)
+		val, ok := p.store.Peek(k)
+		if !ok || val.(cacheValue).value == nil {
+			continue
+		}
+		if len(configs[k]) == 0 && len(types[k]) == 0 {
+			// Without any dependencies we have no way to check the entry is still valid.
+			continue
+		}
+		entry, ok := snapshotEntry(v, k, val.(cacheValue).value, configs[k], types[k])
+		if !ok {
+			continue
+		}
+		snapshot.Entries = append(snapshot.Entries, entry)
+	}
+	return snapshot
+}
+
+func snapshotEntry(v XdsCacheVersioner, key string, value *discovery.Resource,
+	configs []ConfigKey, types []config.GroupVersionKind) (xdsCacheSnapshotEntry, bool) {
+	entry := xdsCacheSnapshotEntry{Key: key}
+	for _, ckey := range configs {
+		version, ok := v.ConfigVersion(ckey)
+		if !ok {
+			return entry, false
+		}
+		entry.Configs = append(entry.Configs, xdsCacheSnapshotConfigEntry{Key: ckey, Version: version})
+	}
+	for _, kind := range types {
+		version, ok := v.TypeVersion(kind)
+		if !ok {
+			return entry, false
+		}
+		entry.Types = append(entry.Types, xdsCacheSnapshotTypeEntry{Kind: kind, Version: version})
+	}
+	b, err := proto.Marshal(value)
+	if err != nil {
+		log.Warnf("failed to marshal xds cache entry %v: %v", key, err)
+		return entry, false
+	}
+	entry.Resource = b
+	return entry, true
+}
+
+func (p *persistentCache) Restore(v XdsCacheVersioner) (int, error) {
+	b, err := os.ReadFile(p.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	snapshot := xdsCacheSnapshot{}
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return 0, fmt.Errorf("failed to parse xds cache snapshot %v: %v", p.path, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	restored := 0
+	for _, e := range snapshot.Entries {
+		entry, ok := validateSnapshotEntry(v, e)
+		if !ok {
+			continue
+		}
+		if _, f := p.store.Peek(e.Key); f {
+			// Never overwrite entries generated since startup; they are at least as fresh.
+			continue
+		}
+		res := &discovery.Resource{}
+		if err := proto.Unmarshal(e.Resource, res); err != nil {
+			log.Warnf("failed to unmarshal xds cache entry %v: %v", e.Key, err)
+			continue
+		}
+		p.store.Add(e.Key, cacheValue{value: res, token: CacheToken(p.nextToken.Inc())})
+		indexConfig(p.configIndex, e.Key, entry)
+		indexType(p.typesIndex, e.Key, entry)
+		restored++
+	}
+	size(p.store.Len())
+	xdsCacheSnapshotRestored.Record(float64(restored))
+	return restored, nil
+}
+
+// validateSnapshotEntry checks that every dependency of the entry has the same version as when it was persisted.
+func validateSnapshotEntry(v XdsCacheVersioner, e xdsCacheSnapshotEntry) (persistedEntry, bool) {
+	entry := persistedEntry{key: e.Key}
+	for _, c := range e.Configs {
+		if version, ok := v.ConfigVersion(c.Key); !ok || version != c.Version {
+			return entry, false
+		}
+		entry.configs = append(entry.configs, c.Key)
+	}
+	for _, t := range e.Types {
+		if version, ok := v.TypeVersion(t.Kind); !ok || version != t.Version {
+			return entry, false
+		}
+		entry.types = append(entry.types, t.Kind)
+	}
+	return entry, true
+}
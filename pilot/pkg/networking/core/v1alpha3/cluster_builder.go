@@ -760,6 +760,10 @@ func (cb *ClusterBuilder) buildUpstreamClusterTLSContext(opts *buildClusterOpts,
 				ValidationContextSdsSecretConfig: authn_model.ConstructSdsSecretConfig(authn_model.SDSRootResourceName),
 			},
 		}
+		// Validate the peers of federated trust domains against the trust anchors of their own trust domain.
+		if cb.push != nil {
+			authn_model.ApplySpiffeValidator(tlsContext.CommonTlsContext, cb.push.TrustDomainBundles())
+		}
 		// Set default SNI of cluster name for istio_mutual if sni is not set.
 		if len(tlsContext.Sni) == 0 {
 			tlsContext.Sni = c.cluster.Name
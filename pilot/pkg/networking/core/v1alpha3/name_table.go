@@ -23,6 +23,7 @@ import (
 	nds "istio.io/istio/pilot/pkg/proto"
 	"istio.io/istio/pilot/pkg/serviceregistry/provider"
 	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/protocol"
 )
 
 // BuildNameTable produces a table of hostnames and their associated IPs that can then
@@ -112,6 +113,7 @@ func (configgen *ConfigGeneratorImpl) BuildNameTable(node *model.Proxy, push *mo
 		nameInfo := &nds.NameTable_NameInfo{
 			Ips:      addressList,
 			Registry: string(svc.Attributes.ServiceRegistry),
+			Ports:    buildNameTablePorts(svc.Ports),
 		}
 		if svc.Attributes.ServiceRegistry == provider.Kubernetes {
 			// The agent will take care of resolving a, a.ns, a.ns.svc, etc.
@@ -123,3 +125,24 @@ func (configgen *ConfigGeneratorImpl) BuildNameTable(node *model.Proxy, push *mo
 	}
 	return out
 }
+
+// buildNameTablePorts returns the named ports of the service, for the agent to answer SRV queries.
+func buildNameTablePorts(ports model.PortList) []*nds.NameTable_Port {
+	var out []*nds.NameTable_Port
+	for _, port := range ports {
+		if port.Name == "" {
+			// SRV records are only defined for named ports, like in Kubernetes.
+			continue
+		}
+		transport := "tcp"
+		if port.Protocol == protocol.UDP {
+			transport = "udp"
+		}
+		out = append(out, &nds.NameTable_Port{
+			Name:     port.Name,
+			Port:     uint32(port.Port),
+			Protocol: transport,
+		})
+	}
+	return out
+}
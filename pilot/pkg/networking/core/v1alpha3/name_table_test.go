@@ -212,6 +212,7 @@ func TestNameTable(t *testing.T) {
 						Registry:  "Kubernetes",
 						Shortname: "headless-svc",
 						Namespace: "testns",
+						Ports:     []*nds.NameTable_Port{{Name: "tcp-port", Port: 9000, Protocol: "tcp"}},
 					},
 				},
 			},
@@ -245,6 +246,7 @@ func TestNameTable(t *testing.T) {
 						Registry:  "Kubernetes",
 						Shortname: "headless-svc",
 						Namespace: "testns",
+						Ports:     []*nds.NameTable_Port{{Name: "tcp-port", Port: 9000, Protocol: "tcp"}},
 					},
 				},
 			},
@@ -284,6 +286,7 @@ func TestNameTable(t *testing.T) {
 						Registry:  "Kubernetes",
 						Shortname: "headless-svc",
 						Namespace: "testns",
+						Ports:     []*nds.NameTable_Port{{Name: "tcp-port", Port: 9000, Protocol: "tcp"}},
 					},
 				},
 			},
@@ -324,6 +327,7 @@ func TestNameTable(t *testing.T) {
 						Registry:  "Kubernetes",
 						Shortname: "headless-svc",
 						Namespace: "testns",
+						Ports:     []*nds.NameTable_Port{{Name: "tcp-port", Port: 9000, Protocol: "tcp"}},
 					},
 				},
 			},
@@ -339,6 +343,10 @@ func TestNameTable(t *testing.T) {
 						Registry:  "Kubernetes",
 						Shortname: "wildcard-svc",
 						Namespace: "testns",
+						Ports: []*nds.NameTable_Port{
+							{Name: "tcp-port", Port: 9000, Protocol: "tcp"},
+							{Name: "http-port", Port: 8000, Protocol: "tcp"},
+						},
 					},
 				},
 			},
@@ -20,12 +20,13 @@ import (
 	"istio.io/istio/pilot/pkg/util/sets"
 )
 
-func trustDomainsForValidation(meshConfig *meshconfig.MeshConfig) []string {
+func trustDomainsForValidation(meshConfig *meshconfig.MeshConfig, federatedTrustDomains []string) []string {
 	if features.SkipValidateTrustDomain {
 		return nil
 	}
 
 	tds := append([]string{meshConfig.TrustDomain}, meshConfig.TrustDomainAliases...)
+	tds = append(tds, federatedTrustDomains...)
 	return dedupTrustDomains(tds)
 }
 
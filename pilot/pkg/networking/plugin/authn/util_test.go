@@ -25,6 +25,7 @@ func TestTrustDomainsForValidation(t *testing.T) {
 	tests := []struct {
 		name       string
 		meshConfig *meshconfig.MeshConfig
+		federated  []string
 		want       []string
 	}{
 		{
@@ -60,10 +61,19 @@ func TestTrustDomainsForValidation(t *testing.T) {
 			},
 			want: []string{"cluster.local", "alias-1.domain", "alias-2.domain", "some-other-alias-1.domain"},
 		},
+		{
+			name: "Federated trust domains",
+			meshConfig: &meshconfig.MeshConfig{
+				TrustDomain:        "cluster.local",
+				TrustDomainAliases: []string{"alias-1.domain"},
+			},
+			federated: []string{"bar.org", "foo.org", "alias-1.domain"},
+			want:      []string{"cluster.local", "alias-1.domain", "bar.org", "foo.org"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := trustDomainsForValidation(tt.meshConfig); !reflect.DeepEqual(got, tt.want) {
+			if got := trustDomainsForValidation(tt.meshConfig, tt.federated); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("trustDomainsForValidation() = %#v, want %#v", got, tt.want)
 			}
 		})
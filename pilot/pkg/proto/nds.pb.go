@@ -69,11 +69,13 @@ type NameTable_NameInfo struct {
 	// the registry where this
 	Registry string `protobuf:"bytes,2,opt,name=registry,proto3" json:"registry,omitempty"`
 	// these are set only for k8s services
-	Shortname            string   `protobuf:"bytes,3,opt,name=shortname,proto3" json:"shortname,omitempty"`
-	Namespace            string   `protobuf:"bytes,4,opt,name=namespace,proto3" json:"namespace,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Shortname string `protobuf:"bytes,3,opt,name=shortname,proto3" json:"shortname,omitempty"`
+	Namespace string `protobuf:"bytes,4,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	// the ports of the service, used to synthesize SRV records
+	Ports                []*NameTable_Port `protobuf:"bytes,5,rep,name=ports,proto3" json:"ports,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *NameTable_NameInfo) Reset()         { *m = NameTable_NameInfo{} }
@@ -129,10 +131,74 @@ func (m *NameTable_NameInfo) GetNamespace() string {
 	return ""
 }
 
+func (m *NameTable_NameInfo) GetPorts() []*NameTable_Port {
+	if m != nil {
+		return m.Ports
+	}
+	return nil
+}
+
+type NameTable_Port struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Port uint32 `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	// the transport protocol of the port, tcp or udp
+	Protocol             string   `protobuf:"bytes,3,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *NameTable_Port) Reset()         { *m = NameTable_Port{} }
+func (m *NameTable_Port) String() string { return proto.CompactTextString(m) }
+func (*NameTable_Port) ProtoMessage()    {}
+func (*NameTable_Port) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3cd1956996ab4e55, []int{0, 1}
+}
+
+func (m *NameTable_Port) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_NameTable_Port.Unmarshal(m, b)
+}
+func (m *NameTable_Port) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_NameTable_Port.Marshal(b, m, deterministic)
+}
+func (m *NameTable_Port) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_NameTable_Port.Merge(m, src)
+}
+func (m *NameTable_Port) XXX_Size() int {
+	return xxx_messageInfo_NameTable_Port.Size(m)
+}
+func (m *NameTable_Port) XXX_DiscardUnknown() {
+	xxx_messageInfo_NameTable_Port.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_NameTable_Port proto.InternalMessageInfo
+
+func (m *NameTable_Port) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *NameTable_Port) GetPort() uint32 {
+	if m != nil {
+		return m.Port
+	}
+	return 0
+}
+
+func (m *NameTable_Port) GetProtocol() string {
+	if m != nil {
+		return m.Protocol
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*NameTable)(nil), "istio.networking.nds.v1.NameTable")
 	proto.RegisterMapType((map[string]*NameTable_NameInfo)(nil), "istio.networking.nds.v1.NameTable.TableEntry")
 	proto.RegisterType((*NameTable_NameInfo)(nil), "istio.networking.nds.v1.NameTable.NameInfo")
+	proto.RegisterType((*NameTable_Port)(nil), "istio.networking.nds.v1.NameTable.Port")
 }
 
 func init() {
@@ -140,20 +206,23 @@ func init() {
 }
 
 var fileDescriptor_3cd1956996ab4e55 = []byte{
-	// 229 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xcc, 0x4b, 0x29, 0xd6,
-	0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x12, 0xcf, 0x2c, 0x2e, 0xc9, 0xcc, 0xd7, 0xcb, 0x4b, 0x2d,
-	0x29, 0xcf, 0x2f, 0xca, 0xce, 0xcc, 0x4b, 0xd7, 0x03, 0xc9, 0x95, 0x19, 0x2a, 0xad, 0x65, 0xe2,
-	0xe2, 0xf4, 0x4b, 0xcc, 0x4d, 0x0d, 0x49, 0x4c, 0xca, 0x49, 0x15, 0x72, 0xe6, 0x62, 0x2d, 0x01,
-	0x31, 0x24, 0x18, 0x15, 0x98, 0x35, 0xb8, 0x8d, 0x74, 0xf5, 0x70, 0x68, 0xd3, 0x83, 0x6b, 0xd1,
-	0x03, 0x93, 0xae, 0x79, 0x25, 0x45, 0x95, 0x41, 0x10, 0xbd, 0x52, 0x25, 0x5c, 0x1c, 0x20, 0x69,
-	0xcf, 0xbc, 0xb4, 0x7c, 0x21, 0x01, 0x2e, 0xe6, 0xcc, 0x82, 0x62, 0xb0, 0x71, 0x9c, 0x41, 0x20,
-	0xa6, 0x90, 0x14, 0x17, 0x47, 0x51, 0x6a, 0x7a, 0x66, 0x71, 0x49, 0x51, 0xa5, 0x04, 0x93, 0x02,
-	0xa3, 0x06, 0x67, 0x10, 0x9c, 0x2f, 0x24, 0xc3, 0xc5, 0x59, 0x9c, 0x91, 0x5f, 0x54, 0x92, 0x97,
-	0x98, 0x9b, 0x2a, 0xc1, 0x0c, 0x96, 0x44, 0x08, 0x80, 0x64, 0x41, 0x74, 0x71, 0x41, 0x62, 0x72,
-	0xaa, 0x04, 0x0b, 0x44, 0x16, 0x2e, 0x20, 0x95, 0xca, 0xc5, 0x85, 0x70, 0x0a, 0xc8, 0xde, 0xec,
-	0xd4, 0x4a, 0x09, 0x46, 0xb0, 0x2a, 0x10, 0x53, 0xc8, 0x91, 0x8b, 0xb5, 0x2c, 0x31, 0xa7, 0x34,
-	0x15, 0x6c, 0x29, 0xb7, 0x91, 0x36, 0x11, 0x5e, 0x83, 0xf9, 0x22, 0x08, 0xa2, 0xd3, 0x8a, 0xc9,
-	0x82, 0x31, 0x89, 0x0d, 0x1c, 0x9e, 0xc6, 0x80, 0x00, 0x00, 0x00, 0xff, 0xff, 0x4b, 0x59, 0x9f,
-	0x74, 0x5c, 0x01, 0x00, 0x00,
+	// 278 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x50, 0xc1, 0x4a, 0x03, 0x31,
+	0x10, 0x25, 0xdd, 0xae, 0x34, 0x53, 0x04, 0xc9, 0xc5, 0xb0, 0x78, 0x28, 0x5e, 0x2c, 0x88, 0x01,
+	0xeb, 0x45, 0x04, 0x0f, 0x22, 0x1e, 0xf4, 0x20, 0x12, 0xfc, 0x81, 0xb4, 0xc6, 0x1a, 0xba, 0x4d,
+	0x96, 0x24, 0x56, 0xf6, 0xbb, 0x3c, 0xf9, 0x77, 0x32, 0xb3, 0x75, 0x7b, 0x12, 0x7a, 0xd9, 0x7d,
+	0x33, 0x6f, 0xdf, 0x9b, 0xb7, 0x0f, 0xb8, 0x7f, 0x4b, 0xaa, 0x89, 0x21, 0x07, 0x71, 0xec, 0x52,
+	0x76, 0x41, 0x79, 0x9b, 0xbf, 0x42, 0x5c, 0x39, 0xbf, 0x54, 0xc8, 0x6d, 0x2e, 0x4f, 0x7f, 0x0a,
+	0xe0, 0xcf, 0x66, 0x6d, 0x5f, 0xcd, 0xbc, 0xb6, 0xe2, 0x1e, 0xca, 0x8c, 0x40, 0xb2, 0x49, 0x31,
+	0x1d, 0xcf, 0x2e, 0xd4, 0x3f, 0x32, 0xd5, 0x4b, 0x14, 0x3d, 0x1f, 0x7c, 0x8e, 0xad, 0xee, 0xb4,
+	0xd5, 0x37, 0x83, 0x11, 0xf2, 0x8f, 0xfe, 0x3d, 0x88, 0x23, 0x28, 0x5c, 0x93, 0xc8, 0x8f, 0x6b,
+	0x84, 0xa2, 0x82, 0x51, 0xb4, 0x4b, 0x97, 0x72, 0x6c, 0xe5, 0x60, 0xc2, 0xa6, 0x5c, 0xf7, 0xb3,
+	0x38, 0x01, 0x9e, 0x3e, 0x42, 0xcc, 0xde, 0xac, 0xad, 0x2c, 0x88, 0xdc, 0x2d, 0x90, 0xc5, 0x77,
+	0x6a, 0xcc, 0xc2, 0xca, 0x61, 0xc7, 0xf6, 0x0b, 0x71, 0x0b, 0x65, 0x13, 0x62, 0x4e, 0xb2, 0xa4,
+	0xec, 0x67, 0x7b, 0x64, 0x7f, 0x09, 0x31, 0xeb, 0x4e, 0x55, 0x3d, 0xc1, 0x10, 0x47, 0x21, 0x60,
+	0x48, 0xd7, 0x19, 0xf9, 0x13, 0xc6, 0x1d, 0x7e, 0x44, 0x71, 0x0f, 0x35, 0x61, 0xfc, 0x0d, 0xaa,
+	0x76, 0x11, 0xea, 0x6d, 0xd2, 0x7e, 0xae, 0x2c, 0xc0, 0xae, 0x16, 0xac, 0x60, 0x65, 0xdb, 0xad,
+	0x21, 0x42, 0x71, 0x07, 0xe5, 0xc6, 0xd4, 0x9f, 0x96, 0x0c, 0xc7, 0xb3, 0xf3, 0x3d, 0xa2, 0xfe,
+	0x15, 0xaa, 0x3b, 0xe5, 0xcd, 0xe0, 0x9a, 0xcd, 0x0f, 0xe8, 0xe0, 0xd5, 0xef, 0x00, 0x7f, 0x53,
+	0x79, 0x6c, 0xe8, 0x01, 0x00, 0x00,
 }
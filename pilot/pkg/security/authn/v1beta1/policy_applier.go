@@ -25,6 +25,7 @@ import (
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	envoy_jwt "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
 	http_conn "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	duration "github.com/golang/protobuf/ptypes/duration"
 	"github.com/golang/protobuf/ptypes/empty"
 
@@ -143,12 +144,21 @@ func (a *v1beta1PolicyApplier) AuthNFilter() *http_conn.HttpFilter {
 func (a *v1beta1PolicyApplier) InboundMTLSSettings(endpointPort uint32, node *model.Proxy, trustDomainAliases []string) plugin.MTLSSettings {
 	effectiveMTLSMode := a.GetMutualTLSModeForPort(endpointPort)
 	authnLog.Debugf("InboundFilterChain: build inbound filter change for %v:%d in %s mode", node.ID, endpointPort, effectiveMTLSMode)
-	return plugin.MTLSSettings{
+	settings := plugin.MTLSSettings{
 		Port: endpointPort,
 		Mode: effectiveMTLSMode,
 		TCP:  authn_utils.BuildInboundTLS(effectiveMTLSMode, node, networking.ListenerProtocolTCP, trustDomainAliases),
 		HTTP: authn_utils.BuildInboundTLS(effectiveMTLSMode, node, networking.ListenerProtocolHTTP, trustDomainAliases),
 	}
+	if a.push != nil {
+		// Validate the peers of federated trust domains against the trust anchors of their own trust domain.
+		for _, ctx := range []*tls.DownstreamTlsContext{settings.TCP, settings.HTTP} {
+			if ctx != nil {
+				authn_model.ApplySpiffeValidator(ctx.CommonTlsContext, a.push.TrustDomainBundles())
+			}
+		}
+	}
+	return settings
 }
 
 // NewPolicyApplier returns new applier for v1beta1 authentication policies.
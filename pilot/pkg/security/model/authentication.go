@@ -15,6 +15,8 @@
 package model
 
 import (
+	"sort"
+	"strings"
 	"time"
 
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -59,6 +61,10 @@ const (
 	// https://github.com/istio/proxy/blob/master/src/envoy/http/authn/http_filter_factory.cc#L30
 	AuthnFilterName = "istio_authn"
 
+	// SpiffeCertValidatorName is the name of the Envoy certificate validator that validates SPIFFE identities
+	// against the trust anchors of their trust domain.
+	SpiffeCertValidatorName = "envoy.tls.cert_validator.spiffe"
+
 	// KubernetesSecretType is the name of a SDS secret stored in Kubernetes
 	KubernetesSecretType    = "kubernetes"
 	KubernetesSecretTypeURI = KubernetesSecretType + "://"
@@ -213,6 +219,41 @@ func ApplyToCommonTLSContext(tlsContext *tls.CommonTlsContext, proxy *model.Prox
 	}
 }
 
+// ApplySpiffeValidator configures the validation context of the commonTlsContext to validate the peer certificate
+// against the trust anchors of the trust domain of its SPIFFE identity, so that the trust anchors of a federated
+// trust domain are not trusted for identities of another trust domain. It is a no-op if trustBundles is empty or
+// the peer certificate is not validated.
+func ApplySpiffeValidator(tlsContext *tls.CommonTlsContext, trustBundles map[string][]string) {
+	if len(trustBundles) == 0 {
+		return
+	}
+	combined := tlsContext.GetCombinedValidationContext()
+	if combined == nil {
+		return
+	}
+	trustDomains := make([]string, 0, len(trustBundles))
+	for td := range trustBundles {
+		trustDomains = append(trustDomains, td)
+	}
+	sort.Strings(trustDomains)
+	cfg := &tls.SPIFFECertValidatorConfig{}
+	for _, td := range trustDomains {
+		cfg.TrustDomains = append(cfg.TrustDomains, &tls.SPIFFECertValidatorConfig_TrustDomain{
+			Name: td,
+			TrustBundle: &core.DataSource{
+				Specifier: &core.DataSource_InlineString{InlineString: strings.Join(trustBundles[td], "\n")},
+			},
+		})
+	}
+	if combined.DefaultValidationContext == nil {
+		combined.DefaultValidationContext = &tls.CertificateValidationContext{}
+	}
+	combined.DefaultValidationContext.CustomValidatorConfig = &core.TypedExtensionConfig{
+		Name:        SpiffeCertValidatorName,
+		TypedConfig: util.MessageToAny(cfg),
+	}
+}
+
 // ApplyCustomSDSToClientCommonTLSContext applies the customized sds to CommonTlsContext
 // Used for building upstream TLS context for egress gateway's TLS/mTLS origination
 func ApplyCustomSDSToClientCommonTLSContext(tlsContext *tls.CommonTlsContext, tlsOpts *networking.ClientTLSSettings) {
@@ -27,6 +27,7 @@ import (
 	"google.golang.org/protobuf/types/known/durationpb"
 
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/spiffe"
 )
 
@@ -430,3 +431,72 @@ func TestApplyToCommonTLSContext(t *testing.T) {
 		})
 	}
 }
+
+func TestApplySpiffeValidator(t *testing.T) {
+	validated := func() *auth.CommonTlsContext {
+		return &auth.CommonTlsContext{
+			ValidationContextType: &auth.CommonTlsContext_CombinedValidationContext{
+				CombinedValidationContext: &auth.CommonTlsContext_CombinedCertificateValidationContext{
+					DefaultValidationContext:         &auth.CertificateValidationContext{},
+					ValidationContextSdsSecretConfig: ConstructSdsSecretConfig(SDSRootResourceName),
+				},
+			},
+		}
+	}
+	withValidator := func(cfg *auth.SPIFFECertValidatorConfig) *auth.CommonTlsContext {
+		ctx := validated()
+		ctx.GetCombinedValidationContext().DefaultValidationContext.CustomValidatorConfig = &core.TypedExtensionConfig{
+			Name:        SpiffeCertValidatorName,
+			TypedConfig: util.MessageToAny(cfg),
+		}
+		return ctx
+	}
+	testCases := []struct {
+		name         string
+		tlsContext   *auth.CommonTlsContext
+		trustBundles map[string][]string
+		expected     *auth.CommonTlsContext
+	}{
+		{
+			name:       "no trust bundles",
+			tlsContext: validated(),
+			expected:   validated(),
+		},
+		{
+			name:         "peer certificate not validated",
+			tlsContext:   &auth.CommonTlsContext{},
+			trustBundles: map[string][]string{"foo.org": {"foo-root"}},
+			expected:     &auth.CommonTlsContext{},
+		},
+		{
+			name:       "trust bundles by trust domain",
+			tlsContext: validated(),
+			trustBundles: map[string][]string{
+				"foo.org":       {"foo-root-1", "foo-root-2"},
+				"cluster.local": {"mesh-root"},
+			},
+			expected: withValidator(&auth.SPIFFECertValidatorConfig{
+				TrustDomains: []*auth.SPIFFECertValidatorConfig_TrustDomain{
+					{
+						Name:        "cluster.local",
+						TrustBundle: &core.DataSource{Specifier: &core.DataSource_InlineString{InlineString: "mesh-root"}},
+					},
+					{
+						Name:        "foo.org",
+						TrustBundle: &core.DataSource{Specifier: &core.DataSource_InlineString{InlineString: "foo-root-1\nfoo-root-2"}},
+					},
+				},
+			}),
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ApplySpiffeValidator(test.tlsContext, test.trustBundles)
+
+			if !cmp.Equal(test.tlsContext, test.expected, protocmp.Transform()) {
+				t.Errorf("got(%#v), want(%#v)\n", spew.Sdump(test.tlsContext), spew.Sdump(test.expected))
+			}
+		})
+	}
+}
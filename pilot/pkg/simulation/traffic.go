@@ -202,13 +202,15 @@ func (r Result) Matches(t *testing.T, want Result) {
 }
 
 type Simulation struct {
-	t         *testing.T
+	t         test.Failer
 	Listeners []*listener.Listener
 	Clusters  []*cluster.Cluster
 	Routes    []*route.RouteConfiguration
 }
 
-func NewSimulationFromConfigGen(t *testing.T, s *v1alpha3.ConfigGenTest, proxy *model.Proxy) *Simulation {
+// NewSimulationFromConfigGen builds a Simulation from the config generated for proxy. The Failer is used to
+// report internal errors; outside of tests, test.Wrap can be used to convert these to an error.
+func NewSimulationFromConfigGen(t test.Failer, s *v1alpha3.ConfigGenTest, proxy *model.Proxy) *Simulation {
 	sim := &Simulation{
 		t:         t,
 		Listeners: s.Listeners(proxy),
@@ -218,7 +220,7 @@ func NewSimulationFromConfigGen(t *testing.T, s *v1alpha3.ConfigGenTest, proxy *
 	return sim
 }
 
-func NewSimulation(t *testing.T, s *xds.FakeDiscoveryServer, proxy *model.Proxy) *Simulation {
+func NewSimulation(t test.Failer, s *xds.FakeDiscoveryServer, proxy *model.Proxy) *Simulation {
 	return NewSimulationFromConfigGen(t, s.ConfigGenTest, proxy)
 }
 
@@ -229,9 +231,14 @@ func (sim *Simulation) withT(t *testing.T) *Simulation {
 	return &cpy
 }
 
+// RunExpectations runs each expectation as a sub test. This requires the Simulation to be created with a *testing.T.
 func (sim *Simulation) RunExpectations(es []Expect) {
+	t, ok := sim.t.(*testing.T)
+	if !ok {
+		sim.t.Fatalf("RunExpectations requires a *testing.T, got %T", sim.t)
+	}
 	for _, e := range es {
-		sim.t.Run(e.Name, func(t *testing.T) {
+		t.Run(e.Name, func(t *testing.T) {
 			sim.withT(t).Run(e.Call).Matches(t, e.Result)
 		})
 	}
@@ -71,6 +71,7 @@ type Reporter struct {
 	ledger                 ledger.Ledger
 	distributionEventQueue chan distributionEvent
 	controller             *DistributionController
+	sinkController         *SinkController
 }
 
 var _ xds.DistributionStatusCache = &Reporter{}
@@ -139,6 +140,39 @@ func (r *Reporter) Start(clientSet kubernetes.Interface, namespace string, podna
 	}()
 }
 
+// StartLocal starts writing the distribution status of config to the sinks of the controller, using only the
+// acks of the dataplanes connected to this istiod. It is used for config that is not stored in Kubernetes.
+func (r *Reporter) StartLocal(controller *SinkController, stop <-chan struct{}) {
+	scope.Info("Starting status sink controller")
+	r.mu.Lock()
+	r.sinkController = controller
+	r.mu.Unlock()
+	t := r.clock.Tick(r.UpdateInterval)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t:
+				r.writeSinkStatus()
+			}
+		}
+	}()
+}
+
+// writeSinkStatus writes the distribution status of every resource in flight to the sink controller.
+func (r *Reporter) writeSinkStatus() {
+	report, finishedResources := r.buildReport()
+	go r.removeCompletedResource(finishedResources)
+	for key, acked := range report.InProgressResources {
+		res := ResourceFromString(key)
+		if res == nil {
+			continue
+		}
+		r.sinkController.writeStatus(*res, Progress{AckedInstances: acked, TotalInstances: report.DataPlaneCount})
+	}
+}
+
 // build a distribution report to send to status leader
 func (r *Reporter) buildReport() (DistributionReport, []Resource) {
 	r.mu.RLock()
@@ -233,8 +267,12 @@ func (r *Reporter) DeleteInProgressResource(res config.Config) {
 		r.controller.configDeleted(res)
 	}
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	sinkController := r.sinkController
 	delete(r.inProgressResources, res.Key())
+	r.mu.Unlock()
+	if sinkController != nil {
+		sinkController.configDeleted(res)
+	}
 }
 
 // generate a distribution report and write it to a ConfigMap for the leader to read.
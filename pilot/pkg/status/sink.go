@@ -0,0 +1,115 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"strconv"
+	"sync"
+
+	"istio.io/api/meta/v1alpha1"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+// Sink receives the status of config that is not stored in Kubernetes, such as config read from files or from an
+// upstream xDS server, and writes it back to where the config came from. A Sink ignores config it does not own.
+type Sink interface {
+	// WriteStatus writes cfg.Status, which is an *v1alpha1.IstioStatus.
+	WriteStatus(cfg config.Config) error
+	// DeleteStatus removes the status of a deleted config.
+	DeleteStatus(cfg config.Config) error
+}
+
+// SinkController writes distribution status to sinks. Unlike the DistributionController, it only uses the
+// distribution reports of the local istiod, and never writes status to the config store.
+type SinkController struct {
+	configStore model.ConfigStore
+	sinks       []Sink
+
+	mu sync.Mutex
+	// written holds the last status written for each config, keyed by config key.
+	written map[string]*v1alpha1.IstioStatus
+}
+
+// NewSinkController returns a controller that writes status for the config in configStore to sinks.
+func NewSinkController(configStore model.ConfigStore, sinks ...Sink) *SinkController {
+	return &SinkController{
+		configStore: configStore,
+		sinks:       sinks,
+		written:     map[string]*v1alpha1.IstioStatus{},
+	}
+}
+
+func (c *SinkController) writeStatus(res Resource, progress Progress) {
+	schema, _ := collections.All.FindByGroupVersionResource(res.GroupVersionResource)
+	if schema == nil {
+		return
+	}
+	current := c.configStore.Get(schema.Resource().GroupVersionKind(), res.Name, res.Namespace)
+	if current == nil || res.Generation != strconv.FormatInt(current.Generation, 10) {
+		// The config was deleted or changed since the report; a newer report will follow.
+		return
+	}
+	key := current.Key()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cfg := current.DeepCopy()
+	if cfg.Status == nil {
+		cfg.Status = &v1alpha1.IstioStatus{}
+	}
+	_, desired := ReconcileStatuses(&cfg, progress, current.Generation)
+	if !statusChanged(c.written[key], desired) {
+		return
+	}
+	cfg.Status = desired
+	for _, s := range c.sinks {
+		if err := s.WriteStatus(cfg); err != nil {
+			scope.Warnf("failed to write status of %v: %v", key, err)
+			// Try again with the next report.
+			return
+		}
+	}
+	c.written[key] = desired
+}
+
+func (c *SinkController) configDeleted(cfg config.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.written, cfg.Key())
+	for _, s := range c.sinks {
+		if err := s.DeleteStatus(cfg); err != nil {
+			scope.Warnf("failed to delete status of %v: %v", cfg.Key(), err)
+		}
+	}
+}
+
+// statusChanged compares statuses, ignoring probe and transition times.
+func statusChanged(a, b *v1alpha1.IstioStatus) bool {
+	if a == nil || b == nil {
+		return a != b
+	}
+	if a.ObservedGeneration != b.ObservedGeneration || len(a.Conditions) != len(b.Conditions) {
+		return true
+	}
+	for i := range a.Conditions {
+		ac, bc := a.Conditions[i], b.Conditions[i]
+		if ac.Type != bc.Type || ac.Status != bc.Status || ac.Reason != bc.Reason || ac.Message != bc.Message {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"istio.io/api/meta/v1alpha1"
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/pkg/ledger"
+)
+
+type fakeSink struct {
+	written []config.Config
+	deleted []config.Config
+}
+
+func (f *fakeSink) WriteStatus(cfg config.Config) error {
+	f.written = append(f.written, cfg)
+	return nil
+}
+
+func (f *fakeSink) DeleteStatus(cfg config.Config) error {
+	f.deleted = append(f.deleted, cfg)
+	return nil
+}
+
+func TestSinkController(t *testing.T) {
+	RegisterTestingT(t)
+	store := memory.MakeSkipValidation(collections.Pilot)
+	vs := config.Config{
+		Meta: config.Meta{
+			GroupVersionKind: gvk.VirtualService,
+			Namespace:        "default",
+			Name:             "foo",
+		},
+		Spec: &networking.VirtualService{Hosts: []string{"foo.example.com"}},
+		Status: &v1alpha1.IstioStatus{
+			Conditions: []*v1alpha1.IstioCondition{{Type: "Accepted", Status: "True"}},
+		},
+	}
+	if _, err := store.Create(vs); err != nil {
+		t.Fatal(err)
+	}
+	sink := &fakeSink{}
+	r := initReporterWithoutStarting()
+	r.ledger = ledger.Make(time.Minute)
+	r.sinkController = NewSinkController(store, sink)
+	r.AddInProgressResource(vs)
+
+	r.processEvent("conA", "", r.ledger.RootHash())
+	r.processEvent("conB", "", "old")
+	r.writeSinkStatus()
+	Expect(sink.written).To(HaveLen(1))
+	status := sink.written[0].Status.(*v1alpha1.IstioStatus)
+	Expect(status.Conditions).To(HaveLen(2))
+	Expect(status.Conditions[0].Type).To(Equal("Accepted"))
+	Expect(status.Conditions[1].Type).To(Equal("Reconciled"))
+	Expect(status.Conditions[1].Message).To(Equal("1/2 proxies up to date."))
+
+	// Unchanged status is not written again.
+	r.writeSinkStatus()
+	Expect(sink.written).To(HaveLen(1))
+
+	r.processEvent("conB", "", r.ledger.RootHash())
+	r.writeSinkStatus()
+	Expect(sink.written).To(HaveLen(2))
+	status = sink.written[1].Status.(*v1alpha1.IstioStatus)
+	Expect(status.Conditions[1].Message).To(Equal("2/2 proxies up to date."))
+
+	r.DeleteInProgressResource(vs)
+	Expect(sink.deleted).To(HaveLen(1))
+	Expect(sink.deleted[0].Name).To(Equal("foo"))
+}
@@ -0,0 +1,98 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trustbundle
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/spiffe"
+)
+
+// BundleEndpoint is a SPIFFE bundle endpoint, serving the trust bundle of the mesh trust domain in JWKS format so
+// other trust domains can federate with the mesh.
+type BundleEndpoint struct {
+	// roots returns the PEM encoded roots of the mesh trust domain.
+	roots       func() []byte
+	refreshHint time.Duration
+
+	mu        sync.Mutex
+	lastRoots []byte
+	sequence  uint64
+}
+
+// NewBundleEndpoint returns a SPIFFE bundle endpoint serving the roots, with the given refresh hint.
+func NewBundleEndpoint(roots func() []byte, refreshHint time.Duration) *BundleEndpoint {
+	return &BundleEndpoint{
+		roots:       roots,
+		refreshHint: refreshHint,
+		// The sequence is increased whenever the roots change. Start from the current time, so the sequence
+		// keeps increasing across restarts.
+		sequence: uint64(time.Now().Unix()),
+	}
+}
+
+func (e *BundleEndpoint) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	roots := e.roots()
+	certs, err := parseRoots(roots)
+	if err != nil || len(certs) == 0 {
+		trustBundleLog.Errorf("failed to serve the SPIFFE bundle: invalid roots: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	doc, err := spiffe.MarshalBundle(certs, e.sequenceFor(roots), e.refreshHint)
+	if err != nil {
+		trustBundleLog.Errorf("failed to serve the SPIFFE bundle: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(doc)
+}
+
+// sequenceFor returns the sequence of the bundle holding the roots.
+func (e *BundleEndpoint) sequenceFor(roots []byte) uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.lastRoots != nil && !bytes.Equal(e.lastRoots, roots) {
+		e.sequence++
+	}
+	e.lastRoots = roots
+	return e.sequence
+}
+
+func parseRoots(roots []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, roots = pem.Decode(roots)
+		if block == nil {
+			return certs, nil
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
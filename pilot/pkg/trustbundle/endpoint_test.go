@@ -0,0 +1,70 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trustbundle
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+
+	"istio.io/istio/pkg/spiffe"
+)
+
+func TestBundleEndpoint(t *testing.T) {
+	roots := atomic.NewString(rootCACert)
+	server := httptest.NewTLSServer(NewBundleEndpoint(func() []byte { return []byte(roots.Load()) }, time.Minute))
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	bundle, err := spiffe.FetchBundle("cluster.local", server.Listener.Addr().String(), pool, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Certs) != 1 || bundle.RefreshHint != time.Minute {
+		t.Fatalf("unexpected bundle: %+v", bundle)
+	}
+	sequence := bundle.Sequence
+
+	// The sequence does not change with the roots.
+	if bundle, err = spiffe.FetchBundle("cluster.local", server.Listener.Addr().String(), pool, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if bundle.Sequence != sequence {
+		t.Errorf("expected sequence %d, got %d", sequence, bundle.Sequence)
+	}
+
+	roots.Store(rootCACert + intermediateCACert)
+	if bundle, err = spiffe.FetchBundle("cluster.local", server.Listener.Addr().String(), pool, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Certs) != 2 || bundle.Sequence != sequence+1 {
+		t.Errorf("expected 2 certs with sequence %d, got %d certs with sequence %d", sequence+1, len(bundle.Certs), bundle.Sequence)
+	}
+
+	roots.Store(malformedCert)
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d for invalid roots, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
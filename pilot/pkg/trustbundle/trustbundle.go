@@ -17,6 +17,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
@@ -46,10 +47,18 @@ type TrustBundle struct {
 	updatecb           func()
 	endpointMutex      sync.RWMutex
 	endpoints          []string
+	remoteBundles      map[string]remoteBundle
 	endpointUpdateChan chan struct{}
 	remoteCaCertPool   *x509.CertPool
 }
 
+// remoteBundle is the trust bundle last fetched from a SPIFFE bundle endpoint.
+type remoteBundle struct {
+	trustDomain string
+	certs       []string
+	nextRefresh time.Time
+}
+
 var (
 	trustBundleLog               = log.RegisterScope("trustBundle", "Workload mTLS trust bundle logs", 0)
 	remoteTimeout  time.Duration = 10 * time.Second
@@ -62,6 +71,12 @@ const (
 	sourceSpiffeEndpoints
 
 	RemoteDefaultPollPeriod = 30 * time.Minute
+
+	// minRefreshHint is the shortest refresh interval of a SPIFFE bundle endpoint, whatever its refresh hint.
+	minRefreshHint = 10 * time.Second
+
+	// fetchRetryInterval is how long to wait before fetching a bundle again after a failed fetch.
+	fetchRetryInterval = 30 * time.Second
 )
 
 func isEqSliceStr(certs1 []string, certs2 []string) bool {
@@ -90,6 +105,7 @@ func NewTrustBundle(remoteCaCertPool *x509.CertPool) *TrustBundle {
 		updatecb:           nil,
 		endpointUpdateChan: make(chan struct{}, 1),
 		endpoints:          []string{},
+		remoteBundles:      map[string]remoteBundle{},
 	}
 	if remoteCaCertPool == nil {
 		tb.remoteCaCertPool, err = x509.SystemCertPool()
@@ -185,21 +201,68 @@ func (tb *TrustBundle) UpdateTrustAnchor(anchorConfig *TrustAnchorUpdate) error
 	return nil
 }
 
+// GetFederatedTrustBundles returns the trust anchors of the trust domains federated with the mesh, fetched from
+// SPIFFE bundle endpoints and keyed by trust domain. They are not part of the trust anchors of the mesh trust domain
+// returned by GetTrustBundle, and must only be trusted for identities of their own trust domain.
+func (tb *TrustBundle) GetFederatedTrustBundles() map[string][]string {
+	tb.endpointMutex.RLock()
+	defer tb.endpointMutex.RUnlock()
+	return federatedTrustBundles(tb.endpoints, tb.remoteBundles)
+}
+
+// federatedTrustBundles returns the trust anchors of the bundles of trust domains other than the mesh trust domain.
+func federatedTrustBundles(endpoints []string, remoteBundles map[string]remoteBundle) map[string][]string {
+	meshTrustDomain := spiffe.GetTrustDomain()
+	bundles := map[string][]string{}
+	for _, endpoint := range endpoints {
+		rb := remoteBundles[endpoint]
+		if rb.trustDomain == meshTrustDomain || len(rb.certs) == 0 {
+			continue
+		}
+		bundles[rb.trustDomain] = append(bundles[rb.trustDomain], rb.certs...)
+	}
+	return bundles
+}
+
 func (tb *TrustBundle) updateRemoteEndpoint(spiffeEndpoints []string) {
-	tb.mutex.RLock()
+	tb.endpointMutex.RLock()
 	remoteEndpoints := tb.endpoints
-	tb.mutex.RUnlock()
+	tb.endpointMutex.RUnlock()
 
 	if isEqSliceStr(spiffeEndpoints, remoteEndpoints) {
 		return
 	}
 	trustBundleLog.Infof("updated remote endpoints  :%v", spiffeEndpoints)
-	tb.mutex.Lock()
+	tb.endpointMutex.Lock()
 	tb.endpoints = spiffeEndpoints
-	tb.mutex.Unlock()
+	tb.endpointMutex.Unlock()
 	tb.endpointUpdateChan <- struct{}{}
 }
 
+// parseSpiffeBundleURL splits a MeshConfig SPIFFE bundle URL, in the format [<trust domain>|]<url>, into the trust
+// domain and the URL of the bundle endpoint. The trust domain defaults to the mesh trust domain.
+func parseSpiffeBundleURL(spiffeBundleURL string) (string, string) {
+	if i := strings.Index(spiffeBundleURL, "|"); i >= 0 {
+		return spiffeBundleURL[:i], spiffeBundleURL[i+1:]
+	}
+	return spiffe.GetTrustDomain(), spiffeBundleURL
+}
+
+// refreshInterval returns how long to wait before fetching a bundle again, using its refresh hint if it is
+// shorter than the poll interval.
+func refreshInterval(refreshHint, pollInterval time.Duration) time.Duration {
+	if refreshHint <= 0 {
+		return pollInterval
+	}
+	if refreshHint < minRefreshHint {
+		refreshHint = minRefreshHint
+	}
+	if refreshHint < pollInterval {
+		return refreshHint
+	}
+	return pollInterval
+}
+
 // AddMeshConfigUpdate : Update trustAnchor configurations from meshConfig
 func (tb *TrustBundle) AddMeshConfigUpdate(cfg *meshconfig.MeshConfig) error {
 	var err error
@@ -229,52 +292,106 @@ func (tb *TrustBundle) AddMeshConfigUpdate(cfg *meshconfig.MeshConfig) error {
 	return nil
 }
 
-func (tb *TrustBundle) fetchRemoteTrustAnchors() {
-	var err error
+// fetchRemoteTrustAnchors fetches the bundles of the SPIFFE bundle endpoints that are due for a refresh, or all of
+// them if force is set, and returns when the next bundle is due.
+func (tb *TrustBundle) fetchRemoteTrustAnchors(force bool, pollInterval time.Duration) time.Time {
+	now := time.Now()
+	nextRefresh := now.Add(pollInterval)
 
 	tb.endpointMutex.RLock()
 	remoteEndpoints := tb.endpoints
+	cached := tb.remoteBundles
 	tb.endpointMutex.RUnlock()
-	remoteCerts := []string{}
 
-	currentTrustDomain := spiffe.GetTrustDomain()
+	remoteBundles := map[string]remoteBundle{}
 	for _, endpoint := range remoteEndpoints {
-		trustDomainAnchorMap, err := spiffe.RetrieveSpiffeBundleRootCerts(
-			map[string]string{currentTrustDomain: endpoint}, tb.remoteCaCertPool, remoteTimeout)
-		if err != nil {
-			trustBundleLog.Errorf("unable to fetch trust Anchors from endpoint %s: %s", endpoint, err)
-			continue
+		if rb, f := cached[endpoint]; f && !force && now.Before(rb.nextRefresh) {
+			remoteBundles[endpoint] = rb
+		} else {
+			remoteBundles[endpoint] = tb.fetchRemoteBundle(endpoint, cached[endpoint], now, pollInterval)
+		}
+		if rb := remoteBundles[endpoint]; rb.nextRefresh.Before(nextRefresh) {
+			nextRefresh = rb.nextRefresh
 		}
-		certs := trustDomainAnchorMap[currentTrustDomain]
-		for _, cert := range certs {
-			certStr := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
-			trustBundleLog.Debugf("from endpoint %v, fetched trust anchor cert: %v", endpoint, certStr)
-			remoteCerts = append(remoteCerts, certStr)
+	}
+	tb.endpointMutex.Lock()
+	federatedChanged := !reflect.DeepEqual(federatedTrustBundles(remoteEndpoints, cached),
+		federatedTrustBundles(remoteEndpoints, remoteBundles))
+	tb.remoteBundles = remoteBundles
+	tb.endpointMutex.Unlock()
+
+	// Only the bundles of the mesh trust domain are merged into the mesh trust anchors. The bundles of federated
+	// trust domains are kept by trust domain, so they are not trusted for identities of the mesh trust domain.
+	meshTrustDomain := spiffe.GetTrustDomain()
+	remoteCerts := []string{}
+	for _, endpoint := range remoteEndpoints {
+		if rb := remoteBundles[endpoint]; rb.trustDomain == meshTrustDomain {
+			remoteCerts = append(remoteCerts, rb.certs...)
 		}
 	}
-	err = tb.UpdateTrustAnchor(&TrustAnchorUpdate{
+	err := tb.UpdateTrustAnchor(&TrustAnchorUpdate{
 		TrustAnchorConfig: TrustAnchorConfig{Certs: remoteCerts},
 		Source:            sourceSpiffeEndpoints,
 	})
 	if err != nil {
 		trustBundleLog.Errorf("failed to update meshConfig Spiffe trustAnchors: %v", err)
 	}
+	if federatedChanged {
+		trustBundleLog.Infof("updated the trust anchors of the federated trust domains")
+		if tb.updatecb != nil {
+			tb.updatecb()
+		}
+	}
+	return nextRefresh
+}
+
+// fetchRemoteBundle fetches the bundle of a SPIFFE bundle endpoint. If the fetch fails, the trust anchors of the
+// previously fetched bundle are kept, so that a brief outage of the endpoint does not break mTLS with its trust
+// domain, and the bundle is fetched again sooner than usual.
+func (tb *TrustBundle) fetchRemoteBundle(spiffeBundleURL string, prev remoteBundle, now time.Time,
+	pollInterval time.Duration) remoteBundle {
+	trustDomain, endpoint := parseSpiffeBundleURL(spiffeBundleURL)
+	rb := remoteBundle{trustDomain: trustDomain, nextRefresh: now.Add(pollInterval)}
+	bundle, err := spiffe.FetchBundle(trustDomain, endpoint, tb.remoteCaCertPool, remoteTimeout)
+	if err != nil {
+		trustBundleLog.Errorf("unable to fetch trust Anchors from endpoint %s, keeping %d previously fetched: %s",
+			endpoint, len(prev.certs), err)
+		rb.certs = prev.certs
+		if fetchRetryInterval < pollInterval {
+			rb.nextRefresh = now.Add(fetchRetryInterval)
+		}
+		return rb
+	}
+	for _, cert := range bundle.Certs {
+		certStr := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+		trustBundleLog.Debugf("from endpoint %v, fetched trust anchor cert for trust domain %v: %v", endpoint, trustDomain, certStr)
+		rb.certs = append(rb.certs, certStr)
+	}
+	rb.nextRefresh = now.Add(refreshInterval(bundle.RefreshHint, pollInterval))
+	return rb
 }
 
+// ProcessRemoteTrustAnchors fetches the bundles of the SPIFFE bundle endpoints when they change, and refreshes
+// them every poll interval, or sooner if the bundle has a shorter refresh hint.
 func (tb *TrustBundle) ProcessRemoteTrustAnchors(stop <-chan struct{}, pollInterval time.Duration) {
-	ticker := time.NewTicker(pollInterval)
-	defer ticker.Stop()
+	timer := time.NewTimer(pollInterval)
+	defer timer.Stop()
 	for {
+		var nextRefresh time.Time
 		select {
-		case <-ticker.C:
+		case <-timer.C:
 			trustBundleLog.Infof("waking up to perform periodic checks")
-			tb.fetchRemoteTrustAnchors()
+			nextRefresh = tb.fetchRemoteTrustAnchors(false, pollInterval)
 		case <-stop:
 			trustBundleLog.Infof("stop processing endpoint trustAnchor pdates")
 			return
 		case <-tb.endpointUpdateChan:
-			tb.fetchRemoteTrustAnchors()
+			nextRefresh = tb.fetchRemoteTrustAnchors(true, pollInterval)
 			trustBundleLog.Infof("processing endpoint trustAnchor Updates for config change")
+			if !timer.Stop() {
+				<-timer.C
+			}
 		}
+		timer.Reset(time.Until(nextRefresh))
 	}
 }
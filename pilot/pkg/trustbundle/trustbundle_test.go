@@ -314,8 +314,9 @@ func TestAddMeshConfigUpdate(t *testing.T) {
 
 	// Test3: Stop server1
 	server1.Close()
-	// Check server1's valid trustAnchor is no longer in the trustbundle within poll frequency window
-	expectTbCount(t, tb, 1, 6*time.Second, "server1(stopped) trustAnchor not removed from bundle")
+	// Check server1's previously fetched trustAnchor is kept in the trustbundle after the poll frequency window
+	time.Sleep(3 * time.Second)
+	expectTbCount(t, tb, 2, time.Second, "server1(stopped) trustAnchor removed from bundle")
 
 	// Test4: Update with server1, server2 and mesh pem ca
 	tb.AddMeshConfigUpdate(&meshconfig.MeshConfig{CaCertificates: []*meshconfig.MeshConfig_CertificateData{
@@ -333,3 +334,93 @@ func TestAddMeshConfigUpdate(t *testing.T) {
 	tb.AddMeshConfigUpdate(&meshconfig.MeshConfig{CaCertificates: []*meshconfig.MeshConfig_CertificateData{}})
 	expectTbCount(t, tb, 0, 3*time.Second, "trustAnchor not updated in bundle after meshConfig cleared")
 }
+
+func TestSpiffeBundleTrustDomains(t *testing.T) {
+	caCertPool := x509.NewCertPool()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte(validSpiffeX509Bundle))
+	}))
+	defer server.Close()
+	caCertPool.AddCert(server.Certificate())
+	remoteTimeout = 300 * time.Millisecond
+
+	tb := NewTrustBundle(caCertPool)
+	updates := 0
+	tb.UpdateCb(func() { updates++ })
+	tb.AddMeshConfigUpdate(&meshconfig.MeshConfig{CaCertificates: []*meshconfig.MeshConfig_CertificateData{
+		{CertificateData: &meshconfig.MeshConfig_CertificateData_SpiffeBundleUrl{
+			SpiffeBundleUrl: "foo.org|" + server.Listener.Addr().String(),
+		}},
+	}})
+	<-tb.endpointUpdateChan
+	// The bundle has a refresh hint longer than the poll interval.
+	next := tb.fetchRemoteTrustAnchors(true, time.Hour)
+	if until := time.Until(next); until <= 0 || until > time.Hour {
+		t.Errorf("unexpected next refresh in %v", until)
+	}
+	bundles := tb.GetFederatedTrustBundles()
+	if len(bundles) != 1 || len(bundles["foo.org"]) != 1 {
+		t.Errorf("expected the bundle to be mapped to its trust domain, got %v", bundles)
+	}
+	// The roots of a federated trust domain are not trusted for the mesh trust domain.
+	if certs := tb.GetTrustBundle(); len(certs) != 0 {
+		t.Errorf("expected the federated roots not to be merged into the mesh roots, got %v", certs)
+	}
+	if updates != 1 {
+		t.Errorf("expected an update for the federated bundle, got %d", updates)
+	}
+
+	// Bundles of the mesh trust domain are merged into the mesh roots.
+	tb.AddMeshConfigUpdate(&meshconfig.MeshConfig{CaCertificates: []*meshconfig.MeshConfig_CertificateData{
+		{CertificateData: &meshconfig.MeshConfig_CertificateData_SpiffeBundleUrl{
+			SpiffeBundleUrl: "foo.org|" + server.Listener.Addr().String(),
+		}},
+		{CertificateData: &meshconfig.MeshConfig_CertificateData_SpiffeBundleUrl{
+			SpiffeBundleUrl: server.Listener.Addr().String(),
+		}},
+	}})
+	<-tb.endpointUpdateChan
+	tb.fetchRemoteTrustAnchors(true, time.Hour)
+	expectTbCount(t, tb, 1, time.Second, "spiffe trustAnchors not updated in bundle")
+	if bundles := tb.GetFederatedTrustBundles(); len(bundles) != 1 || len(bundles["foo.org"]) != 1 {
+		t.Errorf("expected only the federated trust domain, got %v", bundles)
+	}
+
+	// Bundles are not fetched again before their refresh.
+	server.Close()
+	tb.fetchRemoteTrustAnchors(false, time.Hour)
+	if bundles := tb.GetFederatedTrustBundles(); len(bundles["foo.org"]) != 1 {
+		t.Errorf("expected the bundle to be kept until its refresh, got %v", bundles)
+	}
+
+	// Bundles that fail to be fetched keep their previous trust anchors, and are fetched again sooner.
+	updates = 0
+	next = tb.fetchRemoteTrustAnchors(true, time.Hour)
+	if bundles := tb.GetFederatedTrustBundles(); len(bundles["foo.org"]) != 1 {
+		t.Errorf("expected the bundle to be kept after a failed fetch, got %v", bundles)
+	}
+	expectTbCount(t, tb, 1, time.Second, "spiffe trustAnchors removed after a failed fetch")
+	if updates != 0 {
+		t.Errorf("expected no update after a failed fetch, got %d", updates)
+	}
+	if until := time.Until(next); until <= 0 || until > fetchRetryInterval {
+		t.Errorf("expected a failed fetch to be retried within %v, got %v", fetchRetryInterval, until)
+	}
+}
+
+func TestRefreshInterval(t *testing.T) {
+	cases := []struct {
+		refreshHint time.Duration
+		expected    time.Duration
+	}{
+		{refreshHint: 0, expected: RemoteDefaultPollPeriod},
+		{refreshHint: time.Minute, expected: time.Minute},
+		{refreshHint: time.Second, expected: minRefreshHint},
+		{refreshHint: 24 * time.Hour, expected: RemoteDefaultPollPeriod},
+	}
+	for _, tc := range cases {
+		if got := refreshInterval(tc.refreshHint, RemoteDefaultPollPeriod); got != tc.expected {
+			t.Errorf("refresh hint %v: expected %v, got %v", tc.refreshHint, tc.expected, got)
+		}
+	}
+}
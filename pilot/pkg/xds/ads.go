@@ -646,6 +646,9 @@ func (s *DiscoveryServer) computeProxyState(proxy *model.Proxy, request *model.P
 			}
 		}
 	}
+	// The scopes are read when the proxy is enqueued for a push, to determine its priority.
+	proxy.Lock()
+	defer proxy.Unlock()
 	switch {
 	case sidecar && proxy.Type == model.SidecarProxy:
 		proxy.SetSidecarScope(push)
@@ -659,6 +662,10 @@ func (s *DiscoveryServer) computeProxyState(proxy *model.Proxy, request *model.P
 
 // shouldProcessRequest returns whether or not to continue with the request.
 func (s *DiscoveryServer) shouldProcessRequest(proxy *model.Proxy, req *discovery.DiscoveryRequest) bool {
+	if req.TypeUrl == v3.ConfigStatusType {
+		s.recordConfigStatus(proxy, req)
+		return false
+	}
 	if req.TypeUrl != v3.HealthInfoType {
 		return true
 	}
@@ -696,7 +703,9 @@ func (s *DiscoveryServer) pushConnection(con *Connection, pushEv *Event) error {
 		s.updateProxy(con.proxy, pushRequest)
 	}
 
-	if !s.ProxyNeedsPush(con.proxy, pushRequest) {
+	needsPush := s.ProxyNeedsPush(con.proxy, pushRequest)
+	s.recordPushDecision(con, pushRequest, needsPush)
+	if !needsPush {
 		log.Debugf("Skipping push to %v, no updates required", con.ConID)
 		if pushRequest.Full {
 			// Only report for full versions, incremental pushes do not have a new version.
@@ -874,7 +883,9 @@ func (s *DiscoveryServer) startPush(req *model.PushRequest) {
 		}
 	}
 	req.Start = time.Now()
-	for _, p := range s.AllClients() {
+	clients := s.AllClients()
+	s.pushTracer.recordPush(req, len(clients))
+	for _, p := range clients {
 		s.pushQueue.Enqueue(p, req)
 	}
 }
@@ -894,6 +905,9 @@ func (s *DiscoveryServer) removeCon(conID string) {
 		totalXDSInternalErrors.Increment()
 	} else {
 		delete(s.adsClients, conID)
+		s.pushBudget.Remove(con)
+		s.pushTracer.remove(conID)
+		s.configStatus.remove(con.proxy.ID)
 		recordXDSClients(con.proxy.Metadata.IstioVersion, -1)
 	}
 }
@@ -0,0 +1,128 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	gogotypes "github.com/gogo/protobuf/types"
+
+	"istio.io/api/meta/v1alpha1"
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// ConfigStatus is the status of a config, as reported by a client that received the config over xDS, such as
+// an istiod using this istiod as a config source.
+type ConfigStatus struct {
+	// Kind is the type of the config, as group/version/kind.
+	Kind      string                `json:"kind"`
+	Namespace string                `json:"namespace"`
+	Name      string                `json:"name"`
+	Status    *v1alpha1.IstioStatus `json:"status"`
+}
+
+// configStatusCache holds the latest config status reported by each proxy.
+type configStatusCache struct {
+	mu sync.Mutex
+	// proxies maps proxy ID to the status of each config, keyed by kind/namespace/name.
+	proxies map[string]map[string]ConfigStatus
+}
+
+func newConfigStatusCache() *configStatusCache {
+	return &configStatusCache{proxies: map[string]map[string]ConfigStatus{}}
+}
+
+// parseConfigStatus decodes a ConfigStatusType request. The single resource name is the config, as
+// group/version/kind/namespace/name, and the error detail holds its status.
+func parseConfigStatus(req *discovery.DiscoveryRequest) (ConfigStatus, error) {
+	if len(req.ResourceNames) != 1 || req.ErrorDetail == nil || len(req.ErrorDetail.Details) != 1 {
+		return ConfigStatus{}, fmt.Errorf("expected a single config and status")
+	}
+	parts := strings.Split(req.ResourceNames[0], "/")
+	if len(parts) != 5 {
+		return ConfigStatus{}, fmt.Errorf("invalid config name %q", req.ResourceNames[0])
+	}
+	detail := req.ErrorDetail.Details[0]
+	status := &v1alpha1.IstioStatus{}
+	if err := gogotypes.UnmarshalAny(&gogotypes.Any{TypeUrl: detail.TypeUrl, Value: detail.Value}, status); err != nil {
+		return ConfigStatus{}, err
+	}
+	return ConfigStatus{
+		Kind:      strings.Join(parts[:3], "/"),
+		Namespace: parts[3],
+		Name:      parts[4],
+		Status:    status,
+	}, nil
+}
+
+func (c *configStatusCache) record(proxyID string, cs ConfigStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	statuses := c.proxies[proxyID]
+	if statuses == nil {
+		statuses = map[string]ConfigStatus{}
+		c.proxies[proxyID] = statuses
+	}
+	statuses[cs.Kind+"/"+cs.Namespace+"/"+cs.Name] = cs
+}
+
+func (c *configStatusCache) remove(proxyID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.proxies, proxyID)
+}
+
+func (c *configStatusCache) list() map[string][]ConfigStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string][]ConfigStatus, len(c.proxies))
+	for proxyID, statuses := range c.proxies {
+		list := make([]ConfigStatus, 0, len(statuses))
+		for _, cs := range statuses {
+			list = append(list, cs)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Kind != list[j].Kind {
+				return list[i].Kind < list[j].Kind
+			}
+			if list[i].Namespace != list[j].Namespace {
+				return list[i].Namespace < list[j].Namespace
+			}
+			return list[i].Name < list[j].Name
+		})
+		out[proxyID] = list
+	}
+	return out
+}
+
+// recordConfigStatus records config status reported by a proxy.
+func (s *DiscoveryServer) recordConfigStatus(proxy *model.Proxy, req *discovery.DiscoveryRequest) {
+	cs, err := parseConfigStatus(req)
+	if err != nil {
+		log.Warnf("ADS: invalid config status from %s: %v", proxy.ID, err)
+		return
+	}
+	s.configStatus.record(proxy.ID, cs)
+}
+
+// configStatusz shows the config status reported by each proxy that reads config from this istiod.
+func (s *DiscoveryServer) configStatusz(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, s.configStatus.list())
+}
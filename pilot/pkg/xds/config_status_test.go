@@ -0,0 +1,78 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"fmt"
+	"testing"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	gogotypes "github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/ptypes/any"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+
+	"istio.io/api/meta/v1alpha1"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+func configStatusRequest(t *testing.T, name string, status *v1alpha1.IstioStatus) *discovery.DiscoveryRequest {
+	detail, err := gogotypes.MarshalAny(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &discovery.DiscoveryRequest{
+		TypeUrl:       v3.ConfigStatusType,
+		ResourceNames: []string{name},
+		ErrorDetail: &rpcstatus.Status{
+			Details: []*any.Any{{TypeUrl: detail.TypeUrl, Value: detail.Value}},
+		},
+	}
+}
+
+func TestConfigStatus(t *testing.T) {
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+	ads := s.ConnectADS().WithType(v3.ConfigStatusType)
+
+	// Invalid reports are ignored.
+	ads.Request(t, configStatusRequest(t, "default/vs", &v1alpha1.IstioStatus{}))
+	ads.Request(t, configStatusRequest(t, "networking.istio.io/v1alpha3/VirtualService/default/vs", &v1alpha1.IstioStatus{
+		Conditions: []*v1alpha1.IstioCondition{{Type: "Reconciled", Status: "True"}},
+	}))
+	ads.ExpectNoResponse(t)
+
+	retry.UntilSuccessOrFail(t, func() error {
+		got := s.Discovery.configStatus.list()["test.default"]
+		if len(got) != 1 {
+			return fmt.Errorf("expected 1 config status, got %+v", got)
+		}
+		if got[0].Kind != "networking.istio.io/v1alpha3/VirtualService" || got[0].Namespace != "default" || got[0].Name != "vs" {
+			return fmt.Errorf("unexpected config %+v", got[0])
+		}
+		if len(got[0].Status.Conditions) != 1 || got[0].Status.Conditions[0].Type != "Reconciled" {
+			return fmt.Errorf("unexpected status %v", got[0].Status)
+		}
+		return nil
+	})
+
+	// Status is dropped once the proxy disconnects.
+	ads.Cleanup()
+	retry.UntilSuccessOrFail(t, func() error {
+		if got := s.Discovery.configStatus.list(); len(got) != 0 {
+			return fmt.Errorf("expected no config status, got %+v", got)
+		}
+		return nil
+	})
+}
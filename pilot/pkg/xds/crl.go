@@ -0,0 +1,98 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"bytes"
+	"sync"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+// revocationList holds the CRLs of the CA, distributed to proxies with the CrlGenerator.
+type revocationList struct {
+	mu sync.RWMutex
+	// enabled is set once the CA is known to support revocation.
+	enabled bool
+	crl     []byte
+}
+
+func (r *revocationList) get() (bool, []byte) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.enabled, r.crl
+}
+
+// update sets the CRLs, returning true if they changed.
+func (r *revocationList) update(crl []byte) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.enabled && bytes.Equal(r.crl, crl) {
+		return false
+	}
+	r.enabled = true
+	r.crl = crl
+	return true
+}
+
+// UpdateCRL updates the PEM encoded CRLs of the CA, and pushes them to the proxies watching them.
+// An empty CRL is pushed as well, so revocations that expired are removed from proxies.
+func (s *DiscoveryServer) UpdateCRL(crl []byte) {
+	if !s.crl.update(crl) {
+		return
+	}
+	s.ConfigUpdate(&model.PushRequest{
+		Full:   true,
+		Reason: []model.TriggerReason{model.GlobalUpdate},
+	})
+}
+
+// CrlGenerator generates the CRLs of the CA for the istio-agent, as a CertificateValidationContext.
+type CrlGenerator struct {
+	Server *DiscoveryServer
+}
+
+var _ model.XdsResourceGenerator = &CrlGenerator{}
+
+func crlNeedsPush(req *model.PushRequest) bool {
+	return req == nil || (req.Full && len(req.ConfigsUpdated) == 0)
+}
+
+// Generate returns the CRLs of the CA. Nothing is returned until the CA publishes CRLs, so the
+// agent keeps its last CRLs if istiod does not run the CA.
+func (e *CrlGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource,
+	req *model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
+	if !crlNeedsPush(req) {
+		return nil, model.DefaultXdsLogDetails, nil
+	}
+	enabled, crl := e.Server.crl.get()
+	if !enabled {
+		return nil, model.DefaultXdsLogDetails, nil
+	}
+	vc := &tls.CertificateValidationContext{}
+	if len(crl) > 0 {
+		vc.Crl = &core.DataSource{
+			Specifier: &core.DataSource_InlineBytes{
+				InlineBytes: crl,
+			},
+		}
+	}
+	return model.Resources{&discovery.Resource{Resource: util.MessageToAny(vc)}}, model.DefaultXdsLogDetails, nil
+}
@@ -0,0 +1,62 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"bytes"
+	"testing"
+
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes"
+
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+)
+
+func expectCRL(t *testing.T, resp *discovery.DiscoveryResponse, crl []byte) {
+	t.Helper()
+	if len(resp.Resources) != 1 {
+		t.Fatalf("expected 1 resource, got %v", resp.Resources)
+	}
+	vc := &tls.CertificateValidationContext{}
+	// nolint: staticcheck
+	if err := ptypes.UnmarshalAny(resp.Resources[0], vc); err != nil {
+		t.Fatal(err)
+	}
+	if got := vc.GetCrl().GetInlineBytes(); !bytes.Equal(got, crl) {
+		t.Fatalf("expected CRL %q, got %q", crl, got)
+	}
+}
+
+func TestCRL(t *testing.T) {
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+	ads := s.ConnectADS().WithType(v3.CRLType)
+
+	// Nothing is sent until the CA publishes CRLs.
+	ads.Request(t, nil)
+	ads.ExpectNoResponse(t)
+
+	crl := []byte("-----BEGIN X509 CRL-----\nfake\n-----END X509 CRL-----\n")
+	s.Discovery.UpdateCRL(crl)
+	expectCRL(t, ads.ExpectResponse(t), crl)
+
+	// Unchanged CRLs are not pushed again.
+	s.Discovery.UpdateCRL(crl)
+	ads.ExpectNoResponse(t)
+
+	// Once no certificate is revoked, an empty validation context clears the CRL on proxies.
+	s.Discovery.UpdateCRL(nil)
+	expectCRL(t, ads.ExpectResponse(t), nil)
+}
@@ -195,11 +195,22 @@ func (s *DiscoveryServer) AddDebugHandlers(mux, internalMux *http.ServeMux, enab
 	s.addDebugHandler(mux, internalMux, "/debug/push_status", "Last PushContext Details", s.PushStatusHandler)
 	s.addDebugHandler(mux, internalMux, "/debug/pushcontext", "Debug support for current push context", s.PushContextHandler)
 	s.addDebugHandler(mux, internalMux, "/debug/connections", "Info about the connected XDS clients", s.ConnectionsHandler)
+	s.addDebugHandler(mux, internalMux, "/debug/push_trace", "Recent pushes, or the push decisions for the proxy given by proxyID", s.pushTrace)
+	s.addDebugHandler(mux, internalMux, "/debug/push_budget", "Push budgets, and the proxies and namespaces being throttled", s.pushBudgetz)
+	s.addDebugHandler(mux, internalMux, "/debug/config_status", "Status of config reported by istiods using this istiod as a config source",
+		s.configStatusz)
 
 	s.addDebugHandler(mux, internalMux, "/debug/inject", "Active inject template", s.InjectTemplateHandler(webhook))
 	s.addDebugHandler(mux, internalMux, "/debug/mesh", "Active mesh config", s.MeshHandler)
 	s.addDebugHandler(mux, internalMux, "/debug/networkz", "List cross-network gateways", s.networkz)
 	s.addDebugHandler(mux, internalMux, "/debug/exportz", "List endpoints that been exported via MCS", s.exportz)
+	// The certificate issuances expose the identities of every workload, and revoking a certificate changes the
+	// state of the CA, so these are unsafe admin endpoints only served over XDS to the identity of Istiod itself,
+	// and not listed with the handlers served on HTTP.
+	if features.EnableUnsafeAdminEndpoints && internalMux != nil {
+		internalMux.HandleFunc("/debug/ca_issuancez", s.caIssuancez)
+		internalMux.HandleFunc("/debug/ca_revoke", s.caRevoke)
+	}
 
 	s.addDebugHandler(mux, internalMux, "/debug/list", "List all supported debug commands in json", s.List)
 }
@@ -833,6 +844,22 @@ func (s *DiscoveryServer) networkz(w http.ResponseWriter, _ *http.Request) {
 	writeJSON(w, mgr.AllGateways())
 }
 
+func (s *DiscoveryServer) caIssuancez(w http.ResponseWriter, req *http.Request) {
+	if s.CAIssuances == nil {
+		http.Error(w, "the CA audit log is not enabled", http.StatusNotFound)
+		return
+	}
+	s.CAIssuances.ServeHTTP(w, req)
+}
+
+func (s *DiscoveryServer) caRevoke(w http.ResponseWriter, req *http.Request) {
+	if s.CARevocation == nil {
+		http.Error(w, "certificate revocation is not supported by the CA", http.StatusNotFound)
+		return
+	}
+	s.CARevocation.ServeHTTP(w, req)
+}
+
 func (s *DiscoveryServer) exportz(w http.ResponseWriter, _ *http.Request) {
 	aggregateController, ok := s.Env.ServiceDiscovery.(*aggregate.Controller)
 	if !ok {
@@ -24,9 +24,11 @@ import (
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 
 	"istio.io/istio/istioctl/pkg/util/configdump"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/xds"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/spiffe"
 )
 
 func TestSyncz(t *testing.T) {
@@ -213,3 +215,55 @@ func TestDebugHandlers(t *testing.T) {
 		t.Errorf("Error in generatating debug endpoint list")
 	}
 }
+
+func TestCAAdminEndpointsOnlyServedToIstiod(t *testing.T) {
+	defer func(unsafe bool, sa string) {
+		features.EnableUnsafeAdminEndpoints = unsafe
+		features.IstiodServiceAccount = sa
+	}(features.EnableUnsafeAdminEndpoints, features.IstiodServiceAccount)
+	features.IstiodServiceAccount = "istiod"
+
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	var served []string
+	record := func(param string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			served = append(served, req.URL.Query().Get(param))
+		})
+	}
+	s.Discovery.CARevocation = record("cert")
+	s.Discovery.CAIssuances = record("serial")
+
+	istiod := &spiffe.Identity{TrustDomain: "cluster.local", Namespace: "istio-system", ServiceAccount: "istiod"}
+	gateway := &spiffe.Identity{TrustDomain: "cluster.local", Namespace: "istio-system", ServiceAccount: "istio-ingressgateway"}
+	for _, resource := range []string{"ca_revoke?cert=fake", "ca_issuancez?serial=fake"} {
+		t.Run(resource, func(t *testing.T) {
+			served = nil
+			request := func(unsafe bool, identity *spiffe.Identity) (*http.ServeMux, error) {
+				features.EnableUnsafeAdminEndpoints = unsafe
+				mux := http.NewServeMux()
+				dg := &xds.DebugGen{Server: s.Discovery, SystemNamespace: "istio-system", DebugMux: http.NewServeMux()}
+				s.Discovery.AddDebugHandlers(mux, dg.DebugMux, false, nil)
+				_, _, err := dg.Generate(&model.Proxy{VerifiedIdentity: identity}, nil,
+					&model.WatchedResource{ResourceNames: []string{resource}}, nil)
+				return mux, err
+			}
+
+			if _, err := request(true, gateway); err == nil || len(served) != 0 {
+				t.Fatalf("expected the request to be rejected for the gateway, got error %v and served %v", err, served)
+			}
+			if _, err := request(false, istiod); err != nil || len(served) != 0 {
+				t.Fatalf("expected the request not to be served without unsafe admin endpoints, got error %v and served %v", err, served)
+			}
+			mux, err := request(true, istiod)
+			if err != nil || len(served) != 1 || served[0] != "fake" {
+				t.Fatalf("expected the request to be served to Istiod, got error %v and served %v", err, served)
+			}
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/"+resource, nil))
+			if rr.Code != http.StatusNotFound || len(served) != 1 {
+				t.Fatalf("expected the request not to be served over HTTP, got code %d and served %v", rr.Code, served)
+			}
+		})
+	}
+}
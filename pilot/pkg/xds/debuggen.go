@@ -25,6 +25,7 @@ import (
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/golang/protobuf/ptypes/any"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 )
 
@@ -39,6 +40,12 @@ var activeNamespaceDebuggers = map[string]struct{}{
 	"edsz":        {},
 }
 
+// istiodDebuggers are only available to the identity of Istiod itself, as they expose or change the state of the CA.
+var istiodDebuggers = map[string]struct{}{
+	"ca_issuancez": {},
+	"ca_revoke":    {},
+}
+
 // DebugGen is a Generator for istio debug info
 type DebugGen struct {
 	Server          *DiscoveryServer
@@ -98,6 +105,12 @@ func (dg *DebugGen) Generate(proxy *model.Proxy, push *model.PushContext, w *mod
 	u, _ := url.Parse(resourceName)
 	debugType := u.Path
 	identity := proxy.VerifiedIdentity
+	if _, ok := istiodDebuggers[debugType]; ok {
+		if identity == nil || identity.Namespace != dg.SystemNamespace || features.IstiodServiceAccount == "" ||
+			identity.ServiceAccount != features.IstiodServiceAccount {
+			return res, model.DefaultXdsLogDetails, fmt.Errorf("the debug info is only available to Istiod, not to identity: %q", identity)
+		}
+	}
 	if identity.Namespace != dg.SystemNamespace {
 		shouldAllow := false
 		if _, ok := activeNamespaceDebuggers[debugType]; ok {
@@ -133,7 +133,9 @@ func (s *DiscoveryServer) pushConnectionDelta(con *Connection, pushEv *Event) er
 		s.updateProxy(con.proxy, pushRequest)
 	}
 
-	if !s.ProxyNeedsPush(con.proxy, pushRequest) {
+	needsPush := s.ProxyNeedsPush(con.proxy, pushRequest)
+	s.recordPushDecision(con, pushRequest, needsPush)
+	if !needsPush {
 		log.Debugf("Skipping push to %v, no updates required", con.ConID)
 		if pushRequest.Full {
 			// Only report for full versions, incremental pushes do not have a new version
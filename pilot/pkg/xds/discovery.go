@@ -15,6 +15,7 @@
 package xds
 
 import (
+	"net/http"
 	"strconv"
 	"sync"
 	"time"
@@ -117,6 +118,18 @@ type DiscoveryServer struct {
 	// pushQueue is the buffer that used after debounce and before the real xds push.
 	pushQueue *PushQueue
 
+	// pushBudget limits the rate of pushes to each proxy and namespace. Nil if no budgets are configured.
+	pushBudget *pushBudget
+
+	// pushTracer records recent pushes and push decisions for debugging. Nil if push tracing is disabled.
+	pushTracer *pushTracer
+
+	// configStatus holds the status of config reported by clients that read config from this server.
+	configStatus *configStatusCache
+
+	// crl holds the CRLs of the CA, distributed to proxies by the CrlGenerator.
+	crl revocationList
+
 	// debugHandlers is the list of all the supported debug handlers.
 	debugHandlers map[string]string
 
@@ -145,6 +158,12 @@ type DiscoveryServer struct {
 
 	// JwtKeyResolver holds a reference to the JWT key resolver instance.
 	JwtKeyResolver *model.JwksResolver
+
+	// CAIssuances, if set, serves the recent certificate issuances of the Istiod CA on the debug interface.
+	CAIssuances http.Handler
+
+	// CARevocation, if set, revokes certificates issued by the Istiod CA on the debug interface.
+	CARevocation http.Handler
 }
 
 // EndpointShards holds the set of endpoint shards of a service. Registries update
@@ -190,12 +209,25 @@ func NewDiscoveryServer(env *model.Environment, plugins []string, instanceID str
 		instanceID: instanceID,
 	}
 
+	out.pushBudget = newPushBudget(pushBudgetOptions{
+		proxyQPS:       features.PushBudgetProxyQPS,
+		proxyBurst:     features.PushBudgetProxyBurst,
+		namespaceQPS:   features.PushBudgetNamespaceQPS,
+		namespaceBurst: features.PushBudgetNamespaceBurst,
+	}, out.pushQueue)
+	out.pushTracer = newPushTracer(features.PushTraceSize)
+	out.configStatus = newConfigStatusCache()
+
 	out.initJwksResolver()
 
 	out.initGenerators(env, systemNameSpace)
 
 	if features.EnableXDSCaching {
-		out.Cache = model.NewXdsCache()
+		if features.XDSCacheSnapshotPath != "" {
+			out.Cache = model.NewPersistentXdsCache(features.XDSCacheSnapshotPath)
+		} else {
+			out.Cache = model.NewXdsCache()
+		}
 	}
 
 	out.ConfigGenerator = core.NewConfigGenerator(plugins, out.Cache)
@@ -237,6 +269,8 @@ var processStartTime = time.Now()
 // CachesSynced is called when caches have been synced so that server can accept connections.
 func (s *DiscoveryServer) CachesSynced() {
 	log.Infof("All caches have been synced up in %v, marking server ready", time.Since(processStartTime))
+	// Warm the xds cache before any proxies connect.
+	s.restoreCache()
 	s.serverReady.Store(true)
 }
 
@@ -249,6 +283,9 @@ func (s *DiscoveryServer) Start(stopCh <-chan struct{}) {
 	go s.handleUpdates(stopCh)
 	go s.periodicRefreshMetrics(stopCh)
 	go s.sendPushes(stopCh)
+	if _, ok := s.Cache.(model.PersistentXdsCache); ok {
+		go s.periodicCacheSnapshot(features.XDSCacheSnapshotInterval, stopCh)
+	}
 }
 
 func (s *DiscoveryServer) getNonK8sRegistries() []serviceregistry.Instance {
@@ -453,7 +490,7 @@ func debounce(ch chan *model.PushRequest, stopCh <-chan struct{}, opts debounceO
 	}
 }
 
-func doSendPushes(stopCh <-chan struct{}, semaphore chan struct{}, queue *PushQueue) {
+func doSendPushes(stopCh <-chan struct{}, semaphore chan struct{}, queue *PushQueue, budget *pushBudget) {
 	for {
 		select {
 		case <-stopCh:
@@ -468,6 +505,13 @@ func doSendPushes(stopCh <-chan struct{}, semaphore chan struct{}, queue *PushQu
 			if shuttingdown {
 				return
 			}
+			push, allowed := budget.Admit(client, push)
+			if !allowed {
+				// The push was deferred, and will be enqueued again once the proxy is within budget.
+				queue.MarkDone(client)
+				<-semaphore
+				continue
+			}
 			recordPushTriggers(push.Reason...)
 			// Signals that a push is done by reading from the semaphore, allowing another send on it.
 			doneFunc := func() {
@@ -529,7 +573,7 @@ func (s *DiscoveryServer) initPushContext(req *model.PushRequest, oldPushContext
 }
 
 func (s *DiscoveryServer) sendPushes(stopCh <-chan struct{}) {
-	doSendPushes(stopCh, s.concurrentPushLimit, s.pushQueue)
+	doSendPushes(stopCh, s.concurrentPushLimit, s.pushQueue, s.pushBudget)
 }
 
 // initGenerators initializes generators to be used by XdsServer.
@@ -543,6 +587,7 @@ func (s *DiscoveryServer) initGenerators(env *model.Environment, systemNameSpace
 	s.Generators[v3.NameTableType] = &NdsGenerator{Server: s}
 	s.Generators[v3.ExtensionConfigurationType] = &EcdsGenerator{Server: s}
 	s.Generators[v3.ProxyConfigType] = &PcdsGenerator{Server: s, TrustBundle: env.TrustBundle}
+	s.Generators[v3.CRLType] = &CrlGenerator{Server: s}
 
 	s.Generators["grpc"] = &grpcgen.GrpcConfigGenerator{}
 	s.Generators["grpc/"+v3.EndpointType] = edsGen
@@ -88,7 +88,7 @@ func TestSendPushesManyPushes(t *testing.T) {
 			}
 		}()
 	}
-	go doSendPushes(stopCh, semaphore, queue)
+	go doSendPushes(stopCh, semaphore, queue, nil)
 
 	for push := 0; push < 100; push++ {
 		for _, proxy := range proxies {
@@ -142,7 +142,7 @@ func TestSendPushesSinglePush(t *testing.T) {
 			}
 		}()
 	}
-	go doSendPushes(stopCh, semaphore, queue)
+	go doSendPushes(stopCh, semaphore, queue, nil)
 
 	for _, proxy := range proxies {
 		queue.Enqueue(proxy, &model.PushRequest{Push: &model.PushContext{}})
@@ -144,6 +144,30 @@ var (
 		[]float64{.1, .5, 1, 3, 5, 10, 20, 30},
 	)
 
+	priorityTag = monitoring.MustCreateLabel("priority")
+
+	pushQueueDepth = monitoring.NewGauge(
+		"pilot_push_queue_depth",
+		"Number of proxies waiting in the push queue, by priority class.",
+		monitoring.WithLabels(priorityTag),
+	)
+
+	pushQueueWaitTime = monitoring.NewDistribution(
+		"pilot_push_queue_wait_time",
+		"Time in seconds a proxy waits in the push queue before being dequeued, by priority class.",
+		[]float64{.1, .5, 1, 3, 5, 10, 20, 30},
+		monitoring.WithLabels(priorityTag),
+	)
+
+	pushBudgetThrottled = monitoring.NewSum(
+		"pilot_xds_push_budget_throttled_total",
+		"Total number of pushes deferred because a proxy or namespace push budget was exhausted.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	pushBudgetThrottledProxy     = pushBudgetThrottled.With(typeTag.Value("proxy"))
+	pushBudgetThrottledNamespace = pushBudgetThrottled.With(typeTag.Value("namespace"))
+
 	pushTriggers = monitoring.NewSum(
 		"pilot_push_triggers",
 		"Total number of times a push was triggered, labeled by reason for the push.",
@@ -208,6 +232,14 @@ func recordPushTriggers(reasons ...model.TriggerReason) {
 	}
 }
 
+func recordPushQueueDepth(priority PushPriority, depth int) {
+	pushQueueDepth.With(priorityTag.Value(priority.String())).Record(float64(depth))
+}
+
+func recordPushQueueWait(priority PushPriority, wait time.Duration) {
+	pushQueueWaitTime.With(priorityTag.Value(priority.String())).Record(wait.Seconds())
+}
+
 func isUnexpectedError(err error) bool {
 	s, ok := status.FromError(err)
 	// Unavailable or canceled code will be sent when a connection is closing down. This is very normal,
@@ -271,6 +303,9 @@ func init() {
 		pushTime,
 		proxiesConvergeDelay,
 		proxiesQueueTime,
+		pushQueueDepth,
+		pushQueueWaitTime,
+		pushBudgetThrottled,
 		pushContextErrors,
 		totalXDSInternalErrors,
 		inboundUpdates,
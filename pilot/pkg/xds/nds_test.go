@@ -44,14 +44,17 @@ func TestNDS(t *testing.T) {
 				Table: map[string]*nds.NameTable_NameInfo{
 					"random-1.host.example": {
 						Ips:      []string{"240.240.0.1"},
+						Ports:    []*nds.NameTable_Port{{Name: "http", Port: 80, Protocol: "tcp"}},
 						Registry: "External",
 					},
 					"random-2.host.example": {
 						Ips:      []string{"9.9.9.9"},
+						Ports:    []*nds.NameTable_Port{{Name: "http", Port: 80, Protocol: "tcp"}},
 						Registry: "External",
 					},
 					"random-3.host.example": {
 						Ips:      []string{"240.240.0.2"},
+						Ports:    []*nds.NameTable_Port{{Name: "http", Port: 80, Protocol: "tcp"}},
 						Registry: "External",
 					},
 				},
@@ -66,6 +69,7 @@ func TestNDS(t *testing.T) {
 				Table: map[string]*nds.NameTable_NameInfo{
 					"random-2.host.example": {
 						Ips:      []string{"9.9.9.9"},
+						Ports:    []*nds.NameTable_Port{{Name: "http", Port: 80, Protocol: "tcp"}},
 						Registry: "External",
 					},
 				},
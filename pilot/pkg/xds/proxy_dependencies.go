@@ -30,11 +30,18 @@ var configKindAffectedProxyTypes = map[config.GroupVersionKind][]model.NodeType{
 // ConfigAffectsProxy checks if a pushEv will affect a specified proxy. That means whether the push will be performed
 // towards the proxy.
 func ConfigAffectsProxy(req *model.PushRequest, proxy *model.Proxy) bool {
+	return configPushDecision(req, proxy) == PushDecisionPushed
+}
+
+// configPushDecision returns PushDecisionPushed if a pushEv will affect a specified proxy, or the reason it does not.
+func configPushDecision(req *model.PushRequest, proxy *model.Proxy) PushDecision {
 	// Empty changes means "all" to get a backward compatibility.
 	if len(req.ConfigsUpdated) == 0 {
-		return true
+		return PushDecisionPushed
 	}
 
+	// Unless a config is relevant to the type of the proxy, every config was filtered out by proxy type.
+	decision := PushDecisionSkippedType
 	for config := range req.ConfigsUpdated {
 		affected := true
 
@@ -49,12 +56,16 @@ func ConfigAffectsProxy(req *model.PushRequest, proxy *model.Proxy) bool {
 			}
 		}
 
-		if affected && checkProxyDependencies(proxy, config) {
-			return true
+		if !affected {
+			continue
+		}
+		if checkProxyDependencies(proxy, config) {
+			return PushDecisionPushed
 		}
+		decision = PushDecisionSkippedSidecarScope
 	}
 
-	return false
+	return decision
 }
 
 func checkProxyDependencies(proxy *model.Proxy, config model.ConfigKey) bool {
@@ -75,8 +86,15 @@ func checkProxyDependencies(proxy *model.Proxy, config model.ConfigKey) bool {
 
 // DefaultProxyNeedsPush check if a proxy needs push for this push event.
 func DefaultProxyNeedsPush(proxy *model.Proxy, req *model.PushRequest) bool {
-	if ConfigAffectsProxy(req, proxy) {
-		return true
+	return defaultPushDecision(proxy, req) == PushDecisionPushed
+}
+
+// defaultPushDecision returns PushDecisionPushed if a proxy needs push for this push event, or the reason it does
+// not. This is the decision of DefaultProxyNeedsPush.
+func defaultPushDecision(proxy *model.Proxy, req *model.PushRequest) PushDecision {
+	decision := configPushDecision(req, proxy)
+	if decision == PushDecisionPushed {
+		return decision
 	}
 
 	// If the proxy's service updated, need push for it.
@@ -87,9 +105,32 @@ func DefaultProxyNeedsPush(proxy *model.Proxy, req *model.PushRequest) bool {
 			Name:      string(svc.Hostname),
 			Namespace: svc.Attributes.Namespace,
 		}]; ok {
-			return true
+			return PushDecisionPushed
 		}
 	}
 
-	return false
+	return decision
+}
+
+// PushDecision describes whether a push was sent to a proxy, and if not, why it was skipped.
+type PushDecision string
+
+const (
+	// PushDecisionPushed means the proxy was pushed.
+	PushDecisionPushed PushDecision = "pushed"
+	// PushDecisionSkippedType means none of the updated configs are relevant to the type of the proxy.
+	PushDecisionSkippedType PushDecision = "skipped_type"
+	// PushDecisionSkippedSidecarScope means the updated configs are not part of the Sidecar scope of the proxy.
+	PushDecisionSkippedSidecarScope PushDecision = "skipped_sidecar_scope"
+	// PushDecisionSkipped means the push was skipped by a ProxyNeedsPush other than DefaultProxyNeedsPush, although
+	// DefaultProxyNeedsPush would have pushed the proxy.
+	PushDecisionSkipped PushDecision = "skipped"
+)
+
+// explainSkippedPush determines why a push was skipped for a proxy, with the same checks as DefaultProxyNeedsPush.
+func explainSkippedPush(proxy *model.Proxy, req *model.PushRequest) PushDecision {
+	if decision := defaultPushDecision(proxy, req); decision != PushDecisionPushed {
+		return decision
+	}
+	return PushDecisionSkipped
 }
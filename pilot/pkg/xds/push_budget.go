@@ -0,0 +1,273 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+type pushBudgetOptions struct {
+	proxyQPS       float64
+	proxyBurst     int
+	namespaceQPS   float64
+	namespaceBurst int
+}
+
+// pushBudget limits how often pushes are sent to a single proxy, and to all proxies in a namespace, using token
+// buckets. Pushes over budget are deferred; all pushes deferred for a proxy are merged and enqueued again once the
+// budget allows it. This keeps a noisy proxy or namespace from consuming push capacity needed by the rest of the mesh.
+type pushBudget struct {
+	opts  pushBudgetOptions
+	queue *PushQueue
+
+	mu         sync.Mutex
+	proxies    map[*Connection]*proxyBudget
+	namespaces map[string]*namespaceBudget
+}
+
+type proxyBudget struct {
+	limiter *rate.Limiter
+	// deferred is the merged request of all pushes deferred for the proxy, if any
+	deferred      *model.PushRequest
+	deferredUntil time.Time
+	timer         *time.Timer
+	throttled     int64
+	// removed is set once the connection is closed, so that deferred pushes are dropped
+	removed bool
+}
+
+type namespaceBudget struct {
+	limiter   *rate.Limiter
+	throttled int64
+}
+
+// newPushBudget returns a pushBudget, or nil if no budgets are configured.
+func newPushBudget(opts pushBudgetOptions, queue *PushQueue) *pushBudget {
+	if opts.proxyQPS <= 0 && opts.namespaceQPS <= 0 {
+		return nil
+	}
+	return &pushBudget{
+		opts:       opts,
+		queue:      queue,
+		proxies:    map[*Connection]*proxyBudget{},
+		namespaces: map[string]*namespaceBudget{},
+	}
+}
+
+func newLimiter(qps float64, burst int) *rate.Limiter {
+	if qps <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}
+
+// Admit reports whether a push to the connection may be sent now, returning the request to send. If not, the push
+// is deferred and will be enqueued again, merged with any other deferred pushes for the connection, once the
+// budget allows it.
+func (b *pushBudget) Admit(con *Connection, req *model.PushRequest) (*model.PushRequest, bool) {
+	if b == nil || con.proxy == nil {
+		return req, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pb := b.proxies[con]
+	if pb == nil {
+		if connectionClosed(con) {
+			// The push was queued before the connection was removed; do not track a budget for it again.
+			return req, true
+		}
+		pb = &proxyBudget{limiter: newLimiter(b.opts.proxyQPS, b.opts.proxyBurst)}
+		b.proxies[con] = pb
+	}
+	ns := con.proxy.ConfigNamespace
+	nb := b.namespaces[ns]
+	if nb == nil {
+		nb = &namespaceBudget{limiter: newLimiter(b.opts.namespaceQPS, b.opts.namespaceBurst)}
+		b.namespaces[ns] = nb
+	}
+
+	now := time.Now()
+	pr := pb.limiter.ReserveN(now, 1)
+	nr := nb.limiter.ReserveN(now, 1)
+	proxyDelay, namespaceDelay := pr.DelayFrom(now), nr.DelayFrom(now)
+	if proxyDelay == 0 && namespaceDelay == 0 {
+		if pb.deferred != nil {
+			// Send everything that was deferred along with this push. The pending timer will find nothing to do.
+			req = pb.deferred.Merge(req)
+			pb.deferred = nil
+		}
+		return req, true
+	}
+
+	// Over budget; return the tokens so they are available when the deferred push is sent.
+	pr.CancelAt(now)
+	nr.CancelAt(now)
+	delay := proxyDelay
+	if proxyDelay > 0 {
+		pb.throttled++
+		pushBudgetThrottledProxy.Increment()
+	}
+	if namespaceDelay > 0 {
+		nb.throttled++
+		pushBudgetThrottledNamespace.Increment()
+		if namespaceDelay > delay {
+			// All proxies deferred by the namespace budget get about the same delay. Spread their pushes out, so
+			// they do not all come back at once and get deferred again.
+			delay = namespaceDelay + time.Duration(rand.Int63n(int64(namespaceDelay)+1))
+		}
+	}
+	if pb.deferred != nil {
+		pb.deferred = pb.deferred.Merge(req)
+		return nil, false
+	}
+	pb.deferred = req
+	pb.deferredUntil = now.Add(delay)
+	pb.timer = time.AfterFunc(delay, func() {
+		b.mu.Lock()
+		deferred := pb.deferred
+		pb.deferred = nil
+		removed := pb.removed
+		b.mu.Unlock()
+		if deferred != nil && !removed {
+			b.queue.Enqueue(con, deferred)
+		}
+	})
+	return nil, false
+}
+
+// Remove drops the budget of a closed connection, along with any push deferred for it.
+func (b *pushBudget) Remove(con *Connection) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pb := b.proxies[con]
+	if pb == nil {
+		return
+	}
+	pb.removed = true
+	pb.deferred = nil
+	if pb.timer != nil {
+		pb.timer.Stop()
+	}
+	delete(b.proxies, con)
+}
+
+// connectionClosed returns true if the stream of the connection is done.
+func connectionClosed(con *Connection) bool {
+	if con.stream != nil {
+		return con.stream.Context().Err() != nil
+	}
+	if con.deltaStream != nil {
+		return con.deltaStream.Context().Err() != nil
+	}
+	return false
+}
+
+// PushBudgetDebug describes the push budgets and the proxies and namespaces that have been throttled.
+type PushBudgetDebug struct {
+	ProxyQPS       float64                    `json:"proxyQPS"`
+	ProxyBurst     int                        `json:"proxyBurst"`
+	NamespaceQPS   float64                    `json:"namespaceQPS"`
+	NamespaceBurst int                        `json:"namespaceBurst"`
+	Proxies        []ProxyPushBudgetDebug     `json:"proxies"`
+	Namespaces     []NamespacePushBudgetDebug `json:"namespaces"`
+}
+
+// ProxyPushBudgetDebug describes the push budget of a single proxy.
+type ProxyPushBudgetDebug struct {
+	ConnectionID string `json:"connectionID"`
+	Namespace    string `json:"namespace"`
+	// Throttled is the number of pushes to the proxy deferred because the proxy was over budget.
+	Throttled int64 `json:"throttled"`
+	// DeferredUntil is set if a push to the proxy is currently deferred.
+	DeferredUntil *time.Time `json:"deferredUntil,omitempty"`
+}
+
+// NamespacePushBudgetDebug describes the push budget of a namespace.
+type NamespacePushBudgetDebug struct {
+	Namespace string `json:"namespace"`
+	// Throttled is the number of pushes to proxies in the namespace deferred because the namespace was over budget.
+	Throttled int64 `json:"throttled"`
+}
+
+func (b *pushBudget) debug() PushBudgetDebug {
+	if b == nil {
+		return PushBudgetDebug{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := PushBudgetDebug{
+		ProxyQPS:       b.opts.proxyQPS,
+		ProxyBurst:     b.opts.proxyBurst,
+		NamespaceQPS:   b.opts.namespaceQPS,
+		NamespaceBurst: b.opts.namespaceBurst,
+		Proxies:        []ProxyPushBudgetDebug{},
+		Namespaces:     []NamespacePushBudgetDebug{},
+	}
+	for con, pb := range b.proxies {
+		if pb.throttled == 0 && pb.deferred == nil {
+			continue
+		}
+		pd := ProxyPushBudgetDebug{
+			ConnectionID: con.ConID,
+			Namespace:    con.proxy.ConfigNamespace,
+			Throttled:    pb.throttled,
+		}
+		if pb.deferred != nil {
+			until := pb.deferredUntil
+			pd.DeferredUntil = &until
+		}
+		out.Proxies = append(out.Proxies, pd)
+	}
+	for ns, nb := range b.namespaces {
+		if nb.throttled == 0 {
+			continue
+		}
+		out.Namespaces = append(out.Namespaces, NamespacePushBudgetDebug{Namespace: ns, Throttled: nb.throttled})
+	}
+	// Most throttled first
+	sort.Slice(out.Proxies, func(i, j int) bool {
+		if out.Proxies[i].Throttled != out.Proxies[j].Throttled {
+			return out.Proxies[i].Throttled > out.Proxies[j].Throttled
+		}
+		return out.Proxies[i].ConnectionID < out.Proxies[j].ConnectionID
+	})
+	sort.Slice(out.Namespaces, func(i, j int) bool {
+		if out.Namespaces[i].Throttled != out.Namespaces[j].Throttled {
+			return out.Namespaces[i].Throttled > out.Namespaces[j].Throttled
+		}
+		return out.Namespaces[i].Namespace < out.Namespaces[j].Namespace
+	})
+	return out
+}
+
+// pushBudgetz shows the configured push budgets, and which proxies and namespaces are being throttled.
+func (s *DiscoveryServer) pushBudgetz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, s.pushBudget.debug())
+}
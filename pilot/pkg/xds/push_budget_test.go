@@ -0,0 +1,202 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schema/gvk"
+)
+
+func budgetConnection(id, namespace string) *Connection {
+	return &Connection{ConID: id, proxy: &model.Proxy{Type: model.SidecarProxy, ConfigNamespace: namespace}}
+}
+
+func serviceEntryPush(name string) *model.PushRequest {
+	return &model.PushRequest{ConfigsUpdated: map[model.ConfigKey]struct{}{{Kind: gvk.ServiceEntry, Name: name}: {}}}
+}
+
+func TestPushBudgetProxy(t *testing.T) {
+	queue := NewPushQueue()
+	defer queue.ShutDown()
+	b := newPushBudget(pushBudgetOptions{proxyQPS: 5, proxyBurst: 1}, queue)
+	con := budgetConnection("a", "ns")
+
+	if _, ok := b.Admit(con, serviceEntryPush("1")); !ok {
+		t.Fatalf("expected first push to be allowed")
+	}
+	if _, ok := b.Admit(con, serviceEntryPush("2")); ok {
+		t.Fatalf("expected second push to be deferred")
+	}
+	if _, ok := b.Admit(con, serviceEntryPush("3")); ok {
+		t.Fatalf("expected third push to be deferred")
+	}
+	// Other proxies have their own budget
+	if _, ok := b.Admit(budgetConnection("b", "ns"), serviceEntryPush("1")); !ok {
+		t.Fatalf("expected push to another proxy to be allowed")
+	}
+
+	dbg := b.debug()
+	if len(dbg.Proxies) != 1 || dbg.Proxies[0].ConnectionID != "a" || dbg.Proxies[0].Throttled != 2 || dbg.Proxies[0].DeferredUntil == nil {
+		t.Fatalf("unexpected debug output: %+v", dbg)
+	}
+
+	// The deferred pushes are merged into a single push once the proxy is within budget again.
+	ExpectDequeue(t, queue, con)
+	if queue.Pending() != 0 {
+		t.Fatalf("expected a single merged push, got %v pending", queue.Pending())
+	}
+	queue.MarkDone(con)
+	dbg = b.debug()
+	if dbg.Proxies[0].DeferredUntil != nil {
+		t.Fatalf("expected no deferred push, got %+v", dbg.Proxies[0])
+	}
+}
+
+func TestPushBudgetMerge(t *testing.T) {
+	queue := NewPushQueue()
+	defer queue.ShutDown()
+	b := newPushBudget(pushBudgetOptions{proxyQPS: 5, proxyBurst: 1}, queue)
+	con := budgetConnection("a", "ns")
+
+	b.Admit(con, serviceEntryPush("1"))
+	b.Admit(con, serviceEntryPush("2"))
+	b.Admit(con, serviceEntryPush("3"))
+
+	done := make(chan *model.PushRequest, 1)
+	go func() {
+		_, req, _ := queue.Dequeue()
+		done <- req
+	}()
+	select {
+	case req := <-done:
+		got, ok := b.Admit(con, req)
+		if !ok {
+			t.Fatalf("expected deferred push to be allowed")
+		}
+		if _, f := got.ConfigsUpdated[model.ConfigKey{Kind: gvk.ServiceEntry, Name: "2"}]; !f {
+			t.Fatalf("expected merged push to include config 2, got %v", got.ConfigsUpdated)
+		}
+		if _, f := got.ConfigsUpdated[model.ConfigKey{Kind: gvk.ServiceEntry, Name: "3"}]; !f {
+			t.Fatalf("expected merged push to include config 3, got %v", got.ConfigsUpdated)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for deferred push")
+	}
+}
+
+func TestPushBudgetNamespace(t *testing.T) {
+	queue := NewPushQueue()
+	defer queue.ShutDown()
+	b := newPushBudget(pushBudgetOptions{namespaceQPS: 1, namespaceBurst: 2}, queue)
+
+	for _, id := range []string{"a", "b"} {
+		if _, ok := b.Admit(budgetConnection(id, "noisy"), serviceEntryPush("1")); !ok {
+			t.Fatalf("expected push to %v to be allowed", id)
+		}
+	}
+	if _, ok := b.Admit(budgetConnection("c", "noisy"), serviceEntryPush("1")); ok {
+		t.Fatalf("expected push over the namespace budget to be deferred")
+	}
+	if _, ok := b.Admit(budgetConnection("d", "quiet"), serviceEntryPush("1")); !ok {
+		t.Fatalf("expected push to another namespace to be allowed")
+	}
+
+	dbg := b.debug()
+	if len(dbg.Namespaces) != 1 || dbg.Namespaces[0].Namespace != "noisy" || dbg.Namespaces[0].Throttled != 1 {
+		t.Fatalf("unexpected debug output: %+v", dbg)
+	}
+}
+
+func TestPushBudgetNamespaceJitter(t *testing.T) {
+	queue := NewPushQueue()
+	defer queue.ShutDown()
+	b := newPushBudget(pushBudgetOptions{namespaceQPS: 10, namespaceBurst: 1}, queue)
+
+	start := time.Now()
+	b.Admit(budgetConnection("a", "noisy"), serviceEntryPush("1"))
+	for _, id := range []string{"b", "c", "d", "e"} {
+		if _, ok := b.Admit(budgetConnection(id, "noisy"), serviceEntryPush("1")); ok {
+			t.Fatalf("expected push to %v to be deferred", id)
+		}
+	}
+	// The deferred pushes are spread over up to twice the namespace delay, rather than all sent at once.
+	seen := map[time.Time]struct{}{}
+	for _, p := range b.debug().Proxies {
+		until := *p.DeferredUntil
+		if until.Before(start.Add(90*time.Millisecond)) || until.After(time.Now().Add(200*time.Millisecond)) {
+			t.Fatalf("unexpected deferral of %v until %v", p.ConnectionID, until.Sub(start))
+		}
+		seen[until] = struct{}{}
+	}
+	if len(seen) < 2 {
+		t.Fatalf("expected deferred pushes to be jittered, got %v", seen)
+	}
+}
+
+type closedStream struct {
+	fakeStream
+}
+
+func (h *closedStream) Context() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestPushBudgetRemove(t *testing.T) {
+	queue := NewPushQueue()
+	defer queue.ShutDown()
+	b := newPushBudget(pushBudgetOptions{proxyQPS: 20, proxyBurst: 1}, queue)
+	con := budgetConnection("a", "ns")
+
+	b.Admit(con, serviceEntryPush("1"))
+	if _, ok := b.Admit(con, serviceEntryPush("2")); ok {
+		t.Fatalf("expected second push to be deferred")
+	}
+	b.Remove(con)
+	con.stream = &closedStream{}
+
+	// The deferred push is dropped, rather than enqueued for the closed connection.
+	time.Sleep(100 * time.Millisecond)
+	if queue.Pending() != 0 {
+		t.Fatalf("expected the deferred push to be dropped, got %v pending", queue.Pending())
+	}
+	// Pushes queued before the connection was removed do not recreate its budget.
+	if _, ok := b.Admit(con, serviceEntryPush("3")); !ok {
+		t.Fatalf("expected push to the closed connection to be allowed")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.proxies) != 0 {
+		t.Fatalf("expected no budget for the closed connection, got %v", len(b.proxies))
+	}
+}
+
+func TestPushBudgetDisabled(t *testing.T) {
+	b := newPushBudget(pushBudgetOptions{}, NewPushQueue())
+	if b != nil {
+		t.Fatalf("expected no budget when disabled")
+	}
+	con := budgetConnection("a", "ns")
+	for i := 0; i < 100; i++ {
+		if _, ok := b.Admit(con, serviceEntryPush("1")); !ok {
+			t.Fatalf("expected push to be allowed")
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// maxTracedConfigs is the maximum number of updated configs listed in a push trace entry.
+const maxTracedConfigs = 20
+
+// PushTraceEntry records a push, and for a proxy, the decision whether to push it.
+type PushTraceEntry struct {
+	Time        time.Time             `json:"time"`
+	PushVersion string                `json:"pushVersion,omitempty"`
+	Full        bool                  `json:"full"`
+	Reasons     []model.TriggerReason `json:"reasons,omitempty"`
+	// ConfigsUpdated lists the updated configs, as kind/namespace/name. At most maxTracedConfigs are listed.
+	// Empty for a full push means all configs are considered updated.
+	ConfigsUpdated []string `json:"configsUpdated,omitempty"`
+	// ConfigsUpdatedCount is the total number of updated configs.
+	ConfigsUpdatedCount int `json:"configsUpdatedCount"`
+	// Proxies is the number of proxies the push was sent to. Only set for pushes to all proxies.
+	Proxies int `json:"proxies,omitempty"`
+	// Decision is the outcome of the push for a proxy. Only set for proxy entries.
+	Decision PushDecision `json:"decision,omitempty"`
+}
+
+// PushTraceResponse is the response of the /debug/push_trace endpoint.
+type PushTraceResponse struct {
+	// ProxyID is the connection the entries are for. If empty, the entries are all recent pushes.
+	ProxyID string           `json:"proxyID,omitempty"`
+	Entries []PushTraceEntry `json:"entries"`
+}
+
+// pushTraceRecord is a recorded push, or push decision for a proxy. The entry describing the push is shared by
+// the push and all the decisions for it, and must not be modified.
+type pushTraceRecord struct {
+	entry    *PushTraceEntry
+	time     time.Time
+	decision PushDecision
+}
+
+// pushTraceRing is a bounded ring buffer of push trace records.
+type pushTraceRing struct {
+	records []pushTraceRecord
+	next    int
+}
+
+func (r *pushTraceRing) add(size int, rec pushTraceRecord) {
+	if len(r.records) < size {
+		r.records = append(r.records, rec)
+		return
+	}
+	r.records[r.next] = rec
+	r.next = (r.next + 1) % size
+}
+
+// list returns the entries, oldest first.
+func (r *pushTraceRing) list() []PushTraceEntry {
+	out := make([]PushTraceEntry, 0, len(r.records))
+	for i := range r.records {
+		rec := r.records[(r.next+i)%len(r.records)]
+		e := *rec.entry
+		e.Time = rec.time
+		if rec.decision != "" {
+			e.Proxies = 0
+			e.Decision = rec.decision
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// pushTracer records recent pushes, and the push decisions for each connection, so that it is possible to
+// tell why a config change did or did not reach a proxy.
+type pushTracer struct {
+	size int
+
+	mu      sync.Mutex
+	pushes  pushTraceRing
+	proxies map[string]*pushTraceRing
+	// lastPush and lastEntry are the last push to all proxies and its entry, which is shared by the push
+	// decisions for it, so that the entry is not built again for every proxy.
+	lastPush  *model.PushRequest
+	lastEntry *PushTraceEntry
+}
+
+func newPushTracer(size int) *pushTracer {
+	if size <= 0 {
+		return nil
+	}
+	return &pushTracer{size: size, proxies: map[string]*pushTraceRing{}}
+}
+
+func newPushTraceEntry(req *model.PushRequest) PushTraceEntry {
+	e := PushTraceEntry{
+		Time:                time.Now(),
+		Full:                req.Full,
+		Reasons:             req.Reason,
+		ConfigsUpdatedCount: len(req.ConfigsUpdated),
+	}
+	if req.Push != nil {
+		e.PushVersion = req.Push.PushVersion
+	}
+	for key := range req.ConfigsUpdated {
+		e.ConfigsUpdated = append(e.ConfigsUpdated, key.Kind.Kind+"/"+key.Namespace+"/"+key.Name)
+	}
+	// Sort before truncating, so the same configs are listed for the same push.
+	sort.Strings(e.ConfigsUpdated)
+	if len(e.ConfigsUpdated) > maxTracedConfigs {
+		e.ConfigsUpdated = e.ConfigsUpdated[:maxTracedConfigs]
+	}
+	return e
+}
+
+// recordPush records a push to all proxies.
+func (t *pushTracer) recordPush(req *model.PushRequest, proxies int) {
+	if t == nil {
+		return
+	}
+	e := newPushTraceEntry(req)
+	e.Proxies = proxies
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pushes.add(t.size, pushTraceRecord{entry: &e, time: e.Time})
+	t.lastPush = req
+	t.lastEntry = &e
+}
+
+// recordDecision records whether a push was sent to a connection.
+func (t *pushTracer) recordDecision(con *Connection, req *model.PushRequest, decision PushDecision) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	e := t.lastEntry
+	if req != t.lastPush {
+		// The push was merged with other pushes for this connection, or was not a push to all proxies.
+		t.mu.Unlock()
+		pe := newPushTraceEntry(req)
+		e = &pe
+		t.mu.Lock()
+	}
+	defer t.mu.Unlock()
+	r := t.proxies[con.ConID]
+	if r == nil {
+		r = &pushTraceRing{}
+		t.proxies[con.ConID] = r
+	}
+	r.add(t.size, pushTraceRecord{entry: e, time: now, decision: decision})
+}
+
+// remove drops the entries of a closed connection.
+func (t *pushTracer) remove(conID string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.proxies, conID)
+}
+
+func (t *pushTracer) listPushes() []PushTraceEntry {
+	if t == nil {
+		return []PushTraceEntry{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.pushes.list()
+}
+
+func (t *pushTracer) listDecisions(conID string) []PushTraceEntry {
+	if t == nil {
+		return []PushTraceEntry{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := t.proxies[conID]
+	if r == nil {
+		return []PushTraceEntry{}
+	}
+	return r.list()
+}
+
+// recordPushDecision records the outcome of ProxyNeedsPush for a connection.
+func (s *DiscoveryServer) recordPushDecision(con *Connection, req *model.PushRequest, needsPush bool) {
+	if s.pushTracer == nil {
+		return
+	}
+	decision := PushDecisionPushed
+	if !needsPush {
+		decision = explainSkippedPush(con.proxy, req)
+	}
+	s.pushTracer.recordDecision(con, req, decision)
+}
+
+// pushTrace shows recent pushes. If a proxyID is given, the recent push decisions for the proxy are shown instead.
+func (s *DiscoveryServer) pushTrace(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Query().Get("proxyID") == "" {
+		writeJSON(w, PushTraceResponse{Entries: s.pushTracer.listPushes()})
+		return
+	}
+	con := s.getDebugConnection(w, req)
+	if con == nil {
+		// Error response already written
+		return
+	}
+	writeJSON(w, PushTraceResponse{ProxyID: con.ConID, Entries: s.pushTracer.listDecisions(con.ConID)})
+}
@@ -0,0 +1,194 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+func TestPushTraceRing(t *testing.T) {
+	tracer := newPushTracer(3)
+	for i := 0; i < 5; i++ {
+		tracer.recordPush(&model.PushRequest{Push: &model.PushContext{PushVersion: fmt.Sprint(i)}}, i)
+	}
+	got := tracer.listPushes()
+	if len(got) != 3 {
+		t.Fatalf("expected 3 entries, got %v", len(got))
+	}
+	for i, e := range got {
+		if want := fmt.Sprint(i + 2); e.PushVersion != want {
+			t.Fatalf("expected entry %d to be push %v, got %v", i, want, e.PushVersion)
+		}
+	}
+	if newPushTracer(0) != nil {
+		t.Fatalf("expected tracing to be disabled")
+	}
+}
+
+func TestPushTraceDecisionsShareEntry(t *testing.T) {
+	tracer := newPushTracer(3)
+	req := &model.PushRequest{Full: true, ConfigsUpdated: map[model.ConfigKey]struct{}{
+		{Kind: gvk.ServiceEntry, Name: "foo.com", Namespace: "ns"}: {},
+	}}
+	tracer.recordPush(req, 2)
+	a, b := &Connection{ConID: "a"}, &Connection{ConID: "b"}
+	tracer.recordDecision(a, req, PushDecisionPushed)
+	tracer.recordDecision(b, req, PushDecisionSkippedType)
+
+	// The entry is built once for the push, and shared by the decisions for it.
+	shared := tracer.pushes.records[0].entry
+	for _, con := range []*Connection{a, b} {
+		if e := tracer.proxies[con.ConID].records[0].entry; e != shared {
+			t.Fatalf("expected the decision for %v to share the push entry", con.ConID)
+		}
+	}
+	got := tracer.listDecisions(b.ConID)
+	if len(got) != 1 || got[0].Decision != PushDecisionSkippedType || got[0].Proxies != 0 ||
+		len(got[0].ConfigsUpdated) != 1 || !got[0].Full {
+		t.Fatalf("unexpected decisions: %+v", got)
+	}
+	if got := tracer.listPushes(); len(got) != 1 || got[0].Proxies != 2 || got[0].Decision != "" {
+		t.Fatalf("unexpected pushes: %+v", got)
+	}
+
+	// Merged requests get their own entry.
+	merged := req.Merge(&model.PushRequest{Full: true})
+	tracer.recordDecision(a, merged, PushDecisionPushed)
+	if e := tracer.proxies[a.ConID].records[1].entry; e == shared {
+		t.Fatalf("expected the decision for a merged push to have its own entry")
+	}
+}
+
+func TestExplainSkippedPush(t *testing.T) {
+	scope := &model.SidecarScope{Name: "default", Namespace: "ns", RootNamespace: "istio-system"}
+	scope.AddConfigDependencies(model.ConfigKey{Kind: gvk.ServiceEntry, Name: "bar.com", Namespace: "ns"})
+	sidecar := &model.Proxy{Type: model.SidecarProxy, SidecarScope: scope}
+	instance := &model.Proxy{
+		Type:         model.SidecarProxy,
+		SidecarScope: scope,
+		ServiceInstances: []*model.ServiceInstance{{
+			Service: &model.Service{Hostname: "foo.com", Attributes: model.ServiceAttributes{Namespace: "ns"}},
+		}},
+	}
+	cases := []struct {
+		name    string
+		proxy   *model.Proxy
+		configs []model.ConfigKey
+		want    PushDecision
+	}{
+		{"gateway", sidecar, []model.ConfigKey{{Kind: gvk.Gateway, Name: "gw", Namespace: "ns"}}, PushDecisionSkippedType},
+		{"service entry", sidecar, []model.ConfigKey{{Kind: gvk.ServiceEntry, Name: "foo.com", Namespace: "ns"}}, PushDecisionSkippedSidecarScope},
+		{"mixed", sidecar, []model.ConfigKey{
+			{Kind: gvk.Gateway, Name: "gw", Namespace: "ns"},
+			{Kind: gvk.Sidecar, Name: "default", Namespace: "other"},
+		}, PushDecisionSkippedSidecarScope},
+		// DefaultProxyNeedsPush pushes these, so they can only have been skipped by a custom ProxyNeedsPush.
+		{"in sidecar scope", sidecar, []model.ConfigKey{{Kind: gvk.ServiceEntry, Name: "bar.com", Namespace: "ns"}}, PushDecisionSkipped},
+		{"service of the proxy", instance, []model.ConfigKey{{Kind: gvk.ServiceEntry, Name: "foo.com", Namespace: "ns"}}, PushDecisionSkipped},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &model.PushRequest{ConfigsUpdated: map[model.ConfigKey]struct{}{}}
+			for _, c := range tt.configs {
+				req.ConfigsUpdated[c] = struct{}{}
+			}
+			if got := explainSkippedPush(tt.proxy, req); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPushTraceEntryConfigs(t *testing.T) {
+	req := &model.PushRequest{ConfigsUpdated: map[model.ConfigKey]struct{}{}}
+	for i := 0; i < 2*maxTracedConfigs; i++ {
+		req.ConfigsUpdated[model.ConfigKey{Kind: gvk.ServiceEntry, Name: fmt.Sprintf("svc-%02d", i), Namespace: "ns"}] = struct{}{}
+	}
+	e := newPushTraceEntry(req)
+	if e.ConfigsUpdatedCount != 2*maxTracedConfigs {
+		t.Fatalf("expected %d updated configs, got %d", 2*maxTracedConfigs, e.ConfigsUpdatedCount)
+	}
+	if len(e.ConfigsUpdated) != maxTracedConfigs {
+		t.Fatalf("expected %d listed configs, got %d", maxTracedConfigs, len(e.ConfigsUpdated))
+	}
+	// The first configs in order are listed.
+	for i, c := range e.ConfigsUpdated {
+		if want := fmt.Sprintf("ServiceEntry/ns/svc-%02d", i); c != want {
+			t.Fatalf("expected config %d to be %v, got %v", i, want, c)
+		}
+	}
+}
+
+func getPushTrace(t *testing.T, s *DiscoveryServer, proxyID string) PushTraceResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/debug/push_trace?proxyID="+proxyID, nil)
+	rr := httptest.NewRecorder()
+	s.pushTrace(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status %v: %v", rr.Code, rr.Body.String())
+	}
+	got := PushTraceResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestPushTrace(t *testing.T) {
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+	ads := s.ConnectADS().WithType(v3.ClusterType)
+	ads.RequestResponseAck(t, nil)
+
+	expectDecision := func(key model.ConfigKey, want PushDecision) {
+		t.Helper()
+		s.Discovery.ConfigUpdate(&model.PushRequest{
+			Full:           true,
+			ConfigsUpdated: map[model.ConfigKey]struct{}{key: {}},
+			Reason:         []model.TriggerReason{model.ConfigUpdate},
+		})
+		retry.UntilSuccessOrFail(t, func() error {
+			entries := getPushTrace(t, s.Discovery, "test.default").Entries
+			if len(entries) == 0 {
+				return fmt.Errorf("no push decisions recorded")
+			}
+			last := entries[len(entries)-1]
+			if len(last.ConfigsUpdated) != 1 || last.ConfigsUpdated[0] != key.Kind.Kind+"/"+key.Namespace+"/"+key.Name {
+				return fmt.Errorf("unexpected last push: %+v", last)
+			}
+			if last.Decision != want {
+				return fmt.Errorf("got decision %v, want %v", last.Decision, want)
+			}
+			return nil
+		})
+	}
+
+	expectDecision(model.ConfigKey{Kind: gvk.Gateway, Name: "gw", Namespace: "default"}, PushDecisionSkippedType)
+	expectDecision(model.ConfigKey{Kind: gvk.ServiceEntry, Name: "unknown.example.com", Namespace: "other"}, PushDecisionSkippedSidecarScope)
+	expectDecision(model.ConfigKey{Kind: gvk.AuthorizationPolicy, Name: "policy", Namespace: "default"}, PushDecisionPushed)
+
+	pushes := getPushTrace(t, s.Discovery, "").Entries
+	if len(pushes) == 0 || pushes[len(pushes)-1].Proxies != 1 {
+		t.Fatalf("expected recent pushes to all proxies, got %+v", pushes)
+	}
+}
@@ -16,19 +16,93 @@ package xds
 
 import (
 	"sync"
+	"time"
 
 	"istio.io/istio/pilot/pkg/model"
 )
 
+// PushPriority is the priority class of a proxy in the PushQueue. Lower values are more urgent.
+type PushPriority int
+
+const (
+	// GatewayPushPriority is used for gateways, which serve traffic for many workloads.
+	GatewayPushPriority PushPriority = iota
+	// DependencyPushPriority is used for proxies that depend on a config changed by the push.
+	DependencyPushPriority
+	// DefaultPushPriority is used for all other proxies.
+	DefaultPushPriority
+
+	numPushPriorities = int(DefaultPushPriority) + 1
+)
+
+func (p PushPriority) String() string {
+	switch p {
+	case GatewayPushPriority:
+		return "gateway"
+	case DependencyPushPriority:
+		return "dependency"
+	default:
+		return "default"
+	}
+}
+
+// pushPriorityWeights is the relative share of dequeues each priority class gets while several classes
+// have pending proxies. Every class gets a non-zero share, so a steady stream of gateway pushes cannot
+// starve other proxies.
+var pushPriorityWeights = [numPushPriorities]int{
+	GatewayPushPriority:    4,
+	DependencyPushPriority: 2,
+	DefaultPushPriority:    1,
+}
+
+// pushPriority returns the priority class of a push to a connection.
+func pushPriority(con *Connection, req *model.PushRequest) PushPriority {
+	if con.proxy == nil {
+		return DefaultPushPriority
+	}
+	if con.proxy.Type == model.Router {
+		return GatewayPushPriority
+	}
+	// An empty ConfigsUpdated means everything changed, so no proxy is more urgent than another.
+	if req == nil || len(req.ConfigsUpdated) == 0 {
+		return DefaultPushPriority
+	}
+	con.proxy.RLock()
+	defer con.proxy.RUnlock()
+	if con.proxy.SidecarScope != nil && ConfigAffectsProxy(req, con.proxy) {
+		return DependencyPushPriority
+	}
+	return DefaultPushPriority
+}
+
+type pendingPush struct {
+	request  *model.PushRequest
+	priority PushPriority
+	// seq identifies the queue entry that is valid for this push. Entries left behind when a push is
+	// promoted to a higher priority class are skipped on Dequeue.
+	seq      uint64
+	enqueued time.Time
+}
+
+type queueEntry struct {
+	con *Connection
+	seq uint64
+}
+
 type PushQueue struct {
 	cond *sync.Cond
 
 	// pending stores all connections in the queue. If the same connection is enqueued again,
 	// the PushRequest will be merged.
-	pending map[*Connection]*model.PushRequest
+	pending map[*Connection]*pendingPush
 
-	// queue maintains ordering of the queue
-	queue []*Connection
+	// queues maintains ordering of the queue within each priority class
+	queues [numPushPriorities][]queueEntry
+	// depth is the number of pending connections in each priority class
+	depth [numPushPriorities]int
+	// credit tracks the share of dequeues each priority class has received, for weighted round robin.
+	credit [numPushPriorities]int
+	seq    uint64
 
 	// processing stores all connections that have been Dequeue(), but not MarkDone().
 	// The value stored will be initially be nil, but may be populated if the connection is Enqueue().
@@ -40,7 +114,7 @@ type PushQueue struct {
 
 func NewPushQueue() *PushQueue {
 	return &PushQueue{
-		pending:    make(map[*Connection]*model.PushRequest),
+		pending:    make(map[*Connection]*pendingPush),
 		processing: make(map[*Connection]*model.PushRequest),
 		cond:       sync.NewCond(&sync.Mutex{}),
 	}
@@ -49,6 +123,8 @@ func NewPushQueue() *PushQueue {
 // Enqueue will mark a proxy as pending a push. If it is already pending, pushInfo will be merged.
 // ServiceEntry updates will be added together, and full will be set if either were full
 func (p *PushQueue) Enqueue(con *Connection, pushRequest *model.PushRequest) {
+	priority := pushPriority(con, pushRequest)
+
 	p.cond.L.Lock()
 	defer p.cond.L.Unlock()
 
@@ -62,41 +138,85 @@ func (p *PushQueue) Enqueue(con *Connection, pushRequest *model.PushRequest) {
 		return
 	}
 
-	if request, f := p.pending[con]; f {
-		p.pending[con] = request.Merge(pushRequest)
+	if pending, f := p.pending[con]; f {
+		pending.request = pending.request.Merge(pushRequest)
+		if priority < pending.priority {
+			// The merged push is more urgent; move it to the higher priority class.
+			p.depth[pending.priority]--
+			recordPushQueueDepth(pending.priority, p.depth[pending.priority])
+			p.push(con, pending, priority)
+		}
 		return
 	}
 
-	p.pending[con] = pushRequest
-	p.queue = append(p.queue, con)
+	p.pending[con] = &pendingPush{request: pushRequest, enqueued: time.Now()}
+	p.push(con, p.pending[con], priority)
 	// Signal waiters on Dequeue that a new item is available
 	p.cond.Signal()
 }
 
+// push adds a pending connection to the back of the queue for a priority class. Must be called with the lock held.
+func (p *PushQueue) push(con *Connection, pending *pendingPush, priority PushPriority) {
+	p.seq++
+	pending.seq = p.seq
+	pending.priority = priority
+	p.queues[priority] = append(p.queues[priority], queueEntry{con: con, seq: p.seq})
+	p.depth[priority]++
+	recordPushQueueDepth(priority, p.depth[priority])
+}
+
+// nextPriority selects the priority class to dequeue from, using smooth weighted round robin over the
+// classes with pending connections. Must be called with the lock held, and with at least one pending connection.
+func (p *PushQueue) nextPriority() PushPriority {
+	best, total := -1, 0
+	for i := range p.depth {
+		if p.depth[i] == 0 {
+			continue
+		}
+		p.credit[i] += pushPriorityWeights[i]
+		total += pushPriorityWeights[i]
+		if best == -1 || p.credit[i] > p.credit[best] {
+			best = i
+		}
+	}
+	p.credit[best] -= total
+	return PushPriority(best)
+}
+
 // Remove a proxy from the queue. If there are no proxies ready to be removed, this will block
 func (p *PushQueue) Dequeue() (con *Connection, request *model.PushRequest, shutdown bool) {
 	p.cond.L.Lock()
 	defer p.cond.L.Unlock()
 
 	// Block until there is one to remove. Enqueue will signal when one is added.
-	for len(p.queue) == 0 && !p.shuttingDown {
+	for len(p.pending) == 0 && !p.shuttingDown {
 		p.cond.Wait()
 	}
 
-	if len(p.queue) == 0 {
+	if len(p.pending) == 0 {
 		// We must be shutting down.
 		return nil, nil, true
 	}
 
-	con, p.queue = p.queue[0], p.queue[1:]
-
-	request = p.pending[con]
+	priority := p.nextPriority()
+	var pending *pendingPush
+	for {
+		var entry queueEntry
+		entry, p.queues[priority] = p.queues[priority][0], p.queues[priority][1:]
+		if pp, f := p.pending[entry.con]; f && pp.seq == entry.seq {
+			con, pending = entry.con, pp
+			break
+		}
+	}
 	delete(p.pending, con)
+	p.depth[priority]--
+	recordPushQueueDepth(priority, p.depth[priority])
+	recordPushQueueWait(priority, time.Since(pending.enqueued))
 
 	// Mark the connection as in progress
 	p.processing[con] = nil
 
-	return con, request, false
+	return con, pending.request, false
 }
 
 func (p *PushQueue) MarkDone(con *Connection) {
@@ -108,8 +228,8 @@ func (p *PushQueue) MarkDone(con *Connection) {
 	// If the info is present, that means Enqueue was called while connection was not yet marked done.
 	// This means we need to add it back to the queue.
 	if request != nil {
-		p.pending[con] = request
-		p.queue = append(p.queue, con)
+		p.pending[con] = &pendingPush{request: request, enqueued: time.Now()}
+		p.push(con, p.pending[con], pushPriority(con, request))
 		p.cond.Signal()
 	}
 }
@@ -118,7 +238,18 @@ func (p *PushQueue) MarkDone(con *Connection) {
 func (p *PushQueue) Pending() int {
 	p.cond.L.Lock()
 	defer p.cond.L.Unlock()
-	return len(p.queue)
+	return len(p.pending)
+}
+
+// PendingByPriority returns the number of pending proxies in each priority class.
+func (p *PushQueue) PendingByPriority() map[PushPriority]int {
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	out := make(map[PushPriority]int, numPushPriorities)
+	for i, d := range p.depth {
+		out[PushPriority(i)] = d
+	}
+	return out
 }
 
 // ShutDown will cause queue to ignore all new items added to it. As soon as the
@@ -369,3 +369,93 @@ func TestProxyQueue(t *testing.T) {
 		}
 	})
 }
+
+func TestProxyQueuePriority(t *testing.T) {
+	changed := model.ConfigKey{Kind: gvk.ServiceEntry, Name: "foo.com", Namespace: "ns"}
+	dependentScope := &model.SidecarScope{}
+	dependentScope.AddConfigDependencies(changed)
+	newConnection := func(id string, nodeType model.NodeType, scope *model.SidecarScope) *Connection {
+		return &Connection{ConID: id, proxy: &model.Proxy{Type: nodeType, SidecarScope: scope}}
+	}
+	gateway := newConnection("gateway", model.Router, nil)
+	dependent := newConnection("dependent", model.SidecarProxy, dependentScope)
+	other := newConnection("other", model.SidecarProxy, &model.SidecarScope{})
+	req := func() *model.PushRequest {
+		return &model.PushRequest{Full: true, ConfigsUpdated: map[model.ConfigKey]struct{}{changed: {}}}
+	}
+
+	t.Run("classify", func(t *testing.T) {
+		cases := []struct {
+			con  *Connection
+			req  *model.PushRequest
+			want PushPriority
+		}{
+			{gateway, req(), GatewayPushPriority},
+			{dependent, req(), DependencyPushPriority},
+			{other, req(), DefaultPushPriority},
+			{dependent, &model.PushRequest{Full: true}, DefaultPushPriority},
+			{&Connection{ConID: "no-proxy"}, req(), DefaultPushPriority},
+		}
+		for _, tt := range cases {
+			if got := pushPriority(tt.con, tt.req); got != tt.want {
+				t.Errorf("%v: got priority %v, want %v", tt.con.ConID, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("higher priority first", func(t *testing.T) {
+		p := NewPushQueue()
+		defer p.ShutDown()
+		p.Enqueue(other, req())
+		p.Enqueue(dependent, req())
+		p.Enqueue(gateway, req())
+
+		ExpectDequeue(t, p, gateway)
+		ExpectDequeue(t, p, dependent)
+		ExpectDequeue(t, p, other)
+		ExpectTimeout(t, p)
+	})
+
+	t.Run("promote on merge", func(t *testing.T) {
+		p := NewPushQueue()
+		defer p.ShutDown()
+		p.Enqueue(other, req())
+		// A push that touches no config the proxy depends on is low priority until merged with one that does.
+		p.Enqueue(dependent, &model.PushRequest{ConfigsUpdated: map[model.ConfigKey]struct{}{
+			{Kind: gvk.ServiceEntry, Name: "bar.com", Namespace: "ns"}: {},
+		}})
+		if got := p.PendingByPriority()[DefaultPushPriority]; got != 2 {
+			t.Fatalf("expected 2 pending default priority pushes, got %v", got)
+		}
+		p.Enqueue(dependent, req())
+		if got := p.PendingByPriority()[DependencyPushPriority]; got != 1 {
+			t.Fatalf("expected 1 pending dependency priority push, got %v", got)
+		}
+
+		ExpectDequeue(t, p, dependent)
+		ExpectDequeue(t, p, other)
+		ExpectTimeout(t, p)
+		if p.Pending() != 0 {
+			t.Fatalf("expected empty queue, got %v", p.Pending())
+		}
+	})
+
+	t.Run("weighted share", func(t *testing.T) {
+		p := NewPushQueue()
+		defer p.ShutDown()
+		for i := 0; i < 20; i++ {
+			p.Enqueue(newConnection(fmt.Sprintf("gateway-%d", i), model.Router, nil), req())
+			p.Enqueue(newConnection(fmt.Sprintf("other-%d", i), model.SidecarProxy, &model.SidecarScope{}), req())
+		}
+		// While both classes have pending proxies, gateways get 4 of every 5 dequeues, but others are not starved.
+		got := map[PushPriority]int{}
+		for i := 0; i < 10; i++ {
+			con, request, _ := p.Dequeue()
+			got[pushPriority(con, request)]++
+			p.MarkDone(con)
+		}
+		if got[GatewayPushPriority] != 8 || got[DefaultPushPriority] != 2 {
+			t.Fatalf("unexpected share of dequeues: %v", got)
+		}
+	})
+}
@@ -34,6 +34,10 @@ const (
 	NameTableType   = apiTypePrefix + "istio.networking.nds.v1.NameTable"
 	HealthInfoType  = apiTypePrefix + "istio.v1.HealthInformation"
 	ProxyConfigType = apiTypePrefix + "istio.mesh.v1alpha1.ProxyConfig"
+	// ConfigStatusType reports the status of config received over xDS back to the server that sent it.
+	ConfigStatusType = apiTypePrefix + "istio.meta.v1alpha1.IstioStatus"
+	// CRLType carries the CRLs of the mesh CA, as a CertificateValidationContext.
+	CRLType = apiTypePrefix + "istio.security.v1.CertificateRevocationList"
 	// DebugType requests debug info from istio, a secured implementation for istio debug interface.
 	DebugType     = "istio.io/debug"
 	BootstrapType = apiTypePrefix + "envoy.config.bootstrap.v3.Bootstrap"
@@ -59,6 +63,8 @@ func GetShortType(typeURL string) string {
 		return "NDS"
 	case ProxyConfigType:
 		return "PCDS"
+	case CRLType:
+		return "CRL"
 	case ExtensionConfigurationType:
 		return "ECDS"
 	default:
@@ -83,6 +89,8 @@ func GetMetricType(typeURL string) string {
 		return "nds"
 	case ProxyConfigType:
 		return "pcds"
+	case CRLType:
+		return "crl"
 	case ExtensionConfigurationType:
 		return "ecds"
 	case BootstrapType:
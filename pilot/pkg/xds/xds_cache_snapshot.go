@@ -0,0 +1,186 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"sort"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/schema/gvk"
+)
+
+// cacheVersioner versions the configuration that xds cache entries depend on, using the current state of the
+// config store, service registries and endpoint shards. Versions are derived from content only, so they are
+// stable across restarts. Restored entries are deliberately not checked against the PushContext version: it is
+// derived from the time of each push, so it differs after every restart and no snapshot entry would ever be
+// valid. Hashing the content an entry depends on validates it against the same state the current PushContext
+// is built from.
+type cacheVersioner struct {
+	s *DiscoveryServer
+	// global is the version of configuration that impacts every entry but is not tracked as a dependency.
+	global string
+}
+
+var _ model.XdsCacheVersioner = &cacheVersioner{}
+
+func newCacheVersioner(s *DiscoveryServer) *cacheVersioner {
+	h := sha256.New()
+	hashJSON(h, s.Env.Mesh())
+	hashJSON(h, s.Env.Networks())
+	return &cacheVersioner{s: s, global: hex.EncodeToString(h.Sum(nil))}
+}
+
+func (v *cacheVersioner) ConfigVersion(key model.ConfigKey) (string, bool) {
+	switch key.Kind {
+	case gvk.ServiceEntry:
+		return v.serviceVersion(host.Name(key.Name), key.Namespace), true
+	case gvk.Secret:
+		// Secrets are never written to disk.
+		return "", false
+	}
+	if v.s.Env.IstioConfigStore == nil {
+		return "", false
+	}
+	h := sha256.New()
+	h.Write([]byte(v.global))
+	if cfg := v.s.Env.IstioConfigStore.Get(key.Kind, key.Name, key.Namespace); cfg != nil {
+		hashJSON(h, cfg.Spec)
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+func (v *cacheVersioner) TypeVersion(kind config.GroupVersionKind) (string, bool) {
+	if v.s.Env.IstioConfigStore == nil {
+		return "", false
+	}
+	cfgs, err := v.s.Env.IstioConfigStore.List(kind, "")
+	if err != nil {
+		return "", false
+	}
+	sort.Slice(cfgs, func(i, j int) bool {
+		if cfgs[i].Namespace != cfgs[j].Namespace {
+			return cfgs[i].Namespace < cfgs[j].Namespace
+		}
+		return cfgs[i].Name < cfgs[j].Name
+	})
+	h := sha256.New()
+	h.Write([]byte(v.global))
+	for _, cfg := range cfgs {
+		_, _ = fmt.Fprintf(h, "%s/%s\n", cfg.Namespace, cfg.Name)
+		hashJSON(h, cfg.Spec)
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// serviceVersion hashes a service and all of its endpoints.
+func (v *cacheVersioner) serviceVersion(hostname host.Name, namespace string) string {
+	h := sha256.New()
+	h.Write([]byte(v.global))
+	if svc, _ := v.s.Env.GetService(hostname); svc != nil && svc.Attributes.Namespace == namespace {
+		// Services are shared with the registries, which update them under the service lock.
+		svc.Mutex.RLock()
+		hashJSON(h, svc)
+		svc.Mutex.RUnlock()
+	}
+
+	v.s.mutex.RLock()
+	shards := v.s.EndpointShardsByService[string(hostname)][namespace]
+	v.s.mutex.RUnlock()
+	if shards == nil {
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	shards.mutex.RLock()
+	defer shards.mutex.RUnlock()
+	keys := make([]string, 0, len(shards.Shards))
+	for k := range shards.Shards {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(h, "shard %s\n", k)
+		for _, ep := range shards.Shards[k] {
+			_, _ = fmt.Fprintf(h, "%s:%d %s %s %s %s %s %d %s %d\n",
+				ep.Address, ep.EndpointPort, ep.ServicePortName, ep.Labels, ep.ServiceAccount, ep.Network,
+				ep.Locality.Label, ep.LbWeight, ep.TLSMode, ep.TunnelAbility)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashJSON(h hash.Hash, obj interface{}) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		// Fall back to the Go representation; this only risks a spurious version mismatch.
+		b = []byte(fmt.Sprintf("%+v", obj))
+	}
+	h.Write(b)
+}
+
+// restoreCache loads entries from the cache snapshot that are still valid for the current configuration.
+func (s *DiscoveryServer) restoreCache() {
+	pc, ok := s.Cache.(model.PersistentXdsCache)
+	if !ok {
+		return
+	}
+	t0 := time.Now()
+	n, err := pc.Restore(newCacheVersioner(s))
+	if err != nil {
+		log.Warnf("failed to restore xds cache snapshot: %v", err)
+		return
+	}
+	log.Infof("restored %d xds cache entries from snapshot in %v", n, time.Since(t0))
+}
+
+// saveCache writes the xds cache to disk. Nothing is written while pushes are pending, as cache entries may not
+// yet reflect the current configuration.
+func (s *DiscoveryServer) saveCache() {
+	pc, ok := s.Cache.(model.PersistentXdsCache)
+	if !ok {
+		return
+	}
+	if s.InboundUpdates.Load() != s.CommittedUpdates.Load() {
+		log.Debugf("skipping xds cache snapshot, pushes are pending")
+		return
+	}
+	n, err := pc.Save(newCacheVersioner(s))
+	if err != nil {
+		log.Warnf("failed to write xds cache snapshot: %v", err)
+		return
+	}
+	log.Debugf("wrote %d xds cache entries to snapshot", n)
+}
+
+// periodicCacheSnapshot periodically writes the xds cache to disk, and once more when the server stops.
+func (s *DiscoveryServer) periodicCacheSnapshot(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.saveCache()
+		case <-stopCh:
+			s.saveCache()
+			return
+		}
+	}
+}
@@ -17,6 +17,7 @@ package xds
 import (
 	"fmt"
 	"math/rand"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -24,8 +25,10 @@ import (
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/golang/protobuf/ptypes/any"
 	"go.uber.org/atomic"
+	"google.golang.org/protobuf/proto"
 
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/cluster"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/gvk"
 	"istio.io/istio/pkg/test/util/retry"
@@ -217,3 +220,164 @@ func TestXdsCache(t *testing.T) {
 		}
 	})
 }
+
+type fakeVersioner struct {
+	configs map[model.ConfigKey]string
+	types   map[config.GroupVersionKind]string
+}
+
+func (f fakeVersioner) ConfigVersion(key model.ConfigKey) (string, bool) {
+	v, ok := f.configs[key]
+	return v, ok
+}
+
+func (f fakeVersioner) TypeVersion(kind config.GroupVersionKind) (string, bool) {
+	v, ok := f.types[kind]
+	return v, ok
+}
+
+func TestXdsCacheSnapshot(t *testing.T) {
+	ep1 := EndpointBuilder{
+		clusterName: "outbound|1||foo.com",
+		service:     &model.Service{Hostname: "foo.com", Attributes: model.ServiceAttributes{Namespace: "ns"}},
+	}
+	ep2 := EndpointBuilder{
+		clusterName: "outbound|1||bar.com",
+		service:     &model.Service{Hostname: "bar.com", Attributes: model.ServiceAttributes{Namespace: "ns"}},
+	}
+	sds := SecretResource{Name: "cert", Namespace: "ns"}
+	foo := model.ConfigKey{Kind: gvk.ServiceEntry, Name: "foo.com", Namespace: "ns"}
+	bar := model.ConfigKey{Kind: gvk.ServiceEntry, Name: "bar.com", Namespace: "ns"}
+	versions := func() fakeVersioner {
+		return fakeVersioner{
+			configs: map[model.ConfigKey]string{foo: "1", bar: "1"},
+			types:   map[config.GroupVersionKind]string{gvk.PeerAuthentication: "1"},
+		}
+	}
+	res1 := &discovery.Resource{Name: "foo", Resource: &any.Any{TypeUrl: "foo", Value: []byte("foo")}}
+	res2 := &discovery.Resource{Name: "bar", Resource: &any.Any{TypeUrl: "bar", Value: []byte("bar")}}
+
+	path := filepath.Join(t.TempDir(), "xds-cache")
+	c := model.NewPersistentXdsCache(path)
+	for _, e := range []struct {
+		entry model.XdsCacheEntry
+		value *discovery.Resource
+	}{{ep1, res1}, {ep2, res2}, {sds, res1}} {
+		_, tok, _ := c.Get(e.entry)
+		c.Add(e.entry, tok, e.value)
+	}
+	n, err := c.Save(versions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Secrets cannot be versioned, so are never persisted.
+	if n != 2 {
+		t.Fatalf("expected 2 entries saved, got %v", n)
+	}
+
+	t.Run("restore", func(t *testing.T) {
+		c := model.NewPersistentXdsCache(path)
+		n, err := c.Restore(versions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 {
+			t.Fatalf("expected 2 entries restored, got %v", n)
+		}
+		if got, _, f := c.Get(ep1); !f || !proto.Equal(got, res1) {
+			t.Fatalf("unexpected result: %v, want %v", got, res1)
+		}
+		// Restored entries must still be invalidated by their dependencies.
+		c.Clear(map[model.ConfigKey]struct{}{foo: {}})
+		if _, _, f := c.Get(ep1); f {
+			t.Fatalf("expected entry to be cleared")
+		}
+		if got, _, f := c.Get(ep2); !f || !proto.Equal(got, res2) {
+			t.Fatalf("unexpected result: %v, want %v", got, res2)
+		}
+		c.ClearAll()
+		if len(c.Keys()) != 0 {
+			t.Fatalf("expected cache to be cleared, got %v", c.Keys())
+		}
+	})
+
+	t.Run("config changed", func(t *testing.T) {
+		c := model.NewPersistentXdsCache(path)
+		v := versions()
+		v.configs[foo] = "2"
+		if n, err := c.Restore(v); err != nil || n != 1 {
+			t.Fatalf("expected 1 entry restored, got %v, %v", n, err)
+		}
+		if _, _, f := c.Get(ep1); f {
+			t.Fatalf("stale entry was restored")
+		}
+	})
+
+	t.Run("type changed", func(t *testing.T) {
+		c := model.NewPersistentXdsCache(path)
+		v := versions()
+		v.types[gvk.PeerAuthentication] = "2"
+		if n, err := c.Restore(v); err != nil || n != 0 {
+			t.Fatalf("expected no entries restored, got %v, %v", n, err)
+		}
+	})
+
+	t.Run("missing snapshot", func(t *testing.T) {
+		c := model.NewPersistentXdsCache(filepath.Join(t.TempDir(), "missing"))
+		if n, err := c.Restore(versions()); err != nil || n != 0 {
+			t.Fatalf("expected no entries restored, got %v, %v", n, err)
+		}
+	})
+}
+
+func TestXdsCacheVersionerServiceUpdate(t *testing.T) {
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+	svc := &model.Service{
+		Hostname:    "foo.com",
+		Attributes:  model.ServiceAttributes{Namespace: "ns"},
+		ClusterVIPs: map[cluster.ID]string{},
+	}
+	s.MemRegistry.AddService(svc.Hostname, svc)
+	key := model.ConfigKey{Kind: gvk.ServiceEntry, Name: "foo.com", Namespace: "ns"}
+
+	// The registries update services in place, under the service lock, while versions are computed.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			svc.Mutex.Lock()
+			svc.ClusterVIPs[cluster.ID(fmt.Sprint(i))] = "1.2.3.4"
+			svc.Mutex.Unlock()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		newCacheVersioner(s.Discovery).ConfigVersion(key)
+	}
+	<-done
+}
+
+func TestXdsCacheVersioner(t *testing.T) {
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+	key := model.ConfigKey{Kind: gvk.ServiceEntry, Name: "foo.com", Namespace: "ns"}
+	versioner := func() model.XdsCacheVersioner {
+		return newCacheVersioner(s.Discovery)
+	}
+	v1, _ := versioner().ConfigVersion(key)
+	if v, _ := versioner().ConfigVersion(key); v != v1 {
+		t.Fatalf("expected stable version, got %v and %v", v1, v)
+	}
+
+	s.Discovery.EDSCacheUpdate("cluster", "foo.com", "ns", []*model.IstioEndpoint{{Address: "1.2.3.4", EndpointPort: 80}})
+	v2, _ := versioner().ConfigVersion(key)
+	if v2 == v1 {
+		t.Fatalf("expected version to change after endpoint update")
+	}
+	s.Discovery.EDSCacheUpdate("cluster", "foo.com", "ns", []*model.IstioEndpoint{{Address: "1.2.3.4", EndpointPort: 80}})
+	if v, _ := versioner().ConfigVersion(key); v != v2 {
+		t.Fatalf("expected version to be unchanged for identical endpoints, got %v and %v", v2, v)
+	}
+
+	if _, ok := versioner().ConfigVersion(model.ConfigKey{Kind: gvk.Secret, Name: "cert", Namespace: "ns"}); ok {
+		t.Fatalf("secrets must not be versioned")
+	}
+}
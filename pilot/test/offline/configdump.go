@@ -0,0 +1,127 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offline
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	adminapi "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	"github.com/golang/protobuf/ptypes/any"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pilot/pkg/xds"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pilot/test/xdstest"
+	"istio.io/istio/pkg/test"
+)
+
+// GeneratedConfig holds the xDS resources generated for a single proxy, sorted by resource name.
+type GeneratedConfig struct {
+	Listeners        model.Resources
+	Clusters         model.Resources
+	Routes           model.Resources
+	Endpoints        model.Resources
+	ExtensionConfigs model.Resources
+	NameTables       model.Resources
+}
+
+// Generate runs the discovery server's xDS generators for the proxy, following the same resource
+// dependencies Envoy would request: RDS names come from LDS, EDS names from CDS and ECDS names
+// from LDS. The proxy must already be initialized with SetupProxy.
+func Generate(t test.Failer, s *xds.FakeDiscoveryServer, proxy *model.Proxy) (*GeneratedConfig, error) {
+	push := s.PushContext()
+	generate := func(typeURL string, names []string) (model.Resources, error) {
+		gen, f := s.Discovery.Generators[typeURL]
+		if !f {
+			return nil, fmt.Errorf("no generator found for %v", typeURL)
+		}
+		res, _, err := gen.Generate(proxy, push, &model.WatchedResource{TypeUrl: typeURL, ResourceNames: names},
+			&model.PushRequest{Full: true, Push: push, Start: time.Now()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate %v: %v", v3.GetShortType(typeURL), err)
+		}
+		sort.Slice(res, func(i, j int) bool {
+			return res[i].Name < res[j].Name
+		})
+		return res, nil
+	}
+
+	var err error
+	gc := &GeneratedConfig{}
+	if gc.Clusters, err = generate(v3.ClusterType, nil); err != nil {
+		return nil, err
+	}
+	if gc.Listeners, err = generate(v3.ListenerType, nil); err != nil {
+		return nil, err
+	}
+	listeners := s.Listeners(proxy)
+	if gc.Routes, err = generate(v3.RouteType, xdstest.ExtractRoutesFromListeners(listeners)); err != nil {
+		return nil, err
+	}
+	if gc.Endpoints, err = generate(v3.EndpointType, xdstest.ExtractEdsClusterNames(s.Clusters(proxy))); err != nil {
+		return nil, err
+	}
+	if gc.ExtensionConfigs, err = generate(v3.ExtensionConfigurationType, xdstest.ExtractExtensionConfigNames(t, listeners)); err != nil {
+		return nil, err
+	}
+	if gc.NameTables, err = generate(v3.NameTableType, nil); err != nil {
+		return nil, err
+	}
+	return gc, nil
+}
+
+// ConfigDump converts the generated configuration to an Envoy admin API config dump, as read by
+// `istioctl proxy-config -f`. As this version of the admin API has no ECDS section, extension
+// configurations are appended to the dump as individual TypedExtensionConfig entries.
+func (gc *GeneratedConfig) ConfigDump() *adminapi.ConfigDump {
+	clusters := &adminapi.ClustersConfigDump{}
+	for _, c := range gc.Clusters {
+		clusters.DynamicActiveClusters = append(clusters.DynamicActiveClusters, &adminapi.ClustersConfigDump_DynamicCluster{Cluster: c.Resource})
+	}
+	listeners := &adminapi.ListenersConfigDump{}
+	for _, l := range gc.Listeners {
+		listeners.DynamicListeners = append(listeners.DynamicListeners, &adminapi.ListenersConfigDump_DynamicListener{
+			Name:        l.Name,
+			ActiveState: &adminapi.ListenersConfigDump_DynamicListenerState{Listener: l.Resource},
+		})
+	}
+	routes := &adminapi.RoutesConfigDump{}
+	for _, r := range gc.Routes {
+		routes.DynamicRouteConfigs = append(routes.DynamicRouteConfigs, &adminapi.RoutesConfigDump_DynamicRouteConfig{RouteConfig: r.Resource})
+	}
+	endpoints := &adminapi.EndpointsConfigDump{}
+	for _, e := range gc.Endpoints {
+		endpoints.DynamicEndpointConfigs = append(endpoints.DynamicEndpointConfigs,
+			&adminapi.EndpointsConfigDump_DynamicEndpointConfig{EndpointConfig: e.Resource})
+	}
+	dump := &adminapi.ConfigDump{
+		Configs: []*any.Any{
+			util.MessageToAny(&adminapi.BootstrapConfigDump{}),
+			util.MessageToAny(clusters),
+			util.MessageToAny(listeners),
+			util.MessageToAny(&adminapi.ScopedRoutesConfigDump{}),
+			util.MessageToAny(routes),
+			util.MessageToAny(&adminapi.SecretsConfigDump{}),
+			util.MessageToAny(endpoints),
+		},
+	}
+	for _, ec := range gc.ExtensionConfigs {
+		dump.Configs = append(dump.Configs, ec.Resource)
+	}
+	return dump
+}
@@ -0,0 +1,100 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offline
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/util/protomarshal"
+)
+
+// Diff writes a unified diff of every resource that differs between base and gc to w. Resources
+// are compared by type and name. It returns true if any differences were found.
+func Diff(w io.Writer, base, gc *GeneratedConfig, context int) (bool, error) {
+	sections := []struct {
+		name       string
+		base, curr model.Resources
+	}{
+		{"Cluster", base.Clusters, gc.Clusters},
+		{"Listener", base.Listeners, gc.Listeners},
+		{"RouteConfiguration", base.Routes, gc.Routes},
+		{"ClusterLoadAssignment", base.Endpoints, gc.Endpoints},
+		{"TypedExtensionConfig", base.ExtensionConfigs, gc.ExtensionConfigs},
+		{"NameTable", base.NameTables, gc.NameTables},
+	}
+	changed := false
+	for _, s := range sections {
+		baseJSON, err := resourcesToJSON(s.base)
+		if err != nil {
+			return false, err
+		}
+		currJSON, err := resourcesToJSON(s.curr)
+		if err != nil {
+			return false, err
+		}
+		for _, name := range unionKeys(baseJSON, currJSON) {
+			a, b := baseJSON[name], currJSON[name]
+			if a == b {
+				continue
+			}
+			changed = true
+			text, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				FromFile: fmt.Sprintf("base %s %s", s.name, name),
+				A:        difflib.SplitLines(a),
+				ToFile:   fmt.Sprintf("%s %s", s.name, name),
+				B:        difflib.SplitLines(b),
+				Context:  context,
+			})
+			if err != nil {
+				return false, err
+			}
+			if _, err := fmt.Fprintln(w, text); err != nil {
+				return false, err
+			}
+		}
+	}
+	return changed, nil
+}
+
+func resourcesToJSON(resources model.Resources) (map[string]string, error) {
+	out := make(map[string]string, len(resources))
+	for _, r := range resources {
+		js, err := protomarshal.ToJSONWithIndent(r.Resource, "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %v: %v", r.Name, err)
+		}
+		out[r.Name] = js + "\n"
+	}
+	return out, nil
+}
+
+func unionKeys(a, b map[string]string) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, f := a[k]; !f {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
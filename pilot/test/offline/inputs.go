@@ -0,0 +1,151 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package offline runs the Istio control plane in memory against configuration read from local files.
+// This allows inspecting the configuration generated for a proxy without access to a cluster.
+package offline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/test/util/yml"
+)
+
+// FileExtensions are the extensions of files that will be read from directories.
+var FileExtensions = []string{".json", ".yaml", ".yml"}
+
+// Inputs holds the configuration read from local files.
+type Inputs struct {
+	// Configs are the Istio configuration resources, such as VirtualService.
+	Configs []config.Config
+	// KubernetesObjects are the Kubernetes resources, such as Service, Endpoints and Pod.
+	KubernetesObjects []runtime.Object
+}
+
+// ReadInputs reads all Istio and Kubernetes resources from the given files or directories. Directories
+// are read recursively. Resources without a namespace are placed in defaultNamespace.
+func ReadInputs(paths []string, defaultNamespace string) (*Inputs, error) {
+	in := &Inputs{}
+	for _, p := range paths {
+		files, err := gatherFiles(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			by, err := os.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			if err := in.parse(string(by), defaultNamespace); err != nil {
+				return nil, fmt.Errorf("failed to read %v: %v", f, err)
+			}
+		}
+	}
+	return in, nil
+}
+
+// ParseInputs reads all Istio and Kubernetes resources from a multi-document YAML string.
+func ParseInputs(content string, defaultNamespace string) (*Inputs, error) {
+	in := &Inputs{}
+	if err := in.parse(content, defaultNamespace); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+func (in *Inputs) parse(content string, defaultNamespace string) error {
+	decode := scheme.Codecs.UniversalDeserializer().Decode
+	for _, doc := range yml.SplitString(content) {
+		configs, others, err := crd.ParseInputs(doc)
+		if err != nil {
+			return err
+		}
+		for _, c := range configs {
+			if c.Namespace == "" {
+				c.Namespace = defaultNamespace
+			}
+			if c.Domain == "" {
+				c.Domain = constants.DefaultKubernetesDomain
+			}
+			in.Configs = append(in.Configs, c)
+		}
+		if len(others) == 0 {
+			continue
+		}
+		o, _, err := decode([]byte(doc), nil, nil)
+		if err != nil {
+			return fmt.Errorf("failed deserializing kubernetes object %v: %v", others[0].Kind, err)
+		}
+		if m, ok := o.(interface {
+			GetNamespace() string
+			SetNamespace(string)
+		}); ok && m.GetNamespace() == "" {
+			m.SetNamespace(defaultNamespace)
+		}
+		in.KubernetesObjects = append(in.KubernetesObjects, o)
+	}
+	return nil
+}
+
+// FindPod returns the Pod with the given name and namespace, or nil if it is not found.
+func (in *Inputs) FindPod(name, namespace string) *corev1.Pod {
+	for _, o := range in.KubernetesObjects {
+		if pod, ok := o.(*corev1.Pod); ok && pod.Name == name && pod.Namespace == namespace {
+			return pod
+		}
+	}
+	return nil
+}
+
+func gatherFiles(path string) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isValidFile(p) {
+			return nil
+		}
+		files = append(files, p)
+		return nil
+	})
+	return files, err
+}
+
+func isValidFile(f string) bool {
+	ext := strings.ToLower(filepath.Ext(f))
+	for _, e := range FileExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offline
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/xds"
+	"istio.io/istio/pkg/cluster"
+	"istio.io/istio/pkg/test"
+	"istio.io/pkg/version"
+)
+
+// ClusterID is the cluster the Kubernetes resources read from files are placed in.
+const ClusterID cluster.ID = "Kubernetes"
+
+// ProxyOptions describe the proxy to generate configuration for.
+type ProxyOptions struct {
+	// Pod, if set, is the name of a Pod in the inputs. Its labels, IP and namespace will be used.
+	Pod string
+	// Namespace of the proxy.
+	Namespace string
+	// Labels of the proxy. These are merged with the Pod labels, if a Pod is set.
+	Labels map[string]string
+	// IP of the proxy. Defaults to the Pod IP, if set.
+	IP string
+	// Type of the proxy, sidecar or router.
+	Type model.NodeType
+	// IstioVersion of the proxy. Defaults to the running version.
+	IstioVersion string
+}
+
+// Run starts an in memory discovery server populated with the inputs and calls f with it. Any
+// failure while starting the server, or reported by f through the Failer, is returned as an error.
+func Run(in *Inputs, meshConfig *meshconfig.MeshConfig, f func(t test.Failer, s *xds.FakeDiscoveryServer)) error {
+	return test.Wrap(func(t test.Failer) {
+		s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{
+			Configs:                    in.Configs,
+			KubernetesObjectsByCluster: map[cluster.ID][]runtime.Object{ClusterID: in.KubernetesObjects},
+			MeshConfig:                 meshConfig,
+		})
+		f(t, s)
+	})
+}
+
+// BuildProxy creates a proxy from the options. The returned proxy must still be initialized with SetupProxy.
+func (in *Inputs) BuildProxy(opts ProxyOptions) (*model.Proxy, error) {
+	labels := map[string]string{}
+	ip := opts.IP
+	id := ""
+	if opts.Pod != "" {
+		name, ns := opts.Pod, opts.Namespace
+		if i := strings.LastIndex(opts.Pod, "."); i > 0 {
+			name, ns = opts.Pod[:i], opts.Pod[i+1:]
+		}
+		pod := in.FindPod(name, ns)
+		if pod == nil {
+			return nil, fmt.Errorf("pod %s.%s not found in inputs", name, ns)
+		}
+		for k, v := range pod.Labels {
+			labels[k] = v
+		}
+		if ip == "" {
+			ip = pod.Status.PodIP
+		}
+		opts.Namespace = ns
+		id = pod.Name + "." + pod.Namespace
+	}
+	for k, v := range opts.Labels {
+		labels[k] = v
+	}
+	if opts.Type == "" {
+		opts.Type = model.SidecarProxy
+	}
+	if !model.IsApplicationNodeType(opts.Type) {
+		return nil, fmt.Errorf("invalid proxy type %q", opts.Type)
+	}
+	if opts.IstioVersion == "" {
+		opts.IstioVersion = version.Info.Version
+	}
+	p := &model.Proxy{
+		ID:              id,
+		Type:            opts.Type,
+		ConfigNamespace: opts.Namespace,
+		Metadata: &model.NodeMetadata{
+			Namespace:    opts.Namespace,
+			Labels:       labels,
+			ClusterID:    ClusterID,
+			IstioVersion: opts.IstioVersion,
+		},
+	}
+	if ip != "" {
+		p.IPAddresses = []string{ip}
+	}
+	return p, nil
+}
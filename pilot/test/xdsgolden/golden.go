@@ -0,0 +1,298 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package xdsgolden is a regression test harness for generated xDS. Each test case is a directory holding input
+// config and proxies; the xDS generated for each proxy is compared against golden files in the same directory.
+//
+// A test case directory has the following layout:
+//
+//   config/       Istio config and Kubernetes objects, such as Services and Pods, as .yaml or .json files.
+//   mesh.yaml     Optional MeshConfig.
+//   proxies.yaml  A list of proxies to generate xDS for. See Proxy.
+//   golden/       The expected xDS, as golden/<proxy>/<type>.yaml, for example golden/productpage/cds.yaml.
+//
+// Run the tests with REFRESH_GOLDEN=true to rewrite the golden files:
+//
+//   REFRESH_GOLDEN=true go test ./my/package/...
+package xdsgolden
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pilot/pkg/xds"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pilot/test/offline"
+	testutil "istio.io/istio/pilot/test/util"
+	"istio.io/istio/pkg/cluster"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/file"
+	"istio.io/istio/pkg/test"
+	"istio.io/istio/pkg/util/protomarshal"
+)
+
+const (
+	configDir   = "config"
+	goldenDir   = "golden"
+	meshFile    = "mesh.yaml"
+	proxiesFile = "proxies.yaml"
+
+	defaultNamespace = "default"
+	defaultIP        = "1.1.1.1"
+)
+
+// Types are the xDS types compared against golden files, in the order they are generated. Types that a proxy
+// receives no resources for have no golden file.
+var Types = []string{
+	v3.ClusterType,
+	v3.ListenerType,
+	v3.RouteType,
+	v3.EndpointType,
+	v3.ExtensionConfigurationType,
+	v3.NameTableType,
+}
+
+// Proxy is an entry in proxies.yaml.
+type Proxy struct {
+	// Name of the proxy, used for its golden directory.
+	Name string `json:"name"`
+	// ID of the proxy. Defaults to <name>.<namespace>.
+	ID string `json:"id,omitempty"`
+	// Type of the proxy, sidecar or router. Defaults to sidecar.
+	Type model.NodeType `json:"type,omitempty"`
+	// Namespace of the proxy. Defaults to default.
+	Namespace string `json:"namespace,omitempty"`
+	// IPAddresses of the proxy. Defaults to 1.1.1.1.
+	IPAddresses []string `json:"ipAddresses,omitempty"`
+	// Metadata is the node metadata sent by the proxy, such as LABELS or ISTIO_VERSION.
+	Metadata *model.NodeMetadata `json:"metadata,omitempty"`
+}
+
+// Run runs every test case in the subdirectories of dir.
+func Run(t *testing.T, dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		caseDir := filepath.Join(dir, e.Name())
+		t.Run(e.Name(), func(t *testing.T) {
+			RunCase(t, caseDir)
+		})
+	}
+}
+
+// RunCase runs the test case in dir, comparing the xDS generated for each proxy against its golden files.
+func RunCase(t *testing.T, dir string) {
+	opts := readOptions(t, dir)
+	proxies := readProxies(t, dir)
+	s := xds.NewFakeDiscoveryServer(t, opts)
+	for _, p := range proxies {
+		p := p
+		t.Run(p.Name, func(t *testing.T) {
+			got := Generate(t, s, p.build(s))
+			compare(t, filepath.Join(dir, goldenDir, p.Name), got)
+		})
+	}
+}
+
+// Generate generates every type in Types for a proxy with offline.Generate, returning the normalized YAML of each
+// type that has resources. The proxy must have been initialized with SetupProxy.
+func Generate(t test.Failer, s *xds.FakeDiscoveryServer, proxy *model.Proxy) map[string][]byte {
+	t.Helper()
+	gc, err := offline.Generate(t, s, proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := map[string]model.Resources{
+		v3.ClusterType:                gc.Clusters,
+		v3.ListenerType:               gc.Listeners,
+		v3.RouteType:                  gc.Routes,
+		v3.EndpointType:               gc.Endpoints,
+		v3.ExtensionConfigurationType: gc.ExtensionConfigs,
+		v3.NameTableType:              gc.NameTables,
+	}
+	out := map[string][]byte{}
+	for _, typeURL := range Types {
+		if res := resources[typeURL]; len(res) > 0 {
+			out[typeURL] = normalize(t, typeURL, res)
+		}
+	}
+	return out
+}
+
+// normalize converts resources, which are sorted by name, to YAML. Fields that are not ordered deterministically,
+// such as the endpoints of a cluster, are sorted.
+func normalize(t test.Failer, typeURL string, res model.Resources) []byte {
+	t.Helper()
+	list := make([]interface{}, 0, len(res))
+	for _, r := range res {
+		msg := r.Resource
+		if typeURL == v3.EndpointType {
+			cla := &endpoint.ClusterLoadAssignment{}
+			if err := r.Resource.UnmarshalTo(cla); err != nil {
+				t.Fatal(err)
+			}
+			sortEndpoints(cla)
+			msg = util.MessageToAny(cla)
+		}
+		js, err := protomarshal.ToJSONMap(msg)
+		if err != nil {
+			t.Fatalf("failed to marshal %v %v: %v", v3.GetShortType(typeURL), r.Name, err)
+		}
+		list = append(list, js)
+	}
+	b, err := yaml.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func sortEndpoints(cla *endpoint.ClusterLoadAssignment) {
+	for _, llb := range cla.Endpoints {
+		sort.SliceStable(llb.LbEndpoints, func(i, j int) bool {
+			return llb.LbEndpoints[i].String() < llb.LbEndpoints[j].String()
+		})
+	}
+	sort.SliceStable(cla.Endpoints, func(i, j int) bool {
+		return cla.Endpoints[i].Locality.String() < cla.Endpoints[j].Locality.String()
+	})
+}
+
+// compare compares generated xDS against the golden files in dir, or rewrites them when updating.
+func compare(t *testing.T, dir string, got map[string][]byte) {
+	t.Helper()
+	refresh := testutil.Refresh()
+	if refresh {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, typeURL := range Types {
+		goldenFile := filepath.Join(dir, v3.GetMetricType(typeURL)+".yaml")
+		content, f := got[typeURL]
+		if !f {
+			if _, err := os.Stat(goldenFile); err == nil {
+				t.Errorf("%v: no %v resources were generated, but a golden file exists", goldenFile, v3.GetShortType(typeURL))
+			}
+			continue
+		}
+		if refresh {
+			t.Logf("Refreshing golden file %s", goldenFile)
+			if err := file.AtomicWrite(goldenFile, content, 0o644); err != nil {
+				t.Error(err)
+			}
+			continue
+		}
+		golden, err := os.ReadFile(goldenFile)
+		if err != nil {
+			t.Errorf("%v resources were generated, but the golden file could not be read (run with REFRESH_GOLDEN=true to create it): %v",
+				v3.GetShortType(typeURL), err)
+			continue
+		}
+		if err := testutil.Compare(content, golden); err != nil {
+			t.Errorf("%v does not match (run with REFRESH_GOLDEN=true to rewrite it):\n%v", goldenFile, err)
+		}
+	}
+}
+
+func readOptions(t *testing.T, dir string) xds.FakeOptions {
+	opts := xds.FakeOptions{}
+	if b, err := os.ReadFile(filepath.Join(dir, meshFile)); err == nil {
+		m, err := mesh.ApplyMeshConfigDefaults(string(b))
+		if err != nil {
+			t.Fatalf("failed to read %v: %v", meshFile, err)
+		}
+		opts.MeshConfig = m
+	} else if !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(dir, configDir)
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return opts
+	}
+	in, err := offline.ReadInputs([]string{configPath}, defaultNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Configs = in.Configs
+	opts.KubernetesObjectsByCluster = map[cluster.ID][]runtime.Object{offline.ClusterID: in.KubernetesObjects}
+	return opts
+}
+
+func readProxies(t *testing.T, dir string) []Proxy {
+	b, err := os.ReadFile(filepath.Join(dir, proxiesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var proxies []Proxy
+	if err := yaml.UnmarshalStrict(b, &proxies); err != nil {
+		t.Fatalf("failed to read %v: %v", proxiesFile, err)
+	}
+	seen := map[string]struct{}{}
+	for _, p := range proxies {
+		if p.Name == "" || strings.ContainsAny(p.Name, `/\`) {
+			t.Fatalf("invalid proxy name %q in %v", p.Name, proxiesFile)
+		}
+		if _, f := seen[p.Name]; f {
+			t.Fatalf("duplicate proxy %q in %v", p.Name, proxiesFile)
+		}
+		seen[p.Name] = struct{}{}
+	}
+	return proxies
+}
+
+// build returns the proxy, initialized for the server.
+func (p Proxy) build(s *xds.FakeDiscoveryServer) *model.Proxy {
+	proxy := &model.Proxy{
+		ID:              p.ID,
+		Type:            p.Type,
+		ConfigNamespace: p.Namespace,
+		IPAddresses:     p.IPAddresses,
+		Metadata:        p.Metadata,
+	}
+	if proxy.ConfigNamespace == "" {
+		proxy.ConfigNamespace = defaultNamespace
+	}
+	if proxy.ID == "" {
+		proxy.ID = p.Name + "." + proxy.ConfigNamespace
+	}
+	if len(proxy.IPAddresses) == 0 {
+		proxy.IPAddresses = []string{defaultIP}
+	}
+	if proxy.Metadata == nil {
+		proxy.Metadata = &model.NodeMetadata{}
+	}
+	if proxy.Metadata.ClusterID == "" {
+		proxy.Metadata.ClusterID = offline.ClusterID
+	}
+	return s.SetupProxy(proxy)
+}
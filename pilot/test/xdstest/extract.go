@@ -137,6 +137,28 @@ func ExtractListener(name string, ll []*listener.Listener) *listener.Listener {
 	return nil
 }
 
+// ExtractExtensionConfigNames returns the names of all HTTP filters that are configured through ECDS.
+func ExtractExtensionConfigNames(t test.Failer, ll []*listener.Listener) []string {
+	names := []string{}
+	seen := sets.NewSet()
+	for _, l := range ll {
+		chains := append([]*listener.FilterChain{}, l.FilterChains...)
+		if l.DefaultFilterChain != nil {
+			chains = append(chains, l.DefaultFilterChain)
+		}
+		for _, fc := range chains {
+			for _, f := range ExtractHTTPConnectionManager(t, fc).GetHttpFilters() {
+				if f.GetConfigDiscovery() == nil || seen.Contains(f.Name) {
+					continue
+				}
+				seen.Insert(f.Name)
+				names = append(names, f.Name)
+			}
+		}
+	}
+	return names
+}
+
 func ExtractRouteConfigurations(rc []*route.RouteConfiguration) map[string]*route.RouteConfiguration {
 	res := map[string]*route.RouteConfiguration{}
 	for _, l := range rc {
@@ -40,11 +40,13 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes/any"
 	pstruct "github.com/golang/protobuf/ptypes/struct"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 
 	mcp "istio.io/api/mcp/v1alpha1"
 	"istio.io/api/mesh/v1alpha1"
+	metav1alpha1 "istio.io/api/meta/v1alpha1"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pilot/pkg/serviceregistry/memory"
@@ -171,6 +173,9 @@ type ADSC struct {
 
 	mutex sync.RWMutex
 
+	// sendMutex serializes sends on the stream, which may happen from multiple goroutines.
+	sendMutex sync.Mutex
+
 	Mesh *v1alpha1.MeshConfig
 
 	// Retrieved configurations can be stored using the common istio model interface.
@@ -780,9 +785,43 @@ func (a *ADSC) Send(req *discovery.DiscoveryRequest) error {
 		strReq, _ := jsonm.MarshalToString(req)
 		adscLog.Debugf("Sending Discovery Request to istiod: %s", strReq)
 	}
+	return a.send(req)
+}
+
+func (a *ADSC) send(req *discovery.DiscoveryRequest) error {
+	a.sendMutex.Lock()
+	defer a.sendMutex.Unlock()
 	return a.stream.Send(req)
 }
 
+// WriteStatus reports the status of a config received from the server back to it. Configs that are not in the
+// Store are ignored.
+func (a *ADSC) WriteStatus(cfg config.Config) error {
+	if a.Store == nil || a.stream == nil || a.Store.Get(cfg.GroupVersionKind, cfg.Name, cfg.Namespace) == nil {
+		return nil
+	}
+	status, ok := cfg.Status.(*metav1alpha1.IstioStatus)
+	if !ok {
+		return nil
+	}
+	detail, err := types.MarshalAny(status)
+	if err != nil {
+		return err
+	}
+	return a.send(&discovery.DiscoveryRequest{
+		TypeUrl:       v3.ConfigStatusType,
+		ResourceNames: []string{cfg.GroupVersionKind.String() + "/" + cfg.Namespace + "/" + cfg.Name},
+		ErrorDetail: &rpcstatus.Status{
+			Details: []*any.Any{{TypeUrl: detail.TypeUrl, Value: detail.Value}},
+		},
+	})
+}
+
+// DeleteStatus does nothing: configs are only deleted once the server stops sending them.
+func (a *ADSC) DeleteStatus(config.Config) error {
+	return nil
+}
+
 func (a *ADSC) handleEDS(eds []*endpoint.ClusterLoadAssignment) {
 	la := map[string]*endpoint.ClusterLoadAssignment{}
 	edsSize := 0
@@ -800,7 +839,7 @@ func (a *ADSC) handleEDS(eds []*endpoint.ClusterLoadAssignment) {
 	}
 	if a.InitialLoad == 0 {
 		// first load - Envoy loads listeners after endpoints
-		_ = a.stream.Send(&discovery.DiscoveryRequest{
+		_ = a.send(&discovery.DiscoveryRequest{
 			Node:    a.node(),
 			TypeUrl: v3.ListenerType,
 		})
@@ -978,7 +1017,7 @@ func XdsInitialRequests() []*discovery.DiscoveryRequest {
 // it will start watching RDS and LDS.
 func (a *ADSC) Watch() {
 	a.watchTime = time.Now()
-	_ = a.stream.Send(&discovery.DiscoveryRequest{
+	_ = a.send(&discovery.DiscoveryRequest{
 		Node:    a.node(),
 		TypeUrl: v3.ClusterType,
 	})
@@ -1000,14 +1039,14 @@ func ConfigInitialRequests() []*discovery.DiscoveryRequest {
 
 // WatchConfig will use the new experimental API watching, similar with MCP.
 func (a *ADSC) WatchConfig() {
-	_ = a.stream.Send(&discovery.DiscoveryRequest{
+	_ = a.send(&discovery.DiscoveryRequest{
 		ResponseNonce: time.Now().String(),
 		Node:          a.node(),
 		TypeUrl:       collections.IstioMeshV1Alpha1MeshConfig.Resource().GroupVersionKind().String(),
 	})
 
 	for _, sch := range collections.Pilot.All() {
-		_ = a.stream.Send(&discovery.DiscoveryRequest{
+		_ = a.send(&discovery.DiscoveryRequest{
 			ResponseNonce: time.Now().String(),
 			Node:          a.node(),
 			TypeUrl:       sch.Resource().GroupVersionKind().String(),
@@ -1043,7 +1082,7 @@ func (a *ADSC) sendRsc(typeurl string, rsc []string) {
 		version = ex.VersionInfo
 		nonce = ex.Nonce
 	}
-	_ = a.stream.Send(&discovery.DiscoveryRequest{
+	_ = a.send(&discovery.DiscoveryRequest{
 		ResponseNonce: nonce,
 		VersionInfo:   version,
 		Node:          a.node(),
@@ -1065,7 +1104,7 @@ func (a *ADSC) ack(msg *discovery.DiscoveryResponse) {
 		}
 	}
 
-	_ = a.stream.Send(&discovery.DiscoveryRequest{
+	_ = a.send(&discovery.DiscoveryRequest{
 		ResponseNonce: msg.Nonce,
 		TypeUrl:       msg.TypeUrl,
 		Node:          a.node(),
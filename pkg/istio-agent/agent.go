@@ -141,6 +141,9 @@ type AgentOptions struct {
 	// ProxyDomain is the DNS domain associated with the proxy (assumed
 	// to include the namespace as well) (for local dns resolution)
 	ProxyDomain string
+	// DNSForwardingRules is the YAML or JSON list of the rules forwarding the DNS queries for
+	// some domains to specific upstream resolvers (for local dns resolution)
+	DNSForwardingRules string
 	// Node identifier used by Envoy
 	ServiceNode string
 
@@ -164,6 +167,9 @@ type AgentOptions struct {
 	// Ability to retrieve ProxyConfig dynamically through XDS
 	EnableDynamicProxyConfig bool
 
+	// Ability to retrieve the CRLs of the mesh CA through XDS, so revoked peer certificates are rejected
+	EnableCRL bool
+
 	// All of the proxy's IP Addresses
 	ProxyIPAddresses []string
 
@@ -463,7 +469,11 @@ func (a *Agent) Run(ctx context.Context) (func(), error) {
 func (a *Agent) initLocalDNSServer() (err error) {
 	// we dont need dns server on gateways
 	if a.cfg.DNSCapture && a.cfg.ProxyXDSViaAgent && a.cfg.ProxyType == model.SidecarProxy {
-		if a.localDNSServer, err = dns.NewLocalDNSServer(a.cfg.ProxyNamespace, a.cfg.ProxyDomain); err != nil {
+		rules, err := dns.ParseForwardingRules(a.cfg.DNSForwardingRules)
+		if err != nil {
+			return err
+		}
+		if a.localDNSServer, err = dns.NewLocalDNSServer(a.cfg.ProxyNamespace, a.cfg.ProxyDomain, rules); err != nil {
 			return err
 		}
 		a.localDNSServer.StartDNS()
@@ -22,8 +22,15 @@ import (
 	"istio.io/istio/pilot/cmd/pilot-agent/status"
 	"istio.io/istio/pilot/cmd/pilot-agent/status/ready"
 	"istio.io/istio/pkg/kube/apimirror"
+	"istio.io/pkg/env"
 )
 
+// rewriteGRPCHealthProbes enables performing the gRPC health check of grpc_health_probe exec probes in the agent,
+// instead of running the command.
+var rewriteGRPCHealthProbes = env.RegisterBoolVar("REWRITE_GRPC_HEALTH_PROBES", false,
+	"If enabled, the gRPC health check of grpc_health_probe commands in WorkloadEntry readiness probes is "+
+		"performed by the agent, so the binary does not need to be installed.").Get()
+
 type WorkloadHealthChecker struct {
 	config applicationHealthCheckConfig
 	prober Prober
@@ -93,7 +100,13 @@ func NewWorkloadHealthChecker(cfg *v1alpha3.ReadinessProbe, envoyProbe ready.Pro
 	case *v1alpha3.ReadinessProbe_TcpSocket:
 		prober = &TCPProber{Config: healthCheckMethod.TcpSocket}
 	case *v1alpha3.ReadinessProbe_Exec:
-		prober = &ExecProber{Config: healthCheckMethod.Exec}
+		// If enabled, the gRPC health check of grpc_health_probe commands is performed by the agent,
+		// the binary does not need to be installed.
+		if grpcConfig, ok := ParseGRPCHealthProbeCommand(healthCheckMethod.Exec.Command); ok && rewriteGRPCHealthProbes {
+			prober = NewGRPCProber(grpcConfig, ipv6)
+		} else {
+			prober = &ExecProber{Config: healthCheckMethod.Exec}
+		}
 	default:
 		prober = nil
 	}
@@ -172,3 +172,24 @@ func TestWorkloadHealthChecker_PerformApplicationHealthCheck(t *testing.T) {
 		}, retry.Delay(time.Millisecond*10), retry.Timeout(time.Second))
 	})
 }
+
+func TestNewWorkloadHealthCheckerGRPCHealthProbe(t *testing.T) {
+	probe := &v1alpha3.ReadinessProbe{
+		HealthCheckMethod: &v1alpha3.ReadinessProbe_Exec{
+			Exec: &v1alpha3.ExecHealthCheckConfig{Command: []string{"grpc_health_probe", "-addr=:8080"}},
+		},
+	}
+	orig := rewriteGRPCHealthProbes
+	t.Cleanup(func() {
+		rewriteGRPCHealthProbes = orig
+	})
+
+	rewriteGRPCHealthProbes = false
+	if _, ok := NewWorkloadHealthChecker(probe, nil, nil, false).prober.(AggregateProber).Probes[0].(*ExecProber); !ok {
+		t.Errorf("expected the command to be executed when the rewrite is disabled")
+	}
+	rewriteGRPCHealthProbes = true
+	if _, ok := NewWorkloadHealthChecker(probe, nil, nil, false).prober.(AggregateProber).Probes[0].(*GRPCProber); !ok {
+		t.Errorf("expected the gRPC health check to be performed by the agent when the rewrite is enabled")
+	}
+}
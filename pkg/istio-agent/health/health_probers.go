@@ -17,14 +17,25 @@ package health
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	grpcHealth "google.golang.org/grpc/health/grpc_health_v1"
+	grpcStatus "google.golang.org/grpc/status"
+
 	"istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/cmd/pilot-agent/status"
 	"istio.io/istio/pilot/cmd/pilot-agent/status/ready"
@@ -162,6 +173,175 @@ func (t *TCPProber) Probe(timeout time.Duration) (ProbeResult, error) {
 	return Healthy, nil
 }
 
+// GRPCHealthCheckConfig configures a health check with the gRPC Health Checking Protocol,
+// see https://github.com/grpc/grpc/blob/master/doc/health-checking.md.
+type GRPCHealthCheckConfig struct {
+	Host string
+	Port uint32
+	// Service is the name of the service checked. The overall health of the server is checked if empty.
+	Service string
+	// TLS enables TLS, the certificate of the server is verified unless TLSNoVerify is set.
+	TLS         bool
+	TLSNoVerify bool
+	// TLSServerName overrides the name verified in the certificate of the server.
+	TLSServerName string
+	// TLSCACert is the file of the CA certificates verifying the server, the system roots are used if empty.
+	TLSCACert string
+	// TLSClientCert and TLSClientKey are the files of the client certificate and key, for mutual TLS.
+	TLSClientCert string
+	TLSClientKey  string
+	// ConnectTimeout and RPCTimeout, if set, bound the time to connect to the server and the time of the health
+	// check RPC, within the timeout of the probe.
+	ConnectTimeout time.Duration
+	RPCTimeout     time.Duration
+}
+
+const (
+	// grpcHealthProbeCommand is the name of the grpc_health_probe binary, commonly used in exec probes of gRPC services.
+	grpcHealthProbeCommand = "grpc_health_probe"
+	// grpcHealthProbeDefaultTimeout is the default -connect-timeout and -rpc-timeout of grpc_health_probe.
+	grpcHealthProbeDefaultTimeout = time.Second
+)
+
+// ParseGRPCHealthProbeCommand returns the health check of a grpc_health_probe command
+// (https://github.com/grpc-ecosystem/grpc-health-probe), so that it can be performed without the binary.
+// Returns false if the command is not a grpc_health_probe command with supported flags.
+func ParseGRPCHealthProbeCommand(command []string) (*GRPCHealthCheckConfig, bool) {
+	if len(command) == 0 || filepath.Base(command[0]) != grpcHealthProbeCommand {
+		return nil, false
+	}
+	cfg := &GRPCHealthCheckConfig{}
+	var addr string
+	fs := flag.NewFlagSet(grpcHealthProbeCommand, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.StringVar(&addr, "addr", "", "")
+	fs.StringVar(&cfg.Service, "service", "", "")
+	fs.BoolVar(&cfg.TLS, "tls", false, "")
+	fs.BoolVar(&cfg.TLSNoVerify, "tls-no-verify", false, "")
+	fs.StringVar(&cfg.TLSServerName, "tls-server-name", "", "")
+	fs.StringVar(&cfg.TLSCACert, "tls-ca-cert", "", "")
+	fs.StringVar(&cfg.TLSClientCert, "tls-client-cert", "", "")
+	fs.StringVar(&cfg.TLSClientKey, "tls-client-key", "", "")
+	fs.DurationVar(&cfg.ConnectTimeout, "connect-timeout", grpcHealthProbeDefaultTimeout, "")
+	fs.DurationVar(&cfg.RPCTimeout, "rpc-timeout", grpcHealthProbeDefaultTimeout, "")
+	fs.String("user-agent", "", "")
+	fs.Bool("v", false, "")
+	if err := fs.Parse(command[1:]); err != nil || fs.NArg() > 0 {
+		return nil, false
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, false
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || p == 0 {
+		return nil, false
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	cfg.Host = host
+	cfg.Port = uint32(p)
+	return cfg, true
+}
+
+type GRPCProber struct {
+	Config *GRPCHealthCheckConfig
+	dialer *net.Dialer
+}
+
+var _ Prober = &GRPCProber{}
+
+func NewGRPCProber(cfg *GRPCHealthCheckConfig, ipv6 bool) *GRPCProber {
+	d := &net.Dialer{
+		LocalAddr: status.UpstreamLocalAddressIPv4,
+	}
+	if ipv6 {
+		d.LocalAddr = status.UpstreamLocalAddressIPv6
+	}
+	return &GRPCProber{Config: cfg, dialer: d}
+}
+
+// Probe checks the health of the target with the gRPC Health Checking Protocol. The target is healthy if it
+// reports the SERVING status.
+func (g *GRPCProber) Probe(timeout time.Duration) (ProbeResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	dialCtx := ctx
+	if g.Config.ConnectTimeout > 0 {
+		var dialCancel context.CancelFunc
+		dialCtx, dialCancel = context.WithTimeout(ctx, g.Config.ConnectTimeout)
+		defer dialCancel()
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.WithUserAgent("istio-probe/1.0"),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return g.dialer.DialContext(ctx, "tcp", addr)
+		}),
+	}
+	if g.Config.TLS {
+		tlsConfig, err := g.tlsConfig()
+		if err != nil {
+			return Unknown, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	addr := net.JoinHostPort(g.Config.Host, strconv.Itoa(int(g.Config.Port)))
+	conn, err := grpc.DialContext(dialCtx, addr, opts...)
+	// if we cant connect, count as fail
+	if err != nil {
+		return Unhealthy, fmt.Errorf("failed to connect to %v: %v", addr, err)
+	}
+	defer conn.Close()
+
+	rpcCtx := ctx
+	if g.Config.RPCTimeout > 0 {
+		var rpcCancel context.CancelFunc
+		rpcCtx, rpcCancel = context.WithTimeout(ctx, g.Config.RPCTimeout)
+		defer rpcCancel()
+	}
+	resp, err := grpcHealth.NewHealthClient(conn).Check(rpcCtx, &grpcHealth.HealthCheckRequest{Service: g.Config.Service})
+	if err != nil {
+		if grpcStatus.Code(err) == codes.Unimplemented {
+			return Unhealthy, errors.New("the server does not implement the gRPC Health Checking Protocol")
+		}
+		return Unhealthy, err
+	}
+	if resp.GetStatus() != grpcHealth.HealthCheckResponse_SERVING {
+		return Unhealthy, fmt.Errorf("service %q is %v", g.Config.Service, resp.GetStatus())
+	}
+	return Healthy, nil
+}
+
+func (g *GRPCProber) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         g.Config.TLSServerName,
+		InsecureSkipVerify: g.Config.TLSNoVerify, // nolint: gosec
+	}
+	if g.Config.TLSCACert != "" {
+		b, err := ioutil.ReadFile(g.Config.TLSCACert)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificate found in %v", g.Config.TLSCACert)
+		}
+	}
+	if g.Config.TLSClientCert != "" || g.Config.TLSClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(g.Config.TLSClientCert, g.Config.TLSClientKey)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
 type ExecProber struct {
 	Config *v1alpha3.ExecHealthCheckConfig
 }
@@ -20,10 +20,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strconv"
 	"testing"
 	"time"
 
+	"google.golang.org/grpc"
+	grpcHealth "google.golang.org/grpc/health"
+	grpcHealthV1 "google.golang.org/grpc/health/grpc_health_v1"
+
 	"istio.io/api/networking/v1alpha3"
 )
 
@@ -171,6 +176,156 @@ func TestExecProber(t *testing.T) {
 	}
 }
 
+func TestGRPCProber(t *testing.T) {
+	tests := []struct {
+		desc                string
+		service             string
+		noHealthService     bool
+		stopped             bool
+		expectedProbeResult ProbeResult
+	}{
+		{
+			desc:                "Healthy",
+			expectedProbeResult: Healthy,
+		},
+		{
+			desc:                "Healthy - service",
+			service:             "serving",
+			expectedProbeResult: Healthy,
+		},
+		{
+			desc:                "Unhealthy - service not serving",
+			service:             "not-serving",
+			expectedProbeResult: Unhealthy,
+		},
+		{
+			desc:                "Unhealthy - unknown service",
+			service:             "unknown",
+			expectedProbeResult: Unhealthy,
+		},
+		{
+			desc:                "Unhealthy - health service not implemented",
+			noHealthService:     true,
+			expectedProbeResult: Unhealthy,
+		},
+		{
+			desc:                "Unhealthy - Could not connect to server",
+			stopped:             true,
+			expectedProbeResult: Unhealthy,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			server, port := createGRPCServer(t, !tt.noHealthService)
+			defer server.Stop()
+			if tt.stopped {
+				server.Stop()
+			}
+			grpcProber := NewGRPCProber(&GRPCHealthCheckConfig{
+				Host:    "127.0.0.1",
+				Port:    port,
+				Service: tt.service,
+			}, false)
+
+			got, err := grpcProber.Probe(time.Second)
+			if got != tt.expectedProbeResult || (err != nil) != (tt.expectedProbeResult != Healthy) {
+				t.Errorf("%s: got: %v, expected: %v, got error: %v", tt.desc, got, tt.expectedProbeResult, err)
+			}
+		})
+	}
+}
+
+func TestParseGRPCHealthProbeCommand(t *testing.T) {
+	tests := []struct {
+		desc     string
+		command  []string
+		expected *GRPCHealthCheckConfig
+	}{
+		{
+			desc:     "address",
+			command:  []string{"/bin/grpc_health_probe", "-addr=:8080"},
+			expected: &GRPCHealthCheckConfig{Host: "localhost", Port: 8080, ConnectTimeout: time.Second, RPCTimeout: time.Second},
+		},
+		{
+			desc:    "service and timeouts",
+			command: []string{"grpc_health_probe", "-addr", "127.0.0.1:8080", "-service=foo", "-connect-timeout=2s", "-rpc-timeout=3s"},
+			expected: &GRPCHealthCheckConfig{
+				Host:           "127.0.0.1",
+				Port:           8080,
+				Service:        "foo",
+				ConnectTimeout: 2 * time.Second,
+				RPCTimeout:     3 * time.Second,
+			},
+		},
+		{
+			desc: "tls",
+			command: []string{
+				"grpc_health_probe", "-addr=localhost:8443", "-tls", "-tls-ca-cert=/etc/ca.pem",
+				"-tls-client-cert=/etc/cert.pem", "-tls-client-key=/etc/key.pem", "-tls-server-name=foo.example.com",
+			},
+			expected: &GRPCHealthCheckConfig{
+				Host:           "localhost",
+				Port:           8443,
+				TLS:            true,
+				TLSServerName:  "foo.example.com",
+				TLSCACert:      "/etc/ca.pem",
+				TLSClientCert:  "/etc/cert.pem",
+				TLSClientKey:   "/etc/key.pem",
+				ConnectTimeout: time.Second,
+				RPCTimeout:     time.Second,
+			},
+		},
+		{
+			desc:    "other command",
+			command: []string{"cat", "/tmp/healthy"},
+		},
+		{
+			desc:    "missing address",
+			command: []string{"grpc_health_probe", "-service=foo"},
+		},
+		{
+			desc:    "invalid port",
+			command: []string{"grpc_health_probe", "-addr=:http"},
+		},
+		{
+			desc:    "unknown flag",
+			command: []string{"grpc_health_probe", "-addr=:8080", "-unknown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, ok := ParseGRPCHealthProbeCommand(tt.command)
+			if ok != (tt.expected != nil) {
+				t.Fatalf("got ok: %v, expected: %v", ok, tt.expected != nil)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got: %+v, expected: %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func createGRPCServer(t *testing.T, healthService bool) (*grpc.Server, uint32) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	if healthService {
+		hs := grpcHealth.NewServer()
+		hs.SetServingStatus("serving", grpcHealthV1.HealthCheckResponse_SERVING)
+		hs.SetServingStatus("not-serving", grpcHealthV1.HealthCheckResponse_NOT_SERVING)
+		grpcHealthV1.RegisterHealthServer(server, hs)
+	}
+	go func() {
+		_ = server.Serve(l)
+	}()
+	return server, uint32(l.Addr().(*net.TCPAddr).Port)
+}
+
 func createHTTPServer(statusCode int) (*httptest.Server, uint32) {
 	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		writer.WriteHeader(statusCode)
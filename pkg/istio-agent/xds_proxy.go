@@ -28,10 +28,12 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
+	auth "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	gogotypes "github.com/gogo/protobuf/types"
 	"github.com/golang/protobuf/jsonpb"
@@ -125,6 +127,9 @@ var proxyLog = log.RegisterScope("xdsproxy", "XDS Proxy in Istio Agent", 0)
 const (
 	localHostIPv4 = "127.0.0.1"
 	localHostIPv6 = "[::1]"
+
+	// wasmCacheIndexFile is the file in the Istio data directory the Wasm module cache index is persisted to.
+	wasmCacheIndexFile = "wasm-cache-index.json"
 )
 
 func initXdsProxy(ia *Agent) (*XdsProxy, error) {
@@ -148,10 +153,22 @@ func initXdsProxy(ia *Agent) (*XdsProxy, error) {
 		healthChecker:  health.NewWorkloadHealthChecker(ia.proxyConfig.ReadinessProbe, envoyProbe, ia.cfg.ProxyIPAddresses, ia.cfg.IsIPv6),
 		xdsHeaders:     ia.cfg.XDSHeaders,
 		xdsUdsPath:     ia.cfg.XdsUdsPath,
-		wasmCache:      wasm.NewLocalFileCache(constants.IstioDataDir, wasm.DefaultWasmModulePurgeInterval, wasm.DefaultWasmModuleExpiry),
 		proxyAddresses: ia.cfg.ProxyIPAddresses,
 	}
 
+	wasmOpts := wasm.Options{
+		PurgeInterval: wasm.DefaultWasmModulePurgeInterval,
+		ModuleExpiry:  wasm.DefaultWasmModuleExpiry,
+		MaxCacheSize:  int64(features.WasmModuleCacheMaxSizeMB) << 20,
+		IndexFile:     filepath.Join(constants.IstioDataDir, wasmCacheIndexFile),
+	}
+	if features.WasmModuleVerificationKeys != "" {
+		if wasmOpts.Verifier, err = wasm.LoadModuleVerifier(features.WasmModuleVerificationKeys); err != nil {
+			return nil, fmt.Errorf("failed to load Wasm module verification keys: %v", err)
+		}
+	}
+	proxy.wasmCache = wasm.NewLocalFileCacheWithOptions(constants.IstioDataDir, wasmOpts)
+
 	if ia.localDNSServer != nil {
 		proxy.handlers[v3.NameTableType] = func(resp *any.Any) error {
 			var nt nds.NameTable
@@ -180,6 +197,17 @@ func initXdsProxy(ia *Agent) (*XdsProxy, error) {
 			return ia.secretCache.UpdateConfigTrustBundle(trustBundle)
 		}
 	}
+	if ia.cfg.EnableCRL && ia.secretCache != nil {
+		proxy.handlers[v3.CRLType] = func(resp *any.Any) error {
+			var vc auth.CertificateValidationContext
+			// nolint: staticcheck
+			if err := ptypes.UnmarshalAny(resp, &vc); err != nil {
+				log.Errorf("failed to unmarshall CRL: %v", err)
+				return err
+			}
+			return ia.secretCache.UpdateCRL(vc.GetCrl().GetInlineBytes())
+		}
+	}
 
 	proxyLog.Infof("Initializing with upstream address %q and cluster %q", proxy.istiodAddress, proxy.clusterID)
 
@@ -335,6 +363,12 @@ func (p *XdsProxy) handleStream(downstream adsStream) error {
 						TypeUrl: v3.ProxyConfigType,
 					}
 				}
+				// fire off an initial CRL request
+				if _, f := p.handlers[v3.CRLType]; f {
+					con.requestsChan <- &discovery.DiscoveryRequest{
+						TypeUrl: v3.CRLType,
+					}
+				}
 				// Fire of a configured initial request, if there is one
 				p.connectedMutex.RLock()
 				initialRequest := p.initialRequest
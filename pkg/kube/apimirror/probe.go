@@ -42,6 +42,19 @@ type HTTPGetAction struct {
 	HTTPHeaders []HTTPHeader `json:"httpHeaders,omitempty" protobuf:"bytes,5,rep,name=httpHeaders"`
 }
 
+// GRPCAction describes an action based on the gRPC Health Checking Protocol. It mirrors the
+// Kubernetes GRPCAction, added in Kubernetes 1.23.
+type GRPCAction struct {
+	// Port number of the gRPC service. Number must be in the range 1 to 65535.
+	Port int32 `json:"port" protobuf:"bytes,1,opt,name=port"`
+	// Service is the name of the service to place in the gRPC HealthCheckRequest
+	// (see https://github.com/grpc/grpc/blob/master/doc/health-checking.md).
+	//
+	// If this is not specified, the default behavior is defined by gRPC.
+	// +optional
+	Service *string `json:"service" protobuf:"bytes,2,opt,name=service"`
+}
+
 // URIScheme identifies the scheme used for connection to a host for Get actions
 type URIScheme string
 
@@ -18,6 +18,7 @@ package inject
 
 import (
 	"encoding/json"
+	"math"
 	"strconv"
 
 	"github.com/gogo/protobuf/types"
@@ -26,6 +27,8 @@ import (
 
 	"istio.io/api/annotation"
 	"istio.io/istio/pilot/cmd/pilot-agent/status"
+	"istio.io/istio/pkg/istio-agent/health"
+	"istio.io/istio/pkg/kube/apimirror"
 	"istio.io/pkg/log"
 )
 
@@ -44,6 +47,17 @@ func ShouldRewriteAppHTTPProbers(annotations map[string]string, specSetting *typ
 	return specSetting.GetValue()
 }
 
+// RewriteGRPCHealthProbesAnnotation opts a pod in to have the exec probes running grpc_health_probe replaced by
+// a gRPC health check performed by pilot agent, when app probers are rewritten.
+// TODO move this to api repo
+const RewriteGRPCHealthProbesAnnotation = "sidecar.istio.io/rewriteGrpcHealthProbes"
+
+// shouldRewriteGRPCHealthProbes returns if we should take over the apps' grpc_health_probe exec probes.
+func shouldRewriteGRPCHealthProbes(annotations map[string]string) bool {
+	rewrite, err := strconv.ParseBool(annotations[RewriteGRPCHealthProbesAnnotation])
+	return err == nil && rewrite
+}
+
 // FindSidecar returns the pointer to the first container whose name matches the "istio-proxy".
 func FindSidecar(containers []corev1.Container) *corev1.Container {
 	return FindContainer(ProxyContainerName, containers)
@@ -60,8 +74,22 @@ func FindContainer(name string, containers []corev1.Container) *corev1.Container
 }
 
 // convertAppProber returns an overwritten `Probe` for pilot agent to take over.
-func convertAppProber(probe *corev1.Probe, newURL string, statusPort int) *corev1.Probe {
-	if probe == nil || probe.HTTPGet == nil {
+func convertAppProber(probe *corev1.Probe, newURL string, statusPort int, rewriteGRPC bool) *corev1.Probe {
+	if probe == nil {
+		return nil
+	}
+	if grpc, _ := grpcHealthProbeAction(probe); rewriteGRPC && grpc != nil {
+		// gRPC health probes are performed by pilot agent, the probe command is replaced.
+		// Kubelet -> HTTP -> Pilot Agent -> gRPC -> Application
+		p := probe.DeepCopy()
+		p.Exec = nil
+		p.HTTPGet = &corev1.HTTPGetAction{
+			Path: newURL,
+			Port: intstr.FromInt(statusPort),
+		}
+		return p
+	}
+	if probe.HTTPGet == nil {
 		return nil
 	}
 	p := probe.DeepCopy()
@@ -81,15 +109,20 @@ type KubeAppProbers map[string]*Prober
 
 // Prober represents a single container prober
 type Prober struct {
-	HTTPGet        *corev1.HTTPGetAction `json:"httpGet"`
+	HTTPGet        *corev1.HTTPGetAction `json:"httpGet,omitempty"`
+	GRPC           *apimirror.GRPCAction `json:"grpc,omitempty"`
 	TimeoutSeconds int32                 `json:"timeoutSeconds,omitempty"`
 }
 
 // DumpAppProbers returns a json encoded string as `status.KubeAppProbers`.
 // Also update the probers so that all usages of named port will be resolved to integer.
-func DumpAppProbers(podspec *corev1.PodSpec, targetPort int32) string {
+// The exec probes running grpc_health_probe are only included if rewriteGRPC is set.
+func DumpAppProbers(podspec *corev1.PodSpec, targetPort int32, rewriteGRPC bool) string {
 	out := KubeAppProbers{}
 	updateNamedPort := func(p *Prober, portMap map[string]int32) *Prober {
+		if p != nil && p.GRPC != nil {
+			return p
+		}
 		if p == nil || p.HTTPGet == nil {
 			return nil
 		}
@@ -116,13 +149,13 @@ func DumpAppProbers(podspec *corev1.PodSpec, targetPort int32) string {
 				portMap[p.Name] = p.ContainerPort
 			}
 		}
-		if h := updateNamedPort(kubeProbeToInternalProber(c.ReadinessProbe), portMap); h != nil {
+		if h := updateNamedPort(kubeProbeToInternalProber(c.ReadinessProbe, rewriteGRPC), portMap); h != nil {
 			out[readyz] = h
 		}
-		if h := updateNamedPort(kubeProbeToInternalProber(c.LivenessProbe), portMap); h != nil {
+		if h := updateNamedPort(kubeProbeToInternalProber(c.LivenessProbe, rewriteGRPC), portMap); h != nil {
 			out[livez] = h
 		}
-		if h := updateNamedPort(kubeProbeToInternalProber(c.StartupProbe), portMap); h != nil {
+		if h := updateNamedPort(kubeProbeToInternalProber(c.StartupProbe, rewriteGRPC), portMap); h != nil {
 			out[startupz] = h
 		}
 
@@ -153,6 +186,7 @@ func patchRewriteProbe(annotations map[string]string, pod *corev1.Pod, defaultPo
 		}
 		statusPort = p
 	}
+	rewriteGRPC := shouldRewriteGRPCHealthProbes(annotations)
 	for i, c := range pod.Spec.Containers {
 		// Skip sidecar container.
 		if c.Name == ProxyContainerName {
@@ -163,13 +197,13 @@ func patchRewriteProbe(annotations map[string]string, pod *corev1.Pod, defaultPo
 			portMap[p.Name] = p.ContainerPort
 		}
 		readyz, livez, startupz := status.FormatProberURL(c.Name)
-		if probePatch := convertAppProber(c.ReadinessProbe, readyz, statusPort); probePatch != nil {
+		if probePatch := convertAppProber(c.ReadinessProbe, readyz, statusPort, rewriteGRPC); probePatch != nil {
 			c.ReadinessProbe = probePatch
 		}
-		if probePatch := convertAppProber(c.LivenessProbe, livez, statusPort); probePatch != nil {
+		if probePatch := convertAppProber(c.LivenessProbe, livez, statusPort, rewriteGRPC); probePatch != nil {
 			c.LivenessProbe = probePatch
 		}
-		if probePatch := convertAppProber(c.StartupProbe, startupz, statusPort); probePatch != nil {
+		if probePatch := convertAppProber(c.StartupProbe, startupz, statusPort, rewriteGRPC); probePatch != nil {
 			c.StartupProbe = probePatch
 		}
 		pod.Spec.Containers[i] = c
@@ -177,11 +211,20 @@ func patchRewriteProbe(annotations map[string]string, pod *corev1.Pod, defaultPo
 }
 
 // kubeProbeToInternalProber converts a Kubernetes Probe to an Istio internal Prober
-func kubeProbeToInternalProber(probe *corev1.Probe) *Prober {
+func kubeProbeToInternalProber(probe *corev1.Probe, rewriteGRPC bool) *Prober {
 	if probe == nil {
 		return nil
 	}
 
+	if rewriteGRPC {
+		if grpc, timeoutSeconds := grpcHealthProbeAction(probe); grpc != nil {
+			return &Prober{
+				GRPC:           grpc,
+				TimeoutSeconds: timeoutSeconds,
+			}
+		}
+	}
+
 	if probe.HTTPGet == nil {
 		return nil
 	}
@@ -191,3 +234,36 @@ func kubeProbeToInternalProber(probe *corev1.Probe) *Prober {
 		TimeoutSeconds: probe.TimeoutSeconds,
 	}
 }
+
+// grpcHealthProbeAction returns the gRPC health check of an exec probe running grpc_health_probe,
+// or nil if the probe cannot be taken over by pilot agent. Only plaintext health checks of the
+// application container are taken over.
+// The timeout of the health check is the timeout of the probe, bounded by the -connect-timeout
+// and -rpc-timeout of the command.
+func grpcHealthProbeAction(probe *corev1.Probe) (*apimirror.GRPCAction, int32) {
+	if probe.Exec == nil {
+		return nil, 0
+	}
+	cfg, ok := health.ParseGRPCHealthProbeCommand(probe.Exec.Command)
+	if !ok || cfg.TLS {
+		return nil, 0
+	}
+	switch cfg.Host {
+	case "localhost", "127.0.0.1", "::1":
+	default:
+		return nil, 0
+	}
+	grpc := &apimirror.GRPCAction{Port: int32(cfg.Port)}
+	if cfg.Service != "" {
+		grpc.Service = &cfg.Service
+	}
+	timeoutSeconds := probe.TimeoutSeconds
+	if timeoutSeconds == 0 {
+		// The default timeout of Kubernetes probes.
+		timeoutSeconds = 1
+	}
+	if commandSeconds := int32(math.Ceil((cfg.ConnectTimeout + cfg.RPCTimeout).Seconds())); commandSeconds < timeoutSeconds {
+		timeoutSeconds = commandSeconds
+	}
+	return grpc, timeoutSeconds
+}
@@ -110,3 +110,28 @@ func TestShouldRewriteAppHTTPProbers(t *testing.T) {
 		}
 	}
 }
+
+func TestGRPCHealthProbeRewrite(t *testing.T) {
+	probe := &corev1.Probe{
+		Handler: corev1.Handler{
+			Exec: &corev1.ExecAction{Command: []string{"grpc_health_probe", "-addr=:8080", "-connect-timeout=3s", "-rpc-timeout=2s"}},
+		},
+		TimeoutSeconds: 10,
+	}
+	podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "app", ReadinessProbe: probe}}}
+
+	if got := DumpAppProbers(podSpec, 15020, false); got != "" {
+		t.Errorf("expected no app probers without the opt-in, got %v", got)
+	}
+	if got := convertAppProber(probe, "/app-health/app/readyz", 15020, false); got != nil {
+		t.Errorf("expected the probe not to be rewritten without the opt-in, got %v", got)
+	}
+
+	want := `{"/app-health/app/readyz":{"grpc":{"port":8080,"service":null},"timeoutSeconds":5}}`
+	if got := DumpAppProbers(podSpec, 15020, true); got != want {
+		t.Errorf("got app probers %v, want %v", got, want)
+	}
+	if got := convertAppProber(probe, "/app-health/app/readyz", 15020, true); got == nil || got.Exec != nil || got.HTTPGet == nil {
+		t.Errorf("expected the probe to be rewritten to the agent, got %v", got)
+	}
+}
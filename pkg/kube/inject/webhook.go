@@ -609,7 +609,7 @@ func applyRewrite(pod *corev1.Pod, req InjectionParameters) error {
 
 	// We don't have to escape json encoding here when using golang libraries.
 	if rewrite && sidecar != nil {
-		if prober := DumpAppProbers(&pod.Spec, req.meshConfig.GetDefaultConfig().GetStatusPort()); prober != "" {
+		if prober := DumpAppProbers(&pod.Spec, req.meshConfig.GetDefaultConfig().GetStatusPort(), shouldRewriteGRPCHealthProbes(pod.Annotations)); prober != "" {
 			sidecar.Env = append(sidecar.Env, corev1.EnvVar{Name: status.KubeAppProberEnvName, Value: prober})
 		}
 		patchRewriteProbe(pod.Annotations, pod, req.meshConfig.GetDefaultConfig().GetStatusPort())
@@ -52,8 +52,10 @@ const (
 	WorkloadKeyCertResourceName = "default"
 
 	// Credential fetcher type
-	GCE  = "GoogleComputeEngine"
-	Mock = "Mock" // testing only
+	GCE   = "GoogleComputeEngine"
+	AWS   = "AmazonWebServices"
+	Azure = "MicrosoftAzure"
+	Mock  = "Mock" // testing only
 
 	// GoogleCAProvider uses the Google CA for workload certificate signing
 	GoogleCAProvider = "GoogleCA"
@@ -121,7 +123,8 @@ type Options struct {
 	ClusterID string
 
 	// The type of Elliptical Signature algorithm to use
-	// when generating private keys. Currently only ECDSA is supported.
+	// when generating private keys: ECDSA (P-256), ECDSA_P384 or ED25519.
+	// Envoy cannot load ED25519 keys, so the SDS server refuses to serve them.
 	ECCSigAlg string
 
 	// FileMountedCerts indicates whether the proxy is using file
@@ -131,6 +134,11 @@ type Options struct {
 	// well-known ./etc/certs location.
 	FileMountedCerts bool
 
+	// ValidateFileMountedCerts makes the agent validate the certificates read from files before serving
+	// them: the key must match the certificate, which must chain to the workload roots. If the files are
+	// invalid, for example while they are being written, the last valid certificate is served.
+	ValidateFileMountedCerts bool
+
 	// PilotCertProvider is the provider of the Pilot certificate (PILOT_CERT_PROVIDER env)
 	// Determines the root CA file to use for connecting to CA gRPC:
 	// - istiod
@@ -249,6 +257,9 @@ type SecretItem struct {
 
 	RootCert []byte
 
+	// CRL is the PEM encoded certificate revocation lists of the CAs in RootCert, if any.
+	CRL []byte
+
 	// ResourceName passed from envoy SDS discovery request.
 	// "ROOTCA" for root cert request, "default" for key/cert request.
 	ResourceName string
@@ -262,7 +273,8 @@ type CredFetcher interface {
 	// GetPlatformCredential fetches workload credential provided by the platform.
 	GetPlatformCredential() (string, error)
 
-	// GetType returns credential fetcher type. Currently the supported type is "GoogleComputeEngine".
+	// GetType returns credential fetcher type. Currently the supported types are "GoogleComputeEngine",
+	// "AmazonWebServices" and "MicrosoftAzure".
 	GetType() string
 
 	// The name of the IdentityProvider that can authenticate the workload credential.
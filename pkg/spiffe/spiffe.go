@@ -190,85 +190,124 @@ func RetrieveSpiffeBundleRootCertsFromStringInput(inputString string, extraTrust
 // It can use the system cert pool and the supplied certificates to validate the endpoints.
 func RetrieveSpiffeBundleRootCerts(config map[string]string, caCertPool *x509.CertPool, retryTimeout time.Duration) (
 	map[string][]*x509.Certificate, error) {
-	httpClient := &http.Client{}
-
 	ret := map[string][]*x509.Certificate{}
 	for trustdomain, endpoint := range config {
-		if !strings.HasPrefix(endpoint, "https://") {
-			endpoint = "https://" + endpoint
-		}
-		u, err := url.Parse(endpoint)
+		bundle, err := FetchBundle(trustdomain, endpoint, caCertPool, retryTimeout)
 		if err != nil {
-			return nil, fmt.Errorf("failed to split the SPIFFE bundle URL: %v", err)
+			return nil, err
 		}
+		ret[trustdomain] = append(ret[trustdomain], bundle.Certs...)
+	}
+	for trustDomain, certs := range ret {
+		spiffeLog.Infof("Loaded SPIFFE trust bundle for: %v, containing %d certs", trustDomain, len(certs))
+	}
+	return ret, nil
+}
 
-		config := &tls.Config{
-			ServerName: u.Hostname(),
-			RootCAs:    caCertPool,
-		}
+// Bundle is the SPIFFE trust bundle of a trust domain.
+type Bundle struct {
+	TrustDomain string
+	// Certs are the X.509 roots of the trust domain.
+	Certs []*x509.Certificate
+	// Sequence is increased by the trust domain whenever the bundle changes.
+	Sequence uint64
+	// RefreshHint is how often the bundle should be refreshed, zero if the trust domain provides no hint.
+	RefreshHint time.Duration
+}
 
-		httpClient.Transport = &http.Transport{
-			TLSClientConfig: config,
-		}
+// FetchBundle retrieves the SPIFFE trust bundle of a trust domain from its bundle endpoint, retrying until
+// retryTimeout. The endpoint is validated with the cert pool.
+func FetchBundle(trustdomain, endpoint string, caCertPool *x509.CertPool, retryTimeout time.Duration) (*Bundle, error) {
+	if !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to split the SPIFFE bundle URL: %v", err)
+	}
 
-		retryBackoffTime := firstRetryBackOffTime
-		startTime := time.Now()
-		var resp *http.Response
-		for {
-			resp, err = httpClient.Get(endpoint)
-			var errMsg string
-			if err != nil {
-				errMsg = fmt.Sprintf("Calling %s failed with error: %v", endpoint, err)
-			} else if resp == nil {
-				errMsg = fmt.Sprintf("Calling %s failed with nil response", endpoint)
-			} else if resp.StatusCode != http.StatusOK {
-				b := make([]byte, 1024)
-				n, _ := resp.Body.Read(b)
-				errMsg = fmt.Sprintf("Calling %s failed with unexpected status: %v, fetching bundle: %s",
-					endpoint, resp.StatusCode, string(b[:n]))
-			} else {
-				break
-			}
+	config := &tls.Config{
+		ServerName: u.Hostname(),
+		RootCAs:    caCertPool,
+	}
 
-			if startTime.Add(retryTimeout).Before(time.Now()) {
-				return nil, fmt.Errorf("exhausted retries to fetch the SPIFFE bundle %s from url %s. Latest error: %v",
-					trustdomain, endpoint, errMsg)
-			}
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: config,
+		},
+	}
 
-			spiffeLog.Warnf("%s, retry in %v", errMsg, retryBackoffTime)
-			time.Sleep(retryBackoffTime)
-			retryBackoffTime *= 2 // Exponentially increase the retry backoff time.
+	retryBackoffTime := firstRetryBackOffTime
+	startTime := time.Now()
+	var resp *http.Response
+	for {
+		resp, err = httpClient.Get(endpoint)
+		var errMsg string
+		if err != nil {
+			errMsg = fmt.Sprintf("Calling %s failed with error: %v", endpoint, err)
+		} else if resp == nil {
+			errMsg = fmt.Sprintf("Calling %s failed with nil response", endpoint)
+		} else if resp.StatusCode != http.StatusOK {
+			b := make([]byte, 1024)
+			n, _ := resp.Body.Read(b)
+			resp.Body.Close()
+			errMsg = fmt.Sprintf("Calling %s failed with unexpected status: %v, fetching bundle: %s",
+				endpoint, resp.StatusCode, string(b[:n]))
+		} else {
+			break
 		}
-		defer resp.Body.Close()
 
-		doc := new(bundleDoc)
-		if err := json.NewDecoder(resp.Body).Decode(doc); err != nil {
-			return nil, fmt.Errorf("trust domain [%s] at URL [%s] failed to decode bundle: %v", trustdomain, endpoint, err)
+		if startTime.Add(retryTimeout).Before(time.Now()) {
+			return nil, fmt.Errorf("exhausted retries to fetch the SPIFFE bundle %s from url %s. Latest error: %v",
+				trustdomain, endpoint, errMsg)
 		}
 
-		var cert *x509.Certificate
-		for i, key := range doc.Keys {
-			if key.Use == "x509-svid" {
-				if len(key.Certificates) != 1 {
-					return nil, fmt.Errorf("trust domain [%s] at URL [%s] expected 1 certificate in x509-svid entry %d; got %d",
-						trustdomain, endpoint, i, len(key.Certificates))
-				}
-				cert = key.Certificates[0]
+		spiffeLog.Warnf("%s, retry in %v", errMsg, retryBackoffTime)
+		time.Sleep(retryBackoffTime)
+		retryBackoffTime *= 2 // Exponentially increase the retry backoff time.
+	}
+	defer resp.Body.Close()
+
+	doc := new(bundleDoc)
+	if err := json.NewDecoder(resp.Body).Decode(doc); err != nil {
+		return nil, fmt.Errorf("trust domain [%s] at URL [%s] failed to decode bundle: %v", trustdomain, endpoint, err)
+	}
+
+	bundle := &Bundle{
+		TrustDomain: trustdomain,
+		Sequence:    doc.Sequence,
+		RefreshHint: time.Duration(doc.RefreshHint) * time.Second,
+	}
+	for i, key := range doc.Keys {
+		if key.Use == "x509-svid" {
+			if len(key.Certificates) != 1 {
+				return nil, fmt.Errorf("trust domain [%s] at URL [%s] expected 1 certificate in x509-svid entry %d; got %d",
+					trustdomain, endpoint, i, len(key.Certificates))
 			}
-		}
-		if cert == nil {
-			return nil, fmt.Errorf("trust domain [%s] at URL [%s] does not provide a X509 SVID", trustdomain, endpoint)
-		}
-		if certs, ok := ret[trustdomain]; ok {
-			ret[trustdomain] = append(certs, cert)
-		} else {
-			ret[trustdomain] = []*x509.Certificate{cert}
+			bundle.Certs = append(bundle.Certs, key.Certificates[0])
 		}
 	}
-	for trustDomain, certs := range ret {
-		spiffeLog.Infof("Loaded SPIFFE trust bundle for: %v, containing %d certs", trustDomain, len(certs))
+	if len(bundle.Certs) == 0 {
+		return nil, fmt.Errorf("trust domain [%s] at URL [%s] does not provide a X509 SVID", trustdomain, endpoint)
 	}
-	return ret, nil
+	return bundle, nil
+}
+
+// MarshalBundle returns the SPIFFE bundle document, in JWKS format, holding the X.509 roots of a trust domain.
+func MarshalBundle(certs []*x509.Certificate, sequence uint64, refreshHint time.Duration) ([]byte, error) {
+	doc := bundleDoc{
+		JSONWebKeySet: jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}},
+		Sequence:      sequence,
+		RefreshHint:   int(refreshHint.Seconds()),
+	}
+	for _, cert := range certs {
+		doc.Keys = append(doc.Keys, jose.JSONWebKey{
+			Key:          cert.PublicKey,
+			Certificates: []*x509.Certificate{cert},
+			Use:          "x509-svid",
+		})
+	}
+	return json.Marshal(doc)
 }
 
 // PeerCertVerifier is an instance to verify the peer certificate in the SPIFFE way using the retrieved root certificates.
@@ -345,6 +345,34 @@ func TestRetrieveSpiffeBundleRootCertsFromStringInput(t *testing.T) {
 	}
 }
 
+func TestMarshalAndFetchBundle(t *testing.T) {
+	other := httptest.NewTLSServer(http.NotFoundHandler())
+	defer other.Close()
+	var bundle []byte
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write(bundle)
+	}))
+	defer server.Close()
+
+	roots := []*x509.Certificate{server.Certificate(), other.Certificate()}
+	var err error
+	if bundle, err = MarshalBundle(roots, 3, 5*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	got, err := FetchBundle("foo.com", server.Listener.Addr().String(), pool, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TrustDomain != "foo.com" || got.Sequence != 3 || got.RefreshHint != 5*time.Minute {
+		t.Errorf("unexpected bundle: %+v", got)
+	}
+	if len(got.Certs) != 2 || !got.Certs[0].Equal(roots[0]) || !got.Certs[1].Equal(roots[1]) {
+		t.Errorf("expected the roots to round trip, got %d certs", len(got.Certs))
+	}
+}
+
 // TestVerifyPeerCert tests VerifyPeerCert is effective at the client side, using a TLS server.
 func TestGetGeneralCertPoolAndVerifyPeerCert(t *testing.T) {
 	validRootCert := string(util.ReadFile(validRootCertFile1, t))
@@ -33,7 +33,12 @@ const (
 
 // newEnvoy creates a new Envoy struct and starts envoy.
 func (s *TestSetup) newEnvoy() (envoy.Instance, error) {
-	confPath := filepath.Join(env2.IstioOut, fmt.Sprintf("config.conf.%v.yaml", s.ports.AdminPort))
+	outDir := env2.IstioOut
+	if outDir == "" {
+		// The output directory does not exist, do not write the config to the working directory of the test.
+		outDir = s.t.TempDir()
+	}
+	confPath := filepath.Join(outDir, fmt.Sprintf("config.conf.%v.yaml", s.ports.AdminPort))
 	log.Printf("Envoy config: in %v\n", confPath)
 	if err := s.CreateEnvoyConf(confPath); err != nil {
 		return nil, err
@@ -15,16 +15,21 @@
 package wasm
 
 import (
+	"context"
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"istio.io/istio/pkg/file"
 	"istio.io/pkg/log"
 )
 
@@ -40,7 +45,9 @@ const (
 
 // Cache models a Wasm module cache.
 type Cache interface {
-	Get(url, checksum string, timeout time.Duration) (string, error)
+	// Get returns the path of the local file of the Wasm module at the url. The pull secret is used to pull
+	// modules from `oci://` registries.
+	Get(url, checksum string, timeout time.Duration, pullSecret []byte) (string, error)
 	Cleanup()
 }
 
@@ -52,6 +59,9 @@ type LocalFileCache struct {
 	// http fetcher fetches Wasm module with HTTP get.
 	httpFetcher *HTTPFetcher
 
+	// image fetcher fetches Wasm module from OCI and Docker registries.
+	imageFetcher *ImageFetcher
+
 	// directory path used to store Wasm module.
 	dir string
 
@@ -62,6 +72,15 @@ type LocalFileCache struct {
 	purgeInterval    time.Duration
 	wasmModuleExpiry time.Duration
 
+	// Maximum total size of the Wasm module files, 0 if unbounded.
+	maxCacheSize int64
+
+	// indexFile, if set, is the file the cache index is persisted to.
+	indexFile string
+
+	// verifier, if set, verifies the signature of the Wasm modules before they are cached.
+	verifier *ModuleVerifier
+
 	// stopChan currently is only used by test
 	stopChan chan struct{}
 }
@@ -80,18 +99,54 @@ type cacheEntry struct {
 
 	// Last time that this local Wasm module is referenced.
 	last time.Time
+
+	// Size of the Wasm module file.
+	size int64
+
+	// Whether the signature of the module was verified.
+	verified bool
+}
+
+// Options configures the LocalFileCache.
+type Options struct {
+	// Interval and expiry of the stale Wasm module purging.
+	PurgeInterval time.Duration
+	ModuleExpiry  time.Duration
+
+	// MaxCacheSize is the maximum total size of the Wasm module files in bytes. When it is exceeded, the least
+	// recently used modules are evicted. 0 means unbounded.
+	MaxCacheSize int64
+
+	// IndexFile, if set, is the file the cache index is persisted to, so modules downloaded before a restart are
+	// not downloaded again.
+	IndexFile string
+
+	// Verifier, if set, verifies the signature of the Wasm modules before they are handed to Envoy.
+	Verifier *ModuleVerifier
 }
 
 // NewLocalFileCache create a new Wasm module cache which downloads and stores Wasm module files locally.
 func NewLocalFileCache(dir string, purgeInterval, moduleExpiry time.Duration) *LocalFileCache {
+	return NewLocalFileCacheWithOptions(dir, Options{PurgeInterval: purgeInterval, ModuleExpiry: moduleExpiry})
+}
+
+// NewLocalFileCacheWithOptions create a new Wasm module cache which downloads and stores Wasm module files locally.
+func NewLocalFileCacheWithOptions(dir string, opts Options) *LocalFileCache {
 	cache := &LocalFileCache{
 		httpFetcher:      NewHTTPFetcher(),
+		imageFetcher:     NewImageFetcher(nil, false),
 		modules:          make(map[cacheKey]cacheEntry),
 		dir:              dir,
-		purgeInterval:    purgeInterval,
-		wasmModuleExpiry: moduleExpiry,
+		purgeInterval:    opts.PurgeInterval,
+		wasmModuleExpiry: opts.ModuleExpiry,
+		maxCacheSize:     opts.MaxCacheSize,
+		indexFile:        opts.IndexFile,
+		verifier:         opts.Verifier,
 		stopChan:         make(chan struct{}),
 	}
+	if cache.indexFile != "" {
+		cache.loadIndex()
+	}
 	go func() {
 		cache.purge()
 	}()
@@ -99,7 +154,7 @@ func NewLocalFileCache(dir string, purgeInterval, moduleExpiry time.Duration) *L
 }
 
 // Get returns path the local Wasm module file.
-func (c *LocalFileCache) Get(downloadURL, checksum string, timeout time.Duration) (string, error) {
+func (c *LocalFileCache) Get(downloadURL, checksum string, timeout time.Duration, pullSecret []byte) (string, error) {
 	url, err := url.Parse(downloadURL)
 	if err != nil {
 		return "", fmt.Errorf("fail to parse Wasm module fetch url: %s", downloadURL)
@@ -123,34 +178,123 @@ func (c *LocalFileCache) Get(downloadURL, checksum string, timeout time.Duration
 			wasmRemoteFetchCount.With(resultTag.Value(downloadFailure)).Increment()
 			return "", err
 		}
-
-		// Get sha256 checksum and check if it is the same as provided one.
-		dChecksum := fmt.Sprintf("%x", sha256.Sum256(b))
-		if checksum != "" && dChecksum != checksum {
-			wasmRemoteFetchCount.With(resultTag.Value(checksumMismatch)).Increment()
-			return "", fmt.Errorf("module downloaded from %v has checksum %v, which does not match: %v", downloadURL, dChecksum, checksum)
+		dChecksum, err := checkModule(downloadURL, checksum, b)
+		if err != nil {
+			return "", err
+		}
+		if c.verifier != nil {
+			if err := c.verifier.verifyDetached(c.httpFetcher, downloadURL, b, timeout); err != nil {
+				return "", err
+			}
 		}
-
-		wasmRemoteFetchCount.With(resultTag.Value(fetchSuccess)).Increment()
-
-		// TODO(bianpengyuan): Add sanity check on downloaded file to make sure it is a valid Wasm module.
-
 		key.checksum = dChecksum
-		f := filepath.Join(c.dir, fmt.Sprintf("%s.wasm", dChecksum))
-
-		if err := c.addEntry(key, b, f); err != nil {
+		return c.addModule(key, dChecksum, b)
+	case "oci":
+		ref, err := parseImageReference(downloadURL)
+		if err != nil {
 			return "", err
 		}
+		if timeout == 0 {
+			timeout = defaultImageFetchTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		// A digest identifies the module, so images pinned by digest are served from the cache without contacting
+		// the registry. Tags are mutable, so they are resolved to the digest of the image first.
+		tagKey := key
+		digest := ref.digest
+		if digest == "" {
+			digest, err = c.imageFetcher.Resolve(ctx, ref, pullSecret)
+			if err != nil {
+				wasmRemoteFetchCount.With(resultTag.Value(downloadFailure)).Increment()
+				// The registry may be unavailable or the pull secret expired, keep serving the module the tag
+				// resolved to last.
+				if modulePath := c.getEntry(tagKey); modulePath != "" {
+					wasmLog.Warnf("failed to resolve image %s, using the cached module: %v", downloadURL, err)
+					return modulePath, nil
+				}
+				return "", fmt.Errorf("failed to resolve image %s: %v", downloadURL, err)
+			}
+			ref.digest = digest
+		}
+		if checksum == strings.TrimPrefix(digest, "sha256:") {
+			// The checksum is the image digest, which was verified when the manifest was pulled.
+			checksum = ""
+		}
+		key = cacheKey{downloadURL: ref.withDigest(digest)}
+		if modulePath := c.getEntry(key); modulePath != "" {
+			// Cached modules are named by their checksum.
+			if dChecksum := strings.TrimSuffix(filepath.Base(modulePath), ".wasm"); checksum != "" && dChecksum != checksum {
+				wasmRemoteFetchCount.With(resultTag.Value(checksumMismatch)).Increment()
+				return "", fmt.Errorf("module downloaded from %v has checksum %v, which does not match: %v", downloadURL, dChecksum, checksum)
+			}
+			if tagKey.downloadURL != key.downloadURL {
+				c.addAlias(tagKey, key)
+			}
+			return modulePath, nil
+		}
 
-		return f, nil
+		b, err := c.imageFetcher.Fetch(ctx, ref, pullSecret)
+		if err != nil {
+			wasmRemoteFetchCount.With(resultTag.Value(downloadFailure)).Increment()
+			return "", fmt.Errorf("failed to pull image %s: %v", downloadURL, err)
+		}
+		dChecksum, err := checkModule(downloadURL, checksum, b)
+		if err != nil {
+			return "", err
+		}
+		if c.verifier != nil {
+			if err := c.verifier.verifyImage(ctx, c.imageFetcher, ref, pullSecret); err != nil {
+				return "", err
+			}
+		}
+		modulePath, err := c.addModule(key, dChecksum, b)
+		if err != nil {
+			return "", err
+		}
+		if tagKey.downloadURL != key.downloadURL {
+			c.addAlias(tagKey, key)
+		}
+		return modulePath, nil
 	default:
 		return "", fmt.Errorf("unsupported Wasm module downloading URL scheme: %v", url.Scheme)
 	}
 }
 
+// checkModule checks the downloaded module against the provided checksum, and returns its checksum.
+func checkModule(downloadURL, checksum string, b []byte) (string, error) {
+	// Get sha256 checksum and check if it is the same as provided one.
+	dChecksum := fmt.Sprintf("%x", sha256.Sum256(b))
+	if checksum != "" && dChecksum != checksum {
+		wasmRemoteFetchCount.With(resultTag.Value(checksumMismatch)).Increment()
+		return "", fmt.Errorf("module downloaded from %v has checksum %v, which does not match: %v", downloadURL, dChecksum, checksum)
+	}
+
+	wasmRemoteFetchCount.With(resultTag.Value(fetchSuccess)).Increment()
+
+	// TODO(bianpengyuan): Add sanity check on downloaded file to make sure it is a valid Wasm module.
+
+	return dChecksum, nil
+}
+
+// addModule stores the module in a local file named by its checksum, and adds it to the cache.
+func (c *LocalFileCache) addModule(key cacheKey, dChecksum string, b []byte) (string, error) {
+	f := filepath.Join(c.dir, fmt.Sprintf("%s.wasm", dChecksum))
+
+	if err := c.addEntry(key, b, f); err != nil {
+		return "", err
+	}
+
+	return f, nil
+}
+
 // Cleanup closes background Wasm module purge routine.
 func (c *LocalFileCache) Cleanup() {
 	close(c.stopChan)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.saveIndex()
 }
 
 func (c *LocalFileCache) addEntry(key cacheKey, wasmModule []byte, f string) error {
@@ -161,6 +305,7 @@ func (c *LocalFileCache) addEntry(key cacheKey, wasmModule []byte, f string) err
 	if ce, ok := c.modules[key]; ok {
 		// Update last touched time.
 		ce.last = time.Now()
+		c.modules[key] = ce
 		return nil
 	}
 
@@ -172,12 +317,43 @@ func (c *LocalFileCache) addEntry(key cacheKey, wasmModule []byte, f string) err
 	ce := cacheEntry{
 		modulePath: f,
 		last:       time.Now(),
+		size:       int64(len(wasmModule)),
+		verified:   c.verifier != nil,
 	}
 	c.modules[key] = ce
-	wasmCacheEntries.Record(float64(len(c.modules)))
+	wasmCacheModuleSize.With(moduleTag.Value(moduleName(key))).Record(float64(ce.size))
+	c.evict(key)
+	c.recordCacheSize()
+	c.saveIndex()
 	return nil
 }
 
+// addAlias adds an entry for the alias referring to the module of the key, so that the module of an image tag is
+// found when the tag cannot be resolved.
+func (c *LocalFileCache) addAlias(alias, key cacheKey) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	ce, ok := c.modules[key]
+	if !ok {
+		return
+	}
+	if prev, ok := c.modules[alias]; ok {
+		if prev.modulePath == ce.modulePath {
+			prev.last = ce.last
+			c.modules[alias] = prev
+			return
+		}
+		// The tag was moved to another image.
+		if err := c.removeEntry(alias); err != nil {
+			wasmLog.Errorf("failed to remove Wasm module %v: %v", prev.modulePath, err)
+		}
+	}
+	c.modules[alias] = ce
+	wasmCacheModuleSize.With(moduleTag.Value(moduleName(alias))).Record(float64(ce.size))
+	c.recordCacheSize()
+	c.saveIndex()
+}
+
 func (c *LocalFileCache) getEntry(key cacheKey) string {
 	modulePath := ""
 	cacheHit := false
@@ -186,13 +362,82 @@ func (c *LocalFileCache) getEntry(key cacheKey) string {
 	if ce, ok := c.modules[key]; ok {
 		// Update last touched time.
 		ce.last = time.Now()
+		c.modules[key] = ce
 		modulePath = ce.modulePath
 		cacheHit = true
 	}
 	wasmCacheLookupCount.With(hitTag.Value(strconv.FormatBool(cacheHit))).Increment()
+	wasmCacheModuleLookupCount.With(moduleTag.Value(moduleName(key)), hitTag.Value(strconv.FormatBool(cacheHit))).Increment()
 	return modulePath
 }
 
+// evict removes the least recently used modules, except the one of the key, until the total size of the module
+// files is below the maximum cache size. It must be called with the lock held.
+func (c *LocalFileCache) evict(keep cacheKey) {
+	if c.maxCacheSize <= 0 {
+		return
+	}
+	for c.totalSize() > c.maxCacheSize {
+		var lru *cacheKey
+		for k, m := range c.modules {
+			k := k
+			if k == keep || c.modules[keep].modulePath == m.modulePath {
+				continue
+			}
+			if lru == nil || m.last.Before(c.modules[*lru].last) {
+				lru = &k
+			}
+		}
+		if lru == nil {
+			wasmLog.Warnf("Wasm module %v is larger than the maximum cache size %d", c.modules[keep].modulePath, c.maxCacheSize)
+			return
+		}
+		m := c.modules[*lru]
+		if err := c.removeEntry(*lru); err != nil {
+			wasmLog.Errorf("failed to evict Wasm module %v: %v", m.modulePath, err)
+			return
+		}
+		wasmCacheEvictionCount.With(reasonTag.Value(evictionSize)).Increment()
+		wasmLog.Debugf("evicted least recently used Wasm module %v", m.modulePath)
+	}
+}
+
+// removeEntry removes the cache entry, and the module file if no other entry refers to it. It must be called with
+// the lock held.
+func (c *LocalFileCache) removeEntry(key cacheKey) error {
+	m := c.modules[key]
+	for k, o := range c.modules {
+		if k != key && o.modulePath == m.modulePath {
+			delete(c.modules, key)
+			return nil
+		}
+	}
+	if err := os.Remove(m.modulePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(c.modules, key)
+	wasmCacheModuleSize.With(moduleTag.Value(moduleName(key))).Record(0)
+	return nil
+}
+
+// totalSize returns the total size of the module files. It must be called with the lock held.
+func (c *LocalFileCache) totalSize() int64 {
+	files := map[string]int64{}
+	for _, m := range c.modules {
+		files[m.modulePath] = m.size
+	}
+	var total int64
+	for _, size := range files {
+		total += size
+	}
+	return total
+}
+
+func (c *LocalFileCache) recordCacheSize() {
+	wasmCacheEntries.Record(float64(len(c.modules)))
+	wasmCacheSize.Record(float64(c.totalSize()))
+}
+
 // Purge periodically clean up the stale Wasm modules local file and the cache map.
 func (c *LocalFileCache) purge() {
 	ticker := time.NewTicker(c.purgeInterval)
@@ -204,15 +449,17 @@ func (c *LocalFileCache) purge() {
 			for k, m := range c.modules {
 				if m.expired(c.wasmModuleExpiry) {
 					// The module has not be touched for expiry duration, delete it from the map as well as the local dir.
-					if err := os.Remove(m.modulePath); err != nil {
+					if err := c.removeEntry(k); err != nil {
 						wasmLog.Errorf("failed to purge Wasm module %v: %v", m.modulePath, err)
 					} else {
-						delete(c.modules, k)
+						wasmCacheEvictionCount.With(reasonTag.Value(evictionExpiry)).Increment()
 						wasmLog.Debugf("successfully removed stale Wasm module %v", m.modulePath)
 					}
 				}
 			}
-			wasmCacheEntries.Record(float64(len(c.modules)))
+			c.recordCacheSize()
+			// The index is also saved to persist the last touched times.
+			c.saveIndex()
 			c.mux.Unlock()
 		case <-c.stopChan:
 			// Currently this will only happen in test.
@@ -226,3 +473,93 @@ func (ce *cacheEntry) expired(expiry time.Duration) bool {
 	now := time.Now()
 	return now.Sub(ce.last) > expiry
 }
+
+// moduleName returns the name of the module in metrics, its URL without query parameters.
+func moduleName(key cacheKey) string {
+	if i := strings.IndexAny(key.downloadURL, "?#"); i >= 0 {
+		return key.downloadURL[:i]
+	}
+	return key.downloadURL
+}
+
+// indexEntry is a cache entry in the persisted cache index.
+type indexEntry struct {
+	URL      string    `json:"url"`
+	Checksum string    `json:"checksum,omitempty"`
+	File     string    `json:"file"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"lastUsed"`
+	Verified bool      `json:"verified,omitempty"`
+}
+
+// loadIndex restores the cache entries from the index file. Entries whose module file is missing or no longer matches
+// the checksum in its name, or which were not verified when verification is enabled, are dropped.
+func (c *LocalFileCache) loadIndex() {
+	b, err := ioutil.ReadFile(c.indexFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			wasmLog.Warnf("failed to read Wasm module cache index %v: %v", c.indexFile, err)
+		}
+		return
+	}
+	var entries []indexEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		wasmLog.Warnf("invalid Wasm module cache index %v: %v", c.indexFile, err)
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for _, e := range entries {
+		if c.verifier != nil && !e.Verified {
+			continue
+		}
+		f := filepath.Join(c.dir, filepath.Base(e.File))
+		if !moduleFileIntact(f, e.Size) {
+			wasmLog.Warnf("dropping Wasm module %v from cache index: module file %v is missing or was modified", e.URL, f)
+			continue
+		}
+		key := cacheKey{downloadURL: e.URL, checksum: e.Checksum}
+		c.modules[key] = cacheEntry{modulePath: f, last: e.LastUsed, size: e.Size, verified: e.Verified}
+		wasmCacheModuleSize.With(moduleTag.Value(moduleName(key))).Record(float64(e.Size))
+	}
+	wasmLog.Infof("restored %d Wasm modules from cache index %v", len(c.modules), c.indexFile)
+	c.recordCacheSize()
+}
+
+// moduleFileIntact returns true if the module file has the given size, and its sha256 checksum matches the
+// checksum it is named by.
+func moduleFileIntact(f string, size int64) bool {
+	b, err := ioutil.ReadFile(f)
+	if err != nil || int64(len(b)) != size {
+		return false
+	}
+	return fmt.Sprintf("%x.wasm", sha256.Sum256(b)) == filepath.Base(f)
+}
+
+// saveIndex persists the cache entries to the index file. It must be called with the lock held.
+func (c *LocalFileCache) saveIndex() {
+	if c.indexFile == "" {
+		return
+	}
+	entries := make([]indexEntry, 0, len(c.modules))
+	for k, m := range c.modules {
+		entries = append(entries, indexEntry{
+			URL:      k.downloadURL,
+			Checksum: k.checksum,
+			File:     filepath.Base(m.modulePath),
+			Size:     m.size,
+			LastUsed: m.last,
+			Verified: m.verified,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].URL < entries[j].URL || entries[i].URL == entries[j].URL && entries[i].Checksum < entries[j].Checksum
+	})
+	b, err := json.Marshal(entries)
+	if err == nil {
+		err = file.AtomicWrite(c.indexFile, b, 0o644)
+	}
+	if err != nil {
+		wasmLog.Errorf("failed to save Wasm module cache index %v: %v", c.indexFile, err)
+	}
+}
@@ -72,12 +72,12 @@ func TestWasmCache(t *testing.T) {
 		{
 			name:                 "invalid scheme",
 			initialCachedModules: map[cacheKey]cacheEntry{},
-			fetchURL:             "oci://abc",
+			fetchURL:             "ftp://abc",
 			purgeInterval:        DefaultWasmModulePurgeInterval,
 			wasmModuleExpiry:     DefaultWasmModuleExpiry,
 			checksum:             dataCheckSum,
 			wantFileName:         fmt.Sprintf("%x.wasm", dataCheckSum),
-			wantErrorMsgPrefix:   "unsupported Wasm module downloading URL scheme: oci",
+			wantErrorMsgPrefix:   "unsupported Wasm module downloading URL scheme: ftp",
 			wantServerReqNum:     0,
 		},
 		{
@@ -162,7 +162,7 @@ func TestWasmCache(t *testing.T) {
 				}
 			}
 
-			gotFilePath, gotErr := cache.Get(c.fetchURL, fmt.Sprintf("%x", c.checksum), 0)
+			gotFilePath, gotErr := cache.Get(c.fetchURL, fmt.Sprintf("%x", c.checksum), 0, nil)
 			wantFilePath := filepath.Join(tmpDir, c.wantFileName)
 			if c.wantErrorMsgPrefix != "" {
 				if gotErr == nil {
@@ -204,7 +204,7 @@ func TestWasmCacheMissChecksum(t *testing.T) {
 
 	// Get wasm module three times, since checksum is not specified, it will be fetched from module server every time.
 	// 1st time
-	gotFilePath, err := cache.Get(ts.URL, "", 0)
+	gotFilePath, err := cache.Get(ts.URL, "", 0, nil)
 	if err != nil {
 		t.Fatalf("failed to download Wasm module: %v", err)
 	}
@@ -213,7 +213,7 @@ func TestWasmCacheMissChecksum(t *testing.T) {
 	}
 
 	// 2nd time
-	gotFilePath, err = cache.Get(ts.URL, "", 0)
+	gotFilePath, err = cache.Get(ts.URL, "", 0, nil)
 	if err != nil {
 		t.Fatalf("failed to download Wasm module: %v", err)
 	}
@@ -222,7 +222,7 @@ func TestWasmCacheMissChecksum(t *testing.T) {
 	}
 
 	// 3rd time
-	gotFilePath, err = cache.Get(ts.URL, "", 0)
+	gotFilePath, err = cache.Get(ts.URL, "", 0, nil)
 	if err != nil {
 		t.Fatalf("failed to download Wasm module: %v", err)
 	}
@@ -235,3 +235,105 @@ func TestWasmCacheMissChecksum(t *testing.T) {
 		t.Errorf("wasm download call got %v want %v", gotNumRequest, wantNumRequest)
 	}
 }
+
+func TestWasmCachePersistentIndex(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "data"+r.URL.Path)
+	}))
+	defer ts.Close()
+	tmpDir := t.TempDir()
+	opts := Options{
+		PurgeInterval: DefaultWasmModulePurgeInterval,
+		ModuleExpiry:  DefaultWasmModuleExpiry,
+		IndexFile:     filepath.Join(tmpDir, "index.json"),
+	}
+
+	cache := NewLocalFileCacheWithOptions(tmpDir, opts)
+	want, err := cache.Get(ts.URL+"/a", "", 0, nil)
+	if err != nil {
+		t.Fatalf("failed to download Wasm module: %v", err)
+	}
+	cache.Cleanup()
+
+	// The module is not downloaded again after a restart.
+	ts.Close()
+	cache = NewLocalFileCacheWithOptions(tmpDir, opts)
+	got, err := cache.Get(ts.URL+"/a", fmt.Sprintf("%x", sha256.Sum256([]byte("data/a\n"))), 0, nil)
+	if err != nil {
+		t.Fatalf("failed to get Wasm module from the restored cache: %v", err)
+	}
+	if got != want {
+		t.Errorf("Wasm module path got %v, want %v", got, want)
+	}
+	cache.Cleanup()
+
+	// Modules which were not verified are not restored when verification is enabled.
+	opts.Verifier = &ModuleVerifier{}
+	verifyingCache := NewLocalFileCacheWithOptions(tmpDir, opts)
+	defer close(verifyingCache.stopChan)
+	if n := len(verifyingCache.modules); n != 0 {
+		t.Errorf("expecting no module restored without verification, got %d", n)
+	}
+
+	// Modules whose file was modified on disk are not restored, even if the size did not change.
+	if err := ioutil.WriteFile(want, []byte("evil/a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts.Verifier = nil
+	cache = NewLocalFileCacheWithOptions(tmpDir, opts)
+	if n := len(cache.modules); n != 0 {
+		t.Errorf("expecting no module restored after the module file was modified, got %d", n)
+	}
+	cache.Cleanup()
+}
+
+func TestWasmCacheMaxSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every module is 10 bytes.
+		fmt.Fprintf(w, "%-10s", r.URL.Path)
+	}))
+	defer ts.Close()
+	tmpDir := t.TempDir()
+	cache := NewLocalFileCacheWithOptions(tmpDir, Options{
+		PurgeInterval: DefaultWasmModulePurgeInterval,
+		ModuleExpiry:  DefaultWasmModuleExpiry,
+		MaxCacheSize:  25,
+	})
+	defer close(cache.stopChan)
+
+	get := func(p string) string {
+		t.Helper()
+		f, err := cache.Get(ts.URL+p, "", 0, nil)
+		if err != nil {
+			t.Fatalf("failed to download Wasm module: %v", err)
+		}
+		return f
+	}
+	a := get("/a")
+	b := get("/b")
+	// Touch a, so b is the least recently used module.
+	cache.mux.Lock()
+	for k, m := range cache.modules {
+		if m.modulePath == a {
+			m.last = time.Now().Add(time.Second)
+			cache.modules[k] = m
+		}
+	}
+	cache.mux.Unlock()
+	c := get("/c")
+
+	files, err := ioutil.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, f := range files {
+		got[filepath.Join(tmpDir, f.Name())] = true
+	}
+	if !got[a] || got[b] || !got[c] || len(got) != 2 {
+		t.Errorf("expecting modules %v and %v to be kept, got %v", a, c, got)
+	}
+	if size := cache.totalSize(); size != 20 {
+		t.Errorf("cache size got %d, want 20", size)
+	}
+}
@@ -33,6 +33,11 @@ const (
 	apiTypePrefix      = "type.googleapis.com/"
 	typedStructType    = apiTypePrefix + "udpa.type.v1.TypedStruct"
 	wasmHTTPFilterType = apiTypePrefix + "envoy.extensions.filters.http.wasm.v3.Wasm"
+
+	// WasmSecretEnv is the Wasm VM environment variable holding the image pull secret, in the format of a
+	// kubernetes.io/dockerconfigjson secret, used to pull `oci://` modules. It is removed from the VM config before
+	// the config is sent to Envoy.
+	WasmSecretEnv = "ISTIO_META_WASM_IMAGE_PULL_SECRET"
 )
 
 // MaybeConvertWasmExtensionConfig converts any presence of module remote download to local file.
@@ -145,6 +150,24 @@ func convert(resource *any.Any, cache Cache) (newExtensionConfig *any.Any, sendN
 	status = conversionSuccess
 
 	vm := wasmHTTPFilterConfig.Config.GetVmConfig()
+	var pullSecret []byte
+	if envs := vm.GetEnvironmentVariables(); envs != nil {
+		if secret, f := envs.KeyValues[WasmSecretEnv]; f {
+			pullSecret = []byte(secret)
+			delete(envs.KeyValues, WasmSecretEnv)
+			// The pull secret must never reach Envoy, so the config forwarded on a fail open
+			// failure is the original one without the secret.
+			stripped, err := marshalExtensionConfig(ec, wasmHTTPFilterConfig)
+			if err != nil {
+				status = marshalFailure
+				wasmLog.Errorf("failed to marshal extension config resource without pull secret: %v", err)
+				sendNack = true
+				return
+			}
+			newExtensionConfig = stripped
+		}
+	}
+
 	remote := vm.GetCode().GetRemote()
 	httpURI := remote.GetHttpUri()
 	if httpURI == nil {
@@ -156,7 +179,7 @@ func convert(resource *any.Any, cache Cache) (newExtensionConfig *any.Any, sendN
 	if remote.GetHttpUri().Timeout != nil {
 		timeout = remote.GetHttpUri().Timeout.AsDuration()
 	}
-	f, err := cache.Get(httpURI.GetUri(), remote.GetSha256(), timeout)
+	f, err := cache.Get(httpURI.GetUri(), remote.GetSha256(), timeout, pullSecret)
 	if err != nil {
 		status = fetchFailure
 		wasmLog.Errorf("cannot fetch Wasm module %v: %v", remote.GetHttpUri().GetUri(), err)
@@ -174,21 +197,13 @@ func convert(resource *any.Any, cache Cache) (newExtensionConfig *any.Any, sendN
 		},
 	}
 
-	wasmTypedConfig, err = anypb.New(wasmHTTPFilterConfig)
-	if err != nil {
-		status = marshalFailure
-		wasmLog.Errorf("failed to marshal new wasm HTTP filter %+v to protobuf Any: %v", wasmHTTPFilterConfig, err)
-		return
-	}
-	ec.TypedConfig = wasmTypedConfig
-	wasmLog.Debugf("new extension config resource %+v", ec)
-
-	nec, err := anypb.New(ec)
+	nec, err := marshalExtensionConfig(ec, wasmHTTPFilterConfig)
 	if err != nil {
 		status = marshalFailure
 		wasmLog.Errorf("failed to marshal new extension config resource: %v", err)
 		return
 	}
+	wasmLog.Debugf("new extension config resource %+v", ec)
 
 	// At this point, we are certain that wasm module has been downloaded and config is rewritten.
 	// ECDS has been rewritten successfully and should not nack.
@@ -196,3 +211,13 @@ func convert(resource *any.Any, cache Cache) (newExtensionConfig *any.Any, sendN
 	sendNack = false
 	return
 }
+
+// marshalExtensionConfig sets the Wasm HTTP filter as the typed config of the extension config and marshals it.
+func marshalExtensionConfig(ec *core.TypedExtensionConfig, wasmHTTPFilterConfig *wasm.Wasm) (*any.Any, error) {
+	wasmTypedConfig, err := anypb.New(wasmHTTPFilterConfig)
+	if err != nil {
+		return nil, err
+	}
+	ec.TypedConfig = wasmTypedConfig
+	return anypb.New(ec)
+}
@@ -34,7 +34,7 @@ import (
 
 type mockCache struct{}
 
-func (c *mockCache) Get(downloadURL, checksum string, timeout time.Duration) (string, error) {
+func (c *mockCache) Get(downloadURL, checksum string, timeout time.Duration, pullSecret []byte) (string, error) {
 	url, _ := url.Parse(downloadURL)
 	query := url.Query()
 
@@ -44,6 +44,9 @@ func (c *mockCache) Get(downloadURL, checksum string, timeout time.Duration) (st
 	if errMsg != "" {
 		err = errors.New(errMsg)
 	}
+	if secret := query.Get("secret"); secret != string(pullSecret) {
+		err = errors.New("unexpected pull secret " + string(pullSecret))
+	}
 
 	return module, err
 }
@@ -98,6 +101,26 @@ func TestWasmConvert(t *testing.T) {
 			},
 			wantNack: false,
 		},
+		{
+			name: "remote load with pull secret",
+			input: []*core.TypedExtensionConfig{
+				extensionConfigMap["remote-load-secret"],
+			},
+			wantOutput: []*core.TypedExtensionConfig{
+				extensionConfigMap["remote-load-secret-local-file"],
+			},
+			wantNack: false,
+		},
+		{
+			name: "remote load fail open with pull secret",
+			input: []*core.TypedExtensionConfig{
+				extensionConfigMap["remote-load-secret-fail-open"],
+			},
+			wantOutput: []*core.TypedExtensionConfig{
+				extensionConfigMap["remote-load-secret-fail-open-stripped"],
+			},
+			wantNack: false,
+		},
 		{
 			name: "no typed struct",
 			input: []*core.TypedExtensionConfig{
@@ -257,6 +280,42 @@ var extensionConfigMap = map[string]*core.TypedExtensionConfig{
 			},
 		},
 	}),
+	"remote-load-secret": buildTypedStructExtensionConfig("remote-load-secret", &wasm.Wasm{
+		Config: &v3.PluginConfig{
+			Vm: &v3.PluginConfig_VmConfig{
+				VmConfig: &v3.VmConfig{
+					Code: &core.AsyncDataSource{Specifier: &core.AsyncDataSource_Remote{
+						Remote: &core.RemoteDataSource{
+							HttpUri: &core.HttpUri{
+								Uri: "oci://test?module=test.wasm&secret=test-secret",
+							},
+						},
+					}},
+					EnvironmentVariables: &v3.EnvironmentVariables{
+						KeyValues: map[string]string{WasmSecretEnv: "test-secret", "FOO": "bar"},
+					},
+				},
+			},
+		},
+	}),
+	"remote-load-secret-local-file": buildWasmExtensionConfig("remote-load-secret", &wasm.Wasm{
+		Config: &v3.PluginConfig{
+			Vm: &v3.PluginConfig_VmConfig{
+				VmConfig: &v3.VmConfig{
+					Code: &core.AsyncDataSource{Specifier: &core.AsyncDataSource_Local{
+						Local: &core.DataSource{
+							Specifier: &core.DataSource_Filename{
+								Filename: "test.wasm",
+							},
+						},
+					}},
+					EnvironmentVariables: &v3.EnvironmentVariables{
+						KeyValues: map[string]string{"FOO": "bar"},
+					},
+				},
+			},
+		},
+	}),
 	"remote-load-fail": buildTypedStructExtensionConfig("remote-load-fail", &wasm.Wasm{
 		Config: &v3.PluginConfig{
 			Vm: &v3.PluginConfig_VmConfig{
@@ -288,4 +347,42 @@ var extensionConfigMap = map[string]*core.TypedExtensionConfig{
 			FailOpen: true,
 		},
 	}),
+	"remote-load-secret-fail-open": buildTypedStructExtensionConfig("remote-load-secret-fail-open", &wasm.Wasm{
+		Config: &v3.PluginConfig{
+			Vm: &v3.PluginConfig_VmConfig{
+				VmConfig: &v3.VmConfig{
+					Code: &core.AsyncDataSource{Specifier: &core.AsyncDataSource_Remote{
+						Remote: &core.RemoteDataSource{
+							HttpUri: &core.HttpUri{
+								Uri: "oci://test?module=test.wasm&secret=test-secret&error=download-error",
+							},
+						},
+					}},
+					EnvironmentVariables: &v3.EnvironmentVariables{
+						KeyValues: map[string]string{WasmSecretEnv: "test-secret", "FOO": "bar"},
+					},
+				},
+			},
+			FailOpen: true,
+		},
+	}),
+	"remote-load-secret-fail-open-stripped": buildWasmExtensionConfig("remote-load-secret-fail-open", &wasm.Wasm{
+		Config: &v3.PluginConfig{
+			Vm: &v3.PluginConfig_VmConfig{
+				VmConfig: &v3.VmConfig{
+					Code: &core.AsyncDataSource{Specifier: &core.AsyncDataSource_Remote{
+						Remote: &core.RemoteDataSource{
+							HttpUri: &core.HttpUri{
+								Uri: "oci://test?module=test.wasm&secret=test-secret&error=download-error",
+							},
+						},
+					}},
+					EnvironmentVariables: &v3.EnvironmentVariables{
+						KeyValues: map[string]string{"FOO": "bar"},
+					},
+				},
+			},
+			FailOpen: true,
+		},
+	}),
 }
@@ -0,0 +1,553 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// Media types of the manifests.
+	ociManifestMediaType    = "application/vnd.oci.image.manifest.v1+json"
+	ociIndexMediaType       = "application/vnd.oci.image.index.v1+json"
+	dockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerListMediaType     = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// Media types of the Wasm artifact image layout.
+	// https://github.com/solo-io/wasm/blob/master/spec/spec.md
+	wasmConfigMediaType = "application/vnd.module.wasm.config.v1+json"
+	wasmLayerMediaType  = "application/vnd.module.wasm.content.layer.v1+wasm"
+
+	// compatWasmFile is the Wasm module file in the single layer of a "compat" image.
+	// https://github.com/solo-io/wasm/blob/master/spec/spec-compat.md
+	compatWasmFile = "plugin.wasm"
+
+	// cosignSignatureAnnotation is the annotation of the layers of a cosign signature image, holding the base64
+	// encoded signature of the layer.
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	dockerHubRegistry     = "registry-1.docker.io"
+	dockerHubAuthRegistry = "index.docker.io"
+
+	// Maximum size of the manifests and the Wasm modules read from the registries.
+	maxManifestSize = 4 << 20
+	maxModuleSize   = 256 << 20
+
+	defaultImageFetchTimeout = 30 * time.Second
+)
+
+var manifestMediaTypes = strings.Join([]string{
+	ociManifestMediaType, dockerManifestMediaType, ociIndexMediaType, dockerListMediaType,
+}, ", ")
+
+// ImageFetcher fetches Wasm modules from OCI and Docker registries.
+type ImageFetcher struct {
+	client *http.Client
+	// insecure registries are reached over plain HTTP.
+	insecure bool
+}
+
+// NewImageFetcher creates a new Wasm module fetcher for OCI and Docker registries. Registries are reached over
+// HTTPS with the client, or over plain HTTP if insecure is set.
+func NewImageFetcher(client *http.Client, insecure bool) *ImageFetcher {
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &ImageFetcher{client: client, insecure: insecure}
+}
+
+// imageReference is a reference to an image in a registry.
+type imageReference struct {
+	registry   string
+	repository string
+	tag        string
+	digest     string
+}
+
+// parseImageReference parses an `oci://` URL, for example oci://registry.example.com/filters/stats:v1 or
+// oci://registry.example.com/filters/stats@sha256:<digest>. Images without registry are pulled from Docker Hub.
+func parseImageReference(s string) (*imageReference, error) {
+	name := strings.TrimPrefix(s, "oci://")
+	if name == s || name == "" {
+		return nil, fmt.Errorf("invalid image reference %q", s)
+	}
+	ref := &imageReference{}
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.digest = name[:i], name[i+1:]
+		if !strings.HasPrefix(ref.digest, "sha256:") || len(ref.digest) != len("sha256:")+64 {
+			return nil, fmt.Errorf("invalid image digest %q", ref.digest)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.tag = name[:i], name[i+1:]
+	}
+	if ref.tag == "" && ref.digest == "" {
+		ref.tag = "latest"
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.registry, ref.repository = parts[0], parts[1]
+	} else {
+		ref.registry, ref.repository = dockerHubRegistry, name
+		if len(parts) == 1 {
+			ref.repository = "library/" + name
+		}
+	}
+	if ref.repository == "" || strings.HasSuffix(ref.repository, "/") {
+		return nil, fmt.Errorf("invalid image reference %q", s)
+	}
+	return ref, nil
+}
+
+// reference returns the tag or the digest of the image, the digest if both are set.
+func (r *imageReference) reference() string {
+	if r.digest != "" {
+		return r.digest
+	}
+	return r.tag
+}
+
+// withDigest returns the `oci://` URL of the image with the digest.
+func (r *imageReference) withDigest(digest string) string {
+	return fmt.Sprintf("oci://%s/%s@%s", r.registry, r.repository, digest)
+}
+
+// Resolve returns the digest of the image manifest, resolving the tag if the image is not referenced by digest.
+func (f *ImageFetcher) Resolve(ctx context.Context, ref *imageReference, pullSecret []byte) (string, error) {
+	if ref.digest != "" {
+		return ref.digest, nil
+	}
+	s, err := f.newSession(ref, pullSecret)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.do(ctx, http.MethodHead, "manifests/"+ref.tag, manifestMediaTypes)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	// Registries are not required to return the digest, hash the manifest instead.
+	_, digest, err := s.getManifest(ctx, ref.tag)
+	return digest, err
+}
+
+// Fetch pulls the image and returns the Wasm module in it. Both the Wasm artifact image layout and the "compat"
+// image layout are supported.
+func (f *ImageFetcher) Fetch(ctx context.Context, ref *imageReference, pullSecret []byte) ([]byte, error) {
+	s, err := f.newSession(ref, pullSecret)
+	if err != nil {
+		return nil, err
+	}
+	m, _, err := s.getManifest(ctx, ref.reference())
+	if err != nil {
+		return nil, err
+	}
+	if m.Config.MediaType == wasmConfigMediaType {
+		for _, l := range m.Layers {
+			if l.MediaType == wasmLayerMediaType {
+				return s.getBlob(ctx, l.Digest)
+			}
+		}
+		return nil, fmt.Errorf("no layer of type %s in Wasm image", wasmLayerMediaType)
+	}
+	// The Wasm module of a "compat" image is in a file system layer, look for it from the top layer.
+	for i := len(m.Layers) - 1; i >= 0; i-- {
+		b, err := s.getBlob(ctx, m.Layers[i].Digest)
+		if err != nil {
+			return nil, err
+		}
+		module, err := extractCompatModule(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid layer %s: %v", m.Layers[i].Digest, err)
+		}
+		if module != nil {
+			return module, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s file found in image", compatWasmFile)
+}
+
+// cosignSignature is a cosign signature of an image: the signed simple signing payload, and its signature.
+type cosignSignature struct {
+	payload   []byte
+	signature []byte
+}
+
+// cosignSignatures returns the cosign signatures of the image, which must be referenced by digest. They are stored
+// in the same repository, in an image tagged with the image digest.
+// https://github.com/sigstore/cosign/blob/main/specs/SIGNATURE_SPEC.md
+func (f *ImageFetcher) cosignSignatures(ctx context.Context, ref *imageReference, pullSecret []byte) ([]cosignSignature, error) {
+	s, err := f.newSession(ref, pullSecret)
+	if err != nil {
+		return nil, err
+	}
+	m, _, err := s.getManifest(ctx, strings.Replace(ref.digest, ":", "-", 1)+".sig")
+	if err != nil {
+		return nil, err
+	}
+	var sigs []cosignSignature
+	for _, l := range m.Layers {
+		encoded, f := l.Annotations[cosignSignatureAnnotation]
+		if !f {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature in layer %s: %v", l.Digest, err)
+		}
+		payload, err := s.getBlob(ctx, l.Digest)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, cosignSignature{payload: payload, signature: sig})
+	}
+	return sigs, nil
+}
+
+// extractCompatModule returns the Wasm module file in the tar, or gzipped tar, layer. Returns nil if not found.
+func extractCompatModule(layer []byte) ([]byte, error) {
+	var r io.Reader = bytes.NewReader(layer)
+	if len(layer) > 2 && layer[0] == 0x1f && layer[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag == tar.TypeReg && path.Clean("/"+h.Name) == "/"+compatWasmFile {
+			return readLimited(tr, maxModuleSize)
+		}
+	}
+}
+
+// manifest is an OCI image manifest, a Docker image manifest, or an index of manifests.
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Config    descriptor   `json:"config"`
+	Layers    []descriptor `json:"layers"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// registrySession sends the requests for an image to its registry, and keeps the authorization obtained.
+type registrySession struct {
+	fetcher       *ImageFetcher
+	ref           *imageReference
+	baseURL       string
+	username      string
+	password      string
+	authorization string
+}
+
+func (f *ImageFetcher) newSession(ref *imageReference, pullSecret []byte) (*registrySession, error) {
+	scheme := "https"
+	if f.insecure {
+		scheme = "http"
+	}
+	s := &registrySession{
+		fetcher: f,
+		ref:     ref,
+		baseURL: fmt.Sprintf("%s://%s/v2/%s/", scheme, ref.registry, ref.repository),
+	}
+	if len(pullSecret) != 0 {
+		var err error
+		if s.username, s.password, err = registryCredentials(pullSecret, ref.registry); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// getManifest returns the image manifest for the reference and its digest. If the reference is an index, the
+// first manifest in it is returned, Wasm modules are platform independent.
+func (s *registrySession) getManifest(ctx context.Context, reference string) (*manifest, string, error) {
+	for i := 0; i < 2; i++ {
+		resp, err := s.do(ctx, http.MethodGet, "manifests/"+reference, manifestMediaTypes)
+		if err != nil {
+			return nil, "", err
+		}
+		b, err := readLimited(resp.Body, maxManifestSize)
+		resp.Body.Close()
+		if err != nil {
+			return nil, "", err
+		}
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+		if strings.HasPrefix(reference, "sha256:") && digest != reference {
+			return nil, "", fmt.Errorf("manifest has digest %s, which does not match %s", digest, reference)
+		}
+		m := &manifest{}
+		if err := json.Unmarshal(b, m); err != nil {
+			return nil, "", fmt.Errorf("invalid manifest: %v", err)
+		}
+		if m.MediaType == "" {
+			m.MediaType = resp.Header.Get("Content-Type")
+		}
+		if m.MediaType != ociIndexMediaType && m.MediaType != dockerListMediaType {
+			return m, digest, nil
+		}
+		if len(m.Manifests) == 0 {
+			return nil, "", errors.New("empty manifest index")
+		}
+		reference = m.Manifests[0].Digest
+	}
+	return nil, "", errors.New("nested manifest index")
+}
+
+// getBlob returns the blob with the digest.
+func (s *registrySession) getBlob(ctx context.Context, digest string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, "blobs/"+digest, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := readLimited(resp.Body, maxModuleSize)
+	if err != nil {
+		return nil, err
+	}
+	if got := fmt.Sprintf("sha256:%x", sha256.Sum256(b)); got != digest {
+		return nil, fmt.Errorf("blob has digest %s, which does not match %s", got, digest)
+	}
+	return b, nil
+}
+
+// do sends the request to the registry, authorizing it on an authentication challenge. Non 200 responses are
+// returned as errors.
+func (s *registrySession) do(ctx context.Context, method, p, accept string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, s.baseURL+p, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if s.authorization != "" {
+			req.Header.Set("Authorization", s.authorization)
+		}
+		resp, err := s.fetcher.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		body, _ := readLimited(resp.Body, 4096)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			if err := s.authorize(ctx, resp.Header.Get("WWW-Authenticate")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return nil, fmt.Errorf("%s %s failed: status code %d %s", method, req.URL, resp.StatusCode,
+			strings.TrimSpace(string(body)))
+	}
+}
+
+// authorize sets the authorization for the authentication challenge of the registry.
+// https://docs.docker.com/registry/spec/auth/token/
+func (s *registrySession) authorize(ctx context.Context, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if s.username == "" && s.password == "" {
+			return fmt.Errorf("registry %s requires credentials", s.ref.registry)
+		}
+		s.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(s.username+":"+s.password))
+		return nil
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || params["realm"] == "" {
+			return fmt.Errorf("invalid authentication realm %q", params["realm"])
+		}
+		query := realm.Query()
+		if params["service"] != "" {
+			query.Set("service", params["service"])
+		}
+		query.Set("scope", fmt.Sprintf("repository:%s:pull", s.ref.repository))
+		realm.RawQuery = query.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+		if err != nil {
+			return err
+		}
+		if s.username != "" || s.password != "" {
+			req.SetBasicAuth(s.username, s.password)
+		}
+		resp, err := s.fetcher.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		b, err := readLimited(resp.Body, maxManifestSize)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to get registry token: status code %d %s", resp.StatusCode,
+				strings.TrimSpace(string(b)))
+		}
+		token := struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}{}
+		if err := json.Unmarshal(b, &token); err != nil {
+			return fmt.Errorf("invalid registry token response: %v", err)
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		if token.Token == "" {
+			return errors.New("no token in registry token response")
+		}
+		s.authorization = "Bearer " + token.Token
+		return nil
+	default:
+		return fmt.Errorf("unsupported registry authentication challenge %q", challenge)
+	}
+}
+
+// parseChallenge parses a WWW-Authenticate header, for example:
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return parts[0], params
+}
+
+// dockerConfig is the content of a pull secret, either of type kubernetes.io/dockerconfigjson or
+// kubernetes.io/dockercfg.
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+type dockerAuth struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// registryCredentials returns the credentials of the registry in the pull secret.
+func registryCredentials(pullSecret []byte, registry string) (string, string, error) {
+	config := dockerConfig{}
+	if err := json.Unmarshal(pullSecret, &config); err != nil {
+		return "", "", fmt.Errorf("invalid image pull secret: %v", err)
+	}
+	if config.Auths == nil {
+		// The legacy format has no "auths" key.
+		if err := json.Unmarshal(pullSecret, &config.Auths); err != nil {
+			return "", "", fmt.Errorf("invalid image pull secret: %v", err)
+		}
+	}
+	for server, auth := range config.Auths {
+		if normalizeRegistry(server) != normalizeRegistry(registry) {
+			continue
+		}
+		if auth.Auth == "" {
+			return auth.Username, auth.Password, nil
+		}
+		b, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid auth of registry %s in image pull secret: %v", server, err)
+		}
+		parts := strings.SplitN(string(b), ":", 2)
+		if len(parts) != 2 {
+			return "", "", fmt.Errorf("invalid auth of registry %s in image pull secret", server)
+		}
+		return parts[0], parts[1], nil
+	}
+	return "", "", nil
+}
+
+// normalizeRegistry returns the host of a registry in a pull secret, such as https://index.docker.io/v1/.
+func normalizeRegistry(registry string) string {
+	registry = strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	registry = strings.SplitN(registry, "/", 2)[0]
+	switch registry {
+	case dockerHubRegistry, "docker.io":
+		return dockerHubAuthRegistry
+	}
+	return registry
+}
+
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("content exceeds %d bytes", limit)
+	}
+	return b, nil
+}
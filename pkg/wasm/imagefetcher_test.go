@@ -0,0 +1,462 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRegistry is an in-process registry serving images with the registry token authentication.
+type fakeRegistry struct {
+	*httptest.Server
+
+	username, password string
+
+	mutex     sync.Mutex
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	requests  []string
+}
+
+func newFakeRegistry(t *testing.T, username, password string) *fakeRegistry {
+	t.Helper()
+	r := &fakeRegistry{
+		username:  username,
+		password:  password,
+		manifests: map[string][]byte{},
+		blobs:     map[string][]byte{},
+	}
+	r.Server = httptest.NewTLSServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// host returns the registry host used in image references.
+func (r *fakeRegistry) host() string {
+	return strings.TrimPrefix(r.URL, "https://")
+}
+
+func (r *fakeRegistry) addBlob(b []byte) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+	r.blobs[digest] = b
+	return digest
+}
+
+// addManifest adds the manifest to the repository, with the tag if set, and returns its digest.
+func (r *fakeRegistry) addManifest(repo, tag string, m interface{}) string {
+	b, _ := json.Marshal(m)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+	r.manifests[repo+"@"+digest] = b
+	if tag != "" {
+		r.manifests[repo+":"+tag] = b
+	}
+	return digest
+}
+
+// addWasmImage adds an image with the Wasm artifact layout.
+func (r *fakeRegistry) addWasmImage(repo, tag string, module []byte) string {
+	return r.addManifest(repo, tag, manifest{
+		MediaType: ociManifestMediaType,
+		Config:    descriptor{MediaType: wasmConfigMediaType, Digest: r.addBlob([]byte("{}"))},
+		Layers:    []descriptor{{MediaType: wasmLayerMediaType, Digest: r.addBlob(module)}},
+	})
+}
+
+// addCompatImage adds an image with the "compat" layout, the module is in a gzipped tar layer.
+func (r *fakeRegistry) addCompatImage(t *testing.T, repo, tag string, module []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: compatWasmFile, Mode: 0o644, Size: int64(len(module)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(module); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return r.addManifest(repo, tag, manifest{
+		MediaType: dockerManifestMediaType,
+		Config:    descriptor{MediaType: "application/vnd.docker.container.image.v1+json", Digest: r.addBlob([]byte("{}"))},
+		Layers:    []descriptor{{MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", Digest: r.addBlob(buf.Bytes())}},
+	})
+}
+
+func (r *fakeRegistry) numRequests(prefix string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	n := 0
+	for _, req := range r.requests {
+		if strings.HasPrefix(req, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+
+	if req.URL.Path == "/token" {
+		if u, p, _ := req.BasicAuth(); u != r.username || p != r.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "token-for-" + req.URL.Query().Get("scope")})
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	var repo, kind, ref string
+	for _, k := range []string{"/manifests/", "/blobs/"} {
+		if i := strings.LastIndex(path, k); i >= 0 {
+			repo, kind, ref = path[:i], strings.Trim(k, "/"), path[i+len(k):]
+		}
+	}
+	if repo == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer token-for-repository:"+repo+":pull" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake-registry"`, r.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var b []byte
+	if kind == "blobs" {
+		b = r.blobs[ref]
+	} else if strings.HasPrefix(ref, "sha256:") {
+		b = r.manifests[repo+"@"+ref]
+	} else {
+		b = r.manifests[repo+":"+ref]
+	}
+	if b == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if kind == "manifests" {
+		w.Header().Set("Docker-Content-Digest", fmt.Sprintf("sha256:%x", sha256.Sum256(b)))
+	}
+	if req.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(b)
+}
+
+func pullSecret(registry, username, password string) []byte {
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return []byte(fmt.Sprintf(`{"auths":{"https://%s":{"auth":"%s"}}}`, registry, auth))
+}
+
+func TestParseImageReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	cases := []struct {
+		ref     string
+		want    imageReference
+		wantErr bool
+	}{
+		{ref: "oci://registry.example.com/filters/stats:v1", want: imageReference{"registry.example.com", "filters/stats", "v1", ""}},
+		{ref: "oci://localhost:5000/stats", want: imageReference{"localhost:5000", "stats", "latest", ""}},
+		{ref: "oci://registry.example.com/stats@" + digest, want: imageReference{"registry.example.com", "stats", "", digest}},
+		{ref: "oci://stats", want: imageReference{dockerHubRegistry, "library/stats", "latest", ""}},
+		{ref: "oci://istio/stats:1.0", want: imageReference{dockerHubRegistry, "istio/stats", "1.0", ""}},
+		{ref: "oci://registry.example.com/stats@sha256:abc", wantErr: true},
+		{ref: "oci://", wantErr: true},
+		{ref: "https://registry.example.com/stats", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := parseImageReference(c.ref)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseImageReference(%q) got %+v, want error", c.ref, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseImageReference(%q) got unexpected error: %v", c.ref, err)
+			continue
+		}
+		if *got != c.want {
+			t.Errorf("parseImageReference(%q) got %+v, want %+v", c.ref, *got, c.want)
+		}
+	}
+}
+
+func TestImageFetcher(t *testing.T) {
+	registry := newFakeRegistry(t, "user", "pass")
+	module := []byte("\x00asm\x01\x00\x00\x00wasm-artifact")
+	compatModule := []byte("\x00asm\x01\x00\x00\x00compat")
+	wasmDigest := registry.addWasmImage("filters/artifact", "v1", module)
+	registry.addCompatImage(t, "filters/compat", "v1", compatModule)
+	compatDigest := registry.addCompatImage(t, "filters/compat", "", compatModule)
+	registry.addManifest("filters/index", "v1", manifest{
+		MediaType: ociIndexMediaType,
+		Manifests: []descriptor{{MediaType: ociManifestMediaType, Digest: registry.addWasmImage("filters/index", "", module)}},
+	})
+	secret := pullSecret(registry.host(), "user", "pass")
+	fetcher := NewImageFetcher(registry.Client(), false)
+
+	cases := []struct {
+		name       string
+		url        string
+		pullSecret []byte
+		wantDigest string
+		wantModule []byte
+		wantErr    string
+	}{
+		{
+			name:       "wasm artifact by tag",
+			url:        "oci://" + registry.host() + "/filters/artifact:v1",
+			pullSecret: secret,
+			wantDigest: wasmDigest,
+			wantModule: module,
+		},
+		{
+			name:       "wasm artifact by digest",
+			url:        "oci://" + registry.host() + "/filters/artifact@" + wasmDigest,
+			pullSecret: secret,
+			wantDigest: wasmDigest,
+			wantModule: module,
+		},
+		{
+			name:       "compat image",
+			url:        "oci://" + registry.host() + "/filters/compat:v1",
+			pullSecret: secret,
+			wantDigest: compatDigest,
+			wantModule: compatModule,
+		},
+		{
+			name:       "image index",
+			url:        "oci://" + registry.host() + "/filters/index:v1",
+			pullSecret: secret,
+			wantModule: module,
+		},
+		{
+			name:    "missing credentials",
+			url:     "oci://" + registry.host() + "/filters/artifact:v1",
+			wantErr: "failed to get registry token: status code 401",
+		},
+		{
+			name:       "wrong credentials",
+			url:        "oci://" + registry.host() + "/filters/artifact:v1",
+			pullSecret: pullSecret(registry.host(), "user", "wrong"),
+			wantErr:    "failed to get registry token: status code 401",
+		},
+		{
+			name:       "unknown tag",
+			url:        "oci://" + registry.host() + "/filters/artifact:v2",
+			pullSecret: secret,
+			wantErr:    "status code 404",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ref, err := parseImageReference(c.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			digest, err := fetcher.Resolve(ctx, ref, c.pullSecret)
+			var got []byte
+			if err == nil {
+				ref.digest = digest
+				got, err = fetcher.Fetch(ctx, ref, c.pullSecret)
+			}
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Errorf("got error %v, want error containing %q", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+			if c.wantDigest != "" && digest != c.wantDigest {
+				t.Errorf("resolved digest got %v, want %v", digest, c.wantDigest)
+			}
+			if !bytes.Equal(got, c.wantModule) {
+				t.Errorf("fetched module got %q, want %q", got, c.wantModule)
+			}
+		})
+	}
+}
+
+func TestRegistryCredentials(t *testing.T) {
+	cases := []struct {
+		name         string
+		secret       string
+		registry     string
+		wantUser     string
+		wantPassword string
+		wantErr      bool
+	}{
+		{
+			name:         "dockerconfigjson auth",
+			secret:       `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`,
+			registry:     "registry.example.com",
+			wantUser:     "user",
+			wantPassword: "pass",
+		},
+		{
+			name:         "dockercfg username and password",
+			secret:       `{"https://registry.example.com/v2/":{"username":"user","password":"pass"}}`,
+			registry:     "registry.example.com",
+			wantUser:     "user",
+			wantPassword: "pass",
+		},
+		{
+			name:         "docker hub",
+			secret:       `{"auths":{"https://index.docker.io/v1/":{"auth":"dXNlcjpwYXNz"}}}`,
+			registry:     dockerHubRegistry,
+			wantUser:     "user",
+			wantPassword: "pass",
+		},
+		{
+			name:     "other registry",
+			secret:   `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`,
+			registry: "other.example.com",
+		},
+		{
+			name:     "invalid secret",
+			secret:   `{"auths":`,
+			registry: "registry.example.com",
+			wantErr:  true,
+		},
+	}
+	for _, c := range cases {
+		user, password, err := registryCredentials([]byte(c.secret), c.registry)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: got error %v, want error %v", c.name, err, c.wantErr)
+		}
+		if user != c.wantUser || password != c.wantPassword {
+			t.Errorf("%s: got credentials %s:%s, want %s:%s", c.name, user, password, c.wantUser, c.wantPassword)
+		}
+	}
+}
+
+func TestWasmCacheImage(t *testing.T) {
+	registry := newFakeRegistry(t, "user", "pass")
+	secret := pullSecret(registry.host(), "user", "pass")
+	tmpDir := t.TempDir()
+	cache := NewLocalFileCache(tmpDir, DefaultWasmModulePurgeInterval, DefaultWasmModuleExpiry)
+	defer close(cache.stopChan)
+	cache.imageFetcher = NewImageFetcher(registry.Client(), false)
+
+	module1 := []byte("\x00asm\x01\x00\x00\x00module-1")
+	module2 := []byte("\x00asm\x01\x00\x00\x00module-2")
+	url := "oci://" + registry.host() + "/filters/stats:latest"
+	wantPath1 := filepath.Join(tmpDir, fmt.Sprintf("%x.wasm", sha256.Sum256(module1)))
+	wantPath2 := filepath.Join(tmpDir, fmt.Sprintf("%x.wasm", sha256.Sum256(module2)))
+
+	digest1 := registry.addWasmImage("filters/stats", "latest", module1)
+	for i := 0; i < 2; i++ {
+		got, err := cache.Get(url, fmt.Sprintf("%x", sha256.Sum256(module1)), 0, secret)
+		if err != nil {
+			t.Fatalf("failed to get Wasm module: %v", err)
+		}
+		if got != wantPath1 {
+			t.Errorf("wasm module path got %v, want %v", got, wantPath1)
+		}
+	}
+	// The tag is resolved every time, the module is only pulled once.
+	if n := registry.numRequests("GET /v2/filters/stats/blobs/"); n != 1 {
+		t.Errorf("expecting the module to be pulled once, got %d blob requests", n)
+	}
+
+	// The checksum may be the image digest.
+	if got, err := cache.Get(url, strings.TrimPrefix(digest1, "sha256:"), 0, secret); err != nil || got != wantPath1 {
+		t.Errorf("wasm module path got %v, %v, want %v", got, err, wantPath1)
+	}
+	if _, err := cache.Get(url, fmt.Sprintf("%x", sha256.Sum256(module2)), 0, secret); err == nil {
+		t.Error("expecting a checksum mismatch")
+	}
+
+	// The tag is moved to a new image.
+	registry.addWasmImage("filters/stats", "latest", module2)
+	got, err := cache.Get(url, "", 0, secret)
+	if err != nil {
+		t.Fatalf("failed to get Wasm module: %v", err)
+	}
+	if got != wantPath2 {
+		t.Errorf("wasm module path got %v, want %v", got, wantPath2)
+	}
+
+	// Cached modules are served when the registry cannot be accessed, here with an invalid pull secret.
+	badSecret := pullSecret(registry.host(), "user", "expired")
+	requests := registry.numRequests("")
+	digestURL := "oci://" + registry.host() + "/filters/stats@" + digest1
+	if got, err := cache.Get(digestURL, "", 0, badSecret); err != nil || got != wantPath1 {
+		t.Errorf("wasm module path got %v, %v, want %v", got, err, wantPath1)
+	}
+	if n := registry.numRequests(""); n != requests {
+		t.Errorf("expecting the image pinned by digest to be served from the cache, got %d registry requests", n-requests)
+	}
+	if got, err := cache.Get(url, "", 0, badSecret); err != nil || got != wantPath2 {
+		t.Errorf("wasm module path got %v, %v, want %v", got, err, wantPath2)
+	}
+	if _, err := cache.Get("oci://"+registry.host()+"/filters/stats:other", "", 0, badSecret); err == nil {
+		t.Error("expecting an error resolving a tag which is not cached")
+	}
+}
+
+func TestImageFetcherInsecure(t *testing.T) {
+	module := []byte("\x00asm\x01\x00\x00\x00module")
+	registry := newFakeRegistry(t, "", "")
+	digest := registry.addWasmImage("stats", "", module)
+	// Serve the registry over plain HTTP.
+	plain := httptest.NewServer(registry.Config.Handler)
+	defer plain.Close()
+	u, _ := url.Parse(plain.URL)
+	registry.URL = plain.URL
+
+	ref, err := parseImageReference("oci://" + u.Host + "/stats@" + digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewImageFetcher(nil, true).Fetch(context.Background(), ref, nil)
+	if err != nil {
+		t.Fatalf("failed to fetch module: %v", err)
+	}
+	if !bytes.Equal(got, module) {
+		t.Errorf("fetched module got %q, want %q", got, module)
+	}
+}
@@ -29,11 +29,22 @@ const (
 	marshalFailure      = "marshal_failure"
 	fetchFailure        = "fetch_failure"
 	missRemoteFetchHint = "miss_remote_fetch_hint"
+
+	// For cache eviction metric.
+	evictionSize   = "size"
+	evictionExpiry = "expiry"
+
+	// For signature verification metric.
+	verificationSuccess = "success"
+	missingSignature    = "missing_signature"
+	invalidSignature    = "invalid_signature"
 )
 
 var (
 	hitTag    = monitoring.MustCreateLabel("hit")
 	resultTag = monitoring.MustCreateLabel("result")
+	moduleTag = monitoring.MustCreateLabel("module")
+	reasonTag = monitoring.MustCreateLabel("reason")
 
 	wasmCacheEntries = monitoring.NewGauge(
 		"wasm_cache_entries",
@@ -46,6 +57,35 @@ var (
 		monitoring.WithLabels(hitTag),
 	)
 
+	wasmCacheSize = monitoring.NewGauge(
+		"wasm_cache_size_bytes",
+		"total size in bytes of the cached Wasm module files.",
+	)
+
+	wasmCacheModuleSize = monitoring.NewGauge(
+		"wasm_cache_module_size_bytes",
+		"size in bytes of a cached Wasm module, 0 once it is removed from the cache.",
+		monitoring.WithLabels(moduleTag),
+	)
+
+	wasmCacheModuleLookupCount = monitoring.NewSum(
+		"wasm_cache_module_lookup_count",
+		"number of Wasm remote fetch cache lookups per module.",
+		monitoring.WithLabels(moduleTag, hitTag),
+	)
+
+	wasmCacheEvictionCount = monitoring.NewSum(
+		"wasm_cache_eviction_count",
+		"number of Wasm modules removed from the cache, because the cache is full or the module expired.",
+		monitoring.WithLabels(reasonTag),
+	)
+
+	wasmModuleVerificationCount = monitoring.NewSum(
+		"wasm_module_verification_count",
+		"number of Wasm module signature verifications and results, including success, missing signature, and invalid signature.",
+		monitoring.WithLabels(resultTag),
+	)
+
 	wasmRemoteFetchCount = monitoring.NewSum(
 		"wasm_remote_fetch_count",
 		"number of Wasm remote fetches and results, including success, download failure, and checksum mismatch.",
@@ -69,6 +109,11 @@ func init() {
 	monitoring.MustRegister(
 		wasmCacheEntries,
 		wasmCacheLookupCount,
+		wasmCacheSize,
+		wasmCacheModuleSize,
+		wasmCacheModuleLookupCount,
+		wasmCacheEvictionCount,
+		wasmModuleVerificationCount,
 		wasmRemoteFetchCount,
 		wasmConfigConversionCount,
 		wasmConfigConversionDuration,
@@ -0,0 +1,157 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ModuleVerifier verifies the signatures of Wasm modules with a set of public keys. A module is accepted if it is
+// signed with any of the keys.
+//
+// Modules fetched over HTTP(S) must have a detached signature at the module URL with a `.sig` suffix, holding the
+// signature of the module, raw or base64 encoded, as produced by `cosign sign-blob`. Modules pulled from registries
+// must be signed with `cosign sign`, the signatures are looked up in the image repository.
+type ModuleVerifier struct {
+	keys []crypto.PublicKey
+}
+
+// NewModuleVerifier creates a verifier with the PEM encoded public keys. ECDSA, RSA and Ed25519 keys are supported.
+func NewModuleVerifier(pemKeys []byte) (*ModuleVerifier, error) {
+	v := &ModuleVerifier{}
+	for {
+		var block *pem.Block
+		block, pemKeys = pem.Decode(pemKeys)
+		if block == nil {
+			break
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %v", err)
+		}
+		switch key.(type) {
+		case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+		v.keys = append(v.keys, key)
+	}
+	if len(v.keys) == 0 {
+		return nil, errors.New("no public key found")
+	}
+	return v, nil
+}
+
+// LoadModuleVerifier creates a verifier with the PEM encoded public keys in the file.
+func LoadModuleVerifier(file string) (*ModuleVerifier, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return NewModuleVerifier(b)
+}
+
+// verify returns whether the signature of the payload is valid for one of the keys.
+func (v *ModuleVerifier) verify(payload, sig []byte) bool {
+	digest := sha256.Sum256(payload)
+	for _, key := range v.keys {
+		switch k := key.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(k, digest[:], sig) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil ||
+				rsa.VerifyPSS(k, crypto.SHA256, digest[:], sig, nil) == nil {
+				return true
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, payload, sig) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyDetached verifies the module downloaded from the URL with its detached signature.
+func (v *ModuleVerifier) verifyDetached(fetcher *HTTPFetcher, downloadURL string, module []byte, timeout time.Duration) error {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return err
+	}
+	u.Path += ".sig"
+	b, err := fetcher.Fetch(u.String(), timeout)
+	if err != nil {
+		wasmModuleVerificationCount.With(resultTag.Value(missingSignature)).Increment()
+		return fmt.Errorf("failed to fetch the signature of module %v: %v", downloadURL, err)
+	}
+	sig := b
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b))); err == nil {
+		sig = decoded
+	}
+	if !v.verify(module, sig) {
+		wasmModuleVerificationCount.With(resultTag.Value(invalidSignature)).Increment()
+		return fmt.Errorf("module downloaded from %v does not have a valid signature", downloadURL)
+	}
+	wasmModuleVerificationCount.With(resultTag.Value(verificationSuccess)).Increment()
+	return nil
+}
+
+// cosignPayload is the signed payload of a cosign signature.
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// verifyImage verifies the image, referenced by digest, with its cosign signatures.
+func (v *ModuleVerifier) verifyImage(ctx context.Context, fetcher *ImageFetcher, ref *imageReference, pullSecret []byte) error {
+	sigs, err := fetcher.cosignSignatures(ctx, ref, pullSecret)
+	if err != nil {
+		wasmModuleVerificationCount.With(resultTag.Value(missingSignature)).Increment()
+		return fmt.Errorf("failed to fetch the signatures of image %v: %v", ref.withDigest(ref.digest), err)
+	}
+	for _, sig := range sigs {
+		payload := cosignPayload{}
+		if err := json.Unmarshal(sig.payload, &payload); err != nil || payload.Critical.Image.DockerManifestDigest != ref.digest {
+			// The signature is for another image.
+			continue
+		}
+		if v.verify(sig.payload, sig.signature) {
+			wasmModuleVerificationCount.With(resultTag.Value(verificationSuccess)).Increment()
+			return nil
+		}
+	}
+	wasmModuleVerificationCount.With(resultTag.Value(invalidSignature)).Increment()
+	return fmt.Errorf("image %v does not have a valid signature", ref.withDigest(ref.digest))
+}
@@ -0,0 +1,201 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func publicKeyPEM(t *testing.T, key interface{}) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func signECDSA(t *testing.T, key *ecdsa.PrivateKey, payload []byte) []byte {
+	t.Helper()
+	digest := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestNewModuleVerifier(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	payload := []byte("module")
+
+	if _, err := NewModuleVerifier([]byte("not a key")); err == nil {
+		t.Error("expecting an error without public key")
+	}
+	v, err := NewModuleVerifier(append(publicKeyPEM(t, &ecKey.PublicKey), publicKeyPEM(t, edPub)...))
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+	cases := []struct {
+		name string
+		sig  []byte
+		want bool
+	}{
+		{name: "ecdsa", sig: signECDSA(t, ecKey, payload), want: true},
+		{name: "ed25519", sig: ed25519.Sign(edKey, payload), want: true},
+		{name: "unknown key", sig: signECDSA(t, otherKey, payload), want: false},
+		{name: "garbage", sig: []byte("signature"), want: false},
+	}
+	for _, c := range cases {
+		if got := v.verify(payload, c.sig); got != c.want {
+			t.Errorf("%s: verify got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestWasmCacheDetachedSignature(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	verifier, err := NewModuleVerifier(publicKeyPEM(t, &key.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules := map[string][]byte{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, f := modules[r.URL.Path]
+		if !f {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(b)
+	}))
+	defer ts.Close()
+	modules["/signed.wasm"] = []byte("signed")
+	modules["/signed.wasm.sig"] = []byte(base64.StdEncoding.EncodeToString(signECDSA(t, key, modules["/signed.wasm"])))
+	modules["/raw.wasm"] = []byte("raw")
+	modules["/raw.wasm.sig"] = signECDSA(t, key, modules["/raw.wasm"])
+	modules["/other.wasm"] = []byte("other")
+	modules["/other.wasm.sig"] = signECDSA(t, otherKey, modules["/other.wasm"])
+	modules["/unsigned.wasm"] = []byte("unsigned")
+
+	cases := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{name: "base64 signature", path: "/signed.wasm"},
+		{name: "raw signature", path: "/raw.wasm"},
+		{name: "signed with another key", path: "/other.wasm", wantErr: "does not have a valid signature"},
+		{name: "missing signature", path: "/unsigned.wasm", wantErr: "failed to fetch the signature"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cache := NewLocalFileCacheWithOptions(tmpDir, Options{
+				PurgeInterval: DefaultWasmModulePurgeInterval,
+				ModuleExpiry:  DefaultWasmModuleExpiry,
+				Verifier:      verifier,
+			})
+			defer close(cache.stopChan)
+			_, err := cache.Get(ts.URL+c.path, "", 0, nil)
+			if c.wantErr == "" {
+				if err != nil {
+					t.Errorf("failed to get verified module: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("error got %v, want %v", err, c.wantErr)
+			}
+			if len(cache.modules) != 0 {
+				t.Error("module which failed the verification must not be cached")
+			}
+		})
+	}
+}
+
+func TestWasmCacheImageSignature(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	verifier, err := NewModuleVerifier(publicKeyPEM(t, &key.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := newFakeRegistry(t, "", "")
+	sign := func(repo, digest, signedDigest string) {
+		payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"%s/%s"},`+
+			`"image":{"docker-manifest-digest":"%s"},"type":"cosign container image signature"},"optional":null}`,
+			registry.host(), repo, signedDigest))
+		registry.addManifest(repo, strings.Replace(digest, ":", "-", 1)+".sig", manifest{
+			MediaType: ociManifestMediaType,
+			Config:    descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: registry.addBlob([]byte("{}"))},
+			Layers: []descriptor{{
+				MediaType:   "application/vnd.dev.cosign.simplesigning.v1+json",
+				Digest:      registry.addBlob(payload),
+				Annotations: map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signECDSA(t, key, payload))},
+			}},
+		})
+	}
+	signed := registry.addWasmImage("signed", "v1", []byte("\x00asm\x01\x00\x00\x00signed"))
+	sign("signed", signed, signed)
+	replayed := registry.addWasmImage("replayed", "v1", []byte("\x00asm\x01\x00\x00\x00replayed"))
+	// The signature of another image is copied.
+	sign("replayed", replayed, signed)
+	registry.addWasmImage("unsigned", "v1", []byte("\x00asm\x01\x00\x00\x00unsigned"))
+
+	cases := []struct {
+		repo    string
+		wantErr string
+	}{
+		{repo: "signed"},
+		{repo: "replayed", wantErr: "does not have a valid signature"},
+		{repo: "unsigned", wantErr: "failed to fetch the signatures"},
+	}
+	for _, c := range cases {
+		t.Run(c.repo, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cache := NewLocalFileCacheWithOptions(tmpDir, Options{
+				PurgeInterval: DefaultWasmModulePurgeInterval,
+				ModuleExpiry:  DefaultWasmModuleExpiry,
+				Verifier:      verifier,
+			})
+			defer close(cache.stopChan)
+			cache.imageFetcher = NewImageFetcher(registry.Client(), false)
+			_, err := cache.Get("oci://"+registry.host()+"/"+c.repo+":v1", "", 0, nil)
+			if c.wantErr == "" {
+				if err != nil {
+					t.Errorf("failed to get verified module: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("error got %v, want %v", err, c.wantErr)
+			}
+		})
+	}
+}
@@ -22,10 +22,20 @@ import (
 	"istio.io/istio/security/pkg/credentialfetcher/plugin"
 )
 
-func NewCredFetcher(credtype, trustdomain, jwtPath, identityProvider string) (security.CredFetcher, error) {
+// NewCredFetcher creates a credential fetcher of the given type. audience is the resource the MicrosoftAzure
+// fetcher requests managed identity tokens for, such as the application ID URI of the identity provider; it
+// is required for that type and ignored by the others.
+func NewCredFetcher(credtype, trustdomain, jwtPath, identityProvider, audience string) (security.CredFetcher, error) {
 	switch credtype {
 	case security.GCE:
 		return plugin.CreateGCEPlugin(trustdomain, jwtPath, identityProvider), nil
+	case security.AWS:
+		return plugin.CreateAWSPlugin("", jwtPath, identityProvider), nil
+	case security.Azure:
+		if audience == "" {
+			return nil, fmt.Errorf("the audience is required by the %s credential fetcher", credtype)
+		}
+		return plugin.CreateAzurePlugin("", audience, jwtPath, identityProvider), nil
 	case security.Mock: // for test only
 		return plugin.CreateMockPlugin("test_token"), nil
 	default:
@@ -27,6 +27,7 @@ func TestNewCredFetcher(t *testing.T) {
 		trustdomain      string
 		jwtPath          string
 		identityProvider string
+		audience         string
 		expectedErr      string
 		expectedToken    string
 		expectedIdp      string
@@ -40,6 +41,34 @@ func TestNewCredFetcher(t *testing.T) {
 			expectedToken:    "",
 			expectedIdp:      "GoogleComputeEngine",
 		},
+		"aws test": {
+			fetcherType:      security.AWS,
+			trustdomain:      "cluster.local",
+			jwtPath:          "/var/run/secrets/tokens/istio-token",
+			identityProvider: "AWSIdentityProvider",
+			expectedErr:      "",
+			expectedToken:    "",
+			expectedIdp:      "AWSIdentityProvider",
+		},
+		"azure test": {
+			fetcherType:      security.Azure,
+			trustdomain:      "cluster.local",
+			jwtPath:          "/var/run/secrets/tokens/istio-token",
+			identityProvider: "AzureIdentityProvider",
+			audience:         "api://istio",
+			expectedErr:      "",
+			expectedToken:    "",
+			expectedIdp:      "AzureIdentityProvider",
+		},
+		"azure without audience test": {
+			fetcherType:      security.Azure,
+			trustdomain:      "cluster.local",
+			jwtPath:          "/var/run/secrets/tokens/istio-token",
+			identityProvider: "AzureIdentityProvider",
+			expectedErr:      "the audience is required by the MicrosoftAzure credential fetcher",
+			expectedToken:    "",
+			expectedIdp:      "",
+		},
 		"mock test": {
 			fetcherType:      security.Mock,
 			trustdomain:      "",
@@ -63,10 +92,11 @@ func TestNewCredFetcher(t *testing.T) {
 	// Disable token refresh for GCE VM credential fetcher.
 	plugin.SetTokenRotation(false)
 	for id, tc := range testCases {
+		id, tc := id, tc
 		t.Run(id, func(t *testing.T) {
 			t.Parallel()
 			cf, err := NewCredFetcher(
-				tc.fetcherType, tc.trustdomain, tc.jwtPath, tc.identityProvider)
+				tc.fetcherType, tc.trustdomain, tc.jwtPath, tc.identityProvider, tc.audience)
 			if cf != nil {
 				defer cf.Stop()
 			}
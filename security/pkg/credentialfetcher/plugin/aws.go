@@ -0,0 +1,175 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is AWS plugin of credentialfetcher.
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var awscredLog = log.RegisterScope("awscred", "AWS credential fetcher for istio agent", 0)
+
+var awsMetadataEndpoint = env.RegisterStringVar("AWS_EC2_METADATA_SERVICE_ENDPOINT", "http://169.254.169.254",
+	"The endpoint of the AWS EC2 instance metadata service, used by the AWS credential fetcher.").Get()
+
+const (
+	awsTokenPath     = "/latest/api/token"
+	awsSignaturePath = "/latest/dynamic/instance-identity/pkcs7"
+	awsTokenHeader   = "X-aws-ec2-metadata-token"
+	awsTokenTTL      = "X-aws-ec2-metadata-token-ttl-seconds"
+
+	// IMDSv2 session tokens are requested for 6 hours, and renewed 5 minutes before they expire.
+	awsSessionTTL         = 6 * time.Hour
+	awsSessionGracePeriod = 5 * time.Minute
+
+	metadataRequestTimeout = 5 * time.Second
+)
+
+// The plugin object.
+type AWSPlugin struct {
+	// endpoint of the instance metadata service.
+	endpoint string
+
+	// The location to save the identity credential
+	jwtPath string
+
+	// identity provider
+	identityProvider string
+
+	client *http.Client
+
+	// IMDSv2 session token, and its expiration time.
+	sessionToken string
+	sessionExp   time.Time
+	// mutex lock is required to avoid race condition when updating the credential file and session token.
+	tokenMutex sync.Mutex
+}
+
+// CreateAWSPlugin creates an AWS credential fetcher plugin, fetching the instance identity document from the
+// instance metadata service at endpoint. Return the pointer to the created plugin.
+func CreateAWSPlugin(endpoint, jwtPath, identityProvider string) *AWSPlugin {
+	if endpoint == "" {
+		endpoint = awsMetadataEndpoint
+	}
+	return &AWSPlugin{
+		endpoint:         strings.TrimSuffix(endpoint, "/"),
+		jwtPath:          jwtPath,
+		identityProvider: identityProvider,
+		client:           &http.Client{Timeout: metadataRequestTimeout},
+	}
+}
+
+func (p *AWSPlugin) Stop() {}
+
+// GetPlatformCredential fetches the signed instance identity document of the EC2 instance from the instance
+// metadata service using IMDSv2, and write it to jwtPath. The credential is the PKCS7 signature of the document,
+// which embeds the document, with the line breaks removed.
+// Note: this function only works in an AWS EC2 environment.
+func (p *AWSPlugin) GetPlatformCredential() (string, error) {
+	p.tokenMutex.Lock()
+	defer p.tokenMutex.Unlock()
+
+	if p.jwtPath == "" {
+		return "", fmt.Errorf("jwtPath is unset")
+	}
+	sessionToken, err := p.getSessionToken(time.Now())
+	if err != nil {
+		awscredLog.Errorf("Failed to get IMDSv2 session token from metadata server: %v", err)
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, p.endpoint+awsSignaturePath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(awsTokenHeader, sessionToken)
+	body, err := doMetadataRequest(p.client, req)
+	if err != nil {
+		// The session token may have been revoked, get a new one on the next call.
+		p.sessionToken = ""
+		awscredLog.Errorf("Failed to get instance identity document from metadata server: %v", err)
+		return "", err
+	}
+	credential := strings.Join(strings.Fields(string(body)), "")
+	if credential == "" {
+		return "", fmt.Errorf("empty instance identity document signature")
+	}
+	awscredLog.Debugf("Got AWS instance identity credential: %d", len(credential))
+	if err := ioutil.WriteFile(p.jwtPath, []byte(credential), 0o640); err != nil {
+		awscredLog.Errorf("Encountered error when writing instance identity credential: %v", err)
+		return "", err
+	}
+	return credential, nil
+}
+
+// getSessionToken returns the cached IMDSv2 session token, or gets a new one if it is about to expire.
+func (p *AWSPlugin) getSessionToken(now time.Time) (string, error) {
+	if p.sessionToken != "" && now.Before(p.sessionExp.Add(-awsSessionGracePeriod)) {
+		return p.sessionToken, nil
+	}
+	req, err := http.NewRequest(http.MethodPut, p.endpoint+awsTokenPath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(awsTokenTTL, strconv.Itoa(int(awsSessionTTL.Seconds())))
+	body, err := doMetadataRequest(p.client, req)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(body))
+	if token == "" {
+		return "", fmt.Errorf("empty IMDSv2 session token")
+	}
+	p.sessionToken = token
+	p.sessionExp = now.Add(awsSessionTTL)
+	return token, nil
+}
+
+// GetType returns credential fetcher type.
+func (p *AWSPlugin) GetType() string {
+	return security.AWS
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *AWSPlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
+
+// doMetadataRequest sends the request to a metadata server, and returns the body of a successful response.
+func doMetadataRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata server %s returned status %d: %s", req.URL.Path, resp.StatusCode,
+			strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
@@ -0,0 +1,143 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+const fakeAWSSignature = "MIAGCSqGSIb3DQEHAqCAMIACAQExCzAJBgUrDgMCGgUAMIAGCSqGSIb3DQEHAaCAJIAEggHbewog\n" +
+	"ICJhY2NvdW50SWQiIDogIjEyMzQ1Njc4OTAxMiIKfQAAAAAAAA==\n"
+
+// fakeAWSMetadataServer is a stand-in for the AWS EC2 instance metadata service, which only allows IMDSv2 requests.
+type fakeAWSMetadataServer struct {
+	mutex            sync.Mutex
+	numTokenCalls    int
+	validToken       string
+	signatureFailure bool
+}
+
+func (s *fakeAWSMetadataServer) setSignatureFailure(fail bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.signatureFailure = fail
+}
+
+func (s *fakeAWSMetadataServer) tokenCalls() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.numTokenCalls
+}
+
+func (s *fakeAWSMetadataServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch {
+	case req.Method == http.MethodPut && req.URL.Path == awsTokenPath:
+		if req.Header.Get(awsTokenTTL) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.numTokenCalls++
+		s.validToken = fmt.Sprintf("session-token-%d", s.numTokenCalls)
+		fmt.Fprint(w, s.validToken)
+	case req.Method == http.MethodGet && req.URL.Path == awsSignaturePath:
+		if req.Header.Get(awsTokenHeader) != s.validToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if s.signatureFailure {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, fakeAWSSignature)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestAWSPlugin(t *testing.T) {
+	ms := &fakeAWSMetadataServer{}
+	server := httptest.NewServer(ms)
+	defer server.Close()
+	jwtPath := filepath.Join(t.TempDir(), "istio-token")
+	p := CreateAWSPlugin(server.URL, jwtPath, "fakeIDP")
+	defer p.Stop()
+
+	expected := "MIAGCSqGSIb3DQEHAqCAMIACAQExCzAJBgUrDgMCGgUAMIAGCSqGSIb3DQEHAaCAJIAEggHbewog" +
+		"ICJhY2NvdW50SWQiIDogIjEyMzQ1Njc4OTAxMiIKfQAAAAAAAA=="
+	for i := 0; i < 2; i++ {
+		credential, err := p.GetPlatformCredential()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if credential != expected {
+			t.Errorf("GetPlatformCredential returned %q, expected %q", credential, expected)
+		}
+		if b, err := ioutil.ReadFile(jwtPath); err != nil || string(b) != expected {
+			t.Errorf("unexpected credential in %s: %q, %v", jwtPath, string(b), err)
+		}
+	}
+	if n := ms.tokenCalls(); n != 1 {
+		t.Errorf("expecting the session token to be reused, got %d token requests", n)
+	}
+
+	// The session token is renewed after a failure.
+	ms.setSignatureFailure(true)
+	if _, err := p.GetPlatformCredential(); err == nil {
+		t.Error("expecting an error when the metadata server fails")
+	}
+	ms.setSignatureFailure(false)
+	if _, err := p.GetPlatformCredential(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := ms.tokenCalls(); n != 2 {
+		t.Errorf("expecting the session token to be renewed, got %d token requests", n)
+	}
+
+	if p.GetType() != "AmazonWebServices" || p.GetIdentityProvider() != "fakeIDP" {
+		t.Errorf("unexpected type %s or identity provider %s", p.GetType(), p.GetIdentityProvider())
+	}
+}
+
+func TestAWSPluginErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	testCases := map[string]struct {
+		endpoint string
+		jwtPath  string
+	}{
+		"jwtPath is unset": {
+			endpoint: server.URL,
+		},
+		"metadata service unavailable": {
+			endpoint: server.URL,
+			jwtPath:  filepath.Join(t.TempDir(), "istio-token"),
+		},
+	}
+	for id, tc := range testCases {
+		p := CreateAWSPlugin(tc.endpoint, tc.jwtPath, "fakeIDP")
+		if _, err := p.GetPlatformCredential(); err == nil {
+			t.Errorf("Case %s: expecting an error", id)
+		}
+		p.Stop()
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is Azure plugin of credentialfetcher.
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/util"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var azurecredLog = log.RegisterScope("azurecred", "Azure credential fetcher for istio agent", 0)
+
+var azureMetadataEndpoint = env.RegisterStringVar("AZURE_IMDS_ENDPOINT", "http://169.254.169.254",
+	"The endpoint of the Azure instance metadata service, used by the Azure credential fetcher.").Get()
+
+const (
+	azureTokenPath  = "/metadata/identity/oauth2/token"
+	azureAPIVersion = "2018-02-01"
+)
+
+// azureTokenResponse is the response of the Azure instance metadata service token endpoint.
+type azureTokenResponse struct {
+	AccessToken string `json:"access_token"`
+}
+
+// The plugin object.
+type AzurePlugin struct {
+	// endpoint of the instance metadata service.
+	endpoint string
+
+	// resource is the audience of the managed identity token.
+	resource string
+
+	// The location to save the identity token
+	jwtPath string
+
+	// identity provider
+	identityProvider string
+
+	client *http.Client
+
+	// token refresh
+	rotationTicker *time.Ticker
+	closing        chan bool
+	tokenCache     string
+	// mutex lock is required to avoid race condition when updating token file and token cache.
+	tokenMutex sync.RWMutex
+}
+
+// CreateAzurePlugin creates an Azure credential fetcher plugin, fetching managed identity tokens for the resource
+// from the instance metadata service at endpoint. Return the pointer to the created plugin.
+func CreateAzurePlugin(endpoint, resource, jwtPath, identityProvider string) *AzurePlugin {
+	if endpoint == "" {
+		endpoint = azureMetadataEndpoint
+	}
+	p := &AzurePlugin{
+		endpoint:         strings.TrimSuffix(endpoint, "/"),
+		resource:         resource,
+		jwtPath:          jwtPath,
+		identityProvider: identityProvider,
+		client:           &http.Client{Timeout: metadataRequestTimeout},
+		closing:          make(chan bool),
+	}
+	if rotateToken {
+		go p.startTokenRotationJob()
+	}
+	return p
+}
+
+func (p *AzurePlugin) Stop() {
+	close(p.closing)
+}
+
+func (p *AzurePlugin) startTokenRotationJob() {
+	// Wake up once in a while and refresh Azure VM credential.
+	p.rotationTicker = time.NewTicker(rotationInterval)
+	for {
+		select {
+		case <-p.rotationTicker.C:
+			p.rotate()
+		case <-p.closing:
+			if p.rotationTicker != nil {
+				p.rotationTicker.Stop()
+			}
+			return
+		}
+	}
+}
+
+func (p *AzurePlugin) rotate() {
+	if p.shouldRotate(time.Now()) {
+		if _, err := p.GetPlatformCredential(); err != nil {
+			azurecredLog.Errorf("credential refresh failed: %+v", err)
+		}
+	}
+}
+
+func (p *AzurePlugin) shouldRotate(now time.Time) bool {
+	p.tokenMutex.RLock()
+	defer p.tokenMutex.RUnlock()
+
+	if p.tokenCache == "" {
+		return true
+	}
+	exp, err := util.GetExp(p.tokenCache)
+	// When fails to get expiration time from token, always refresh the token.
+	if err != nil || exp.IsZero() {
+		return true
+	}
+	rotate := now.After(exp.Add(-gracePeriod))
+	azurecredLog.Debugf("credential expiration: %s, grace period: %s, should rotate: %t",
+		exp.String(), gracePeriod.String(), rotate)
+	return rotate
+}
+
+// GetPlatformCredential fetches the managed identity token of the Azure VM from its instance metadata service,
+// and write it to jwtPath. The local copy of the token in jwtPath is used by both Envoy STS client and istio agent
+// to fetch certificate and access token.
+// Note: this function only works in an Azure VM environment with a managed identity.
+func (p *AzurePlugin) GetPlatformCredential() (string, error) {
+	p.tokenMutex.Lock()
+	defer p.tokenMutex.Unlock()
+
+	if p.jwtPath == "" {
+		return "", fmt.Errorf("jwtPath is unset")
+	}
+	query := url.Values{}
+	query.Set("api-version", azureAPIVersion)
+	query.Set("resource", p.resource)
+	req, err := http.NewRequest(http.MethodGet, p.endpoint+azureTokenPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	body, err := doMetadataRequest(p.client, req)
+	if err != nil {
+		azurecredLog.Errorf("Failed to get vm identity token from metadata server: %v", err)
+		return "", err
+	}
+	resp := azureTokenResponse{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("invalid token response from metadata server: %v", err)
+	}
+	if resp.AccessToken == "" {
+		return "", fmt.Errorf("no access token in the response of metadata server")
+	}
+	// Update token cache.
+	p.tokenCache = resp.AccessToken
+	azurecredLog.Debugf("Got Azure identity token: %d", len(resp.AccessToken))
+	if err := ioutil.WriteFile(p.jwtPath, []byte(resp.AccessToken), 0o640); err != nil {
+		azurecredLog.Errorf("Encountered error when writing vm identity token: %v", err)
+		return "", err
+	}
+	return resp.AccessToken, nil
+}
+
+// GetType returns credential fetcher type.
+func (p *AzurePlugin) GetType() string {
+	return security.Azure
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *AzurePlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
@@ -0,0 +1,105 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"istio.io/istio/security/pkg/util"
+)
+
+// fakeAzureMetadataServer is a stand-in for the Azure instance metadata service token endpoint.
+func fakeAzureMetadataServer(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != azureTokenPath || req.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.URL.Query().Get("api-version") == "" || req.URL.Query().Get("resource") != "api://istio" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"access_token": token,
+			"expires_on":   "1586106834",
+			"resource":     "api://istio",
+			"token_type":   "Bearer",
+		})
+	}))
+}
+
+func TestAzurePlugin(t *testing.T) {
+	SetTokenRotation(false)
+	defer SetTokenRotation(true)
+	server := fakeAzureMetadataServer(t, thirdPartyJwt)
+	defer server.Close()
+
+	testCases := map[string]struct {
+		resource      string
+		jwtPath       string
+		expectedToken string
+		expectedErr   bool
+	}{
+		"fetch token": {
+			resource:      "api://istio",
+			jwtPath:       filepath.Join(t.TempDir(), "istio-token"),
+			expectedToken: thirdPartyJwt,
+		},
+		"jwtPath is unset": {
+			resource:    "api://istio",
+			expectedErr: true,
+		},
+		"unknown resource": {
+			resource:    "api://unknown",
+			jwtPath:     filepath.Join(t.TempDir(), "istio-token"),
+			expectedErr: true,
+		},
+	}
+	for id, tc := range testCases {
+		p := CreateAzurePlugin(server.URL, tc.resource, tc.jwtPath, "fakeIDP")
+		token, err := p.GetPlatformCredential()
+		p.Stop()
+		if tc.expectedErr {
+			if err == nil {
+				t.Errorf("Case %s: expecting an error", id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case %s: unexpected error: %v", id, err)
+			continue
+		}
+		if token != tc.expectedToken {
+			t.Errorf("Case %s: expecting token %q, got %q", id, tc.expectedToken, token)
+		}
+		if b, err := ioutil.ReadFile(tc.jwtPath); err != nil || string(b) != tc.expectedToken {
+			t.Errorf("Case %s: unexpected token in %s: %q, %v", id, tc.jwtPath, string(b), err)
+		}
+		exp, err := util.GetExp(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.shouldRotate(exp.Add(-30 * time.Minute)) {
+			t.Errorf("Case %s: the cached token should not be rotated", id)
+		}
+	}
+}
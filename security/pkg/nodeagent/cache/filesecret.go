@@ -0,0 +1,127 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"istio.io/istio/pkg/security"
+)
+
+// checkFileSecret validates a secret read from files, when ValidateFileMountedCerts is set. If the files
+// could not be read or are invalid, for example while they are being written, the last valid secret read for
+// the resource is returned instead. rootCertPath, if set, holds the roots the certificate chain must be
+// verified with.
+func (sc *SecretManagerClient) checkFileSecret(resourceName string, item *security.SecretItem, err error,
+	rootCertPath string) (*security.SecretItem, error) {
+	if err == nil {
+		if item.CertificateChain != nil {
+			var roots []byte
+			if rootCertPath != "" {
+				roots, _ = ioutil.ReadFile(rootCertPath)
+				if len(roots) != 0 {
+					roots = sc.mergeConfigTrustBundle(roots)
+				}
+			}
+			err = validateFileKeyCert(item.CertificateChain, item.PrivateKey, roots, time.Now())
+		} else {
+			err = validateFileRootCert(item.RootCert)
+		}
+	}
+
+	sc.fileSecretsMutex.Lock()
+	defer sc.fileSecretsMutex.Unlock()
+	if err == nil {
+		sc.fileSecrets[resourceName] = item
+		return item, nil
+	}
+	last, f := sc.fileSecrets[resourceName]
+	if !f {
+		return nil, err
+	}
+	resourceLog(resourceName).Warnf("invalid secret files, serving the last valid secret: %v", err)
+	numFileSecretFallbacks.Increment()
+	return last, nil
+}
+
+// validateFileKeyCert checks that the key matches the leaf of the PEM encoded certificate chain, and that the
+// chain is currently valid. If roots are set, the chain must be verified with them.
+func validateFileKeyCert(certChain, key, roots []byte, now time.Time) error {
+	pair, err := tls.X509KeyPair(certChain, key)
+	if err != nil {
+		return fmt.Errorf("invalid key and certificate chain: %v", err)
+	}
+	certs := make([]*x509.Certificate, 0, len(pair.Certificate))
+	for _, der := range pair.Certificate {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("invalid certificate chain: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	leaf := certs[0]
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return fmt.Errorf("certificate is not valid between %v and %v", leaf.NotBefore, leaf.NotAfter)
+	}
+	if len(roots) == 0 {
+		return nil
+	}
+	rootPool := x509.NewCertPool()
+	if !rootPool.AppendCertsFromPEM(roots) {
+		return fmt.Errorf("invalid root certificates")
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         rootPool,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("certificate chain is not trusted: %v", err)
+	}
+	return nil
+}
+
+// validateFileRootCert checks that the file only holds PEM encoded certificates, so a truncated file is rejected.
+func validateFileRootCert(roots []byte) error {
+	n := 0
+	for {
+		var block *pem.Block
+		block, roots = pem.Decode(roots)
+		if block == nil {
+			break
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("invalid root certificate: %v", err)
+		}
+		n++
+	}
+	if n == 0 {
+		return fmt.Errorf("no root certificate found")
+	}
+	if len(bytes.TrimSpace(roots)) != 0 {
+		return fmt.Errorf("invalid data after the root certificates")
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/file"
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+type testKeyCert struct {
+	cert, key []byte
+}
+
+func genTestCA(t *testing.T) testKeyCert {
+	t.Helper()
+	cert, key, err := pkiutil.GenCertKeyFromOptions(pkiutil.CertOptions{
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		Org:          "Root CA",
+		ECSigAlg:     pkiutil.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeyCert{cert: cert, key: key}
+}
+
+func genTestLeaf(t *testing.T, ca testKeyCert) testKeyCert {
+	t.Helper()
+	signerCert, err := pkiutil.ParsePemEncodedCertificate(ca.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signerKey, err := pkiutil.ParsePemEncodedKey(ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, key, err := pkiutil.GenCertKeyFromOptions(pkiutil.CertOptions{
+		Host:       "spiffe://cluster.local/ns/default/sa/default",
+		TTL:        time.Hour,
+		SignerCert: signerCert,
+		SignerPriv: signerKey,
+		ECSigAlg:   pkiutil.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeyCert{cert: cert, key: key}
+}
+
+func writeTestFile(t *testing.T, path string, b []byte) {
+	t.Helper()
+	if err := file.AtomicWrite(path, b, os.FileMode(0o644)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateFileMountedCerts(t *testing.T) {
+	u := NewUpdateTracker(t)
+	sc := createCache(t, nil, u.Callback, security.Options{ValidateFileMountedCerts: true})
+	dir := t.TempDir()
+	sc.existingCertificateFile = model.SdsCertificateConfig{
+		CertificatePath:   filepath.Join(dir, "cert-chain.pem"),
+		PrivateKeyPath:    filepath.Join(dir, "key.pem"),
+		CaCertificatePath: filepath.Join(dir, "root-cert.pem"),
+	}
+	certPath, keyPath, rootPath := sc.existingCertificateFile.CertificatePath, sc.existingCertificateFile.PrivateKeyPath,
+		sc.existingCertificateFile.CaCertificatePath
+	workloadResource := security.WorkloadKeyCertResourceName
+	rootResource := security.RootCertReqResourceName
+
+	ca := genTestCA(t)
+	leaf := genTestLeaf(t, ca)
+	writeTestFile(t, certPath, leaf.cert)
+	writeTestFile(t, keyPath, leaf.key)
+	writeTestFile(t, rootPath, ca.cert)
+	checkSecret(t, sc, workloadResource, security.SecretItem{
+		ResourceName:     workloadResource,
+		CertificateChain: leaf.cert,
+		PrivateKey:       leaf.key,
+	})
+	checkSecret(t, sc, rootResource, security.SecretItem{
+		ResourceName: rootResource,
+		RootCert:     ca.cert,
+	})
+	u.Expect(map[string]int{})
+
+	// A half-written cert is pushed, but the last valid cert is served.
+	writeTestFile(t, certPath, leaf.cert[:len(leaf.cert)/2])
+	u.Expect(map[string]int{workloadResource: 1})
+	checkSecret(t, sc, workloadResource, security.SecretItem{
+		ResourceName:     workloadResource,
+		CertificateChain: leaf.cert,
+		PrivateKey:       leaf.key,
+	})
+
+	// The key is watched too, the new cert is served once both are written.
+	rotated := genTestLeaf(t, ca)
+	writeTestFile(t, certPath, rotated.cert)
+	u.Expect(map[string]int{workloadResource: 2})
+	checkSecret(t, sc, workloadResource, security.SecretItem{
+		ResourceName:     workloadResource,
+		CertificateChain: leaf.cert,
+		PrivateKey:       leaf.key,
+	})
+	writeTestFile(t, keyPath, rotated.key)
+	u.Expect(map[string]int{workloadResource: 3})
+	checkSecret(t, sc, workloadResource, security.SecretItem{
+		ResourceName:     workloadResource,
+		CertificateChain: rotated.cert,
+		PrivateKey:       rotated.key,
+	})
+
+	// A cert that does not chain to the roots is not served.
+	untrusted := genTestLeaf(t, genTestCA(t))
+	writeTestFile(t, certPath, untrusted.cert)
+	u.Expect(map[string]int{workloadResource: 4})
+	writeTestFile(t, keyPath, untrusted.key)
+	u.Expect(map[string]int{workloadResource: 5})
+	checkSecret(t, sc, workloadResource, security.SecretItem{
+		ResourceName:     workloadResource,
+		CertificateChain: rotated.cert,
+		PrivateKey:       rotated.key,
+	})
+
+	// A half-written root is not served.
+	writeTestFile(t, rootPath, ca.cert[:len(ca.cert)/2])
+	u.Expect(map[string]int{workloadResource: 6, rootResource: 1})
+	checkSecret(t, sc, rootResource, security.SecretItem{
+		ResourceName: rootResource,
+		RootCert:     ca.cert,
+	})
+}
+
+func TestValidateFileMountedCertsWithoutLastValid(t *testing.T) {
+	sc := createCache(t, nil, func(string) {}, security.Options{ValidateFileMountedCerts: true})
+	dir := t.TempDir()
+	sc.existingCertificateFile = model.SdsCertificateConfig{
+		CertificatePath:   filepath.Join(dir, "cert-chain.pem"),
+		PrivateKeyPath:    filepath.Join(dir, "key.pem"),
+		CaCertificatePath: filepath.Join(dir, "root-cert.pem"),
+	}
+	untrusted := genTestLeaf(t, genTestCA(t))
+	writeTestFile(t, sc.existingCertificateFile.CertificatePath, untrusted.cert)
+	writeTestFile(t, sc.existingCertificateFile.PrivateKeyPath, untrusted.key)
+	writeTestFile(t, sc.existingCertificateFile.CaCertificatePath, genTestCA(t).cert)
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err == nil {
+		t.Fatal("expected an untrusted cert to be rejected")
+	}
+}
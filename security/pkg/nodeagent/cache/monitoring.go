@@ -44,6 +44,10 @@ var (
 	numFileSecretFailures = monitoring.NewSum(
 		"num_file_secret_failures_total",
 		"Number of times secret generation failed for files")
+
+	numFileSecretFallbacks = monitoring.NewSum(
+		"num_file_secret_fallbacks_total",
+		"Number of times the last valid secret was served because the secret files were invalid")
 )
 
 func init() {
@@ -53,5 +57,6 @@ func init() {
 		numFailedOutgoingRequests,
 		numFileWatcherFailures,
 		numFileSecretFailures,
+		numFileSecretFallbacks,
 	)
 }
@@ -17,6 +17,8 @@ package cache
 
 import (
 	"bytes"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
@@ -78,7 +80,9 @@ const (
 // will be monitored; when they are near expiration the notifyCallback function is triggered,
 // prompting the client to call GenerateSecret again, if they still care about the certificate. For
 // files, this callback is instead triggered on any change to the file (triggering on expiration
-// would not be helpful, as all we can do is re-read the same file).
+// would not be helpful, as all we can do is re-read the same file). With ValidateFileMountedCerts, a
+// certificate read from files is only served if its key matches and it chains to the workload roots;
+// otherwise the last valid certificate is served, so a half-written file does not break the proxy.
 type SecretManagerClient struct {
 	caClient security.Client
 
@@ -105,6 +109,12 @@ type SecretManagerClient struct {
 	fileCerts map[FileCert]struct{}
 	certMutex sync.RWMutex
 
+	// fileSecretsMutex protects fileSecrets
+	fileSecretsMutex sync.Mutex
+	// fileSecrets holds the last valid secret read from files for each resource, served when the files
+	// are invalid and ValidateFileMountedCerts is set.
+	fileSecrets map[string]*security.SecretItem
+
 	// outputMutex protects writes of certificates to disk
 	outputMutex sync.Mutex
 
@@ -113,6 +123,11 @@ type SecretManagerClient struct {
 	// Dynamically configured Trust Bundle
 	configTrustBundle []byte
 
+	// crlMutex protects crl
+	crlMutex sync.RWMutex
+	// crl holds the certificate revocation lists of the CA, served with the workload trust anchor
+	crl []byte
+
 	// queue maintains all certificate rotation events that need to be triggered when they are about to expire
 	queue queue.Delayed
 	stop  chan struct{}
@@ -179,6 +194,7 @@ func NewSecretManagerClient(caClient security.Client, options *security.Options)
 		},
 		certWatcher: watcher,
 		fileCerts:   make(map[FileCert]struct{}),
+		fileSecrets: make(map[string]*security.SecretItem),
 		stop:        make(chan struct{}),
 	}
 
@@ -220,6 +236,7 @@ func (sc *SecretManagerClient) getCachedSecret(resourceName string) (secret *sec
 			ns = &security.SecretItem{
 				ResourceName: resourceName,
 				RootCert:     rootCertBundle,
+				CRL:          sc.getCRL(),
 			}
 			cacheLog.WithLabels("ttl", time.Until(c.ExpireTime)).Info("returned workload trust anchor from cache")
 
@@ -301,6 +318,7 @@ func (sc *SecretManagerClient) GenerateSecret(resourceName string) (secret *secu
 
 	if resourceName == security.RootCertReqResourceName {
 		ns.RootCert = sc.mergeConfigTrustBundle(ns.RootCert)
+		ns.CRL = sc.getCRL()
 	} else {
 		// If periodic cert refresh resulted in discovery of a new root, trigger a ROOTCA request to refresh trust anchor
 		oldRoot := sc.cache.GetRoot()
@@ -474,7 +492,11 @@ func (sc *SecretManagerClient) generateFileSecret(resourceName string) (bool, *s
 	sdsFromFile := false
 	var err error
 	var sitem *security.SecretItem
+	// rootCertPath holds the roots the certificate chain is validated with.
+	var rootCertPath string
+	validate := sc.configOptions.ValidateFileMountedCerts
 
+	// With validation, the files are watched even if they are invalid, as their next change may fix them.
 	switch {
 	// Default root certificate.
 	case resourceName == security.RootCertReqResourceName && sc.rootCertificateExist(cf.CaCertificatePath) && !outputToCertificatePath:
@@ -482,15 +504,24 @@ func (sc *SecretManagerClient) generateFileSecret(resourceName string) (bool, *s
 		if sitem, err = sc.generateRootCertFromExistingFile(cf.CaCertificatePath, resourceName, true); err == nil {
 			// If retrieving workload trustBundle, then merge other configured trustAnchors in ProxyConfig
 			sitem.RootCert = sc.mergeConfigTrustBundle(sitem.RootCert)
+		}
+		if err == nil || validate {
 			sc.addFileWatcher(cf.CaCertificatePath, resourceName)
 		}
 	// Default workload certificate.
 	case resourceName == security.WorkloadKeyCertResourceName && sc.keyCertificateExist(cf.CertificatePath, cf.PrivateKeyPath) && !outputToCertificatePath:
 		sdsFromFile = true
-		if sitem, err = sc.generateKeyCertFromExistingFiles(cf.CertificatePath, cf.PrivateKeyPath, resourceName); err == nil {
+		rootCertPath = cf.CaCertificatePath
+		sitem, err = sc.generateKeyCertFromExistingFiles(cf.CertificatePath, cf.PrivateKeyPath, resourceName)
+		if err == nil || validate {
 			// Adding cert is sufficient here as key can't change without changing the cert.
 			sc.addFileWatcher(cf.CertificatePath, resourceName)
 		}
+		if validate {
+			// The files are validated together, a change to any of them may make the chain valid.
+			sc.addFileWatcher(cf.PrivateKeyPath, resourceName)
+			sc.addFileWatcher(cf.CaCertificatePath, resourceName)
+		}
 	default:
 		// Check if the resource name refers to a file mounted certificate.
 		// Currently used in destination rules and server certs (via metadata).
@@ -499,17 +530,23 @@ func (sc *SecretManagerClient) generateFileSecret(resourceName string) (bool, *s
 		sdsFromFile = ok
 		switch {
 		case ok && cfg.IsRootCertificate():
-			if sitem, err = sc.generateRootCertFromExistingFile(cfg.CaCertificatePath, resourceName, false); err == nil {
+			if sitem, err = sc.generateRootCertFromExistingFile(cfg.CaCertificatePath, resourceName, false); err == nil || validate {
 				sc.addFileWatcher(cfg.CaCertificatePath, resourceName)
 			}
 		case ok && cfg.IsKeyCertificate():
-			if sitem, err = sc.generateKeyCertFromExistingFiles(cfg.CertificatePath, cfg.PrivateKeyPath, resourceName); err == nil {
+			if sitem, err = sc.generateKeyCertFromExistingFiles(cfg.CertificatePath, cfg.PrivateKeyPath, resourceName); err == nil || validate {
 				// Adding cert is sufficient here as key can't change without changing the cert.
 				sc.addFileWatcher(cfg.CertificatePath, resourceName)
 			}
+			if validate {
+				sc.addFileWatcher(cfg.PrivateKeyPath, resourceName)
+			}
 		}
 	}
 
+	if sdsFromFile && validate {
+		sitem, err = sc.checkFileSecret(resourceName, sitem, err, rootCertPath)
+	}
 	if sdsFromFile {
 		if err != nil {
 			cacheLog.Errorf("%s failed to generate secret for proxy from file: %v",
@@ -719,3 +756,33 @@ func (sc *SecretManagerClient) UpdateConfigTrustBundle(trustBundle []byte) error
 func (sc *SecretManagerClient) mergeConfigTrustBundle(rootCert []byte) []byte {
 	return pkiutil.AppendCertByte(sc.getConfigTrustBundle(), rootCert)
 }
+
+func (sc *SecretManagerClient) getCRL() []byte {
+	sc.crlMutex.RLock()
+	defer sc.crlMutex.RUnlock()
+	return sc.crl
+}
+
+// UpdateCRL updates the certificate revocation lists of the CA, and pushes them to the proxy
+// along with the workload trust anchor.
+func (sc *SecretManagerClient) UpdateCRL(crl []byte) error {
+	for rest := crl; len(bytes.TrimSpace(rest)) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return fmt.Errorf("invalid PEM encoded CRL")
+		}
+		if _, err := x509.ParseCRL(block.Bytes); err != nil {
+			return fmt.Errorf("invalid CRL: %v", err)
+		}
+	}
+	sc.crlMutex.Lock()
+	if bytes.Equal(sc.crl, crl) {
+		sc.crlMutex.Unlock()
+		return nil
+	}
+	sc.crl = crl
+	sc.crlMutex.Unlock()
+	sc.CallUpdateCallback(security.RootCertReqResourceName)
+	return nil
+}
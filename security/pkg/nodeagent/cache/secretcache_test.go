@@ -16,8 +16,13 @@ package cache
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -32,6 +37,7 @@ import (
 	"istio.io/istio/pkg/test/util/retry"
 	"istio.io/istio/pkg/testcerts"
 	"istio.io/istio/security/pkg/nodeagent/caclient/providers/mock"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
 	"istio.io/pkg/log"
 )
 
@@ -604,3 +610,69 @@ func TestProxyConfigAnchors(t *testing.T) {
 		RootCert:     rootCert,
 	})
 }
+
+func TestUpdateCRL(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	u := NewUpdateTracker(t)
+	sc := createCache(t, fakeCACli, u.Callback, security.Options{})
+	if _, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName); err != nil {
+		t.Fatal(err)
+	}
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+	u.Reset()
+
+	certPEM, keyPEM, err := pkiutil.GenCertKeyFromOptions(pkiutil.CertOptions{
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		Org:          "Root CA",
+		ECSigAlg:     pkiutil.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := pkiutil.ParsePemEncodedCertificate(certPEM)
+	key, _ := pkiutil.ParsePemEncodedKey(keyPEM)
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, cert, key.(crypto.Signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+
+	if err := sc.UpdateCRL([]byte("not a CRL")); err == nil {
+		t.Fatal("expected invalid CRL to be rejected")
+	}
+	if err := sc.UpdateCRL(crl); err != nil {
+		t.Fatal(err)
+	}
+	// The CRL is pushed with the workload trust anchor.
+	u.Expect(map[string]int{security.RootCertReqResourceName: 1})
+	u.Reset()
+	root, err := sc.GenerateSecret(security.RootCertReqResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(root.CRL, crl) {
+		t.Fatalf("expected CRL %q, got %q", crl, root.CRL)
+	}
+	workload, err := sc.GenerateSecret(security.WorkloadKeyCertResourceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workload.CRL != nil {
+		t.Fatalf("expected no CRL with the workload certificate, got %q", workload.CRL)
+	}
+
+	// Unchanged CRLs are not pushed again.
+	if err := sc.UpdateCRL(crl); err != nil {
+		t.Fatal(err)
+	}
+	u.Expect(map[string]int{})
+}
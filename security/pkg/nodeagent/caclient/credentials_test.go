@@ -82,7 +82,7 @@ func TestGetTokenForXDS(t *testing.T) {
 	secOpts.JWTPath = jwtPath
 	defer os.Remove(jwtPath)
 
-	mockCredFetcher, err := credentialfetcher.NewCredFetcher(security.Mock, "", "", "")
+	mockCredFetcher, err := credentialfetcher.NewCredFetcher(security.Mock, "", "", "", "")
 	if err != nil {
 		t.Fatalf("failed to create mock credential fetcher: %v", err)
 	}
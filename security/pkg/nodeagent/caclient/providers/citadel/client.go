@@ -31,6 +31,7 @@ import (
 	pb "istio.io/api/security/v1alpha1"
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/security/pkg/nodeagent/caclient"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
 	"istio.io/pkg/log"
 )
 
@@ -52,6 +53,9 @@ type CitadelClient struct {
 
 // NewCitadelClient create a CA client for Citadel.
 func NewCitadelClient(opts *security.Options, tls bool, rootCert []byte) (*CitadelClient, error) {
+	if err := pkiutil.ValidateECSigAlg(pkiutil.SupportedECSignatureAlgorithms(opts.ECCSigAlg)); err != nil {
+		return nil, err
+	}
 	c := &CitadelClient{
 		enableTLS:     tls,
 		caTLSRootCert: rootCert,
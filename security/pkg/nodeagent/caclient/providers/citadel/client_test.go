@@ -180,6 +180,20 @@ func TestCitadelClientRotation(t *testing.T) {
 	})
 }
 
+func TestCitadelClientECCSigAlg(t *testing.T) {
+	addr := serve(t, mockCAServer{Certs: fakeCert})
+	for _, alg := range []string{"", "ECDSA", "ECDSA_P384", "ED25519"} {
+		cli, err := NewCitadelClient(&security.Options{CAEndpoint: addr, ECCSigAlg: alg}, false, nil)
+		if err != nil {
+			t.Fatalf("%q: failed to create ca client: %v", alg, err)
+		}
+		cli.Close()
+	}
+	if _, err := NewCitadelClient(&security.Options{CAEndpoint: addr, ECCSigAlg: "ECDSA_P521"}, false, nil); err == nil {
+		t.Fatal("expected an error for an unsupported EC signature algorithm")
+	}
+}
+
 func TestCitadelClient(t *testing.T) {
 	testCases := map[string]struct {
 		server       mockCAServer
@@ -17,6 +17,9 @@ package sds
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"time"
 
@@ -143,6 +146,11 @@ func (s *sdsservice) generate(resourceNames []string) (model.Resources, error) {
 			// Instead, we rely on the client to retry (with backoff) on failures.
 			return nil, fmt.Errorf("failed to generate secret for %v: %v", resourceName, err)
 		}
+		if isEd25519Key(secret.PrivateKey) {
+			// Envoy cannot load Ed25519 keys, so ECC_SIGNATURE_ALGORITHM=ED25519 only works for
+			// proxyless gRPC and file mounted outputs, not for certificates served over SDS.
+			return nil, fmt.Errorf("failed to generate secret for %v: Envoy does not support Ed25519 keys", resourceName)
+		}
 
 		res := util.MessageToAny(toEnvoySecret(secret))
 		resources = append(resources, &discovery.Resource{
@@ -198,6 +206,20 @@ func (s *sdsservice) Close() {
 	s.XdsServer.Shutdown()
 }
 
+// isEd25519Key returns true if the PEM encoded private key is an Ed25519 key.
+func isEd25519Key(keyPEM []byte) bool {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return false
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return false
+	}
+	_, ok := key.(ed25519.PrivateKey)
+	return ok
+}
+
 // toEnvoySecret converts a security.SecretItem to an Envoy tls.Secret
 func toEnvoySecret(s *security.SecretItem) *tls.Secret {
 	secret := &tls.Secret{
@@ -206,15 +228,23 @@ func toEnvoySecret(s *security.SecretItem) *tls.Secret {
 
 	cfg, ok := model.SdsCertificateConfigFromResourceName(s.ResourceName)
 	if s.ResourceName == security.RootCertReqResourceName || (ok && cfg.IsRootCertificate()) {
-		secret.Type = &tls.Secret_ValidationContext{
-			ValidationContext: &tls.CertificateValidationContext{
-				TrustedCa: &core.DataSource{
-					Specifier: &core.DataSource_InlineBytes{
-						InlineBytes: s.RootCert,
-					},
+		validationContext := &tls.CertificateValidationContext{
+			TrustedCa: &core.DataSource{
+				Specifier: &core.DataSource_InlineBytes{
+					InlineBytes: s.RootCert,
 				},
 			},
 		}
+		if len(s.CRL) > 0 {
+			validationContext.Crl = &core.DataSource{
+				Specifier: &core.DataSource_InlineBytes{
+					InlineBytes: s.CRL,
+				},
+			}
+		}
+		secret.Type = &tls.Secret_ValidationContext{
+			ValidationContext: validationContext,
+		}
 	} else {
 		secret.Type = &tls.Secret_TlsCertificate{
 			TlsCertificate: &tls.TlsCertificate{
@@ -28,6 +28,7 @@ import (
 	"istio.io/istio/pilot/pkg/xds"
 	"istio.io/istio/pilot/test/xdstest"
 	ca2 "istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
 	"istio.io/pkg/log"
 )
 
@@ -73,6 +74,7 @@ type Expectation struct {
 	CertChain    []byte
 	Key          []byte
 	RootCert     []byte
+	CRL          []byte
 }
 
 func (s *TestServer) Verify(resp *discovery.DiscoveryResponse, expectations ...Expectation) *discovery.DiscoveryResponse {
@@ -88,6 +90,7 @@ func (s *TestServer) Verify(resp *discovery.DiscoveryResponse, expectations ...E
 			Key:          scrt.GetTlsCertificate().GetPrivateKey().GetInlineBytes(),
 			CertChain:    scrt.GetTlsCertificate().GetCertificateChain().GetInlineBytes(),
 			RootCert:     scrt.GetValidationContext().GetTrustedCa().GetInlineBytes(),
+			CRL:          scrt.GetValidationContext().GetCrl().GetInlineBytes(),
 		}
 		if diff := cmp.Diff(e, r); diff != "" {
 			s.t.Fatalf("got diff: %v", diff)
@@ -192,6 +195,25 @@ func TestSDS(t *testing.T) {
 			Key:          fakePushPrivateKey,
 		})
 	})
+	t.Run("ed25519", func(t *testing.T) {
+		_, key, err := pkiutil.GenCSR(pkiutil.CertOptions{Host: "spiffe://cluster.local/ns/foo/sa/bar", ECSigAlg: pkiutil.Ed25519SigAlg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := setupSDS(t)
+		s.UpdateSecret(testResourceName, &ca2.SecretItem{
+			CertificateChain: fakeCertificateChain,
+			PrivateKey:       key,
+			ResourceName:     testResourceName,
+		})
+		cert := s.Connect()
+
+		// Envoy cannot load Ed25519 keys, so they are never served over SDS
+		cert.Request(t, &discovery.DiscoveryRequest{ResourceNames: []string{testResourceName}})
+		if err := cert.ExpectError(t); !strings.Contains(fmt.Sprint(err), "Envoy does not support Ed25519 keys") {
+			t.Fatalf("didn't get expected error; got %v", err)
+		}
+	})
 	t.Run("update empty", func(t *testing.T) {
 		s := setupSDS(t)
 		cert := s.Connect()
@@ -234,6 +256,23 @@ func TestSDS(t *testing.T) {
 		// No need to push a new root if just the cert changes
 		root.ExpectNoResponse(t)
 	})
+	t.Run("push crl", func(t *testing.T) {
+		s := setupSDS(t)
+		root := s.Connect()
+		s.Verify(root.RequestResponseAck(t, &discovery.DiscoveryRequest{ResourceNames: []string{rootResourceName}}), expectRoot)
+
+		fakeCRL := []byte{0o5}
+		s.UpdateSecret(ca2.RootCertReqResourceName, &ca2.SecretItem{
+			RootCert:     fakeRootCert,
+			CRL:          fakeCRL,
+			ResourceName: ca2.RootCertReqResourceName,
+		})
+		s.Verify(root.ExpectResponse(t), Expectation{
+			ResourceName: rootResourceName,
+			RootCert:     fakeRootCert,
+			CRL:          fakeCRL,
+		})
+	})
 	t.Run("reconnect", func(t *testing.T) {
 		s := setupSDS(t)
 		c := s.Connect()
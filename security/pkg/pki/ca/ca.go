@@ -16,7 +16,6 @@ package ca
 
 import (
 	"context"
-	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
@@ -95,6 +94,11 @@ type IstioCAOptions struct {
 
 	// Config for creating self-signed root cert rotator.
 	RotatorConfig *SelfSignedCARootCertRotatorConfig
+
+	// CRLStore, if set, persists the certificates revoked by the CA.
+	CRLStore CRLStore
+	// UpstreamCRLs are the PEM encoded CRLs of the CAs in the cert chain of a plugged-in CA.
+	UpstreamCRLs []byte
 }
 
 // NewSelfSignedIstioCAOptions returns a new IstioCAOptions instance using self-signed certificate.
@@ -246,16 +250,8 @@ func NewPluggedCertIstioCAOptions(certChainFile, signingCertFile, signingKeyFile
 	if err != nil {
 		return nil, err
 	}
-	block, _ := pem.Decode(b)
-	if block == nil {
-		return nil, fmt.Errorf("invalid PEM encoded certificate")
-	}
-	cert, err := x509.ParseCertificate(block.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse X.509 certificate")
-	}
-	if !cert.IsCA {
-		return nil, fmt.Errorf("certificate is not authorized to sign other certificates")
+	if err := verifyPluggedSigningCert(b); err != nil {
+		return nil, err
 	}
 
 	return caOpts, nil
@@ -274,6 +270,9 @@ type IstioCA struct {
 	// rootCertRotator periodically rotates self-signed root cert for CA. It is nil
 	// if CA is not self-signed CA.
 	rootCertRotator *SelfSignedCARootCertRotator
+
+	// revocation holds the certificates revoked by the CA.
+	revocation *revocationList
 }
 
 // NewIstioCA returns a new IstioCA instance.
@@ -283,6 +282,7 @@ func NewIstioCA(opts *IstioCAOptions) (*IstioCA, error) {
 		keyCertBundle: opts.KeyCertBundle,
 		livenessProbe: probe.NewProbe(),
 		caRSAKeySize:  opts.CARSAKeySize,
+		revocation:    newRevocationList(opts.CRLStore, opts.UpstreamCRLs),
 	}
 
 	if opts.CAType == selfSignedCA && opts.RotatorConfig != nil && opts.RotatorConfig.CheckInterval > time.Duration(0) {
@@ -306,6 +306,9 @@ func (ca *IstioCA) Run(stopChan chan struct{}) {
 		// Start root cert rotator in a separate goroutine.
 		go ca.rootCertRotator.Run(stopChan)
 	}
+	// Load the revoked certificates before serving, then keep the CRL up to date.
+	ca.refreshCRL()
+	go ca.runCRLRefresh(stopChan)
 }
 
 // Sign takes a PEM-encoded CSR and cert opts, and returns a signed certificate.
@@ -335,8 +338,8 @@ func (ca *IstioCA) GenKeyCert(hostnames []string, certTTL time.Duration, checkLi
 	// use the type of private key the CA uses to generate an intermediate CA of that type (e.g. CA cert using RSA will
 	// cause intermediate CAs using RSA to be generated)
 	_, signingKey, _, _ := ca.keyCertBundle.GetAll()
-	if util.IsSupportedECPrivateKey(signingKey) {
-		opts.ECSigAlg = util.EcdsaSigAlg
+	if alg, err := util.GetECSigAlg(*signingKey); err == nil {
+		opts.ECSigAlg = alg
 	}
 
 	csrPEM, privPEM, err := util.GenCSR(opts)
@@ -384,6 +387,10 @@ func (ca *IstioCA) sign(csrPEM []byte, subjectIDs []string, requestedLifetime ti
 	if err != nil {
 		return nil, caerror.NewError(caerror.CSRError, err)
 	}
+	// Only issue certificates for key types that are supported by the proxies.
+	if err := util.ValidatePublicKey(csr.PublicKey); err != nil {
+		return nil, caerror.NewError(caerror.CSRError, err)
+	}
 
 	lifetime := requestedLifetime
 	// If the requested requestedLifetime is non-positive, apply the default TTL.
@@ -384,6 +384,40 @@ func TestSignCSR(t *testing.T) {
 			},
 			expectedError: "",
 		},
+		"Workload uses EC P-384": {
+			forCA: false,
+			certOpts: util.CertOptions{
+				Host:     "spiffe://different.com/test",
+				ECSigAlg: util.EcdsaP384SigAlg,
+				IsCA:     false,
+			},
+			maxTTL:       time.Hour,
+			requestedTTL: 30 * time.Minute,
+			verifyFields: util.VerifyFields{
+				ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+				KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+				IsCA:        false,
+				Host:        subjectID,
+			},
+			expectedError: "",
+		},
+		"Workload uses Ed25519": {
+			forCA: false,
+			certOpts: util.CertOptions{
+				Host:     "spiffe://different.com/test",
+				ECSigAlg: util.Ed25519SigAlg,
+				IsCA:     false,
+			},
+			maxTTL:       time.Hour,
+			requestedTTL: 30 * time.Minute,
+			verifyFields: util.VerifyFields{
+				ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+				KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+				IsCA:        false,
+				Host:        subjectID,
+			},
+			expectedError: "",
+		},
 		"CA uses RSA": {
 			forCA: true,
 			certOpts: util.CertOptions{
@@ -393,7 +427,7 @@ func TestSignCSR(t *testing.T) {
 			maxTTL:       365 * 24 * time.Hour,
 			requestedTTL: 30 * 24 * time.Hour,
 			verifyFields: util.VerifyFields{
-				KeyUsage: x509.KeyUsageCertSign,
+				KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 				IsCA:     true,
 				Host:     subjectID,
 			},
@@ -408,7 +442,7 @@ func TestSignCSR(t *testing.T) {
 			maxTTL:       365 * 24 * time.Hour,
 			requestedTTL: 30 * 24 * time.Hour,
 			verifyFields: util.VerifyFields{
-				KeyUsage: x509.KeyUsageCertSign,
+				KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 				IsCA:     true,
 				Host:     subjectID,
 			},
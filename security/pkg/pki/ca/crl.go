@@ -0,0 +1,520 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+const (
+	// CRLChainFile is the ID/name for the file holding the CRLs of the CAs in the cert chain of a plugged-in CA.
+	// Proxies reject a certificate if the CRL of any CA in its chain is missing, so revocation is only
+	// enabled for an intermediate CA if this file exists.
+	CRLChainFile = "crl-chain.pem"
+	// CRLConfigMap stores the revoked certificates, so they are kept across restarts and shared by all replicas.
+	CRLConfigMap = "istio-ca-crl"
+	// RevokedCertsKey is the key of the revoked certificates in CRLConfigMap.
+	RevokedCertsKey = "revoked-certs.json"
+
+	// crlValidity is how long a CRL is valid for. Proxies that cannot get a newer CRL before it expires reject
+	// all certificates issued by the CA, so it is much longer than crlRefreshInterval.
+	crlValidity = 7 * 24 * time.Hour
+	// crlRefreshInterval is how often revocations by other replicas are loaded, and the CRL is re-signed if needed.
+	crlRefreshInterval = time.Minute
+)
+
+// RevokedCertificate is a certificate revoked by the CA.
+type RevokedCertificate struct {
+	SerialNumber   *big.Int  `json:"serialNumber"`
+	RevocationTime time.Time `json:"revocationTime"`
+	// Expiration is when the certificate expires. It is listed in the CRL until then.
+	Expiration time.Time `json:"expiration"`
+}
+
+// CRLStore persists revoked certificates.
+type CRLStore interface {
+	// Load returns the stored revoked certificates.
+	Load() ([]RevokedCertificate, error)
+	// Update stores the revoked certificates returned by f, which is called with the stored ones. f may be called
+	// more than once if the stored certificates are updated concurrently.
+	Update(f func([]RevokedCertificate) []RevokedCertificate) error
+}
+
+// revocationList holds the certificates revoked by the CA and the CRL that lists them.
+type revocationList struct {
+	mu sync.RWMutex
+	// store, if set, persists the revoked certificates.
+	store CRLStore
+	// upstreamCRLs are the PEM encoded CRLs of the CAs above the signing cert.
+	upstreamCRLs []byte
+	// revoked holds the revoked certificates, keyed by serial number.
+	revoked map[string]RevokedCertificate
+	// crl is the PEM encoded CRL signed by the CA, nil if no certificate is revoked.
+	crl []byte
+	// signedBy is the certificate the CRL was signed with.
+	signedBy   *x509.Certificate
+	nextUpdate time.Time
+	number     *big.Int
+	// retired are the signing certs replaced by a rotation, still signing CRLs for the certificates they issued.
+	retired  []*retiredCRLSigner
+	handlers []func()
+}
+
+// retiredCRLSigner is a signing cert replaced by a rotation. Proxies require a CRL for every CA in the chain of a
+// certificate once any CRL is configured, so it keeps signing a CRL, published along with the CRLs of its own cert
+// chain, until the certificates it issued expire.
+type retiredCRLSigner struct {
+	cert         *x509.Certificate
+	signer       crypto.Signer
+	upstreamCRLs []byte
+	until        time.Time
+	crl          []byte
+	nextUpdate   time.Time
+	number       *big.Int
+}
+
+func newRevocationList(store CRLStore, upstreamCRLs []byte) *revocationList {
+	return &revocationList{
+		store:        store,
+		upstreamCRLs: upstreamCRLs,
+		revoked:      map[string]RevokedCertificate{},
+		number:       big.NewInt(0),
+	}
+}
+
+// Revoke revokes the certificate with the given serial number, issued by the CA. As the expiration of the
+// certificate is not known, it is listed in the CRL for the max certificate TTL.
+func (ca *IstioCA) Revoke(serial *big.Int) error {
+	now := time.Now()
+	return ca.revoke(RevokedCertificate{SerialNumber: serial, RevocationTime: now, Expiration: now.Add(ca.maxCertTTL)})
+}
+
+// RevokeCertificate revokes a PEM encoded certificate issued by the CA.
+func (ca *IstioCA) RevokeCertificate(certPEM []byte) error {
+	cert, err := util.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		return err
+	}
+	if !ca.issued(cert) {
+		return fmt.Errorf("certificate %v was not issued by this CA", cert.SerialNumber)
+	}
+	return ca.revoke(RevokedCertificate{SerialNumber: cert.SerialNumber, RevocationTime: time.Now(), Expiration: cert.NotAfter})
+}
+
+// RevokedCertificates returns the certificates revoked by the CA, ordered by serial number.
+func (ca *IstioCA) RevokedCertificates() []RevokedCertificate {
+	rl := ca.revocation
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return sortedRevocations(rl.revoked)
+}
+
+// issued returns whether the certificate was signed by the signing cert of the CA, or by a retired one.
+func (ca *IstioCA) issued(cert *x509.Certificate) bool {
+	signingCert, _, _, _ := ca.keyCertBundle.GetAll()
+	if signingCert != nil && cert.CheckSignatureFrom(signingCert) == nil {
+		return true
+	}
+	rl := ca.revocation
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	for _, r := range rl.retired {
+		if cert.CheckSignatureFrom(r.cert) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCRL returns the PEM encoded CRL of the CA, followed by the CRLs of the retired signing certs and the CRLs of
+// the CAs in their cert chains. It returns nil if no certificate is revoked.
+func (ca *IstioCA) GetCRL() []byte {
+	rl := ca.revocation
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	if rl.crl == nil {
+		return nil
+	}
+	crl := append([]byte{}, rl.crl...)
+	for _, r := range rl.retired {
+		crl = append(crl, r.crl...)
+	}
+	crl = append(crl, rl.upstreamCRLs...)
+	published := [][]byte{rl.upstreamCRLs}
+	for _, r := range rl.retired {
+		if containsBytes(published, r.upstreamCRLs) {
+			continue
+		}
+		crl = append(crl, r.upstreamCRLs...)
+		published = append(published, r.upstreamCRLs)
+	}
+	return crl
+}
+
+func containsBytes(list [][]byte, b []byte) bool {
+	for _, l := range list {
+		if bytes.Equal(l, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddCRLHandler adds a handler called whenever the CRL changes.
+func (ca *IstioCA) AddCRLHandler(h func()) {
+	rl := ca.revocation
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.handlers = append(rl.handlers, h)
+}
+
+// rotateCRLSigner replaces the CRLs of the CAs in the cert chain, after the signing cert was rotated from prevCert.
+// prevCert is retired, and keeps signing a CRL until the certificates it issued expire, which is at most the max
+// certificate TTL from now.
+func (ca *IstioCA) rotateCRLSigner(prevCert *x509.Certificate, prevKey *crypto.PrivateKey, upstreamCRLs []byte) {
+	signingCert, _, _, _ := ca.keyCertBundle.GetAll()
+	rl := ca.revocation
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	prevUpstreamCRLs := rl.upstreamCRLs
+	rl.upstreamCRLs = upstreamCRLs
+	retired := make([]*retiredCRLSigner, 0, len(rl.retired)+1)
+	for _, r := range rl.retired {
+		// A signing cert that is rotated back to is no longer retired.
+		if signingCert == nil || !bytes.Equal(r.cert.Raw, signingCert.Raw) {
+			retired = append(retired, r)
+		}
+	}
+	rl.retired = retired
+	if prevCert == nil || prevKey == nil || (signingCert != nil && bytes.Equal(prevCert.Raw, signingCert.Raw)) {
+		return
+	}
+	signer, ok := (*prevKey).(crypto.Signer)
+	if !ok || prevCert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		pkiCaLog.Warnf("the retired CA signing certificate cannot sign CRLs, certificates it issued are rejected by " +
+			"proxies while certificates are revoked")
+		return
+	}
+	until := time.Now().Add(ca.maxCertTTL)
+	if prevCert.NotAfter.Before(until) {
+		until = prevCert.NotAfter
+	}
+	rl.retired = append(rl.retired, &retiredCRLSigner{
+		cert:         prevCert,
+		signer:       signer,
+		upstreamCRLs: prevUpstreamCRLs,
+		until:        until,
+		number:       big.NewInt(0),
+	})
+}
+
+func (ca *IstioCA) revoke(rc RevokedCertificate) error {
+	if err := ca.canSignCRL(); err != nil {
+		return err
+	}
+	rl := ca.revocation
+	// The store is written without holding the lock, so signing and CRL reads are not blocked on the
+	// API server. The new list only depends on the stored certificates, which are reloaded on conflicts.
+	if rl.store != nil {
+		err := rl.store.Update(func(stored []RevokedCertificate) []RevokedCertificate {
+			// Drop expired certificates, so the store does not grow forever.
+			out := []RevokedCertificate{rc}
+			for _, s := range stored {
+				if s.Expiration.After(rc.RevocationTime) {
+					out = append(out, s)
+				}
+			}
+			return out
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store revoked certificate %v: %v", rc.SerialNumber, err)
+		}
+	}
+	rl.mu.Lock()
+	rl.add(rc)
+	changed, err := ca.updateCRLLocked(true)
+	rl.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	pkiCaLog.Infof("revoked certificate %v", rc.SerialNumber)
+	if changed {
+		ca.notifyCRLHandlers()
+	}
+	return nil
+}
+
+// refreshCRL loads the certificates revoked by other replicas, and re-signs the CRL if it changed, is about to
+// expire, or the signing cert was rotated.
+func (ca *IstioCA) refreshCRL() {
+	rl := ca.revocation
+	var stored []RevokedCertificate
+	if rl.store != nil {
+		var err error
+		if stored, err = rl.store.Load(); err != nil {
+			pkiCaLog.Warnf("failed to load revoked certificates: %v", err)
+		}
+	}
+	rl.mu.Lock()
+	added := false
+	for _, rc := range stored {
+		if _, f := rl.revoked[rc.SerialNumber.String()]; !f {
+			rl.add(rc)
+			added = true
+		}
+	}
+	changed, err := ca.updateCRLLocked(added)
+	rl.mu.Unlock()
+	if err != nil {
+		pkiCaLog.Errorf("failed to update CRL: %v", err)
+		return
+	}
+	if changed {
+		ca.notifyCRLHandlers()
+	}
+}
+
+func (ca *IstioCA) runCRLRefresh(stopChan chan struct{}) {
+	ticker := time.NewTicker(crlRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ca.refreshCRL()
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+func (ca *IstioCA) notifyCRLHandlers() {
+	rl := ca.revocation
+	rl.mu.RLock()
+	handlers := append([]func(){}, rl.handlers...)
+	rl.mu.RUnlock()
+	for _, h := range handlers {
+		h()
+	}
+}
+
+// canSignCRL returns an error if the CA cannot publish a CRL that proxies are able to use.
+func (ca *IstioCA) canSignCRL() error {
+	signingCert, signingKey, certChain, _ := ca.keyCertBundle.GetAll()
+	if signingCert == nil || signingKey == nil {
+		return fmt.Errorf("istio CA is not ready")
+	}
+	if signingCert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return fmt.Errorf("the CA signing certificate is not allowed to sign CRLs; it must have the cRLSign key usage")
+	}
+	if len(certChain) > 0 && len(ca.revocation.upstreamCRLs) == 0 {
+		return fmt.Errorf("the CRLs of the CAs in the cert chain must be provided in %s to revoke certificates", CRLChainFile)
+	}
+	return nil
+}
+
+func (rl *revocationList) add(rc RevokedCertificate) {
+	if prev, f := rl.revoked[rc.SerialNumber.String()]; f && prev.RevocationTime.Before(rc.RevocationTime) {
+		// Keep the first revocation.
+		return
+	}
+	rl.revoked[rc.SerialNumber.String()] = rc
+}
+
+// updateCRLLocked removes expired certificates and retired signing certs, and signs new CRLs if needed. It returns
+// whether the CRLs changed.
+func (ca *IstioCA) updateCRLLocked(force bool) (bool, error) {
+	rl := ca.revocation
+	now := time.Now()
+	for serial, rc := range rl.revoked {
+		if rc.Expiration.Before(now) {
+			delete(rl.revoked, serial)
+			force = true
+		}
+	}
+	retired := rl.retired[:0]
+	for _, r := range rl.retired {
+		if r.until.After(now) {
+			retired = append(retired, r)
+		} else {
+			force = true
+		}
+	}
+	rl.retired = retired
+	if len(rl.revoked) == 0 {
+		changed := rl.crl != nil
+		rl.crl = nil
+		for _, r := range rl.retired {
+			r.crl = nil
+		}
+		return changed, nil
+	}
+	signingCert, signingKey, _, _ := ca.keyCertBundle.GetAll()
+	if signingCert == nil || signingKey == nil {
+		return false, fmt.Errorf("istio CA is not ready")
+	}
+
+	revoked := make([]pkix.RevokedCertificate, 0, len(rl.revoked))
+	for _, rc := range sortedRevocations(rl.revoked) {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: rc.SerialNumber, RevocationTime: rc.RevocationTime})
+	}
+	changed := false
+	rotated := rl.signedBy == nil || !bytes.Equal(rl.signedBy.Raw, signingCert.Raw)
+	if force || rotated || needsCRL(rl.crl, rl.nextUpdate, now) {
+		signer, ok := (*signingKey).(crypto.Signer)
+		if !ok {
+			return false, fmt.Errorf("the CA signing key cannot sign CRLs")
+		}
+		crl, nextUpdate, number, err := signCRL(revoked, rl.number, signingCert, signer, now)
+		if err != nil {
+			return false, err
+		}
+		rl.crl, rl.nextUpdate, rl.number, rl.signedBy = crl, nextUpdate, number, signingCert
+		changed = true
+	}
+	// The serial numbers are random, so the retired signing certs list all the revoked certificates.
+	for _, r := range rl.retired {
+		if force || needsCRL(r.crl, r.nextUpdate, now) {
+			crl, nextUpdate, number, err := signCRL(revoked, r.number, r.cert, r.signer, now)
+			if err != nil {
+				return changed, err
+			}
+			r.crl, r.nextUpdate, r.number = crl, nextUpdate, number
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// needsCRL returns whether a CRL is missing or about to expire.
+func needsCRL(crl []byte, nextUpdate, now time.Time) bool {
+	return crl == nil || !now.Add(crlValidity/2).Before(nextUpdate)
+}
+
+// signCRL returns the PEM encoded CRL listing the revoked certificates, signed by the cert, with its next update
+// time and number.
+func signCRL(revoked []pkix.RevokedCertificate, prevNumber *big.Int, cert *x509.Certificate, signer crypto.Signer,
+	now time.Time) ([]byte, time.Time, *big.Int, error) {
+	number := new(big.Int).Add(prevNumber, big.NewInt(1))
+	template := &x509.RevocationList{
+		RevokedCertificates: revoked,
+		Number:              number,
+		ThisUpdate:          now.Add(-util.ClockSkewGracePeriod),
+		NextUpdate:          now.Add(crlValidity),
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, cert, signer)
+	if err != nil {
+		return nil, time.Time{}, nil, fmt.Errorf("failed to sign CRL: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), template.NextUpdate, number, nil
+}
+
+func sortedRevocations(revoked map[string]RevokedCertificate) []RevokedCertificate {
+	out := make([]RevokedCertificate, 0, len(revoked))
+	for _, rc := range revoked {
+		out = append(out, rc)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].SerialNumber.Cmp(out[j].SerialNumber) < 0
+	})
+	return out
+}
+
+type configMapCRLStore struct {
+	client    corev1.ConfigMapsGetter
+	namespace string
+}
+
+// NewConfigMapCRLStore returns a CRLStore that stores revoked certificates in the CRLConfigMap ConfigMap.
+func NewConfigMapCRLStore(client corev1.ConfigMapsGetter, namespace string) CRLStore {
+	return &configMapCRLStore{client: client, namespace: namespace}
+}
+
+func (s *configMapCRLStore) Load() ([]RevokedCertificate, error) {
+	cm, err := s.client.ConfigMaps(s.namespace).Get(context.TODO(), CRLConfigMap, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseRevokedCerts(cm)
+}
+
+func (s *configMapCRLStore) Update(f func([]RevokedCertificate) []RevokedCertificate) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.client.ConfigMaps(s.namespace).Get(context.TODO(), CRLConfigMap, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		create := errors.IsNotFound(err)
+		if create {
+			cm = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: CRLConfigMap, Namespace: s.namespace}}
+		}
+		stored, err := parseRevokedCerts(cm)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(f(stored))
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[RevokedCertsKey] = string(b)
+		if create {
+			_, err = s.client.ConfigMaps(s.namespace).Create(context.TODO(), cm, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				// Created concurrently, retry as an update.
+				return errors.NewConflict(v1.Resource("configmaps"), CRLConfigMap, err)
+			}
+			return err
+		}
+		_, err = s.client.ConfigMaps(s.namespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func parseRevokedCerts(cm *v1.ConfigMap) ([]RevokedCertificate, error) {
+	data := cm.Data[RevokedCertsKey]
+	if data == "" {
+		return nil, nil
+	}
+	var revoked []RevokedCertificate
+	if err := json.Unmarshal([]byte(data), &revoked); err != nil {
+		return nil, fmt.Errorf("invalid %s in configmap %s/%s: %v", RevokedCertsKey, cm.Namespace, cm.Name, err)
+	}
+	return revoked, nil
+}
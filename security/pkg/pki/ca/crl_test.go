@@ -0,0 +1,263 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func createSelfSignedCA(t *testing.T, store CRLStore) *IstioCA {
+	t.Helper()
+	rootCert, rootKey, err := util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		Org:          "Root CA",
+		ECSigAlg:     util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := util.NewVerifiedKeyCertBundleFromPem(rootCert, rootKey, nil, rootCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := NewIstioCA(&IstioCAOptions{
+		DefaultCertTTL: time.Hour,
+		MaxCertTTL:     time.Hour,
+		KeyCertBundle:  bundle,
+		CRLStore:       store,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func signWorkloadCert(t *testing.T, ca *IstioCA) []byte {
+	t.Helper()
+	csr, _, err := util.GenCSR(util.CertOptions{Host: "spiffe://cluster.local/ns/foo/sa/bar", ECSigAlg: util.EcdsaSigAlg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ca.Sign(csr, CertOpts{SubjectIDs: []string{"spiffe://cluster.local/ns/foo/sa/bar"}, TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func parseCRL(t *testing.T, ca *IstioCA, crlPEM []byte) []*big.Int {
+	t.Helper()
+	block, _ := pem.Decode(crlPEM)
+	if block == nil || block.Type != "X509 CRL" {
+		t.Fatalf("invalid CRL %q", crlPEM)
+	}
+	crl, err := x509.ParseCRL(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingCert, _, _, _ := ca.GetCAKeyCertBundle().GetAll()
+	if err := signingCert.CheckCRLSignature(crl); err != nil {
+		t.Fatalf("CRL is not signed by the CA: %v", err)
+	}
+	var serials []*big.Int
+	for _, rc := range crl.TBSCertList.RevokedCertificates {
+		serials = append(serials, rc.SerialNumber)
+	}
+	return serials
+}
+
+func TestRevokeCertificate(t *testing.T) {
+	ca := createSelfSignedCA(t, nil)
+	if crl := ca.GetCRL(); crl != nil {
+		t.Fatalf("expected no CRL before revocation, got %q", crl)
+	}
+	notified := 0
+	ca.AddCRLHandler(func() { notified++ })
+
+	certPEM := signWorkloadCert(t, ca)
+	cert, err := util.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.RevokeCertificate(certPEM); err != nil {
+		t.Fatal(err)
+	}
+	serials := parseCRL(t, ca, ca.GetCRL())
+	if len(serials) != 1 || serials[0].Cmp(cert.SerialNumber) != 0 {
+		t.Fatalf("expected CRL to list %v, got %v", cert.SerialNumber, serials)
+	}
+	if notified != 1 {
+		t.Fatalf("expected 1 CRL notification, got %d", notified)
+	}
+	revoked := ca.RevokedCertificates()
+	if len(revoked) != 1 || !revoked[0].Expiration.Equal(cert.NotAfter) {
+		t.Fatalf("unexpected revoked certificates %+v", revoked)
+	}
+
+	if err := ca.Revoke(big.NewInt(42)); err != nil {
+		t.Fatal(err)
+	}
+	if serials := parseCRL(t, ca, ca.GetCRL()); len(serials) != 2 || serials[0].Int64() != 42 {
+		t.Fatalf("expected CRL to list 2 certificates ordered by serial, got %v", serials)
+	}
+
+	// Certificates issued by another CA are rejected.
+	other := createSelfSignedCA(t, nil)
+	if err := ca.RevokeCertificate(signWorkloadCert(t, other)); err == nil {
+		t.Fatal("expected revocation of a certificate issued by another CA to fail")
+	}
+}
+
+func TestRevokeExpired(t *testing.T) {
+	ca := createSelfSignedCA(t, nil)
+	ca.revocation.add(RevokedCertificate{SerialNumber: big.NewInt(1), Expiration: time.Now().Add(-time.Minute)})
+	if err := ca.Revoke(big.NewInt(2)); err != nil {
+		t.Fatal(err)
+	}
+	if serials := parseCRL(t, ca, ca.GetCRL()); len(serials) != 1 || serials[0].Int64() != 2 {
+		t.Fatalf("expected expired revocation to be pruned, got %v", serials)
+	}
+
+	// Once every revoked certificate has expired, no CRL is published.
+	ca.revocation.revoked = map[string]RevokedCertificate{
+		"2": {SerialNumber: big.NewInt(2), Expiration: time.Now().Add(-time.Minute)},
+	}
+	notified := false
+	ca.AddCRLHandler(func() { notified = true })
+	ca.refreshCRL()
+	if crl := ca.GetCRL(); crl != nil || !notified {
+		t.Fatalf("expected CRL to be removed, got %q", crl)
+	}
+}
+
+func TestRevokeUnsupported(t *testing.T) {
+	// The intermediate CA requires the CRLs of the CAs in its cert chain.
+	ca, err := createCA(time.Hour, util.EcdsaSigAlg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.Revoke(big.NewInt(1)); err == nil || !strings.Contains(err.Error(), CRLChainFile) {
+		t.Fatalf("expected missing %s error, got %v", CRLChainFile, err)
+	}
+	upstream := []byte("-----BEGIN X509 CRL-----\nupstream\n-----END X509 CRL-----\n")
+	ca.revocation.upstreamCRLs = upstream
+	if err := ca.Revoke(big.NewInt(1)); err != nil {
+		t.Fatal(err)
+	}
+	if crl := ca.GetCRL(); !strings.HasSuffix(string(crl), string(upstream)) {
+		t.Fatalf("expected upstream CRLs to be published, got %q", crl)
+	}
+
+	// Signing certs without the cRLSign key usage cannot sign CRLs.
+	bundle, err := util.NewVerifiedKeyCertBundleFromPem([]byte(cert1Pem), []byte(key1Pem), nil, []byte(cert1Pem))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err = NewIstioCA(&IstioCAOptions{DefaultCertTTL: time.Hour, MaxCertTTL: time.Hour, KeyCertBundle: bundle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.Revoke(big.NewInt(1)); err == nil || !strings.Contains(err.Error(), "cRLSign") {
+		t.Fatalf("expected cRLSign error, got %v", err)
+	}
+}
+
+func TestConfigMapCRLStore(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	store := NewConfigMapCRLStore(client.CoreV1(), "istio-system")
+	ca := createSelfSignedCA(t, store)
+	if err := ca.Revoke(big.NewInt(7)); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].SerialNumber.Int64() != 7 {
+		t.Fatalf("unexpected stored revocations %+v", stored)
+	}
+
+	// Another replica sharing the store picks up the revocation.
+	replica, err := NewIstioCA(&IstioCAOptions{
+		DefaultCertTTL: time.Hour,
+		MaxCertTTL:     time.Hour,
+		KeyCertBundle:  ca.GetCAKeyCertBundle(),
+		CRLStore:       store,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica.refreshCRL()
+	if serials := parseCRL(t, replica, replica.GetCRL()); len(serials) != 1 || serials[0].Int64() != 7 {
+		t.Fatalf("expected replica to load the stored revocation, got %v", serials)
+	}
+	if err := replica.Revoke(big.NewInt(8)); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := store.Load(); len(stored) != 2 {
+		t.Fatalf("expected 2 stored revocations, got %+v", stored)
+	}
+}
+
+// readingStore reads the CRL of the CA while storing revocations, as a concurrent request would.
+type readingStore struct {
+	ca     *IstioCA
+	stored []RevokedCertificate
+}
+
+func (s *readingStore) Load() ([]RevokedCertificate, error) {
+	return s.stored, nil
+}
+
+func (s *readingStore) Update(f func([]RevokedCertificate) []RevokedCertificate) error {
+	s.ca.GetCRL()
+	s.stored = f(s.stored)
+	return nil
+}
+
+func TestRevokeDoesNotLockWhileStoring(t *testing.T) {
+	store := &readingStore{}
+	ca := createSelfSignedCA(t, store)
+	store.ca = ca
+	done := make(chan error, 1)
+	go func() {
+		done <- ca.Revoke(big.NewInt(7))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the CRL could not be read while the revocation was stored")
+	}
+	if len(store.stored) != 1 {
+		t.Fatalf("expected 1 stored revocation, got %+v", store.stored)
+	}
+	if serials := parseCRL(t, ca, ca.GetCRL()); len(serials) != 1 || serials[0].Int64() != 7 {
+		t.Fatalf("unexpected CRL serials %v", serials)
+	}
+}
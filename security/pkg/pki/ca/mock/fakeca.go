@@ -26,6 +26,9 @@ type FakeCA struct {
 	SignErr       *caerror.Error
 	KeyCertBundle *util.KeyCertBundle
 	ReceivedIDs   []string
+	CRL           []byte
+	RevokeErr     error
+	Revoked       [][]byte
 }
 
 // Sign returns the SignErr if SignErr is not nil, otherwise, it returns SignedCert.
@@ -57,3 +60,17 @@ func (ca *FakeCA) GetCAKeyCertBundle() *util.KeyCertBundle {
 	}
 	return ca.KeyCertBundle
 }
+
+// GetCRL returns CRL.
+func (ca *FakeCA) GetCRL() []byte {
+	return ca.CRL
+}
+
+// RevokeCertificate returns RevokeErr if it is not nil, otherwise, it adds the certificate to Revoked.
+func (ca *FakeCA) RevokeCertificate(certPEM []byte) error {
+	if ca.RevokeErr != nil {
+		return ca.RevokeErr
+	}
+	ca.Revoked = append(ca.Revoked, certPEM)
+	return nil
+}
@@ -0,0 +1,280 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/log"
+)
+
+var pluggedCertRotatorLog = log.RegisterScope("pluggedcertrotator", "Plugged-in CA cert rotator log", 0)
+
+// PluggedCertRotatorConfig configures the PluggedCertRotator.
+type PluggedCertRotatorConfig struct {
+	SigningCertFile string
+	SigningKeyFile  string
+	CertChainFile   string
+	RootCertFile    string
+	// CRLChainFile, if set, holds the CRLs of the CAs in the cert chain.
+	CRLChainFile string
+	// RootOverlap is how long roots removed from RootCertFile keep being published, so workloads
+	// still trust peers holding certificates issued under them until those are renewed.
+	RootOverlap time.Duration
+	// CheckInterval is how often retired roots are checked for removal.
+	CheckInterval time.Duration
+}
+
+// retiredRoot is a root removed from the root cert file, published until the end of the overlap window.
+type retiredRoot struct {
+	cert  *x509.Certificate
+	until time.Time
+}
+
+// pluggedCerts holds the contents of the plugged-in cert files.
+type pluggedCerts struct {
+	signingCert []byte
+	signingKey  []byte
+	certChain   []byte
+	rootCert    []byte
+	crlChain    []byte
+}
+
+func (c pluggedCerts) equal(o pluggedCerts) bool {
+	return bytes.Equal(c.signingCert, o.signingCert) && bytes.Equal(c.signingKey, o.signingKey) &&
+		bytes.Equal(c.certChain, o.certChain) && bytes.Equal(c.rootCert, o.rootCert) && bytes.Equal(c.crlChain, o.crlChain)
+}
+
+// PluggedCertRotator reloads the plugged-in CA key and certificates when they change, and switches the CA
+// to them atomically. Roots removed by a rotation keep being published for the overlap window.
+type PluggedCertRotator struct {
+	config *PluggedCertRotatorConfig
+	ca     *IstioCA
+
+	mu           sync.Mutex
+	current      pluggedCerts
+	retiredRoots []retiredRoot
+	handlers     []func()
+}
+
+// NewPluggedCertRotator returns a rotator for a CA created with NewPluggedCertIstioCAOptions from the same files.
+func NewPluggedCertRotator(config *PluggedCertRotatorConfig, ca *IstioCA) (*PluggedCertRotator, error) {
+	current, err := readPluggedCerts(config)
+	if err != nil {
+		return nil, err
+	}
+	return &PluggedCertRotator{config: config, ca: ca, current: current}, nil
+}
+
+// AddHandler adds a handler called after the CA key and certificates, or the published roots, changed.
+func (r *PluggedCertRotator) AddHandler(h func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = append(r.handlers, h)
+}
+
+// Run removes retired roots once their overlap window ends.
+func (r *PluggedCertRotator) Run(stopCh <-chan struct{}) {
+	interval := r.config.CheckInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.pruneRetiredRoots(time.Now()); err != nil {
+				pluggedCertRotatorLog.Errorf("failed to remove retired roots: %v", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// Reload reads the plugged-in cert files, and switches the CA to them if they changed. The CA keeps using the
+// previous key and certificates if the new ones are invalid.
+func (r *PluggedCertRotator) Reload() error {
+	certs, err := readPluggedCerts(r.config)
+	if err != nil {
+		return err
+	}
+	if err := verifyPluggedSigningCert(certs.signingCert); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	if certs.equal(r.current) {
+		r.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	// Roots that are no longer in the root cert file are retired, roots added back are no longer retired.
+	newRoots, err := parsePemCerts(certs.rootCert)
+	if err != nil {
+		r.mu.Unlock()
+		return fmt.Errorf("invalid root cert file %s: %v", r.config.RootCertFile, err)
+	}
+	oldRoots, _ := parsePemCerts(r.current.rootCert)
+	retired := []retiredRoot{}
+	for _, rr := range r.retiredRoots {
+		if !containsCert(newRoots, rr.cert) {
+			retired = append(retired, rr)
+		}
+	}
+	for _, c := range oldRoots {
+		if !containsCert(newRoots, c) && !containsRetired(retired, c) && r.config.RootOverlap > 0 {
+			retired = append(retired, retiredRoot{cert: c, until: now.Add(r.config.RootOverlap)})
+		}
+	}
+	prevCert, prevKey, _, _ := r.ca.GetCAKeyCertBundle().GetAll()
+	if err := r.ca.GetCAKeyCertBundle().VerifyAndSetAll(certs.signingCert, certs.signingKey, certs.certChain,
+		publishedRoots(certs.rootCert, retired)); err != nil {
+		r.mu.Unlock()
+		return fmt.Errorf("failed to switch to the new CA certificates: %v", err)
+	}
+	r.ca.rotateCRLSigner(prevCert, prevKey, certs.crlChain)
+	r.current = certs
+	r.retiredRoots = retired
+	handlers := append([]func(){}, r.handlers...)
+	r.mu.Unlock()
+
+	pluggedCertRotatorLog.Infof("switched to the new plugged-in CA certificates, %d retired roots are still published", len(retired))
+	// Sign the CRL with the new signing cert, the previous one keeps signing a CRL for the certificates it issued.
+	r.ca.refreshCRL()
+	for _, h := range handlers {
+		h()
+	}
+	return nil
+}
+
+func (r *PluggedCertRotator) pruneRetiredRoots(now time.Time) error {
+	r.mu.Lock()
+	retired := []retiredRoot{}
+	for _, rr := range r.retiredRoots {
+		if now.Before(rr.until) {
+			retired = append(retired, rr)
+		}
+	}
+	if len(retired) == len(r.retiredRoots) {
+		r.mu.Unlock()
+		return nil
+	}
+	c := r.current
+	if err := r.ca.GetCAKeyCertBundle().VerifyAndSetAll(c.signingCert, c.signingKey, c.certChain,
+		publishedRoots(c.rootCert, retired)); err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	r.retiredRoots = retired
+	handlers := append([]func(){}, r.handlers...)
+	r.mu.Unlock()
+
+	pluggedCertRotatorLog.Infof("root overlap window ended, %d retired roots are still published", len(retired))
+	for _, h := range handlers {
+		h()
+	}
+	return nil
+}
+
+func readPluggedCerts(config *PluggedCertRotatorConfig) (pluggedCerts, error) {
+	certs := pluggedCerts{}
+	var err error
+	if certs.signingCert, err = ioutil.ReadFile(config.SigningCertFile); err != nil {
+		return certs, err
+	}
+	if certs.signingKey, err = ioutil.ReadFile(config.SigningKeyFile); err != nil {
+		return certs, err
+	}
+	if config.CertChainFile != "" {
+		if certs.certChain, err = ioutil.ReadFile(config.CertChainFile); err != nil {
+			return certs, err
+		}
+	}
+	if certs.rootCert, err = ioutil.ReadFile(config.RootCertFile); err != nil {
+		return certs, err
+	}
+	if config.CRLChainFile != "" {
+		// The CRL chain is optional.
+		certs.crlChain, _ = ioutil.ReadFile(config.CRLChainFile)
+	}
+	return certs, nil
+}
+
+// verifyPluggedSigningCert checks that the PEM encoded signing cert can be used as CA.
+func verifyPluggedSigningCert(certPEM []byte) error {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return fmt.Errorf("invalid PEM encoded certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse X.509 certificate")
+	}
+	if !cert.IsCA {
+		return fmt.Errorf("certificate is not authorized to sign other certificates")
+	}
+	return nil
+}
+
+// publishedRoots returns the roots in the root cert file, followed by the retired roots.
+func publishedRoots(rootCert []byte, retired []retiredRoot) []byte {
+	roots := rootCert
+	for _, rr := range retired {
+		roots = util.AppendCertByte(roots, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rr.cert.Raw}))
+	}
+	return roots
+}
+
+func parsePemCerts(b []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			return certs, nil
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+func containsCert(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRetired(retired []retiredRoot, cert *x509.Certificate) bool {
+	for _, rr := range retired {
+		if rr.cert.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,378 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+type testPluggedCerts struct {
+	rootCert, rootKey []byte
+	certChain         []byte
+	signingCert       []byte
+	signingKey        []byte
+}
+
+func genTestRoot(t *testing.T, org string) testPluggedCerts {
+	t.Helper()
+	cert, key, err := util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		Org:          org,
+		ECSigAlg:     util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testPluggedCerts{rootCert: cert, rootKey: key}
+}
+
+// genTestIntermediate returns plugged-in certs with an intermediate signed by the root.
+func genTestIntermediate(t *testing.T, root testPluggedCerts) testPluggedCerts {
+	t.Helper()
+	rootCert, err := util.ParsePemEncodedCertificate(root.rootCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootKey, err := util.ParsePemEncodedKey(root.rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, key, err := util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA:       true,
+		TTL:        time.Hour,
+		Org:        "Intermediate CA",
+		SignerCert: rootCert,
+		SignerPriv: rootKey,
+		ECSigAlg:   util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.signingCert, root.signingKey, root.certChain = cert, key, cert
+	return root
+}
+
+func writeTestPluggedCerts(t *testing.T, config *PluggedCertRotatorConfig, certs testPluggedCerts) {
+	t.Helper()
+	for f, b := range map[string][]byte{
+		config.SigningCertFile: certs.signingCert,
+		config.SigningKeyFile:  certs.signingKey,
+		config.CertChainFile:   certs.certChain,
+		config.RootCertFile:    certs.rootCert,
+	} {
+		if err := ioutil.WriteFile(f, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func createPluggedCertCA(t *testing.T, certs testPluggedCerts, overlap time.Duration) (*IstioCA, *PluggedCertRotator) {
+	t.Helper()
+	dir := t.TempDir()
+	config := &PluggedCertRotatorConfig{
+		SigningCertFile: filepath.Join(dir, CACertFile),
+		SigningKeyFile:  filepath.Join(dir, CAPrivateKeyFile),
+		CertChainFile:   filepath.Join(dir, CertChainFile),
+		RootCertFile:    filepath.Join(dir, RootCertFile),
+		RootOverlap:     overlap,
+	}
+	writeTestPluggedCerts(t, config, certs)
+	opts, err := NewPluggedCertIstioCAOptions(config.CertChainFile, config.SigningCertFile, config.SigningKeyFile,
+		config.RootCertFile, time.Hour, time.Hour, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := NewIstioCA(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewPluggedCertRotator(config, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca, r
+}
+
+func TestPluggedCertRotatorIntermediate(t *testing.T) {
+	root := genTestRoot(t, "Root CA")
+	ca, r := createPluggedCertCA(t, genTestIntermediate(t, root), time.Hour)
+	notified := 0
+	r.AddHandler(func() { notified++ })
+
+	// Nothing changed.
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if notified != 0 {
+		t.Fatalf("expected no notification for unchanged files, got %d", notified)
+	}
+
+	next := genTestIntermediate(t, root)
+	writeTestPluggedCerts(t, r.config, next)
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if notified != 1 {
+		t.Fatalf("expected 1 notification, got %d", notified)
+	}
+	_, _, certChain, rootCert := ca.GetCAKeyCertBundle().GetAllPem()
+	if !bytes.Equal(certChain, next.certChain) {
+		t.Errorf("CA is not using the new cert chain")
+	}
+	if !bytes.Equal(rootCert, root.rootCert) {
+		t.Errorf("expected the root to be unchanged, got %q", rootCert)
+	}
+	// Workload certs are issued by the new intermediate.
+	cert, err := util.ParsePemEncodedCertificate(signWorkloadCert(t, ca))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingCert, err := util.ParsePemEncodedCertificate(next.signingCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckSignatureFrom(signingCert); err != nil {
+		t.Errorf("workload cert is not signed by the new intermediate: %v", err)
+	}
+}
+
+func TestPluggedCertRotatorRootOverlap(t *testing.T) {
+	oldRoot := genTestRoot(t, "Old Root CA")
+	ca, r := createPluggedCertCA(t, genTestIntermediate(t, oldRoot), time.Hour)
+	notified := 0
+	r.AddHandler(func() { notified++ })
+
+	newRoot := genTestRoot(t, "New Root CA")
+	writeTestPluggedCerts(t, r.config, genTestIntermediate(t, newRoot))
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	roots, err := parsePemCerts(ca.GetCAKeyCertBundle().GetRootCertPem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 2 || roots[0].Subject.Organization[0] != "New Root CA" || roots[1].Subject.Organization[0] != "Old Root CA" {
+		t.Fatalf("expected the new and old roots to be published, got %d roots", len(roots))
+	}
+
+	// The old root is still published during the overlap window.
+	if err := r.pruneRetiredRoots(time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if notified != 1 {
+		t.Fatalf("expected 1 notification, got %d", notified)
+	}
+
+	if err := r.pruneRetiredRoots(time.Now().Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if notified != 2 {
+		t.Fatalf("expected 2 notifications, got %d", notified)
+	}
+	if got := ca.GetCAKeyCertBundle().GetRootCertPem(); !bytes.Equal(got, newRoot.rootCert) {
+		t.Errorf("expected only the new root after the overlap window, got %q", got)
+	}
+}
+
+func TestPluggedCertRotatorInvalid(t *testing.T) {
+	root := genTestRoot(t, "Root CA")
+	initial := genTestIntermediate(t, root)
+	ca, r := createPluggedCertCA(t, initial, time.Hour)
+	notified := 0
+	r.AddHandler(func() { notified++ })
+
+	cases := []struct {
+		name  string
+		certs testPluggedCerts
+	}{
+		{
+			name: "untrusted intermediate",
+			certs: func() testPluggedCerts {
+				c := genTestIntermediate(t, genTestRoot(t, "Other Root CA"))
+				c.rootCert = root.rootCert
+				return c
+			}(),
+		},
+		{
+			name: "mismatched key",
+			certs: func() testPluggedCerts {
+				c := genTestIntermediate(t, root)
+				c.signingKey = initial.signingKey
+				return c
+			}(),
+		},
+		{
+			name: "invalid signing cert",
+			certs: func() testPluggedCerts {
+				c := genTestIntermediate(t, root)
+				c.signingCert, c.signingKey = []byte("invalid"), []byte("invalid")
+				return c
+			}(),
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			writeTestPluggedCerts(t, r.config, tc.certs)
+			if err := r.Reload(); err == nil {
+				t.Fatal("expected reload to fail")
+			}
+			if notified != 0 {
+				t.Fatalf("expected no notification, got %d", notified)
+			}
+			// The CA keeps using the last good certs.
+			signingCert, _, certChain, rootCert := ca.GetCAKeyCertBundle().GetAllPem()
+			if !bytes.Equal(signingCert, initial.signingCert) || !bytes.Equal(certChain, initial.certChain) ||
+				!bytes.Equal(rootCert, initial.rootCert) {
+				t.Fatal("CA is not using the last good certs")
+			}
+		})
+	}
+}
+
+// genTestRootCRL returns an empty PEM encoded CRL signed by the root.
+func genTestRootCRL(t *testing.T, root testPluggedCerts) []byte {
+	t.Helper()
+	rootCert, err := util.ParsePemEncodedCertificate(root.rootCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootKey, err := util.ParsePemEncodedKey(root.rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, _, _, err := signCRL(nil, big.NewInt(0), rootCert, rootKey.(crypto.Signer), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crl
+}
+
+// verifyCRLs checks that the CRLs hold a CRL signed by the issuer of every certificate in the chain, as proxies
+// require, and returns whether the leaf certificate is revoked.
+func verifyCRLs(t *testing.T, crlPEM []byte, chain ...[]byte) bool {
+	t.Helper()
+	var crls []*pkix.CertificateList
+	for rest := crlPEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		crl, err := x509.ParseCRL(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		crls = append(crls, crl)
+	}
+	certs := make([]*x509.Certificate, 0, len(chain))
+	for _, c := range chain {
+		cert, err := util.ParsePemEncodedCertificate(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, cert)
+	}
+	revoked := false
+	for i := 0; i < len(certs)-1; i++ {
+		found := false
+		for _, crl := range crls {
+			if certs[i+1].CheckCRLSignature(crl) != nil {
+				continue
+			}
+			found = true
+			for _, rc := range crl.TBSCertList.RevokedCertificates {
+				if rc.SerialNumber.Cmp(certs[i].SerialNumber) == 0 {
+					if i > 0 {
+						t.Fatalf("CA certificate %v is revoked", certs[i].Subject)
+					}
+					revoked = true
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("no CRL is signed by %v", certs[i+1].Subject)
+		}
+	}
+	return revoked
+}
+
+func TestPluggedCertRotatorRetiredCRL(t *testing.T) {
+	root := genTestRoot(t, "Root CA")
+	initial := genTestIntermediate(t, root)
+	ca, r := createPluggedCertCA(t, initial, time.Hour)
+	rootCRL := genTestRootCRL(t, root)
+	r.config.CRLChainFile = filepath.Join(filepath.Dir(r.config.RootCertFile), CRLChainFile)
+	if err := ioutil.WriteFile(r.config.CRLChainFile, rootCRL, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r.current.crlChain = rootCRL
+	ca.revocation.upstreamCRLs = rootCRL
+
+	oldCert := signWorkloadCert(t, ca)
+	revokedCert := signWorkloadCert(t, ca)
+	if err := ca.RevokeCertificate(revokedCert); err != nil {
+		t.Fatal(err)
+	}
+
+	next := genTestIntermediate(t, root)
+	writeTestPluggedCerts(t, r.config, next)
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	newCert := signWorkloadCert(t, ca)
+
+	// Certificates issued by the retired intermediate are still accepted, unless they are revoked.
+	crl := ca.GetCRL()
+	if verifyCRLs(t, crl, oldCert, initial.signingCert, root.rootCert) {
+		t.Error("expected the certificate issued by the retired intermediate not to be revoked")
+	}
+	if !verifyCRLs(t, crl, revokedCert, initial.signingCert, root.rootCert) {
+		t.Error("expected the revoked certificate issued by the retired intermediate to be revoked")
+	}
+	if verifyCRLs(t, crl, newCert, next.signingCert, root.rootCert) {
+		t.Error("expected the certificate issued by the new intermediate not to be revoked")
+	}
+	if n := strings.Count(string(crl), "BEGIN X509 CRL"); n != 3 {
+		t.Errorf("expected the CRLs of both intermediates and of the root, got %d CRLs", n)
+	}
+
+	// Certificates of the retired intermediate are still revocable.
+	if err := ca.RevokeCertificate(oldCert); err != nil {
+		t.Fatal(err)
+	}
+	if !verifyCRLs(t, ca.GetCRL(), oldCert, initial.signingCert, root.rootCert) {
+		t.Error("expected the certificate issued by the retired intermediate to be revoked")
+	}
+
+	// The retired intermediate stops signing a CRL once the certificates it issued expired.
+	ca.revocation.retired[0].until = time.Now().Add(-time.Second)
+	ca.refreshCRL()
+	if n := strings.Count(string(ca.GetCRL()), "BEGIN X509 CRL"); n != 2 {
+		t.Errorf("expected the CRLs of the new intermediate and of the root, got %d CRLs", n)
+	}
+}
@@ -50,6 +50,8 @@ type IstioRAOptions struct {
 	K8sClient certificatesv1beta1.CertificatesV1beta1Interface
 	// TrustDomain
 	TrustDomain string
+	// HTTPSigner : Configuration of the external HTTP signer, used with ExtCAHTTP
+	HTTPSigner *HTTPSignerConfig
 }
 
 const (
@@ -59,6 +61,9 @@ const (
 	// ExtCAGrpc : Integration with external CA using Istio CA gRPC API
 	ExtCAGrpc CaExternalType = "ISTIOD_RA_ISTIO_API"
 
+	// ExtCAHTTP : Integration with external CA using an HTTP signing API, such as Vault PKI
+	ExtCAHTTP CaExternalType = "ISTIOD_RA_HTTP_API"
+
 	// DefaultExtCACertDir : Location of external CA certificate
 	DefaultExtCACertDir string = "./etc/external-ca-cert"
 )
@@ -99,6 +104,13 @@ func NewIstioRA(opts *IstioRAOptions) (RegistrationAuthority, error) {
 		}
 		return istioRA, err
 	}
+	if opts.ExternalCAType == ExtCAHTTP {
+		istioRA, err := NewHTTPRA(opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create an HTTP CA: %v", err)
+		}
+		return istioRA, err
+	}
 	return nil, fmt.Errorf("invalid CA Name %s", opts.ExternalCAType)
 }
 
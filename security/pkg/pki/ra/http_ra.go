@@ -0,0 +1,429 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ra
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/istio/pkg/spiffe"
+	"istio.io/istio/security/pkg/pki/ca"
+	raerror "istio.io/istio/security/pkg/pki/error"
+	"istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/log"
+)
+
+var httpRALog = log.RegisterScope("httpra", "HTTP registration authority log", 0)
+
+// HTTPSignerProtocol is the API used to request certificates from an HTTP signer.
+type HTTPSignerProtocol string
+
+const (
+	// HTTPSignerVault requests certificates from the sign endpoint of the HashiCorp Vault PKI secrets engine.
+	// The token is sent in the X-Vault-Token header.
+	HTTPSignerVault HTTPSignerProtocol = "vault"
+	// HTTPSignerPEM posts the CSR as JSON and reads back the certificate followed by its chain as
+	// application/pem-certificate-chain, the format ACME servers use to download certificates (RFC 8555 section 9.1).
+	// The token is sent as a bearer token.
+	HTTPSignerPEM HTTPSignerProtocol = "pem"
+
+	defaultHTTPSignerTimeout      = 10 * time.Second
+	defaultHTTPSignerRetries      = 3
+	defaultHTTPSignerRetryBackoff = 500 * time.Millisecond
+)
+
+// HTTPSignerConfig configures the external HTTP signer used by the HTTPRA.
+type HTTPSignerConfig struct {
+	// URL is the base URL of the signer, the profile paths are relative to it.
+	URL string `json:"url"`
+	// Protocol is the API of the signer.
+	Protocol HTTPSignerProtocol `json:"protocol"`
+	// TokenFile, if set, holds the token used to authenticate to the signer. It is read on every request,
+	// so the token can be rotated.
+	TokenFile string `json:"tokenFile,omitempty"`
+	// CACertFile, if set, holds the roots used to verify the TLS certificate of the signer, instead of
+	// the system roots.
+	CACertFile string `json:"caCertFile,omitempty"`
+	// Timeout of a single signing request.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+	// Retries is the number of times a failed request is retried. Only connection errors, 429 and 5xx
+	// responses are retried.
+	Retries *int `json:"retries,omitempty"`
+	// RetryBackoff is the delay before the first retry, doubled for every further retry.
+	RetryBackoff metav1.Duration `json:"retryBackoff,omitempty"`
+	// Profiles are the issuer profiles of the signer. The first profile matching the namespace of the
+	// workload is used.
+	Profiles []IssuerProfile `json:"profiles"`
+}
+
+// IssuerProfile is an issuer of the signer, such as a Vault PKI role.
+type IssuerProfile struct {
+	Name string `json:"name"`
+	// Path of the signing endpoint, relative to the signer URL, e.g. "v1/pki_int/sign/istio-workload".
+	Path string `json:"path"`
+	// Namespaces whose workloads get certificates from this profile. A profile without namespaces
+	// matches all workloads.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// MaxTTL, if set, caps the lifetime requested from this profile.
+	MaxTTL metav1.Duration `json:"maxTTL,omitempty"`
+	// Headers are added to the requests, e.g. X-Vault-Namespace.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// LoadHTTPSignerConfig reads the YAML or JSON HTTPSignerConfig in the given file.
+func LoadHTTPSignerConfig(file string) (*HTTPSignerConfig, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	config := &HTTPSignerConfig{}
+	if err := yaml.UnmarshalStrict(b, config); err != nil {
+		return nil, fmt.Errorf("failed to parse HTTP signer config %s: %v", file, err)
+	}
+	return config, nil
+}
+
+func (c *HTTPSignerConfig) validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("url must be set")
+	}
+	if c.Protocol != HTTPSignerVault && c.Protocol != HTTPSignerPEM {
+		return fmt.Errorf("unknown protocol %q, must be %q or %q", c.Protocol, HTTPSignerVault, HTTPSignerPEM)
+	}
+	if len(c.Profiles) == 0 {
+		return fmt.Errorf("at least one issuer profile must be configured")
+	}
+	for _, p := range c.Profiles {
+		if p.Path == "" {
+			return fmt.Errorf("issuer profile %q has no path", p.Name)
+		}
+	}
+	return nil
+}
+
+// HTTPRA integrates with an external CA over an HTTP signing API, so Istiod never holds a signing key.
+type HTTPRA struct {
+	raOpts        *IstioRAOptions
+	config        *HTTPSignerConfig
+	client        *http.Client
+	keyCertBundle *util.KeyCertBundle
+	roots         *x509.CertPool
+	retries       int
+	retryBackoff  time.Duration
+}
+
+// NewHTTPRA : Create a RA that forwards CSRs to an external HTTP signer
+func NewHTTPRA(raOpts *IstioRAOptions) (*HTTPRA, error) {
+	config := raOpts.HTTPSigner
+	if config == nil {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("no HTTP signer configured"))
+	}
+	if err := config.validate(); err != nil {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("invalid HTTP signer config: %v", err))
+	}
+	keyCertBundle, err := util.NewKeyCertBundleWithRootCertFromFile(raOpts.CaCertFile)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("error processing Certificate Bundle for HTTP RA"))
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(keyCertBundle.GetRootCertPem()) {
+		return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("no root certificate found in %s", raOpts.CaCertFile))
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.CACertFile != "" {
+		b, err := ioutil.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, raerror.NewError(raerror.CAInitFail, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(b) {
+			return nil, raerror.NewError(raerror.CAInitFail, fmt.Errorf("no certificate found in %s", config.CACertFile))
+		}
+	}
+	timeout := config.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultHTTPSignerTimeout
+	}
+	r := &HTTPRA{
+		raOpts:        raOpts,
+		config:        config,
+		keyCertBundle: keyCertBundle,
+		roots:         roots,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+		retries:      defaultHTTPSignerRetries,
+		retryBackoff: defaultHTTPSignerRetryBackoff,
+	}
+	if config.Retries != nil {
+		r.retries = *config.Retries
+	}
+	if config.RetryBackoff.Duration > 0 {
+		r.retryBackoff = config.RetryBackoff.Duration
+	}
+	return r, nil
+}
+
+// Sign takes a PEM-encoded CSR and cert opts, and returns the certificate issued by the external signer,
+// followed by the intermediate certificates up to, but excluding, the root.
+func (r *HTTPRA) Sign(csrPEM []byte, certOpts ca.CertOpts) ([]byte, error) {
+	lifetime, err := preSign(r.raOpts, csrPEM, certOpts.SubjectIDs, certOpts.TTL, certOpts.ForCA)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := r.selectProfile(certOpts.SubjectIDs)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CSRError, err)
+	}
+	if profile.MaxTTL.Duration > 0 && lifetime > profile.MaxTTL.Duration {
+		lifetime = profile.MaxTTL.Duration
+	}
+	csr, err := util.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CSRError, err)
+	}
+	certs, err := r.requestWithRetries(profile, csrPEM, lifetime)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CertGenError, fmt.Errorf("issuer profile %q: %v", profile.Name, err))
+	}
+	chain, err := r.assembleChain(csr, certs)
+	if err != nil {
+		return nil, raerror.NewError(raerror.CertGenError, fmt.Errorf("issuer profile %q: %v", profile.Name, err))
+	}
+	return chain, nil
+}
+
+// SignWithCertChain is similar to Sign but returns the leaf cert and the entire cert chain.
+// The chain returned by Sign already includes the intermediate certificates of the profile.
+func (r *HTTPRA) SignWithCertChain(csrPEM []byte, certOpts ca.CertOpts) ([]byte, error) {
+	return r.Sign(csrPEM, certOpts)
+}
+
+// GetCAKeyCertBundle returns the KeyCertBundle for the CA.
+func (r *HTTPRA) GetCAKeyCertBundle() *util.KeyCertBundle {
+	return r.keyCertBundle
+}
+
+// selectProfile returns the first profile matching the namespace of the identities.
+func (r *HTTPRA) selectProfile(subjectIDs []string) (*IssuerProfile, error) {
+	namespaces := map[string]struct{}{}
+	for _, id := range subjectIDs {
+		if identity, err := spiffe.ParseIdentity(id); err == nil {
+			namespaces[identity.Namespace] = struct{}{}
+		}
+	}
+	for i, p := range r.config.Profiles {
+		if len(p.Namespaces) == 0 {
+			return &r.config.Profiles[i], nil
+		}
+		for _, ns := range p.Namespaces {
+			if _, f := namespaces[ns]; f {
+				return &r.config.Profiles[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no issuer profile matches %v", subjectIDs)
+}
+
+// retryableError is a failure that may succeed if the request is retried.
+type retryableError struct {
+	error
+}
+
+func (r *HTTPRA) requestWithRetries(profile *IssuerProfile, csrPEM []byte, lifetime time.Duration) ([]*x509.Certificate, error) {
+	backoff := r.retryBackoff
+	for attempt := 0; ; attempt++ {
+		certs, err := r.request(profile, csrPEM, lifetime)
+		if err == nil {
+			return certs, nil
+		}
+		if _, ok := err.(retryableError); !ok || attempt >= r.retries {
+			return nil, err
+		}
+		httpRALog.Warnf("request to issuer profile %q failed, retrying in %v: %v", profile.Name, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+type signRequest struct {
+	CSR string `json:"csr"`
+	TTL string `json:"ttl"`
+	// Format is the encoding of the certificates returned by Vault.
+	Format string `json:"format,omitempty"`
+}
+
+type vaultSignResponse struct {
+	Data struct {
+		Certificate string   `json:"certificate"`
+		IssuingCA   string   `json:"issuing_ca"`
+		CAChain     []string `json:"ca_chain"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func (r *HTTPRA) request(profile *IssuerProfile, csrPEM []byte, lifetime time.Duration) ([]*x509.Certificate, error) {
+	body := signRequest{CSR: string(csrPEM), TTL: fmt.Sprintf("%ds", int64(lifetime.Seconds()))}
+	if r.config.Protocol == HTTPSignerVault {
+		body.Format = "pem"
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	url := strings.TrimSuffix(r.config.URL, "/") + "/" + strings.TrimPrefix(profile.Path, "/")
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.config.Protocol == HTTPSignerPEM {
+		req.Header.Set("Accept", "application/pem-certificate-chain")
+	}
+	if r.config.TokenFile != "" {
+		token, err := ioutil.ReadFile(r.config.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token: %v", err)
+		}
+		if r.config.Protocol == HTTPSignerVault {
+			req.Header.Set("X-Vault-Token", strings.TrimSpace(string(token)))
+		} else {
+			req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		}
+	}
+	for k, v := range profile.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, retryableError{err}
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, retryableError{err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("signer returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return nil, retryableError{err}
+		}
+		return nil, err
+	}
+
+	if r.config.Protocol == HTTPSignerPEM {
+		return parseCertificates(respBody)
+	}
+	vr := &vaultSignResponse{}
+	if err := json.Unmarshal(respBody, vr); err != nil {
+		return nil, fmt.Errorf("invalid signer response: %v", err)
+	}
+	pemChain := vr.Data.Certificate + "\n"
+	if len(vr.Data.CAChain) > 0 {
+		pemChain += strings.Join(vr.Data.CAChain, "\n")
+	} else {
+		pemChain += vr.Data.IssuingCA
+	}
+	return parseCertificates([]byte(pemChain))
+}
+
+func parseCertificates(pemChain []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for rest := pemChain; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate in signer response: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate in signer response")
+	}
+	return certs, nil
+}
+
+// assembleChain verifies the certificates returned by the signer, and returns the PEM encoded leaf
+// followed by the intermediates chaining it to one of the configured roots. Roots are left out, as they are
+// distributed separately.
+func (r *HTTPRA) assembleChain(csr *x509.CertificateRequest, certs []*x509.Certificate) ([]byte, error) {
+	leaf := certs[0]
+	if !publicKeysEqual(leaf, csr) {
+		return nil, fmt.Errorf("the issued certificate does not match the public key of the CSR")
+	}
+	if !r.raOpts.VerifyAppendCA {
+		var out []byte
+		for _, c := range certs {
+			if c != leaf && bytes.Equal(c.RawIssuer, c.RawSubject) && c.CheckSignatureFrom(c) == nil {
+				// Skip self-signed roots.
+				continue
+			}
+			out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+		}
+		return out, nil
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         r.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify the issued certificate: %v", err)
+	}
+	chain := chains[0]
+	var out []byte
+	// The last certificate of the chain is the root.
+	for _, c := range chain[:len(chain)-1] {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return out, nil
+}
+
+func publicKeysEqual(cert *x509.Certificate, csr *x509.CertificateRequest) bool {
+	certKey, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return false
+	}
+	csrKey, err := x509.MarshalPKIXPublicKey(csr.PublicKey)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(certKey, csrKey)
+}
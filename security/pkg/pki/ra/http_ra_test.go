@@ -0,0 +1,372 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ra
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/istio/pkg/spiffe"
+	"istio.io/istio/security/pkg/pki/ca"
+	raerror "istio.io/istio/security/pkg/pki/error"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+// fakeSigner is an external signer holding an intermediate CA key.
+type fakeSigner struct {
+	t *testing.T
+
+	rootPEM         []byte
+	intermediatePEM []byte
+	intermediate    *x509.Certificate
+	intermediateKey interface{}
+
+	mu sync.Mutex
+	// failures is the number of requests that fail with failureCode before one succeeds.
+	failures    int
+	failureCode int
+	requests    []*http.Request
+	ttls        []string
+}
+
+func newFakeSigner(t *testing.T) *fakeSigner {
+	rootPEM, rootKeyPEM, err := pkiutil.GenCertKeyFromOptions(pkiutil.CertOptions{
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		Org:          "Root CA",
+		ECSigAlg:     pkiutil.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := pkiutil.ParsePemEncodedCertificate(rootPEM)
+	rootKey, _ := pkiutil.ParsePemEncodedKey(rootKeyPEM)
+	intermediatePEM, intermediateKeyPEM, err := pkiutil.GenCertKeyFromOptions(pkiutil.CertOptions{
+		IsCA:       true,
+		TTL:        time.Hour,
+		Org:        "Intermediate CA",
+		SignerCert: root,
+		SignerPriv: rootKey,
+		ECSigAlg:   pkiutil.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, _ := pkiutil.ParsePemEncodedCertificate(intermediatePEM)
+	intermediateKey, _ := pkiutil.ParsePemEncodedKey(intermediateKeyPEM)
+	return &fakeSigner{
+		t:               t,
+		rootPEM:         rootPEM,
+		intermediatePEM: intermediatePEM,
+		intermediate:    intermediate,
+		intermediateKey: intermediateKey,
+	}
+}
+
+func (s *fakeSigner) sign(csrPEM []byte, ttl time.Duration) []byte {
+	csr, err := pkiutil.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	ids, _ := pkiutil.ExtractIDs(csr.Extensions)
+	cert, err := pkiutil.GenCertFromCSR(csr, s.intermediate, csr.PublicKey, s.intermediateKey, ids, ttl, false)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+}
+
+func (s *fakeSigner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	fail := s.failures > 0
+	if fail {
+		s.failures--
+	}
+	s.mu.Unlock()
+	if fail {
+		http.Error(w, "unavailable", s.failureCode)
+		return
+	}
+	req := signRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.ttls = append(s.ttls, req.TTL)
+	s.mu.Unlock()
+	ttl, _ := time.ParseDuration(req.TTL)
+	cert := s.sign([]byte(req.CSR), ttl)
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/"):
+		if r.Header.Get("X-Vault-Token") != "s3cr3t" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		resp := vaultSignResponse{}
+		resp.Data.Certificate = string(cert)
+		resp.Data.IssuingCA = string(s.intermediatePEM)
+		resp.Data.CAChain = []string{string(s.intermediatePEM), string(s.rootPEM)}
+		_ = json.NewEncoder(w).Encode(resp)
+	default:
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write(append(cert, s.intermediatePEM...))
+	}
+}
+
+func createFakeHTTPRA(t *testing.T, signer *fakeSigner, config *HTTPSignerConfig) *HTTPRA {
+	dir := t.TempDir()
+	rootFile := filepath.Join(dir, "root-cert.pem")
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(rootFile, signer.rootPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(tokenFile, []byte("s3cr3t\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(signer)
+	t.Cleanup(server.Close)
+	config.URL = server.URL
+	config.TokenFile = tokenFile
+	config.RetryBackoff = metav1.Duration{Duration: time.Millisecond}
+	r, err := NewIstioRA(&IstioRAOptions{
+		ExternalCAType: ExtCAHTTP,
+		DefaultCertTTL: 30 * time.Minute,
+		MaxCertTTL:     time.Hour,
+		CaCertFile:     rootFile,
+		VerifyAppendCA: true,
+		HTTPSigner:     config,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.(*HTTPRA)
+}
+
+func signWorkload(t *testing.T, r *HTTPRA, ns string, ttl time.Duration) ([]byte, error) {
+	id := spiffe.Identity{TrustDomain: "cluster.local", Namespace: ns, ServiceAccount: "default"}.String()
+	csrPEM, _, err := pkiutil.GenCSR(pkiutil.CertOptions{Host: id, ECSigAlg: pkiutil.EcdsaSigAlg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.Sign(csrPEM, ca.CertOpts{SubjectIDs: []string{id}, TTL: ttl})
+}
+
+func verifyChain(t *testing.T, signer *fakeSigner, chain []byte) {
+	t.Helper()
+	certs, err := parseCertificates(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 {
+		t.Fatalf("expected leaf and intermediate without the root, got %d certificates", len(certs))
+	}
+	if !certs[1].Equal(signer.intermediate) {
+		t.Fatalf("expected the intermediate to follow the leaf")
+	}
+	if err := certs[0].CheckSignatureFrom(signer.intermediate); err != nil {
+		t.Fatalf("leaf is not signed by the intermediate: %v", err)
+	}
+}
+
+func TestHTTPRASign(t *testing.T) {
+	for _, protocol := range []HTTPSignerProtocol{HTTPSignerVault, HTTPSignerPEM} {
+		t.Run(string(protocol), func(t *testing.T) {
+			signer := newFakeSigner(t)
+			path := "acme/finalize"
+			if protocol == HTTPSignerVault {
+				path = "v1/pki_int/sign/istio"
+			}
+			r := createFakeHTTPRA(t, signer, &HTTPSignerConfig{
+				Protocol: protocol,
+				Profiles: []IssuerProfile{{Name: "default", Path: path}},
+			})
+			chain, err := signWorkload(t, r, "default", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifyChain(t, signer, chain)
+			withChain, err := signWorkload(t, r, "default", time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifyChain(t, signer, withChain)
+			if signer.ttls[0] != "1800s" || signer.ttls[1] != "60s" {
+				t.Fatalf("expected the default and requested TTLs, got %v", signer.ttls)
+			}
+		})
+	}
+}
+
+func TestHTTPRAProfiles(t *testing.T) {
+	signer := newFakeSigner(t)
+	r := createFakeHTTPRA(t, signer, &HTTPSignerConfig{
+		Protocol: HTTPSignerVault,
+		Profiles: []IssuerProfile{
+			{
+				Name:       "payments",
+				Path:       "v1/pki_payments/sign/istio",
+				Namespaces: []string{"payments"},
+				MaxTTL:     metav1.Duration{Duration: 10 * time.Minute},
+				Headers:    map[string]string{"X-Vault-Namespace": "payments"},
+			},
+			{Name: "default", Path: "v1/pki_int/sign/istio"},
+		},
+	})
+	if _, err := signWorkload(t, r, "payments", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signWorkload(t, r, "default", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got := signer.requests[0].URL.Path; got != "/v1/pki_payments/sign/istio" {
+		t.Fatalf("expected payments profile, got %s", got)
+	}
+	if got := signer.requests[0].Header.Get("X-Vault-Namespace"); got != "payments" {
+		t.Fatalf("expected profile headers, got %q", got)
+	}
+	if got := signer.requests[1].URL.Path; got != "/v1/pki_int/sign/istio" {
+		t.Fatalf("expected default profile, got %s", got)
+	}
+	if signer.ttls[0] != "600s" || signer.ttls[1] != "3600s" {
+		t.Fatalf("expected TTL to be capped by the profile, got %v", signer.ttls)
+	}
+
+	// Without a catch-all profile, workloads in other namespaces are rejected.
+	r.config.Profiles = r.config.Profiles[:1]
+	_, err := signWorkload(t, r, "default", time.Hour)
+	if err == nil || err.(*raerror.Error).ErrorType() != "CSR_ERROR" {
+		t.Fatalf("expected CSR error, got %v", err)
+	}
+}
+
+func TestHTTPRARetries(t *testing.T) {
+	retries := 2
+	cases := []struct {
+		name        string
+		failures    int
+		failureCode int
+		requests    int
+		wantErr     bool
+	}{
+		{name: "retried", failures: 2, failureCode: http.StatusServiceUnavailable, requests: 3},
+		{name: "retries exhausted", failures: 3, failureCode: http.StatusServiceUnavailable, requests: 3, wantErr: true},
+		{name: "rate limited", failures: 1, failureCode: http.StatusTooManyRequests, requests: 2},
+		{name: "not retried", failures: 1, failureCode: http.StatusBadRequest, requests: 1, wantErr: true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := newFakeSigner(t)
+			signer.failures = tt.failures
+			signer.failureCode = tt.failureCode
+			r := createFakeHTTPRA(t, signer, &HTTPSignerConfig{
+				Protocol: HTTPSignerPEM,
+				Retries:  &retries,
+				Profiles: []IssuerProfile{{Name: "default", Path: "sign"}},
+			})
+			_, err := signWorkload(t, r, "default", 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil && err.(*raerror.Error).ErrorType() != "CERT_GEN_ERROR" {
+				t.Fatalf("expected cert generation error, got %v", err)
+			}
+			if len(signer.requests) != tt.requests {
+				t.Fatalf("expected %d requests, got %d", tt.requests, len(signer.requests))
+			}
+		})
+	}
+}
+
+func TestHTTPRAChainVerification(t *testing.T) {
+	signer := newFakeSigner(t)
+	r := createFakeHTTPRA(t, signer, &HTTPSignerConfig{
+		Protocol: HTTPSignerPEM,
+		Profiles: []IssuerProfile{{Name: "default", Path: "sign"}},
+	})
+	// Certificates chaining to a root other than the configured one are rejected.
+	other := newFakeSigner(t)
+	r.roots = x509.NewCertPool()
+	r.roots.AppendCertsFromPEM(other.rootPEM)
+	if _, err := signWorkload(t, r, "default", 0); err == nil || !strings.Contains(err.Error(), "failed to verify") {
+		t.Fatalf("expected verification error, got %v", err)
+	}
+
+	// Certificates that do not match the CSR are rejected.
+	csrPEM, _, _ := pkiutil.GenCSR(pkiutil.CertOptions{Host: "spiffe://cluster.local/ns/default/sa/default", ECSigAlg: pkiutil.EcdsaSigAlg})
+	otherCSR, _, _ := pkiutil.GenCSR(pkiutil.CertOptions{Host: "spiffe://cluster.local/ns/default/sa/default", ECSigAlg: pkiutil.EcdsaSigAlg})
+	csr, _ := pkiutil.ParsePemEncodedCSR(otherCSR)
+	certs, _ := parseCertificates(signer.sign(csrPEM, time.Hour))
+	if _, err := r.assembleChain(csr, certs); err == nil || !strings.Contains(err.Error(), "public key") {
+		t.Fatalf("expected public key mismatch, got %v", err)
+	}
+}
+
+func TestLoadHTTPSignerConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "signer.yaml")
+	config := `
+url: https://vault.example.com:8200
+protocol: vault
+tokenFile: /var/run/secrets/vault/token
+timeout: 5s
+retries: 0
+profiles:
+- name: default
+  path: v1/pki_int/sign/istio
+  maxTTL: 24h
+`
+	if err := ioutil.WriteFile(file, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadHTTPSignerConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Protocol != HTTPSignerVault || got.Timeout.Duration != 5*time.Second || *got.Retries != 0 ||
+		got.Profiles[0].MaxTTL.Duration != 24*time.Hour {
+		t.Fatalf("unexpected config %+v", got)
+	}
+	if err := got.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("url: https://vault\nprotocol: acme\nprofiles: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = LoadHTTPSignerConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := got.validate(); err == nil {
+		t.Fatal("expected unknown protocol to be rejected")
+	}
+}
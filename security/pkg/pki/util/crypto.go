@@ -17,6 +17,8 @@ package util
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -102,11 +104,45 @@ func GetRSAKeySize(privKey crypto.PrivateKey) (int, error) {
 
 // IsSupportedECPrivateKey is a predicate returning true if the private key is EC based
 func IsSupportedECPrivateKey(privKey *crypto.PrivateKey) bool {
-	switch (*privKey).(type) {
+	_, err := GetECSigAlg(*privKey)
+	return err == nil
+}
+
+// GetECSigAlg returns the EC signature algorithm of an EC based private key.
+func GetECSigAlg(privKey crypto.PrivateKey) (SupportedECSignatureAlgorithms, error) {
+	switch k := privKey.(type) {
 	// this should agree with var SupportedECSignatureAlgorithms
 	case *ecdsa.PrivateKey:
-		return true
+		switch k.Curve {
+		case elliptic.P256():
+			return EcdsaSigAlg, nil
+		case elliptic.P384():
+			return EcdsaP384SigAlg, nil
+		default:
+			return "", fmt.Errorf("unsupported ECDSA curve %v", k.Curve.Params().Name)
+		}
+	case ed25519.PrivateKey:
+		return Ed25519SigAlg, nil
+	default:
+		return "", fmt.Errorf("key type is not EC: %v", reflect.TypeOf(privKey))
+	}
+}
+
+// ValidatePublicKey returns an error if the public key, for example of a CSR, is not of a supported type:
+// RSA of at least 2048 bits, ECDSA using P-256 or P-384, or Ed25519.
+func ValidatePublicKey(pub crypto.PublicKey) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minimumRsaKeySize {
+			return fmt.Errorf("RSA key size %d is less than the minimum of %d", k.N.BitLen(), minimumRsaKeySize)
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() && k.Curve != elliptic.P384() {
+			return fmt.Errorf("unsupported ECDSA curve %v, must be P-256 or P-384", k.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
 	default:
-		return false
+		return fmt.Errorf("unsupported public key type %v", reflect.TypeOf(pub))
 	}
+	return nil
 }
@@ -321,6 +321,8 @@ func TestGetRSAKeySize(t *testing.T) {
 func TestIsSupportedECPrivateKey(t *testing.T) {
 	_, ed25519PrivKey, _ := ed25519.GenerateKey(nil)
 	ecdsaPrivKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecdsaP384PrivKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	ecdsaP224PrivKey, _ := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
 
 	cases := map[string]struct {
 		key         crypto.PrivateKey
@@ -330,9 +332,17 @@ func TestIsSupportedECPrivateKey(t *testing.T) {
 			key:         ecdsaPrivKey,
 			isSupported: true,
 		},
+		"ECDSA P-384": {
+			key:         ecdsaP384PrivKey,
+			isSupported: true,
+		},
+		"ECDSA P-224": {
+			key:         ecdsaP224PrivKey,
+			isSupported: false,
+		},
 		"ED25519": {
 			key:         ed25519PrivKey,
-			isSupported: false,
+			isSupported: true,
 		},
 	}
 
@@ -342,3 +352,47 @@ func TestIsSupportedECPrivateKey(t *testing.T) {
 		}
 	}
 }
+
+func TestValidatePublicKey(t *testing.T) {
+	ed25519PubKey, _, _ := ed25519.GenerateKey(nil)
+	ecdsaPrivKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecdsaP384PrivKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	ecdsaP224PrivKey, _ := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	rsaPrivKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	smallRSAPrivKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	cases := map[string]struct {
+		key         crypto.PublicKey
+		expectedErr string
+	}{
+		"RSA": {
+			key: &rsaPrivKey.PublicKey,
+		},
+		"RSA 1024": {
+			key:         &smallRSAPrivKey.PublicKey,
+			expectedErr: "RSA key size 1024 is less than the minimum of 2048",
+		},
+		"ECDSA": {
+			key: &ecdsaPrivKey.PublicKey,
+		},
+		"ECDSA P-384": {
+			key: &ecdsaP384PrivKey.PublicKey,
+		},
+		"ECDSA P-224": {
+			key:         &ecdsaP224PrivKey.PublicKey,
+			expectedErr: "unsupported ECDSA curve P-224, must be P-256 or P-384",
+		},
+		"ED25519": {
+			key: ed25519PubKey,
+		},
+	}
+
+	for id, tc := range cases {
+		err := ValidatePublicKey(tc.key)
+		if tc.expectedErr == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", id, err)
+		} else if tc.expectedErr != "" && (err == nil || err.Error() != tc.expectedErr) {
+			t.Errorf("%s: expected error %q, got %v", id, tc.expectedErr, err)
+		}
+	}
+}
@@ -43,10 +43,41 @@ import (
 type SupportedECSignatureAlgorithms string
 
 const (
-	// only ECDSA using P256 is currently supported
+	// EcdsaSigAlg is ECDSA using P-256.
 	EcdsaSigAlg SupportedECSignatureAlgorithms = "ECDSA"
+	// EcdsaP384SigAlg is ECDSA using P-384.
+	EcdsaP384SigAlg SupportedECSignatureAlgorithms = "ECDSA_P384"
+	// Ed25519SigAlg is Ed25519.
+	Ed25519SigAlg SupportedECSignatureAlgorithms = "ED25519"
 )
 
+// ValidateECSigAlg returns an error if the EC signature algorithm is not supported. An empty algorithm, for RSA,
+// is valid.
+func ValidateECSigAlg(alg SupportedECSignatureAlgorithms) error {
+	switch alg {
+	case "", EcdsaSigAlg, EcdsaP384SigAlg, Ed25519SigAlg:
+		return nil
+	default:
+		return fmt.Errorf("unsupported EC signature algorithm %q, must be one of %s, %s or %s",
+			alg, EcdsaSigAlg, EcdsaP384SigAlg, Ed25519SigAlg)
+	}
+}
+
+// genECKey generates a private key for the EC signature algorithm.
+func genECKey(alg SupportedECSignatureAlgorithms) (crypto.Signer, error) {
+	switch alg {
+	case EcdsaSigAlg:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EcdsaP384SigAlg:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case Ed25519SigAlg:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	default:
+		return nil, errors.New("unsupported EC signature algorithm")
+	}
+}
+
 // CertOptions contains options for generating a new certificate.
 type CertOptions struct {
 	// Comma-separated hostnames and IPs to generate a certificate for.
@@ -94,7 +125,7 @@ type CertOptions struct {
 	PKCS8Key bool
 
 	// The type of Elliptical Signature algorithm to use
-	// when generating private keys. Currently only ECDSA is supported.
+	// when generating private keys: ECDSA (P-256), ECDSA_P384 or ED25519.
 	// If empty, RSA is used, otherwise ECC is used.
 	ECSigAlg SupportedECSignatureAlgorithms
 
@@ -110,18 +141,14 @@ func GenCertKeyFromOptions(options CertOptions) (pemCert []byte, pemKey []byte,
 	// case, otherwise the certificate is signed by the signer private key
 	// as specified in the CertOptions.
 	if options.ECSigAlg != "" {
-		var ecPriv *ecdsa.PrivateKey
-
-		switch options.ECSigAlg {
-		case EcdsaSigAlg:
-			ecPriv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-			if err != nil {
-				return nil, nil, fmt.Errorf("cert generation fails at EC key generation (%v)", err)
-			}
-		default:
+		if err := ValidateECSigAlg(options.ECSigAlg); err != nil {
 			return nil, nil, errors.New("cert generation fails due to unsupported EC signature algorithm")
 		}
-		return genCert(options, ecPriv, &ecPriv.PublicKey)
+		ecPriv, err := genECKey(options.ECSigAlg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cert generation fails at EC key generation (%v)", err)
+		}
+		return genCert(options, ecPriv, ecPriv.Public())
 	}
 
 	if options.RSAKeySize < minimumRsaKeySize {
@@ -268,8 +295,8 @@ func genCertTemplateFromCSR(csr *x509.CertificateRequest, subjectIDs []string, t
 	var keyUsage x509.KeyUsage
 	extKeyUsages := []x509.ExtKeyUsage{}
 	if isCA {
-		// If the cert is a CA cert, the private key is allowed to sign other certificates.
-		keyUsage = x509.KeyUsageCertSign
+		// If the cert is a CA cert, the private key is allowed to sign other certificates and revocation lists.
+		keyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
 	} else {
 		// Otherwise the private key is allowed for digital signature and key encipherment.
 		keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
@@ -321,8 +348,8 @@ func genCertTemplateFromCSR(csr *x509.CertificateRequest, subjectIDs []string, t
 func genCertTemplateFromOptions(options CertOptions) (*x509.Certificate, error) {
 	var keyUsage x509.KeyUsage
 	if options.IsCA {
-		// If the cert is a CA cert, the private key is allowed to sign other certificates.
-		keyUsage = x509.KeyUsageCertSign
+		// If the cert is a CA cert, the private key is allowed to sign other certificates and revocation lists.
+		keyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
 	} else {
 		// Otherwise the private key is allowed for digital signature and key encipherment.
 		keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
@@ -421,6 +448,12 @@ func encodePem(isCSR bool, csrOrCert []byte, priv interface{}, pkcs8 bool) (
 				return nil, nil, err
 			}
 			privPem = pem.EncodeToMemory(&pem.Block{Type: blockTypeECPrivateKey, Bytes: encodedKey})
+		case ed25519.PrivateKey:
+			// Ed25519 keys can only be encoded with PKCS#8.
+			if encodedKey, err = x509.MarshalPKCS8PrivateKey(k); err != nil {
+				return nil, nil, err
+			}
+			privPem = pem.EncodeToMemory(&pem.Block{Type: blockTypePKCS8PrivateKey, Bytes: encodedKey})
 		}
 	}
 	err = nil
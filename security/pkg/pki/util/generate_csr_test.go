@@ -16,6 +16,7 @@ package util
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -45,11 +46,25 @@ func TestGenCSR(t *testing.T) {
 				ECSigAlg: EcdsaSigAlg,
 			},
 		},
+		"GenCSR with EC P-384": {
+			csrOptions: CertOptions{
+				Host:     "test_ca.com",
+				Org:      "MyOrg",
+				ECSigAlg: EcdsaP384SigAlg,
+			},
+		},
+		"GenCSR with Ed25519": {
+			csrOptions: CertOptions{
+				Host:     "test_ca.com",
+				Org:      "MyOrg",
+				ECSigAlg: Ed25519SigAlg,
+			},
+		},
 		"GenCSR with EC errors due to invalid signature algorithm": {
 			csrOptions: CertOptions{
 				Host:     "test_ca.com",
 				Org:      "MyOrg",
-				ECSigAlg: "ED25519",
+				ECSigAlg: "ECDSA_P521",
 			},
 			err: errors.New("csr cert generation fails due to unsupported EC signature algorithm"),
 		},
@@ -85,10 +100,11 @@ func TestGenCSR(t *testing.T) {
 		if !strings.HasSuffix(string(csr.Extensions[0].Value), "test_ca.com") {
 			t.Errorf("%s: csr host does not match", id)
 		}
-		if tc.csrOptions.ECSigAlg != "" {
-			if tc.csrOptions.ECSigAlg != EcdsaSigAlg {
-				t.Errorf("%s: Only ECDSA signature algorithms are currently supported", id)
+		if tc.csrOptions.ECSigAlg == Ed25519SigAlg {
+			if reflect.TypeOf(csr.PublicKey) != reflect.TypeOf(ed25519.PublicKey{}) {
+				t.Errorf("%s: decoded PKCS#8 returned unexpected key type: %T", id, csr.PublicKey)
 			}
+		} else if tc.csrOptions.ECSigAlg != "" {
 			if reflect.TypeOf(csr.PublicKey) != reflect.TypeOf(&ecdsa.PublicKey{}) {
 				t.Errorf("%s: decoded PKCS#8 returned unexpected key type: %T", id, csr.PublicKey)
 			}
@@ -119,6 +135,14 @@ func TestGenCSRPKCS8Key(t *testing.T) {
 				PKCS8Key: true,
 			},
 		},
+		"PKCS8Key with Ed25519": {
+			csrOptions: CertOptions{
+				Host:     "test_ca.com",
+				Org:      "MyOrg",
+				ECSigAlg: Ed25519SigAlg,
+				PKCS8Key: true,
+			},
+		},
 	}
 
 	for id, tc := range cases {
@@ -153,10 +177,11 @@ func TestGenCSRPKCS8Key(t *testing.T) {
 		if err != nil {
 			t.Errorf("%s: failed to parse PKCS#8 private key", id)
 		}
-		if tc.csrOptions.ECSigAlg != "" {
-			if tc.csrOptions.ECSigAlg != EcdsaSigAlg {
-				t.Errorf("%s: Only ECDSA signature algorithms are currently supported", id)
+		if tc.csrOptions.ECSigAlg == Ed25519SigAlg {
+			if reflect.TypeOf(key) != reflect.TypeOf(ed25519.PrivateKey{}) {
+				t.Errorf("%s: decoded PKCS#8 returned unexpected key type: %T", id, key)
 			}
+		} else if tc.csrOptions.ECSigAlg != "" {
 			if reflect.TypeOf(key) != reflect.TypeOf(&ecdsa.PrivateKey{}) {
 				t.Errorf("%s: decoded PKCS#8 returned unexpected key type: %T", id, key)
 			}
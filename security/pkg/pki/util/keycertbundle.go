@@ -21,6 +21,7 @@ package util
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
@@ -195,8 +196,10 @@ func (b *KeyCertBundle) CertOptions() (*CertOptions, error) {
 			return nil, fmt.Errorf("failed to get RSA key size: %v", err)
 		}
 		opts.RSAKeySize = size
-	case *ecdsa.PrivateKey:
-		opts.ECSigAlg = EcdsaSigAlg
+	case *ecdsa.PrivateKey, ed25519.PrivateKey:
+		if opts.ECSigAlg, err = GetECSigAlg(*b.privKey); err != nil {
+			return nil, err
+		}
 	default:
 		return nil, errors.New("unknown private key type")
 	}
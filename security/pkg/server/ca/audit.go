@@ -0,0 +1,283 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/natefinch/lumberjack"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Outcomes of the certificate requests.
+	AuditOutcomeIssued               = "issued"
+	AuditOutcomeAuthenticationFailed = "authentication_failed"
+	AuditOutcomePolicyRejected       = "policy_rejected"
+	AuditOutcomeSignFailed           = "sign_failed"
+
+	// AuditSinkWriteMethod is the gRPC method called by the gRPC sink for every audit record. It takes the
+	// record as a google.protobuf.Struct, and returns google.protobuf.Empty.
+	AuditSinkWriteMethod = "/istio.security.audit.v1.AuditSink/Write"
+
+	auditSinkFile = "file"
+	auditSinkGRPC = "grpc"
+
+	defaultAuditRecentRecords = 1000
+	defaultAuditQueueSize     = 1000
+	auditSinkTimeout          = 5 * time.Second
+)
+
+// AuditRecord is the audit record of a certificate request.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Peer is the address of the caller.
+	Peer string `json:"peer,omitempty"`
+	// Identities of the caller, empty if the caller is not authenticated.
+	Identities []string `json:"identities,omitempty"`
+	// Authenticator is the type of the authenticator of the caller.
+	Authenticator string `json:"authenticator,omitempty"`
+	// RequestedSANs are the SANs in the CSR.
+	RequestedSANs []string `json:"requestedSANs,omitempty"`
+	// Serial is the decimal serial number of the issued certificate.
+	Serial string `json:"serial,omitempty"`
+	// TTL is the lifetime of the issued certificate, or the requested TTL if none was issued.
+	TTL     metav1.Duration `json:"ttl"`
+	Outcome string          `json:"outcome"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// AuditLogOptions configures the AuditLog.
+type AuditLogOptions struct {
+	// File, if set, is the file the records are written to, one JSON record per line.
+	File string
+	// MaxSizeMB is the size of the file before it is rotated.
+	MaxSizeMB int
+	// MaxBackups is the number of rotated files kept.
+	MaxBackups int
+	// MaxAgeDays is the number of days the rotated files are kept.
+	MaxAgeDays int
+	// GRPCAddress, if set, is the address of the gRPC sink the records are sent to.
+	GRPCAddress string
+	// GRPCDialOptions are used to connect to the gRPC sink.
+	GRPCDialOptions []grpc.DialOption
+	// RecentRecords is the number of records kept in memory for queries.
+	RecentRecords int
+}
+
+// AuditLog records the certificate requests to the CA server.
+type AuditLog struct {
+	file  io.WriteCloser
+	grpc  *grpc.ClientConn
+	queue chan *AuditRecord
+
+	mu       sync.Mutex
+	fileMu   sync.Mutex
+	recent   []*AuditRecord
+	next     int
+	full     bool
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// NewAuditLog returns an AuditLog writing to the file and the gRPC sink in the options.
+func NewAuditLog(opts AuditLogOptions) (*AuditLog, error) {
+	recent := opts.RecentRecords
+	if recent <= 0 {
+		recent = defaultAuditRecentRecords
+	}
+	l := &AuditLog{
+		recent: make([]*AuditRecord, recent),
+		stop:   make(chan struct{}),
+	}
+	if opts.File != "" {
+		l.file = &lumberjack.Logger{
+			Filename:   opts.File,
+			MaxSize:    opts.MaxSizeMB,
+			MaxBackups: opts.MaxBackups,
+			MaxAge:     opts.MaxAgeDays,
+		}
+	}
+	if opts.GRPCAddress != "" {
+		conn, err := grpc.Dial(opts.GRPCAddress, opts.GRPCDialOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to the audit sink %s: %v", opts.GRPCAddress, err)
+		}
+		l.grpc = conn
+		l.queue = make(chan *AuditRecord, defaultAuditQueueSize)
+		go l.sendRecords()
+	}
+	return l, nil
+}
+
+// Record writes the record to the sinks, and keeps it for queries.
+func (l *AuditLog) Record(r *AuditRecord) {
+	l.mu.Lock()
+	l.recent[l.next] = r
+	l.next = (l.next + 1) % len(l.recent)
+	if l.next == 0 {
+		l.full = true
+	}
+	l.mu.Unlock()
+
+	if l.file != nil {
+		if err := l.writeFile(r); err != nil {
+			serverCaLog.Errorf("failed to write audit record: %v", err)
+			auditSinkErrorCounts.With(sinkTag.Value(auditSinkFile)).Increment()
+		}
+	}
+	if l.queue != nil {
+		// The gRPC sink must not slow down signing, the record is dropped if the sink does not keep up.
+		select {
+		case l.queue <- r:
+		default:
+			serverCaLog.Warnf("audit sink queue is full, dropping audit record")
+			auditSinkErrorCounts.With(sinkTag.Value(auditSinkGRPC)).Increment()
+		}
+	}
+}
+
+func (l *AuditLog) writeFile(r *AuditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	l.fileMu.Lock()
+	defer l.fileMu.Unlock()
+	_, err = l.file.Write(append(b, '\n'))
+	return err
+}
+
+func (l *AuditLog) sendRecords() {
+	for {
+		select {
+		case r := <-l.queue:
+			if err := l.send(r); err != nil {
+				serverCaLog.Errorf("failed to send audit record: %v", err)
+				auditSinkErrorCounts.With(sinkTag.Value(auditSinkGRPC)).Increment()
+			}
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+func (l *AuditLog) send(r *AuditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req := &structpb.Struct{}
+	if err := req.UnmarshalJSON(b); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), auditSinkTimeout)
+	defer cancel()
+	return l.grpc.Invoke(ctx, AuditSinkWriteMethod, req, &emptypb.Empty{})
+}
+
+// Query returns the recent records, most recent first, matching the identity and serial if they are set.
+func (l *AuditLog) Query(identity, serial string, limit int) []*AuditRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.recent)
+	}
+	records := []*AuditRecord{}
+	for i := 0; i < n && (limit <= 0 || len(records) < limit); i++ {
+		r := l.recent[(l.next-1-i+len(l.recent))%len(l.recent)]
+		if serial != "" && r.Serial != serial {
+			continue
+		}
+		if identity != "" && !containsString(r.Identities, identity) {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// ServeHTTP serves the recent records matching the "identity" and "serial" query parameters, at most "limit".
+func (l *AuditLog) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	limit := 0
+	if s := req.URL.Query().Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil {
+			http.Error(w, fmt.Sprintf("invalid limit %q", s), http.StatusBadRequest)
+			return
+		}
+	}
+	records := l.Query(req.URL.Query().Get("identity"), req.URL.Query().Get("serial"), limit)
+	b, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// Close stops sending the records to the sinks.
+func (l *AuditLog) Close() error {
+	var err error
+	l.stopOnce.Do(func() {
+		close(l.stop)
+		if l.grpc != nil {
+			err = l.grpc.Close()
+		}
+		if l.file != nil {
+			l.fileMu.Lock()
+			defer l.fileMu.Unlock()
+			if ferr := l.file.Close(); ferr != nil {
+				err = ferr
+			}
+		}
+	})
+	return err
+}
+
+// requestedSANs returns the SANs in the CSR.
+func requestedSANs(csr *x509.CertificateRequest) []string {
+	var sans []string
+	for _, u := range csr.URIs {
+		sans = append(sans, u.String())
+	}
+	sans = append(sans, csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return append(sans, csr.EmailAddresses...)
+}
+
+func containsString(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
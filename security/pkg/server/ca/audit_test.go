@@ -0,0 +1,239 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	pb "istio.io/api/security/v1alpha1"
+	"istio.io/istio/pkg/security"
+	mockca "istio.io/istio/security/pkg/pki/ca/mock"
+	caerror "istio.io/istio/security/pkg/pki/error"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func TestAuditLogQuery(t *testing.T) {
+	l, err := NewAuditLog(AuditLogOptions{RecentRecords: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for i := 0; i < 5; i++ {
+		l.Record(&AuditRecord{Identities: []string{fmt.Sprintf("id-%d", i%2)}, Serial: fmt.Sprint(i)})
+	}
+	testCases := map[string]struct {
+		identity string
+		serial   string
+		limit    int
+		expected []string
+	}{
+		"All recent records": {expected: []string{"4", "3", "2"}},
+		"By identity":        {identity: "id-0", expected: []string{"4", "2"}},
+		"By serial":          {serial: "3", expected: []string{"3"}},
+		"Evicted serial":     {serial: "1", expected: []string{}},
+		"Limit":              {limit: 1, expected: []string{"4"}},
+	}
+	for id, c := range testCases {
+		serials := []string{}
+		for _, r := range l.Query(c.identity, c.serial, c.limit) {
+			serials = append(serials, r.Serial)
+		}
+		if fmt.Sprint(serials) != fmt.Sprint(c.expected) {
+			t.Errorf("Case %s: expecting serials %v, got %v", id, c.expected, serials)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	l.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/ca_issuancez?identity=id-1", nil))
+	records := []AuditRecord{}
+	if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Serial != "3" {
+		t.Errorf("unexpected records served: %v", records)
+	}
+	w = httptest.NewRecorder()
+	l.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/ca_issuancez?limit=foo", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expecting code %d for an invalid limit, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestAuditLogFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+	l, err := NewAuditLog(AuditLogOptions{File: file, MaxSizeMB: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(&AuditRecord{Identities: []string{"id-0"}, Outcome: AuditOutcomeIssued, Serial: "1"})
+	l.Record(&AuditRecord{Outcome: AuditOutcomeAuthenticationFailed})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	outcomes := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		r := AuditRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("invalid audit record %q: %v", scanner.Text(), err)
+		}
+		outcomes = append(outcomes, r.Outcome)
+	}
+	if fmt.Sprint(outcomes) != fmt.Sprint([]string{AuditOutcomeIssued, AuditOutcomeAuthenticationFailed}) {
+		t.Errorf("unexpected records in the audit file: %v", outcomes)
+	}
+}
+
+// fakeAuditSink is a gRPC server implementing AuditSinkWriteMethod.
+type fakeAuditSink struct {
+	records chan *structpb.Struct
+}
+
+func (f *fakeAuditSink) start(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "istio.security.audit.v1.AuditSink",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Write",
+			Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				r := &structpb.Struct{}
+				if err := dec(r); err != nil {
+					return nil, err
+				}
+				f.records <- r
+				return &emptypb.Empty{}, nil
+			},
+		}},
+	}, f)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func TestAuditLogGRPCSink(t *testing.T) {
+	sink := &fakeAuditSink{records: make(chan *structpb.Struct, 1)}
+	l, err := NewAuditLog(AuditLogOptions{
+		GRPCAddress:     sink.start(t),
+		GRPCDialOptions: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.Record(&AuditRecord{Identities: []string{"id-0"}, Outcome: AuditOutcomeIssued, Serial: "1"})
+	select {
+	case r := <-sink.records:
+		if r.Fields["serial"].GetStringValue() != "1" || r.Fields["outcome"].GetStringValue() != AuditOutcomeIssued {
+			t.Errorf("unexpected record sent to the sink: %v", r)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the record was not sent to the sink")
+	}
+}
+
+func TestCreateCertificateAudit(t *testing.T) {
+	csr, _, err := util.GenCSR(util.CertOptions{Host: "spiffe://cluster.local/ns/default/sa/default", RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingCert, _, err := util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA: true, IsSelfSigned: true, TTL: time.Hour, Org: "Root CA", RSAKeySize: 2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		authenticators []security.Authenticator
+		ca             CertificateAuthority
+		outcome        string
+	}{
+		"Unauthenticated request": {
+			authenticators: []security.Authenticator{&mockAuthenticator{errMsg: "Not authorized"}},
+			ca:             &mockca.FakeCA{},
+			outcome:        AuditOutcomeAuthenticationFailed,
+		},
+		"Failed to sign": {
+			authenticators: []security.Authenticator{&mockAuthenticator{identities: []string{"id-0"}}},
+			ca:             &mockca.FakeCA{SignErr: caerror.NewError(caerror.CertGenError, fmt.Errorf("cannot sign"))},
+			outcome:        AuditOutcomeSignFailed,
+		},
+		"Successful signing": {
+			authenticators: []security.Authenticator{&mockAuthenticator{identities: []string{"id-0"}}},
+			ca:             &mockca.FakeCA{SignedCert: signingCert},
+			outcome:        AuditOutcomeIssued,
+		},
+	}
+	for id, c := range testCases {
+		l, err := NewAuditLog(AuditLogOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := &Server{
+			ca:             c.ca,
+			Authenticators: c.authenticators,
+			monitoring:     newMonitoringMetrics(),
+			AuditLog:       l,
+		}
+		_, _ = server.CreateCertificate(context.Background(), &pb.IstioCertificateRequest{Csr: string(csr), ValidityDuration: 60})
+		records := l.Query("", "", 0)
+		if len(records) != 1 {
+			t.Fatalf("Case %s: expecting 1 audit record, got %d", id, len(records))
+		}
+		r := records[0]
+		if r.Outcome != c.outcome {
+			t.Errorf("Case %s: expecting outcome %s, got %s", id, c.outcome, r.Outcome)
+		}
+		if len(r.RequestedSANs) != 1 || r.RequestedSANs[0] != "spiffe://cluster.local/ns/default/sa/default" {
+			t.Errorf("Case %s: unexpected requested SANs %v", id, r.RequestedSANs)
+		}
+		if c.outcome == AuditOutcomeIssued {
+			if r.Serial == "" || r.Authenticator != "mockAuthenticator" || r.TTL.Duration != time.Hour {
+				t.Errorf("Case %s: unexpected record of the issued certificate: %+v", id, r)
+			}
+		} else if r.TTL.Duration != time.Minute {
+			t.Errorf("Case %s: expecting the requested TTL, got %v", id, r.TTL.Duration)
+		}
+		_ = l.Close()
+	}
+}
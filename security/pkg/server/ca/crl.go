@@ -0,0 +1,74 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RevocationAuthority is implemented by CAs that are able to revoke the certificates they issued.
+type RevocationAuthority interface {
+	// GetCRL returns the PEM encoded CRLs of the CA and the CAs in its cert chain, or nil if no certificate is revoked.
+	GetCRL() []byte
+}
+
+// Revoker is implemented by CAs that are able to revoke the certificates they issued.
+type Revoker interface {
+	// RevokeCertificate revokes a PEM encoded certificate, failing if it was not issued by the CA.
+	RevokeCertificate(certPEM []byte) error
+}
+
+// CRL returns the PEM encoded CRLs published by the CA, nil if there are none or the CA does not
+// support revocation.
+func (s *Server) CRL() []byte {
+	ra, ok := s.ca.(RevocationAuthority)
+	if !ok {
+		return nil
+	}
+	return ra.GetCRL()
+}
+
+// ServeCRL serves the CRLs published by the CA over HTTP.
+func (s *Server) ServeCRL(w http.ResponseWriter, _ *http.Request) {
+	if _, ok := s.ca.(RevocationAuthority); !ok {
+		http.Error(w, "certificate revocation is not supported by the CA", http.StatusNotFound)
+		return
+	}
+	crl := s.CRL()
+	if len(crl) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	_, _ = w.Write(crl)
+}
+
+// RevokeHandler returns a handler that revokes the PEM encoded certificate given by the "cert" query parameter.
+// Only certificates issued by the CA are revoked, so a caller cannot list serial numbers of other CAs in the CRL.
+func RevokeHandler(r Revoker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cert := req.URL.Query().Get("cert")
+		if cert == "" {
+			http.Error(w, "the cert query parameter is required", http.StatusBadRequest)
+			return
+		}
+		if err := r.RevokeCertificate([]byte(cert)); err != nil {
+			http.Error(w, fmt.Sprintf("failed to revoke certificate: %v", err), http.StatusBadRequest)
+			return
+		}
+		_, _ = fmt.Fprintln(w, "revoked certificate")
+	})
+}
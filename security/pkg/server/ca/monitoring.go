@@ -19,11 +19,15 @@ import (
 )
 
 const (
-	errorlabel = "error"
+	errorlabel  = "error"
+	reasonlabel = "reason"
+	sinklabel   = "sink"
 )
 
 var (
-	errorTag = monitoring.MustCreateLabel(errorlabel)
+	errorTag  = monitoring.MustCreateLabel(errorlabel)
+	reasonTag = monitoring.MustCreateLabel(reasonlabel)
+	sinkTag   = monitoring.MustCreateLabel(sinklabel)
 
 	csrCounts = monitoring.NewSum(
 		"citadel_server_csr_count",
@@ -51,6 +55,18 @@ var (
 		monitoring.WithLabels(errorTag),
 	)
 
+	policyRejectionCounts = monitoring.NewSum(
+		"citadel_server_policy_rejection_count",
+		"The number of CSRs rejected by the issuance policy.",
+		monitoring.WithLabels(reasonTag),
+	)
+
+	auditSinkErrorCounts = monitoring.NewSum(
+		"citadel_server_audit_sink_err_count",
+		"The number of audit records that could not be written to an audit sink.",
+		monitoring.WithLabels(sinkTag),
+	)
+
 	successCounts = monitoring.NewSum(
 		"citadel_server_success_cert_issuance_count",
 		"The number of certificates issuances that have succeeded.",
@@ -75,6 +91,8 @@ func init() {
 		csrParsingErrorCounts,
 		idExtractionErrorCounts,
 		certSignErrorCounts,
+		policyRejectionCounts,
+		auditSinkErrorCounts,
 		successCounts,
 		rootCertExpiryTimestamp,
 		certChainExpiryTimestamp,
@@ -89,6 +107,7 @@ type monitoringMetrics struct {
 	CSRError          monitoring.Metric
 	IDExtractionError monitoring.Metric
 	certSignErrors    monitoring.Metric
+	policyRejections  monitoring.Metric
 }
 
 // newMonitoringMetrics creates a new monitoringMetrics.
@@ -100,9 +119,14 @@ func newMonitoringMetrics() monitoringMetrics {
 		CSRError:          csrParsingErrorCounts,
 		IDExtractionError: idExtractionErrorCounts,
 		certSignErrors:    certSignErrorCounts,
+		policyRejections:  policyRejectionCounts,
 	}
 }
 
 func (m *monitoringMetrics) GetCertSignError(err string) monitoring.Metric {
 	return m.certSignErrors.With(errorTag.Value(err))
 }
+
+func (m *monitoringMetrics) GetPolicyRejection(reason string) monitoring.Metric {
+	return m.policyRejections.With(reasonTag.Value(reason))
+}
@@ -0,0 +1,156 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/istio/pkg/spiffe"
+)
+
+const (
+	// Reasons of the policy rejections, reported in the rejection metric.
+	policyDenied            = "denied"
+	policyDNSNameNotAllowed = "dns_name_not_allowed"
+
+	policyWildcardMatchToken = "*"
+)
+
+// IssuancePolicy restricts the certificates issued by the CA server to the workloads, based on their
+// authenticated identity.
+type IssuancePolicy struct {
+	// Rules are evaluated against every identity of the caller. All the matching rules apply: the request
+	// is rejected if any of them denies it, the TTL is capped by the lowest max TTL and the DNS names
+	// allowed by any of them can be requested.
+	Rules []IssuancePolicyRule `json:"rules"`
+}
+
+// IssuancePolicyRule applies to the workloads in a namespace and with a service account.
+type IssuancePolicyRule struct {
+	// Namespace of the workloads, empty or "*" matches all namespaces.
+	Namespace string `json:"namespace,omitempty"`
+	// ServiceAccount of the workloads, empty or "*" matches all service accounts.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// Deny rejects the requests of the matching workloads.
+	Deny bool `json:"deny,omitempty"`
+	// MaxTTL, if set, caps the TTL of the certificates.
+	MaxTTL metav1.Duration `json:"maxTTL,omitempty"`
+	// DNSNames are the DNS SANs the workloads can request in their CSR, in addition to their identity.
+	// "*.example.com" allows the subdomains of example.com, and the wildcard name itself.
+	DNSNames []string `json:"dnsNames,omitempty"`
+}
+
+// ParseIssuancePolicy parses the YAML or JSON IssuancePolicy.
+func ParseIssuancePolicy(b []byte) (*IssuancePolicy, error) {
+	p := &IssuancePolicy{}
+	if err := yaml.UnmarshalStrict(b, p); err != nil {
+		return nil, fmt.Errorf("failed to parse issuance policy: %v", err)
+	}
+	for i, r := range p.Rules {
+		if r.MaxTTL.Duration < 0 {
+			return nil, fmt.Errorf("rule %d: max TTL must not be negative", i)
+		}
+		for _, n := range r.DNSNames {
+			if n == "" || strings.Contains(n[1:], policyWildcardMatchToken) || strings.Contains(n, ",") {
+				return nil, fmt.Errorf("rule %d: invalid DNS name %q", i, n)
+			}
+		}
+	}
+	return p, nil
+}
+
+// LoadIssuancePolicy reads the YAML or JSON IssuancePolicy in the given file.
+func LoadIssuancePolicy(file string) (*IssuancePolicy, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseIssuancePolicy(b)
+}
+
+// policyRejection is returned when the policy rejects a request.
+type policyRejection struct {
+	reason string
+	msg    string
+}
+
+func (r *policyRejection) Error() string {
+	return r.msg
+}
+
+// check evaluates the policy for a caller requesting a certificate with the given TTL and DNS names. It
+// returns the TTL to issue the certificate with.
+func (p *IssuancePolicy) check(identities []string, ttl time.Duration, dnsNames []string) (time.Duration, *policyRejection) {
+	var allowedNames []string
+	for _, id := range identities {
+		// Identities that are not SPIFFE IDs only match the rules for all workloads.
+		ns, sa := "", ""
+		if i, err := spiffe.ParseIdentity(id); err == nil {
+			ns, sa = i.Namespace, i.ServiceAccount
+		}
+		for _, r := range p.Rules {
+			if !r.matches(ns, sa) {
+				continue
+			}
+			if r.Deny {
+				return 0, &policyRejection{reason: policyDenied, msg: fmt.Sprintf("identity %s is denied", id)}
+			}
+			if max := r.MaxTTL.Duration; max > 0 && (ttl <= 0 || ttl > max) {
+				ttl = max
+			}
+			allowedNames = append(allowedNames, r.DNSNames...)
+		}
+	}
+	for _, n := range dnsNames {
+		if !dnsNameAllowed(n, allowedNames) {
+			return 0, &policyRejection{
+				reason: policyDNSNameNotAllowed,
+				msg:    fmt.Sprintf("DNS name %s is not allowed for %v", n, identities),
+			}
+		}
+	}
+	return ttl, nil
+}
+
+func (r IssuancePolicyRule) matches(ns, sa string) bool {
+	return matchesPolicyField(r.Namespace, ns) && matchesPolicyField(r.ServiceAccount, sa)
+}
+
+func matchesPolicyField(field, value string) bool {
+	return field == "" || field == policyWildcardMatchToken || field == value
+}
+
+func dnsNameAllowed(name string, allowed []string) bool {
+	name = strings.ToLower(name)
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if name == a {
+			return true
+		}
+		if strings.HasPrefix(a, "*.") {
+			// The wildcard matches a single label, as in certificates.
+			if i := strings.Index(name, "."); i > 0 && name[i:] == a[1:] && !strings.Contains(name[:i], "*") {
+				return true
+			}
+		}
+	}
+	return false
+}
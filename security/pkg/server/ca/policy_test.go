@@ -0,0 +1,192 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "istio.io/api/security/v1alpha1"
+	"istio.io/istio/pkg/security"
+	mockca "istio.io/istio/security/pkg/pki/ca/mock"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+const testIssuancePolicy = `
+rules:
+- maxTTL: 24h
+- namespace: payments
+  maxTTL: 1h
+  dnsNames:
+  - payments.example.com
+  - "*.payments.example.com"
+- namespace: legacy
+  serviceAccount: batch
+  deny: true
+`
+
+func TestParseIssuancePolicy(t *testing.T) {
+	testCases := map[string]struct {
+		policy string
+		valid  bool
+	}{
+		"valid":              {policy: testIssuancePolicy, valid: true},
+		"empty":              {policy: "", valid: true},
+		"unknown field":      {policy: "rules:\n- namespaces: [foo]\n", valid: false},
+		"negative TTL":       {policy: "rules:\n- maxTTL: -1h\n", valid: false},
+		"invalid DNS name":   {policy: "rules:\n- dnsNames: [\"a.*.example.com\"]\n", valid: false},
+		"multiple DNS names": {policy: "rules:\n- dnsNames: [\"a.example.com,b.example.com\"]\n", valid: false},
+	}
+	for id, c := range testCases {
+		_, err := ParseIssuancePolicy([]byte(c.policy))
+		if c.valid != (err == nil) {
+			t.Errorf("Case %s: expecting valid to be %v, got error %v", id, c.valid, err)
+		}
+	}
+}
+
+func TestIssuancePolicyCheck(t *testing.T) {
+	policy, err := ParseIssuancePolicy([]byte(testIssuancePolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		identities []string
+		ttl        time.Duration
+		dnsNames   []string
+		expectTTL  time.Duration
+		reason     string
+	}{
+		"TTL allowed": {
+			identities: []string{"spiffe://cluster.local/ns/default/sa/default"},
+			ttl:        time.Hour,
+			expectTTL:  time.Hour,
+		},
+		"TTL capped": {
+			identities: []string{"spiffe://cluster.local/ns/default/sa/default"},
+			ttl:        48 * time.Hour,
+			expectTTL:  24 * time.Hour,
+		},
+		"TTL capped by the lowest max TTL": {
+			identities: []string{"spiffe://cluster.local/ns/payments/sa/default"},
+			ttl:        12 * time.Hour,
+			expectTTL:  time.Hour,
+		},
+		"Default TTL capped": {
+			identities: []string{"spiffe://cluster.local/ns/payments/sa/default"},
+			expectTTL:  time.Hour,
+		},
+		"Denied service account": {
+			identities: []string{"spiffe://cluster.local/ns/legacy/sa/batch"},
+			reason:     policyDenied,
+		},
+		"Other service account in namespace": {
+			identities: []string{"spiffe://cluster.local/ns/legacy/sa/web"},
+			ttl:        time.Hour,
+			expectTTL:  time.Hour,
+		},
+		"Allowed DNS names": {
+			identities: []string{"spiffe://cluster.local/ns/payments/sa/default"},
+			ttl:        time.Hour,
+			dnsNames:   []string{"payments.example.com", "API.payments.example.com"},
+			expectTTL:  time.Hour,
+		},
+		"Wildcard matches a single label": {
+			identities: []string{"spiffe://cluster.local/ns/payments/sa/default"},
+			dnsNames:   []string{"a.b.payments.example.com"},
+			reason:     policyDNSNameNotAllowed,
+		},
+		"DNS name of another namespace": {
+			identities: []string{"spiffe://cluster.local/ns/default/sa/default"},
+			dnsNames:   []string{"payments.example.com"},
+			reason:     policyDNSNameNotAllowed,
+		},
+		"Non SPIFFE identity": {
+			identities: []string{"test.identity"},
+			ttl:        48 * time.Hour,
+			expectTTL:  24 * time.Hour,
+		},
+	}
+	for id, c := range testCases {
+		ttl, rejection := policy.check(c.identities, c.ttl, c.dnsNames)
+		if c.reason != "" {
+			if rejection == nil || rejection.reason != c.reason {
+				t.Errorf("Case %s: expecting rejection %s, got %v", id, c.reason, rejection)
+			}
+			continue
+		}
+		if rejection != nil {
+			t.Errorf("Case %s: unexpected rejection: %v", id, rejection)
+		} else if ttl != c.expectTTL {
+			t.Errorf("Case %s: expecting TTL %v, got %v", id, c.expectTTL, ttl)
+		}
+	}
+}
+
+func TestCreateCertificateWithIssuancePolicy(t *testing.T) {
+	policy, err := ParseIssuancePolicy([]byte(testIssuancePolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		identity  string
+		host      string
+		code      codes.Code
+		expectIDs []string
+	}{
+		"DNS names added": {
+			identity:  "spiffe://cluster.local/ns/payments/sa/default",
+			host:      "spiffe://cluster.local/ns/payments/sa/default,payments.example.com",
+			code:      codes.OK,
+			expectIDs: []string{"spiffe://cluster.local/ns/payments/sa/default", "payments.example.com"},
+		},
+		"DNS names not allowed": {
+			identity: "spiffe://cluster.local/ns/default/sa/default",
+			host:     "spiffe://cluster.local/ns/default/sa/default,payments.example.com",
+			code:     codes.PermissionDenied,
+		},
+		"Denied": {
+			identity: "spiffe://cluster.local/ns/legacy/sa/batch",
+			host:     "spiffe://cluster.local/ns/legacy/sa/batch",
+			code:     codes.PermissionDenied,
+		},
+	}
+	for id, c := range testCases {
+		csr, _, err := util.GenCSR(util.CertOptions{Host: c.host, RSAKeySize: 2048})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fakeCA := &mockca.FakeCA{SignedCert: []byte("cert")}
+		server := &Server{
+			ca:             fakeCA,
+			Authenticators: []security.Authenticator{&mockAuthenticator{identities: []string{c.identity}}},
+			monitoring:     newMonitoringMetrics(),
+		}
+		server.SetIssuancePolicy(policy)
+		_, err = server.CreateCertificate(context.Background(), &pb.IstioCertificateRequest{Csr: string(csr)})
+		if code := status.Code(err); code != c.code {
+			t.Errorf("Case %s: expecting code to be (%d) but got (%d): %v", id, c.code, code, err)
+			continue
+		}
+		if c.code == codes.OK && !reflect.DeepEqual(fakeCA.ReceivedIDs, c.expectIDs) {
+			t.Errorf("Case %s: expecting subject IDs %v, got %v", id, c.expectIDs, fakeCA.ReceivedIDs)
+		}
+	}
+}
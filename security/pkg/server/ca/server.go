@@ -16,6 +16,7 @@ package ca
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
@@ -23,6 +24,7 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	pb "istio.io/api/security/v1alpha1"
 	"istio.io/istio/pkg/security"
@@ -51,6 +53,11 @@ type Server struct {
 	Authenticators []security.Authenticator
 	ca             CertificateAuthority
 	serverCertTTL  time.Duration
+	// AuditLog, if set, records the certificate requests.
+	AuditLog *AuditLog
+
+	policyMutex sync.RWMutex
+	policy      *IssuancePolicy
 }
 
 func getConnectionAddress(ctx context.Context) string {
@@ -64,33 +71,71 @@ func getConnectionAddress(ctx context.Context) string {
 
 // CreateCertificate handles an incoming certificate signing request (CSR). It does
 // authentication and authorization. Upon validated, signs a certificate that:
-// the SAN is the identity of the caller in authentication result.
+// the SAN is the identity of the caller in authentication result, and the DNS names of the CSR allowed by the
+// issuance policy.
 // the subject public key is the public key in the CSR.
 // the validity duration is the ValidityDuration in request, or default value if the given duration is invalid.
 // it is signed by the CA signing key.
 func (s *Server) CreateCertificate(ctx context.Context, request *pb.IstioCertificateRequest) (
 	*pb.IstioCertificateResponse, error) {
 	s.monitoring.CSR.Increment()
-	caller := Authenticate(ctx, s.Authenticators)
+	record := &AuditRecord{
+		Time: time.Now(),
+		Peer: getConnectionAddress(ctx),
+		TTL:  metav1.Duration{Duration: time.Duration(request.ValidityDuration) * time.Second},
+	}
+	if s.AuditLog != nil {
+		defer s.AuditLog.Record(record)
+	}
+	// An invalid CSR is rejected when signing.
+	csr, _ := util.ParsePemEncodedCSR([]byte(request.Csr))
+	if csr != nil {
+		record.RequestedSANs = requestedSANs(csr)
+	}
+	caller, authenticator := authenticateCaller(ctx, s.Authenticators)
 	if caller == nil {
 		s.monitoring.AuthnError.Increment()
+		record.Outcome = AuditOutcomeAuthenticationFailed
 		return nil, status.Error(codes.Unauthenticated, "request authenticate failure")
 	}
+	record.Identities = caller.Identities
+	record.Authenticator = authenticator
 
-	// TODO: Call authorizer.
-
-	_, _, certChainBytes, rootCertBytes := s.ca.GetCAKeyCertBundle().GetAll()
 	certOpts := ca.CertOpts{
 		SubjectIDs: caller.Identities,
 		TTL:        time.Duration(request.ValidityDuration) * time.Second,
 		ForCA:      false,
 	}
+	if policy := s.getIssuancePolicy(); policy != nil {
+		var dnsNames []string
+		if csr != nil {
+			dnsNames = csr.DNSNames
+		}
+		ttl, rejection := policy.check(caller.Identities, certOpts.TTL, dnsNames)
+		if rejection != nil {
+			serverCaLog.Warnf("CSR rejected by the issuance policy: %v", rejection)
+			s.monitoring.GetPolicyRejection(rejection.reason).Increment()
+			record.Outcome, record.Error = AuditOutcomePolicyRejected, rejection.Error()
+			return nil, status.Errorf(codes.PermissionDenied, "CSR rejected by the issuance policy (%v)", rejection)
+		}
+		certOpts.TTL = ttl
+		certOpts.SubjectIDs = append(append([]string{}, caller.Identities...), dnsNames...)
+		record.TTL.Duration = ttl
+	}
+
+	_, _, certChainBytes, rootCertBytes := s.ca.GetCAKeyCertBundle().GetAll()
 	cert, signErr := s.ca.Sign([]byte(request.Csr), certOpts)
 	if signErr != nil {
 		serverCaLog.Errorf("CSR signing error (%v)", signErr.Error())
 		s.monitoring.GetCertSignError(signErr.(*caerror.Error).ErrorType()).Increment()
+		record.Outcome, record.Error = AuditOutcomeSignFailed, signErr.Error()
 		return nil, status.Errorf(signErr.(*caerror.Error).HTTPErrorCode(), "CSR signing error (%v)", signErr.(*caerror.Error))
 	}
+	record.Outcome = AuditOutcomeIssued
+	if c, err := util.ParsePemEncodedCertificate(cert); err == nil {
+		record.Serial = c.SerialNumber.String()
+		record.TTL.Duration = c.NotAfter.Sub(c.NotBefore)
+	}
 	respCertChain := []string{string(cert)}
 	if len(certChainBytes) != 0 {
 		respCertChain = append(respCertChain, string(certChainBytes))
@@ -104,6 +149,20 @@ func (s *Server) CreateCertificate(ctx context.Context, request *pb.IstioCertifi
 	return response, nil
 }
 
+// SetIssuancePolicy sets the policy checked before signing certificates. A nil policy allows all the
+// authenticated callers.
+func (s *Server) SetIssuancePolicy(policy *IssuancePolicy) {
+	s.policyMutex.Lock()
+	defer s.policyMutex.Unlock()
+	s.policy = policy
+}
+
+func (s *Server) getIssuancePolicy() *IssuancePolicy {
+	s.policyMutex.RLock()
+	defer s.policyMutex.RUnlock()
+	return s.policy
+}
+
 func recordCertsExpiry(keyCertBundle *util.KeyCertBundle) {
 	rootCertExpiry, err := keyCertBundle.ExtractRootCertExpiryTimestamp()
 	if err != nil {
@@ -146,6 +205,12 @@ func New(ca CertificateAuthority, ttl time.Duration,
 // authenticate goes through a list of authenticators (provided client cert, k8s jwt, and ID token)
 // and authenticates if one of them is valid.
 func Authenticate(ctx context.Context, auth []security.Authenticator) *security.Caller {
+	caller, _ := authenticateCaller(ctx, auth)
+	return caller
+}
+
+// authenticateCaller is like Authenticate, and also returns the type of the authenticator of the caller.
+func authenticateCaller(ctx context.Context, auth []security.Authenticator) (*security.Caller, string) {
 	// TODO: apply different authenticators in specific order / according to configuration.
 	var errMsg string
 	for id, authn := range auth {
@@ -155,9 +220,9 @@ func Authenticate(ctx context.Context, auth []security.Authenticator) *security.
 		}
 		if u != nil && err == nil {
 			serverCaLog.Debugf("Authentication successful through auth source %v", u.AuthSource)
-			return u
+			return u, authn.AuthenticatorType()
 		}
 	}
 	serverCaLog.Warnf("Authentication failed for %v: %s", getConnectionAddress(ctx), errMsg)
-	return nil
+	return nil, ""
 }
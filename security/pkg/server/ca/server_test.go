@@ -22,6 +22,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"golang.org/x/net/context"
@@ -263,3 +265,82 @@ func TestCreateCertificate(t *testing.T) {
 		}
 	}
 }
+
+func TestServeCRL(t *testing.T) {
+	crl := []byte("-----BEGIN X509 CRL-----\nfake\n-----END X509 CRL-----\n")
+	testCases := map[string]struct {
+		ca   CertificateAuthority
+		code int
+		body string
+	}{
+		"CRL published": {
+			ca:   &mockca.FakeCA{CRL: crl},
+			code: http.StatusOK,
+			body: string(crl),
+		},
+		"No certificate revoked": {
+			ca:   &mockca.FakeCA{},
+			code: http.StatusNoContent,
+		},
+		"Revocation not supported": {
+			ca:   struct{ CertificateAuthority }{&mockca.FakeCA{CRL: crl}},
+			code: http.StatusNotFound,
+		},
+	}
+
+	for id, c := range testCases {
+		server := &Server{ca: c.ca}
+		w := httptest.NewRecorder()
+		server.ServeCRL(w, httptest.NewRequest(http.MethodGet, "/ca/crl", nil))
+		if w.Code != c.code {
+			t.Errorf("Case %s: expecting code to be (%d) but got (%d)", id, c.code, w.Code)
+		}
+		if c.body != "" && w.Body.String() != c.body {
+			t.Errorf("Case %s: expecting body to be (%s) but got (%s)", id, c.body, w.Body.String())
+		}
+	}
+}
+
+func TestRevokeHandler(t *testing.T) {
+	cert := "-----BEGIN CERTIFICATE-----\nfake\n-----END CERTIFICATE-----\n"
+	testCases := map[string]struct {
+		query     string
+		revokeErr error
+		code      int
+		revoked   string
+	}{
+		"Revoked": {
+			query:   "?" + url.Values{"cert": {cert}}.Encode(),
+			code:    http.StatusOK,
+			revoked: cert,
+		},
+		"Missing cert": {
+			code: http.StatusBadRequest,
+		},
+		"Serial instead of cert": {
+			query: "?serial=1",
+			code:  http.StatusBadRequest,
+		},
+		"Not issued by the CA": {
+			query:     "?" + url.Values{"cert": {cert}}.Encode(),
+			revokeErr: errors.New("certificate 1 was not issued by this CA"),
+			code:      http.StatusBadRequest,
+		},
+	}
+
+	for id, c := range testCases {
+		ca := &mockca.FakeCA{RevokeErr: c.revokeErr}
+		w := httptest.NewRecorder()
+		RevokeHandler(ca).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/ca_revoke"+c.query, nil))
+		if w.Code != c.code {
+			t.Errorf("Case %s: expecting code to be (%d) but got (%d): %s", id, c.code, w.Code, w.Body.String())
+		}
+		if c.revoked == "" {
+			if len(ca.Revoked) != 0 {
+				t.Errorf("Case %s: expecting no revocation but got %q", id, ca.Revoked)
+			}
+		} else if len(ca.Revoked) != 1 || string(ca.Revoked[0]) != c.revoked {
+			t.Errorf("Case %s: expecting (%s) to be revoked but got %q", id, c.revoked, ca.Revoked)
+		}
+	}
+}
@@ -249,8 +249,11 @@ func setupSTS(stsPort int, backendURL string, enableCache bool) (*stsServer.Serv
 	accessTokenTestingEndpoint := backendURL + "/v1/projects/-/serviceAccounts/service-%s@gcp-sa-meshdataplane.iam.gserviceaccount.com:generateAccessToken"
 	tokenExchangePlugin.SetEndpoints(federatedTokenTestingEndpoint, accessTokenTestingEndpoint)
 	// Create token manager
-	tm := tokenmanager.CreateTokenManager(tokenmanager.GoogleTokenExchange,
+	tm, err := tokenmanager.CreateTokenManager(tokenmanager.GoogleTokenExchange,
 		tokenmanager.Config{TrustDomain: tokenBackend.FakeTrustDomain})
+	if err != nil {
+		return nil, nil, err
+	}
 	tm.(*tokenmanager.TokenManager).SetPlugin(tokenExchangePlugin)
 	// Create STS server
 	addr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("127.0.0.1:%d", stsPort))
@@ -123,8 +123,11 @@ func TestStsTokenSource(t *testing.T) {
 
 			// Override token manager in token source to use mock plugin
 			tokenExchangePlugin, _ := google.CreateTokenManagerPlugin(nil, mock.FakeTrustDomain, mock.FakeProjectNum, mock.FakeGKEClusterURL, false)
-			tokenManager := CreateTokenManager(GoogleTokenExchange,
+			tokenManager, err := CreateTokenManager(GoogleTokenExchange,
 				Config{TrustDomain: mock.FakeTrustDomain})
+			if err != nil {
+				t.Fatalf("failed to create token manager: %v", err)
+			}
 			tokenManager.(*TokenManager).SetPlugin(tokenExchangePlugin)
 			ts.tm = tokenManager
 
@@ -273,8 +276,11 @@ func setUpTestComponents(t *testing.T, setup testSetUp) (*stsServer.Server, *moc
 	accessTokenTestingEndpoint := mockServer.URL + "/v1/projects/-/serviceAccounts/service-%s@gcp-sa-meshdataplane.iam.gserviceaccount.com:generateAccessToken"
 	tokenExchangePlugin.SetEndpoints(federatedTokenTestingEndpoint, accessTokenTestingEndpoint)
 	// Create token manager
-	tokenManager := CreateTokenManager(GoogleTokenExchange,
+	tokenManager, err := CreateTokenManager(GoogleTokenExchange,
 		Config{CredFetcher: nil, TrustDomain: mock.FakeTrustDomain})
+	if err != nil {
+		t.Fatalf("failed to create token manager: %v", err)
+	}
 	tokenManager.(*TokenManager).SetPlugin(tokenExchangePlugin)
 	// Create STS server
 	server, _ := stsServer.NewServer(stsServer.Config{LocalHostAddr: "127.0.0.1", LocalPort: 0}, tokenManager)
@@ -0,0 +1,369 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tokenexchange implements a token manager plugin exchanging tokens with an OAuth 2.0 authorization server
+// supporting OAuth 2.0 Token Exchange, defined in https://tools.ietf.org/html/rfc8693.
+package tokenexchange
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/stsservice"
+	"istio.io/pkg/log"
+)
+
+const (
+	httpTimeOutInSec = 5
+	maxRequestRetry  = 5
+
+	// TokenExchangeGrantType is the grant type of the token exchange requests.
+	TokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	// AccessTokenType is the default type of the requested tokens.
+	AccessTokenType = "urn:ietf:params:oauth:token-type:access_token"
+	// JWTTokenType is the default type of the subject tokens.
+	JWTTokenType = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+var (
+	pluginLog = log.RegisterScope("tokenexchange", "OAuth 2.0 token exchange plugin debugging", 0)
+
+	// Well known paths of the authorization server metadata, relative to the issuer URL.
+	// https://tools.ietf.org/html/rfc8414#section-3 and
+	// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfig
+	metadataPaths = []string{"/.well-known/oauth-authorization-server", "/.well-known/openid-configuration"}
+
+	// default grace period of an exchanged token. A cached token is not used if its remaining life time is within
+	// this period.
+	defaultGracePeriod = 5 * time.Minute
+)
+
+// Config configures the token exchange plugin.
+type Config struct {
+	// IssuerURL is the URL of the authorization server. The token endpoint is discovered from the authorization
+	// server metadata, unless TokenEndpoint is set.
+	IssuerURL string
+	// TokenEndpoint, if set, is the URL token exchange requests are sent to.
+	TokenEndpoint string
+	// Audience is the audience of the requested tokens, used when the STS request does not set one.
+	Audience string
+	// Scope is the scope of the requested tokens, used when the STS request does not set one.
+	Scope string
+	// ClientID and ClientSecret, if set, authenticate the client to the authorization server with HTTP basic
+	// authentication.
+	ClientID     string
+	ClientSecret string
+	// GracePeriod is the remaining life time below which a cached token is exchanged again. Defaults to 5 minutes.
+	GracePeriod time.Duration
+	// HTTPClient, if set, is used to send the requests to the authorization server.
+	HTTPClient *http.Client
+}
+
+// Plugin supports token exchange with an OAuth 2.0 authorization server.
+type Plugin struct {
+	config      Config
+	httpClient  *http.Client
+	credFetcher security.CredFetcher
+
+	endpointMutex sync.Mutex
+	tokenEndpoint string
+
+	// tokens is the cache for exchanged tokens, keyed by the request parameters.
+	tokensMutex sync.RWMutex
+	tokens      map[string]stsservice.TokenInfo
+}
+
+// CreateTokenManagerPlugin creates a plugin that exchanges tokens with an OAuth 2.0 authorization server. If the
+// credential fetcher is set, it provides the subject token when the STS request does not have one.
+func CreateTokenManagerPlugin(config Config, credFetcher security.CredFetcher) (*Plugin, error) {
+	if config.IssuerURL == "" && config.TokenEndpoint == "" {
+		return nil, errors.New("either the issuer URL or the token endpoint must be set")
+	}
+	if config.ClientSecret != "" && config.ClientID == "" {
+		return nil, errors.New("the client ID must be set with the client secret")
+	}
+	if config.GracePeriod <= 0 {
+		config.GracePeriod = defaultGracePeriod
+	}
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeOutInSec * time.Second}
+	}
+	return &Plugin{
+		config:        config,
+		httpClient:    client,
+		credFetcher:   credFetcher,
+		tokenEndpoint: config.TokenEndpoint,
+		tokens:        map[string]stsservice.TokenInfo{},
+	}, nil
+}
+
+// ExchangeToken takes STS request parameters and exchanges the subject token with the authorization server, or
+// uses a cached token. Returns StsResponseParameters in JSON.
+func (p *Plugin) ExchangeToken(parameters security.StsRequestParameters) ([]byte, error) {
+	form, err := p.requestForm(parameters)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey(form)
+	if resp, ok := p.useCachedToken(key, time.Now()); ok {
+		return json.Marshal(resp)
+	}
+
+	endpoint, err := p.getTokenEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := p.sendRequest(endpoint, form)
+	if err != nil {
+		pluginLog.Errorf("Failed to exchange token with %s: %v", endpoint, err)
+		return nil, err
+	}
+	pluginLog.WithLabels("latency", time.Since(start).String(), "ttl", resp.ExpiresIn).Infof("exchanged token")
+	if resp.ExpiresIn > 0 {
+		p.tokensMutex.Lock()
+		// Drop the expired tokens, for example those exchanged for a previous subject token.
+		for k, token := range p.tokens {
+			if token.ExpireTime.Before(start) {
+				delete(p.tokens, k)
+			}
+		}
+		p.tokens[key] = stsservice.TokenInfo{
+			TokenType:  resp.IssuedTokenType,
+			IssueTime:  start,
+			ExpireTime: start.Add(time.Duration(resp.ExpiresIn) * time.Second),
+			Token:      resp.AccessToken,
+		}
+		p.tokensMutex.Unlock()
+	}
+	return json.Marshal(resp)
+}
+
+// requestForm returns the form of the token exchange request for the STS request parameters.
+func (p *Plugin) requestForm(parameters security.StsRequestParameters) (url.Values, error) {
+	subjectToken, subjectTokenType := parameters.SubjectToken, parameters.SubjectTokenType
+	if subjectToken == "" && p.credFetcher != nil {
+		var err error
+		if subjectToken, err = p.credFetcher.GetPlatformCredential(); err != nil {
+			return nil, fmt.Errorf("failed to get the subject token: %v", err)
+		}
+	}
+	if subjectToken == "" {
+		return nil, errors.New("no subject token")
+	}
+	if subjectTokenType == "" {
+		subjectTokenType = JWTTokenType
+	}
+	form := url.Values{}
+	form.Set("grant_type", TokenExchangeGrantType)
+	form.Set("subject_token", subjectToken)
+	form.Set("subject_token_type", subjectTokenType)
+	setIfNotEmpty(form, "audience", parameters.Audience, p.config.Audience)
+	setIfNotEmpty(form, "scope", parameters.Scope, p.config.Scope)
+	setIfNotEmpty(form, "resource", parameters.Resource)
+	setIfNotEmpty(form, "requested_token_type", parameters.RequestedTokenType, AccessTokenType)
+	if parameters.ActorToken != "" {
+		form.Set("actor_token", parameters.ActorToken)
+		form.Set("actor_token_type", parameters.ActorTokenType)
+	}
+	return form, nil
+}
+
+// setIfNotEmpty sets the key of the form to the first non empty value.
+func setIfNotEmpty(form url.Values, key string, values ...string) {
+	for _, v := range values {
+		if v != "" {
+			form.Set(key, v)
+			return
+		}
+	}
+}
+
+// cacheKey returns the key of the token exchanged for the form. The tokens are hashed so they are not kept.
+func cacheKey(form url.Values) string {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%q;", k, form[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// useCachedToken returns the STS response of the cached token for the key, if it is not going to expire soon.
+func (p *Plugin) useCachedToken(key string, now time.Time) (*stsservice.StsResponseParameters, bool) {
+	p.tokensMutex.RLock()
+	token, ok := p.tokens[key]
+	p.tokensMutex.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	remainingLife := token.ExpireTime.Sub(now)
+	if remainingLife <= p.config.GracePeriod {
+		return nil, false
+	}
+	pluginLog.Debugf("use a cached token with remaining lifetime: %s", remainingLife.String())
+	return &stsservice.StsResponseParameters{
+		AccessToken:     token.Token,
+		IssuedTokenType: token.TokenType,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(remainingLife.Seconds()),
+	}, true
+}
+
+// authorizationServerMetadata is the authorization server metadata defined in
+// https://tools.ietf.org/html/rfc8414#section-2.
+type authorizationServerMetadata struct {
+	TokenEndpoint string `json:"token_endpoint"`
+}
+
+// getTokenEndpoint returns the token endpoint, discovered from the authorization server metadata if it is not
+// configured.
+func (p *Plugin) getTokenEndpoint() (string, error) {
+	p.endpointMutex.Lock()
+	defer p.endpointMutex.Unlock()
+	if p.tokenEndpoint != "" {
+		return p.tokenEndpoint, nil
+	}
+	issuer := strings.TrimSuffix(p.config.IssuerURL, "/")
+	var errs []string
+	for _, path := range metadataPaths {
+		resp, err := p.httpClient.Get(issuer + path)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			errs = append(errs, fmt.Sprintf("%s returned HTTP status %d", path, resp.StatusCode))
+			continue
+		}
+		md := authorizationServerMetadata{}
+		if err := json.Unmarshal(body, &md); err != nil || md.TokenEndpoint == "" {
+			errs = append(errs, fmt.Sprintf("%s has no token endpoint", path))
+			continue
+		}
+		pluginLog.Infof("discovered token endpoint %s of issuer %s", md.TokenEndpoint, issuer)
+		p.tokenEndpoint = md.TokenEndpoint
+		return p.tokenEndpoint, nil
+	}
+	return "", fmt.Errorf("failed to discover the token endpoint of issuer %s: %s", issuer, strings.Join(errs, "; "))
+}
+
+// sendRequest sends the token exchange request, retrying on server errors.
+func (p *Plugin) sendRequest(endpoint string, form url.Values) (*stsservice.StsResponseParameters, error) {
+	var lastErr error
+	for i := 0; i < maxRequestRetry; i++ {
+		if i > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if p.config.ClientID != "" {
+			// https://tools.ietf.org/html/rfc6749#section-2.3.1
+			req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+		}
+		resp, err := p.httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			lastErr = responseError(resp.StatusCode, body)
+			// Client errors are not retried.
+			if resp.StatusCode < http.StatusInternalServerError {
+				return nil, lastErr
+			}
+			continue
+		}
+		respData := &stsservice.StsResponseParameters{}
+		if err := json.Unmarshal(body, respData); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal token exchange response: %v", err)
+		}
+		if respData.AccessToken == "" {
+			return nil, errors.New("token exchange response does not have access token")
+		}
+		return respData, nil
+	}
+	return nil, lastErr
+}
+
+// responseError returns the error of a token exchange error response, defined in
+// https://tools.ietf.org/html/rfc8693#section-2.2.2.
+func responseError(status int, body []byte) error {
+	errResp := stsservice.StsErrorResponse{}
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != "" {
+		if errResp.ErrorDescription != "" {
+			return fmt.Errorf("token exchange failed (HTTP status %d): %s: %s", status, errResp.Error,
+				errResp.ErrorDescription)
+		}
+		return fmt.Errorf("token exchange failed (HTTP status %d): %s", status, errResp.Error)
+	}
+	return fmt.Errorf("token exchange failed (HTTP status %d): %s", status, strings.TrimSpace(string(body)))
+}
+
+// DumpPluginStatus dumps the status of the cached tokens in JSON.
+func (p *Plugin) DumpPluginStatus() ([]byte, error) {
+	p.tokensMutex.RLock()
+	tokenStatus := make([]stsservice.TokenInfo, 0, len(p.tokens))
+	for _, token := range p.tokens {
+		tokenStatus = append(tokenStatus, stsservice.TokenInfo{
+			TokenType: token.TokenType, IssueTime: token.IssueTime, ExpireTime: token.ExpireTime,
+		})
+	}
+	p.tokensMutex.RUnlock()
+	sort.Slice(tokenStatus, func(i, j int) bool {
+		return tokenStatus[i].IssueTime.Before(tokenStatus[j].IssueTime)
+	})
+	return json.MarshalIndent(stsservice.TokensDump{Tokens: tokenStatus}, "", " ")
+}
+
+// GetMetadata returns the metadata headers related to the token
+func (p *Plugin) GetMetadata(_ bool, _, token string) (map[string]string, error) {
+	if token == "" {
+		return nil, fmt.Errorf("empty token in plugin GetMetadata")
+	}
+	return map[string]string{
+		"authorization": "Bearer " + token,
+	}, nil
+}
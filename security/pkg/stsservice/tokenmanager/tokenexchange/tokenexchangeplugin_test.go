@@ -0,0 +1,264 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenexchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/credentialfetcher/plugin"
+	"istio.io/istio/security/pkg/stsservice"
+)
+
+// fakeAuthorizationServer is a stand-in for an OAuth 2.0 authorization server supporting token exchange.
+type fakeAuthorizationServer struct {
+	*httptest.Server
+
+	mutex     sync.Mutex
+	expiresIn int64
+	status    int
+	forms     []map[string]string
+}
+
+func newFakeAuthorizationServer(t *testing.T) *fakeAuthorizationServer {
+	t.Helper()
+	s := &fakeAuthorizationServer{expiresIn: 3600, status: http.StatusOK}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"token_endpoint": s.URL + "/token"})
+	})
+	mux.HandleFunc("/token", s.exchange)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeAuthorizationServer) exchange(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := req.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	form := map[string]string{}
+	for k := range req.PostForm {
+		form[k] = req.PostForm.Get(k)
+	}
+	if id, secret, ok := req.BasicAuth(); ok {
+		form["client"] = id + ":" + secret
+	}
+	s.forms = append(s.forms, form)
+	if s.status != http.StatusOK {
+		w.WriteHeader(s.status)
+		_ = json.NewEncoder(w).Encode(stsservice.StsErrorResponse{Error: "invalid_target", ErrorDescription: "unknown audience"})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(stsservice.StsResponseParameters{
+		AccessToken:     fmt.Sprintf("access-token-%d", len(s.forms)),
+		IssuedTokenType: AccessTokenType,
+		TokenType:       "Bearer",
+		ExpiresIn:       s.expiresIn,
+	})
+}
+
+func (s *fakeAuthorizationServer) setResponse(status int, expiresIn int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.status = status
+	s.expiresIn = expiresIn
+}
+
+func (s *fakeAuthorizationServer) requests() []map[string]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]map[string]string{}, s.forms...)
+}
+
+func exchange(t *testing.T, p *Plugin, params security.StsRequestParameters) (*stsservice.StsResponseParameters, error) {
+	t.Helper()
+	b, err := p.ExchangeToken(params)
+	if err != nil {
+		return nil, err
+	}
+	resp := &stsservice.StsResponseParameters{}
+	if err := json.Unmarshal(b, resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp, nil
+}
+
+func TestTokenExchange(t *testing.T) {
+	s := newFakeAuthorizationServer(t)
+	p, err := CreateTokenManagerPlugin(Config{
+		IssuerURL:    s.URL,
+		Audience:     "default-audience",
+		Scope:        "default-scope",
+		ClientID:     "client",
+		ClientSecret: "secret",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := security.StsRequestParameters{
+		GrantType:        TokenExchangeGrantType,
+		SubjectToken:     "subject-token",
+		SubjectTokenType: JWTTokenType,
+	}
+	resp, err := exchange(t, p, params)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.AccessToken != "access-token-1" || resp.ExpiresIn != 3600 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	expected := map[string]string{
+		"grant_type":           TokenExchangeGrantType,
+		"subject_token":        "subject-token",
+		"subject_token_type":   JWTTokenType,
+		"audience":             "default-audience",
+		"scope":                "default-scope",
+		"requested_token_type": AccessTokenType,
+		"client":               "client:secret",
+	}
+	if got := s.requests()[0]; fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expecting request %v, got %v", expected, got)
+	}
+
+	// The token is cached.
+	if resp, err := exchange(t, p, params); err != nil || resp.AccessToken != "access-token-1" {
+		t.Errorf("expecting the cached token, got %+v, %v", resp, err)
+	}
+	if n := len(s.requests()); n != 1 {
+		t.Errorf("expecting 1 request to the authorization server, got %d", n)
+	}
+
+	// Requests for another audience or subject are not served from the cache.
+	params.Audience = "other-audience"
+	if resp, err := exchange(t, p, params); err != nil || resp.AccessToken != "access-token-2" {
+		t.Errorf("expecting a new token for another audience, got %+v, %v", resp, err)
+	}
+	if got := s.requests()[1]["audience"]; got != "other-audience" {
+		t.Errorf("expecting the requested audience, got %s", got)
+	}
+	params.SubjectToken = "rotated-subject-token"
+	if resp, err := exchange(t, p, params); err != nil || resp.AccessToken != "access-token-3" {
+		t.Errorf("expecting a new token for another subject token, got %+v, %v", resp, err)
+	}
+
+	dump := stsservice.TokensDump{}
+	b, _ := p.DumpPluginStatus()
+	if err := json.Unmarshal(b, &dump); err != nil {
+		t.Fatal(err)
+	}
+	if len(dump.Tokens) != 3 || dump.Tokens[0].Token != "" {
+		t.Errorf("unexpected token status: %s", string(b))
+	}
+}
+
+func TestTokenExchangeCacheExpiry(t *testing.T) {
+	s := newFakeAuthorizationServer(t)
+	p, err := CreateTokenManagerPlugin(Config{TokenEndpoint: s.URL + "/token"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := security.StsRequestParameters{SubjectToken: "subject-token"}
+
+	// A token expiring within the grace period is not reused.
+	s.setResponse(http.StatusOK, 60)
+	for i := 1; i <= 2; i++ {
+		if resp, err := exchange(t, p, params); err != nil || resp.AccessToken != fmt.Sprintf("access-token-%d", i) {
+			t.Errorf("expecting a new token, got %+v, %v", resp, err)
+		}
+	}
+
+	// A token is reused until shortly before it expires.
+	s.setResponse(http.StatusOK, 3600)
+	if _, err := exchange(t, p, params); err != nil {
+		t.Fatal(err)
+	}
+	for k := range p.tokens {
+		if resp, ok := p.useCachedToken(k, time.Now().Add(50*time.Minute)); !ok || resp.ExpiresIn > 600 {
+			t.Errorf("expecting the cached token to be used, got %+v", resp)
+		}
+		if _, ok := p.useCachedToken(k, time.Now().Add(56*time.Minute)); ok {
+			t.Error("expecting the cached token not to be used within the grace period")
+		}
+	}
+}
+
+func TestTokenExchangeErrors(t *testing.T) {
+	s := newFakeAuthorizationServer(t)
+	s.setResponse(http.StatusBadRequest, 0)
+	noMetadata := httptest.NewServer(http.NotFoundHandler())
+	defer noMetadata.Close()
+
+	testCases := map[string]struct {
+		config      Config
+		credFetcher security.CredFetcher
+		subject     string
+		expectedErr string
+	}{
+		"error response": {
+			config:      Config{IssuerURL: s.URL},
+			subject:     "subject-token",
+			expectedErr: "invalid_target: unknown audience",
+		},
+		"no metadata": {
+			config:      Config{IssuerURL: noMetadata.URL},
+			subject:     "subject-token",
+			expectedErr: "failed to discover the token endpoint",
+		},
+		"no subject token": {
+			config:      Config{IssuerURL: s.URL},
+			expectedErr: "no subject token",
+		},
+	}
+	for id, tc := range testCases {
+		p, err := CreateTokenManagerPlugin(tc.config, tc.credFetcher)
+		if err != nil {
+			t.Fatalf("Case %s: unexpected error: %v", id, err)
+		}
+		_, err = p.ExchangeToken(security.StsRequestParameters{SubjectToken: tc.subject})
+		if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+			t.Errorf("Case %s: expecting error %q, got %v", id, tc.expectedErr, err)
+		}
+	}
+
+	if _, err := CreateTokenManagerPlugin(Config{}, nil); err == nil {
+		t.Error("expecting an error without issuer URL and token endpoint")
+	}
+}
+
+func TestTokenExchangeWithCredFetcher(t *testing.T) {
+	s := newFakeAuthorizationServer(t)
+	p, err := CreateTokenManagerPlugin(Config{IssuerURL: s.URL}, plugin.CreateMockPlugin("platform-token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exchange(t, p, security.StsRequestParameters{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := s.requests()[0]["subject_token"]; got != "platform-token" {
+		t.Errorf("expecting the platform credential as subject token, got %s", got)
+	}
+}
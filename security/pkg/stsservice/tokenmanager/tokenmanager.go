@@ -16,16 +16,21 @@ package tokenmanager
 
 import (
 	"errors"
+	"fmt"
+	"sync"
 
 	"istio.io/istio/pkg/bootstrap/platform"
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/security/pkg/stsservice/tokenmanager/google"
+	"istio.io/istio/security/pkg/stsservice/tokenmanager/tokenexchange"
 	"istio.io/pkg/log"
 )
 
 const (
 	// GoogleTokenExchange is the name of the google token exchange service.
 	GoogleTokenExchange = "GoogleTokenExchange"
+	// TokenExchange is the name of the generic OAuth 2.0 token exchange (RFC 8693) service.
+	TokenExchange = "TokenExchange"
 )
 
 // Plugin provides common interfaces for specific token exchange services.
@@ -43,6 +48,31 @@ type TokenManager struct {
 type Config struct {
 	CredFetcher security.CredFetcher
 	TrustDomain string
+	// TokenExchange configures the TokenExchange plugin.
+	TokenExchange tokenexchange.Config
+}
+
+// PluginFactory creates a token exchange plugin from the token manager config.
+type PluginFactory func(config Config) (Plugin, error)
+
+var (
+	pluginFactoriesMutex sync.RWMutex
+	pluginFactories      = map[string]PluginFactory{}
+)
+
+// RegisterPlugin registers a token exchange plugin, created by CreateTokenManager for the token manager type.
+// Registering a built-in type or an already registered type replaces it.
+func RegisterPlugin(tokenManagerType string, factory PluginFactory) {
+	pluginFactoriesMutex.Lock()
+	defer pluginFactoriesMutex.Unlock()
+	pluginFactories[tokenManagerType] = factory
+}
+
+func getPluginFactory(tokenManagerType string) (PluginFactory, bool) {
+	pluginFactoriesMutex.RLock()
+	defer pluginFactoriesMutex.RUnlock()
+	factory, f := pluginFactories[tokenManagerType]
+	return factory, f
 }
 
 // GCPProjectInfo stores GCP project information, including project number,
@@ -79,11 +109,20 @@ func GetGCPProjectInfo() GCPProjectInfo {
 }
 
 // CreateTokenManager creates a token manager with specified type and returns
-// that token manager
-func CreateTokenManager(tokenManagerType string, config Config) security.TokenManager {
+// that token manager. An error is returned if the plugin of the token manager cannot be created
+// from the config.
+func CreateTokenManager(tokenManagerType string, config Config) (security.TokenManager, error) {
 	tm := &TokenManager{
 		plugin: nil,
 	}
+	if factory, f := getPluginFactory(tokenManagerType); f {
+		p, err := factory(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %v token manager: %v", tokenManagerType, err)
+		}
+		tm.plugin = p
+		return tm, nil
+	}
 	switch tokenManagerType {
 	case GoogleTokenExchange:
 		if projectInfo := GetGCPProjectInfo(); len(projectInfo.Number) > 0 {
@@ -94,8 +133,14 @@ func CreateTokenManager(tokenManagerType string, config Config) security.TokenMa
 		} else {
 			log.Warnf("%v token manager specified but failed to ready GCP project information", GoogleTokenExchange)
 		}
+	case TokenExchange:
+		p, err := tokenexchange.CreateTokenManagerPlugin(config.TokenExchange, config.CredFetcher)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %v token manager: %v", TokenExchange, err)
+		}
+		tm.plugin = p
 	}
-	return tm
+	return tm, nil
 }
 
 func (tm *TokenManager) GenerateToken(parameters security.StsRequestParameters) ([]byte, error) {
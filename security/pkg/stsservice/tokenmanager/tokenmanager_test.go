@@ -0,0 +1,94 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenmanager
+
+import (
+	"errors"
+	"testing"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/stsservice/tokenmanager/tokenexchange"
+)
+
+type fakePlugin struct {
+	token string
+}
+
+func (p *fakePlugin) ExchangeToken(security.StsRequestParameters) ([]byte, error) {
+	return []byte(p.token), nil
+}
+
+func (p *fakePlugin) DumpPluginStatus() ([]byte, error) {
+	return nil, nil
+}
+
+func (p *fakePlugin) GetMetadata(bool, string, string) (map[string]string, error) {
+	return nil, nil
+}
+
+func TestCreateTokenManager(t *testing.T) {
+	RegisterPlugin("Fake", func(config Config) (Plugin, error) {
+		return &fakePlugin{token: config.TrustDomain}, nil
+	})
+	RegisterPlugin("FakeFailure", func(Config) (Plugin, error) {
+		return nil, errors.New("fake error")
+	})
+
+	testCases := map[string]struct {
+		tokenManagerType string
+		config           Config
+		expectedPlugin   bool
+		expectedErr      bool
+	}{
+		"registered plugin": {
+			tokenManagerType: "Fake",
+			config:           Config{TrustDomain: "cluster.local"},
+			expectedPlugin:   true,
+		},
+		"registered plugin failure": {
+			tokenManagerType: "FakeFailure",
+			expectedErr:      true,
+		},
+		"token exchange": {
+			tokenManagerType: TokenExchange,
+			config:           Config{TokenExchange: tokenexchange.Config{IssuerURL: "https://issuer.example.com"}},
+			expectedPlugin:   true,
+		},
+		"token exchange without issuer": {
+			tokenManagerType: TokenExchange,
+			expectedErr:      true,
+		},
+		"unknown type": {
+			tokenManagerType: "Unknown",
+		},
+	}
+	for id, tc := range testCases {
+		tm, err := CreateTokenManager(tc.tokenManagerType, tc.config)
+		if (err != nil) != tc.expectedErr {
+			t.Errorf("Case %s: expecting error %t, got %v", id, tc.expectedErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		if plugin := tm.(*TokenManager).plugin; (plugin != nil) != tc.expectedPlugin {
+			t.Errorf("Case %s: expecting plugin %t, got %v", id, tc.expectedPlugin, plugin)
+		}
+	}
+
+	tm, _ := CreateTokenManager("Fake", Config{TrustDomain: "cluster.local"})
+	if token, err := tm.GenerateToken(security.StsRequestParameters{}); err != nil || string(token) != "cluster.local" {
+		t.Errorf("expecting the token of the registered plugin, got %s, %v", string(token), err)
+	}
+}
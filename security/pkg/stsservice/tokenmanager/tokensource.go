@@ -40,8 +40,10 @@ var _ oauth2.TokenSource = &TokenSource{}
 
 // NewTokenSource creates a token source based on STS token exchange.
 func NewTokenSource(trustDomain, subjectToken, authScope string) *TokenSource {
+	// The GoogleTokenExchange token manager is created without error, its plugin is not set outside of GCP.
+	tm, _ := CreateTokenManager(GoogleTokenExchange, Config{TrustDomain: trustDomain})
 	return &TokenSource{
-		tm:           CreateTokenManager(GoogleTokenExchange, Config{TrustDomain: trustDomain}),
+		tm:           tm,
 		subjectToken: subjectToken,
 		authScope:    authScope,
 	}
@@ -58,7 +58,7 @@ var (
 	mode           = flag.String("mode", selfSignedMode, "Supported mode: self-signed, signer, citadel")
 	// Enable this flag if istio mTLS is enabled and the service is running as server side
 	isServer  = flag.Bool("server", false, "Whether this certificate is for a server.")
-	ec        = flag.String("ec-sig-alg", "", "Generate an elliptical curve private key with the specified algorithm")
+	ec        = flag.String("ec-sig-alg", "", "Generate an elliptical curve private key with the specified algorithm: ECDSA (P-256), ECDSA_P384 or ED25519")
 	sanFields = flag.String("san", "", "Subject Alternative Names")
 )
 
@@ -31,7 +31,7 @@ var (
 	outCsr  = flag.String("out-csr", "csr.pem", "Output csr file.")
 	outPriv = flag.String("out-priv", "priv.pem", "Output private key file.")
 	keySize = flag.Int("key-size", 2048, "Size of the generated private key")
-	ec      = flag.String("ec-sig-alg", "", "Generate an elliptical curve private key with the specified algorithm")
+	ec      = flag.String("ec-sig-alg", "", "Generate an elliptical curve private key with the specified algorithm: ECDSA (P-256), ECDSA_P384 or ED25519")
 )
 
 func saveCreds(csrPem []byte, privPem []byte) {